@@ -16,9 +16,18 @@
 package redistest
 
 import (
-	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
 	"errors"
+	"sync"
 	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+var (
+	serverOnce sync.Once
+	server     *redistest.Server
+	serverErr  error
 )
 
 type testConn struct {
@@ -37,11 +46,15 @@ func (t testConn) Close() error {
 	return t.Conn.Close()
 }
 
-// Dial dials the local Redis server and selects database 9. To prevent
-// stomping on real data, DialTestDB fails if database 9 contains data. The
+// Dial dials an in-process Redis server, started on the first call, and
+// selects database 9. DialTestDB fails if database 9 contains data. The
 // returned connection flushes database 9 on close.
 func Dial() (redis.Conn, error) {
-	c, err := redis.DialTimeout("tcp", ":6379", 0, 1*time.Second, 1*time.Second)
+	serverOnce.Do(func() { server, serverErr = redistest.NewServer() })
+	if serverErr != nil {
+		return nil, serverErr
+	}
+	c, err := redis.DialTimeout("tcp", server.Addr(), 0, 1*time.Second, 1*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"net/url"
 	"regexp"
@@ -55,6 +56,9 @@ type conn struct {
 
 	// Scratch space for formatting integers and floats.
 	numScratch [40]byte
+
+	// RESP3 push replies handler, nil to return them as replies
+	push func(reply []interface{})
 }
 
 // DialTimeout acts like Dial but takes timeouts for establishing the
@@ -83,6 +87,8 @@ type dialOptions struct {
 	useTLS       bool
 	skipVerify   bool
 	tlsConfig    *tls.Config
+	protocol     int
+	push         func(reply []interface{})
 }
 
 // DialReadTimeout specifies the timeout for reading a single command reply.
@@ -165,6 +171,29 @@ func DialUseTLS(useTLS bool) DialOption {
 	}}
 }
 
+// DialProtocol specifies the protocol version negotiated with HELLO when
+// dialing, 3 enables the RESP3 reply types. By default no HELLO is sent and
+// the server speaks RESP2.
+func DialProtocol(version int) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.protocol = version
+	}}
+}
+
+// DialPushHandler specifies the function receiving the RESP3 push replies,
+// such as client side caching invalidations and pub/sub messages, so that
+// they can share the connection with regular commands. The handler runs on
+// the goroutine reading the replies and must not block. Subscription
+// confirmations are still returned as the replies of their commands.
+//
+// Without handler, push replies are returned by Receive as arrays, as
+// PubSubConn expects.
+func DialPushHandler(handler func(reply []interface{})) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.push = handler
+	}}
+}
+
 // Dial connects to the Redis server at the given network and
 // address using the specified options.
 func Dial(network, address string, options ...DialOption) (Conn, error) {
@@ -215,9 +244,19 @@ func Dial(network, address string, options ...DialOption) (Conn, error) {
 		br:           bufio.NewReader(netConn),
 		readTimeout:  do.readTimeout,
 		writeTimeout: do.writeTimeout,
+		push:         do.push,
 	}
 
-	if do.password != "" {
+	if do.protocol > 2 {
+		args := []interface{}{do.protocol}
+		if do.password != "" {
+			args = append(args, "AUTH", "default", do.password)
+		}
+		if _, err := c.Do("HELLO", args...); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	} else if do.password != "" {
 		if _, err := c.Do("AUTH", do.password); err != nil {
 			netConn.Close()
 			return nil, err
@@ -500,7 +539,73 @@ var (
 	pongReply interface{} = "PONG"
 )
 
+// pushReply is a RESP3 push reply.
+type pushReply []interface{}
+
+// readReply reads the next reply, passing the push replies other than the
+// subscription confirmations to the push handler.
 func (c *conn) readReply() (interface{}, error) {
+	for {
+		reply, err := c.readValue()
+		if err != nil {
+			return nil, err
+		}
+		p, ok := reply.(pushReply)
+		if !ok {
+			return reply, nil
+		}
+		if c.push == nil || isSubscription(p) {
+			return []interface{}(p), nil
+		}
+		c.push(p)
+	}
+}
+
+func isSubscription(p pushReply) bool {
+	if len(p) == 0 {
+		return false
+	}
+	kind, _ := p[0].([]byte)
+	switch string(kind) {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ssubscribe", "sunsubscribe":
+		return true
+	}
+	return false
+}
+
+// readBulk reads the payload of a bulk string, blob error or verbatim
+// string of the length in line.
+func (c *conn) readBulk(line []byte) ([]byte, error) {
+	n, err := parseLen(line)
+	if n < 0 || err != nil {
+		return nil, err
+	}
+	p := make([]byte, n)
+	_, err = io.ReadFull(c.br, p)
+	if err != nil {
+		return nil, err
+	}
+	if line, err := c.readLine(); err != nil {
+		return nil, err
+	} else if len(line) != 0 {
+		return nil, protocolError("bad bulk string format")
+	}
+	return p, nil
+}
+
+// readValues reads n replies.
+func (c *conn) readValues(n int) ([]interface{}, error) {
+	r := make([]interface{}, n)
+	for i := range r {
+		var err error
+		if r[i], err = c.readValue(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (c *conn) readValue() (interface{}, error) {
 	line, err := c.readLine()
 	if err != nil {
 		return nil, err
@@ -525,34 +630,78 @@ func (c *conn) readReply() (interface{}, error) {
 	case ':':
 		return parseInt(line[1:])
 	case '$':
+		p, err := c.readBulk(line[1:])
+		if p == nil || err != nil {
+			return nil, err
+		}
+		return p, nil
+	case '*', '~', '>':
+		// arrays, sets and pushes
 		n, err := parseLen(line[1:])
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		p := make([]byte, n)
-		_, err = io.ReadFull(c.br, p)
+		r, err := c.readValues(n)
 		if err != nil {
 			return nil, err
 		}
-		if line, err := c.readLine(); err != nil {
-			return nil, err
-		} else if len(line) != 0 {
-			return nil, protocolError("bad bulk string format")
+		if line[0] == '>' {
+			return pushReply(r), nil
 		}
-		return p, nil
-	case '*':
+		return r, nil
+	case '%', '|':
+		// maps are flattened to alternating keys and values, attributes
+		// are skipped
 		n, err := parseLen(line[1:])
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		r := make([]interface{}, n)
-		for i := range r {
-			r[i], err = c.readReply()
-			if err != nil {
-				return nil, err
-			}
+		r, err := c.readValues(2 * n)
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == '|' {
+			return c.readValue()
 		}
 		return r, nil
+	case '_':
+		return nil, nil
+	case ',':
+		f, err := strconv.ParseFloat(string(line[1:]), 64)
+		if err != nil {
+			return nil, protocolError("malformed double")
+		}
+		return f, nil
+	case '#':
+		if len(line) == 2 && (line[1] == 't' || line[1] == 'f') {
+			return line[1] == 't', nil
+		}
+		return nil, protocolError("malformed boolean")
+	case '(':
+		n, ok := new(big.Int).SetString(string(line[1:]), 10)
+		if !ok {
+			return nil, protocolError("malformed big number")
+		}
+		return n, nil
+	case '!':
+		p, err := c.readBulk(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, protocolError("malformed blob error")
+		}
+		return Error(p), nil
+	case '=':
+		// verbatim strings are prefixed by their format, like txt:
+		p, err := c.readBulk(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 4 || p[3] != ':' {
+			return nil, protocolError("malformed verbatim string")
+		}
+		return p[4:], nil
 	}
 	return nil, protocolError("unexpected response line")
 }
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"net"
 	"os"
 	"reflect"
@@ -209,6 +210,43 @@ var readTests = []struct {
 		"*3\r\n$3\r\nfoo\r\n$-1\r\n$3\r\nbar\r\n",
 		[]interface{}{[]byte("foo"), nil, []byte("bar")},
 	},
+	{
+		"%2\r\n+a\r\n:1\r\n$1\r\nb\r\n_\r\n",
+		[]interface{}{"a", int64(1), []byte("b"), nil},
+	},
+	{
+		"~2\r\n,1.5\r\n,inf\r\n",
+		[]interface{}{1.5, math.Inf(1)},
+	},
+	{
+		"*2\r\n#t\r\n#f\r\n",
+		[]interface{}{true, false},
+	},
+	{
+		"(3492890328409238509324850943850943825024385\r\n",
+		bigNumber("3492890328409238509324850943850943825024385"),
+	},
+	{
+		"=15\r\ntxt:Some string\r\n",
+		[]byte("Some string"),
+	},
+	{
+		"|1\r\n+ttl\r\n:3600\r\n:2\r\n",
+		int64(2),
+	},
+	{
+		">3\r\n$7\r\nmessage\r\n$1\r\nc\r\n$1\r\nm\r\n",
+		[]interface{}{[]byte("message"), []byte("c"), []byte("m")},
+	},
+	{
+		"!21\r\nSYNTAX invalid syntax\r\n",
+		errorSentinel,
+	},
+	{
+		// "x" is not a boolean
+		"#x\r\n",
+		errorSentinel,
+	},
 
 	{
 		// "x" is not a valid length
@@ -242,6 +280,11 @@ var readTests = []struct {
 	},
 }
 
+func bigNumber(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
 func TestRead(t *testing.T) {
 	for _, tt := range readTests {
 		c, _ := redis.Dial("", "", dialTestConn(tt.reply, nil))
@@ -262,6 +305,49 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestReadPush(t *testing.T) {
+	var pushed [][]interface{}
+	c, _ := redis.Dial("", "", dialTestConn(
+		">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nfoo\r\n"+
+			">3\r\n$9\r\nsubscribe\r\n$1\r\nc\r\n:1\r\n"+
+			"+OK\r\n", nil),
+		redis.DialPushHandler(func(reply []interface{}) {
+			pushed = append(pushed, reply)
+		}))
+	// the invalidation goes to the handler, subscription confirmations
+	// are returned for PubSubConn
+	actual, err := c.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{[]byte("subscribe"), []byte("c"), int64(1)}
+	if !reflect.DeepEqual(actual, want) {
+		t.Fatalf("Receive() = %v, want %v", actual, want)
+	}
+	if actual, err = c.Receive(); err != nil || actual != "OK" {
+		t.Fatalf("Receive() = %v, %v, want OK", actual, err)
+	}
+	want = []interface{}{[]byte("invalidate"), []interface{}{[]byte("foo")}}
+	if len(pushed) != 1 || !reflect.DeepEqual(pushed[0], want) {
+		t.Fatalf("pushed %v, want %v", pushed, want)
+	}
+}
+
+func TestDialProtocol(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := redis.Dial("", "",
+		dialTestConn("%1\r\n+proto\r\n:3\r\n", &buf),
+		redis.DialProtocol(3),
+		redis.DialPassword("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "*5\r\n$5\r\nHELLO\r\n$1\r\n3\r\n$4\r\nAUTH\r\n$7\r\ndefault\r\n$2\r\npw\r\n"
+	if buf.String() != want {
+		t.Fatalf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
 var testCommands = []struct {
 	args     []interface{}
 	expected interface{}
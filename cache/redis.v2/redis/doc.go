@@ -59,6 +59,23 @@
 //  bulk string             []byte or nil if value not present.
 //  array                   []interface{} or nil if value not present.
 //
+// Connections dialed with DialProtocol(3) also read the RESP3 types:
+//
+//  Redis type              Go type
+//  null                    nil
+//  double                  float64
+//  boolean                 bool
+//  big number              *big.Int
+//  blob error              redis.Error
+//  verbatim string         []byte without the format prefix
+//  map                     []interface{} of alternating keys and values
+//  set                     []interface{}
+//  push                    []interface{}, or passed to the DialPushHandler
+//  attribute               skipped
+//
+// Maps are flattened so that the helpers written for the RESP2 replies of
+// commands like HGETALL keep working.
+//
 // Use type assertions or the reply helper functions to convert from
 // interface{} to the specific Go type for the command result.
 //
@@ -154,13 +154,26 @@ type Pool struct {
 	// the pool does not close connections based on age.
 	MaxConnLifetime time.Duration
 
+	// ClientTracking enables the client side caching of the GET and HGET
+	// replies, invalidated by the server with CLIENT TRACKING. It requires
+	// redis 6.
+	ClientTracking *ClientTracking
+
 	chInitialized uint32 // set to 1 when field ch is initialized
 
-	mu     sync.Mutex    // mu protects the following fields
-	closed bool          // set to true when the pool is closed.
-	active int           // the number of open connections in the pool
-	ch     chan struct{} // limits open connections when p.Wait is true
-	idle   idleList      // idle connections
+	mu      sync.Mutex    // mu protects the following fields
+	closed  bool          // set to true when the pool is closed.
+	active  int           // the number of open connections in the pool
+	ch      chan struct{} // limits open connections when p.Wait is true
+	idle    idleList      // idle connections
+	gen     uint64        // incremented by Reset
+	tracker *tracker      // client side cache, created by the first dial
+
+	waitCount      int64         // total number of connections waited for
+	waitDuration   time.Duration // total time waited for new connections
+	dialFailures   int64         // total number of failed dials
+	idleClosed     int64         // connections closed by IdleTimeout
+	lifetimeClosed int64         // connections closed by MaxConnLifetime
 }
 
 // NewPool creates a new pool.
@@ -190,14 +203,38 @@ type PoolStats struct {
 	ActiveCount int
 	// IdleCount is the number of idle connections in the pool.
 	IdleCount int
+	// CacheHits is the number of GET and HGET replied from the client side
+	// cache, CacheMisses the number of those read from the server.
+	CacheHits   int64
+	CacheMisses int64
+
+	// WaitCount is the total number of connections waited for when the pool
+	// is at the MaxActive limit, WaitDuration the total time waited.
+	WaitCount    int64
+	WaitDuration time.Duration
+	// DialFailures is the total number of failed dials.
+	DialFailures int64
+	// IdleClosed and LifetimeClosed are the total numbers of connections
+	// closed by IdleTimeout and MaxConnLifetime.
+	IdleClosed     int64
+	LifetimeClosed int64
 }
 
 // Stats returns pool's statistics.
 func (p *Pool) Stats() PoolStats {
 	p.mu.Lock()
 	stats := PoolStats{
-		ActiveCount: p.active,
-		IdleCount:   p.idle.count,
+		ActiveCount:    p.active,
+		IdleCount:      p.idle.count,
+		WaitCount:      p.waitCount,
+		WaitDuration:   p.waitDuration,
+		DialFailures:   p.dialFailures,
+		IdleClosed:     p.idleClosed,
+		LifetimeClosed: p.lifetimeClosed,
+	}
+	if p.tracker != nil {
+		stats.CacheHits = atomic.LoadInt64(&p.tracker.hits)
+		stats.CacheMisses = atomic.LoadInt64(&p.tracker.misses)
 	}
 	p.mu.Unlock()
 
@@ -236,13 +273,42 @@ func (p *Pool) Close() error {
 	if p.ch != nil {
 		close(p.ch)
 	}
+	t := p.tracker
 	p.mu.Unlock()
 	for ; pc != nil; pc = pc.next {
 		pc.c.Close()
 	}
+	if t != nil {
+		t.close()
+	}
 	return nil
 }
 
+// Reset closes the idle connections in the pool and marks the connections in
+// use to be closed when they are returned to the pool. Connections got after
+// Reset are dialed with Dial. Reset is used to move the pool to another
+// server, e.g. after a sentinel failover.
+func (p *Pool) Reset() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.gen++
+	p.active -= p.idle.count
+	pc := p.idle.front
+	p.idle.count = 0
+	p.idle.front, p.idle.back = nil, nil
+	t := p.tracker
+	p.mu.Unlock()
+	for ; pc != nil; pc = pc.next {
+		pc.c.Close()
+	}
+	if t != nil {
+		t.reset()
+	}
+}
+
 func (p *Pool) lazyInit() {
 	// Fast path.
 	if atomic.LoadUint32(&p.chInitialized) == 1 {
@@ -274,6 +340,12 @@ func (p *Pool) get(ctx interface {
 	// Handle limit for p.Wait == true.
 	if p.Wait && p.MaxActive > 0 {
 		p.lazyInit()
+		// wait is an estimate, good enough for the stats.
+		wait := len(p.ch) == 0
+		var start time.Time
+		if wait {
+			start = nowFunc()
+		}
 		if ctx == nil {
 			<-p.ch
 		} else {
@@ -283,6 +355,12 @@ func (p *Pool) get(ctx interface {
 				return nil, ctx.Err()
 			}
 		}
+		if wait {
+			p.mu.Lock()
+			p.waitCount++
+			p.waitDuration += nowFunc().Sub(start)
+			p.mu.Unlock()
+		}
 	}
 
 	p.mu.Lock()
@@ -294,9 +372,10 @@ func (p *Pool) get(ctx interface {
 			pc := p.idle.back
 			p.idle.popBack()
 			p.mu.Unlock()
-			pc.c.Close()
+			p.closeConn(pc)
 			p.mu.Lock()
 			p.active--
+			p.idleClosed++
 		}
 	}
 
@@ -305,13 +384,16 @@ func (p *Pool) get(ctx interface {
 		pc := p.idle.front
 		p.idle.popFront()
 		p.mu.Unlock()
-		if (p.TestOnBorrow == nil || p.TestOnBorrow(pc.c, pc.t) == nil) &&
-			(p.MaxConnLifetime == 0 || nowFunc().Sub(pc.created) < p.MaxConnLifetime) {
+		expired := p.MaxConnLifetime != 0 && nowFunc().Sub(pc.created) >= p.MaxConnLifetime
+		if !expired && (p.TestOnBorrow == nil || p.TestOnBorrow(pc.c, pc.t) == nil) {
 			return pc, nil
 		}
-		pc.c.Close()
+		p.closeConn(pc)
 		p.mu.Lock()
 		p.active--
+		if expired {
+			p.lifetimeClosed++
+		}
 	}
 
 	// Check for pool closed before dialing a new connection.
@@ -327,23 +409,31 @@ func (p *Pool) get(ctx interface {
 	}
 
 	p.active++
+	gen := p.gen
 	p.mu.Unlock()
 	c, err := p.Dial()
+	var epoch uint64
+	if err == nil && p.ClientTracking != nil {
+		if epoch, err = p.tracking().enable(c); err != nil {
+			c.Close()
+		}
+	}
 	if err != nil {
 		c = nil
 		p.mu.Lock()
 		p.active--
+		p.dialFailures++
 		if p.ch != nil && !p.closed {
 			p.ch <- struct{}{}
 		}
 		p.mu.Unlock()
 	}
-	return &poolConn{c: c, created: nowFunc()}, err
+	return &poolConn{c: c, created: nowFunc(), gen: gen, epoch: epoch}, err
 }
 
 func (p *Pool) put(pc *poolConn, forceClose bool) error {
 	p.mu.Lock()
-	if !p.closed && !forceClose {
+	if !p.closed && !forceClose && pc.gen == p.gen {
 		pc.t = nowFunc()
 		p.idle.pushFront(pc)
 		if p.idle.count > p.MaxIdle {
@@ -356,7 +446,7 @@ func (p *Pool) put(pc *poolConn, forceClose bool) error {
 
 	if pc != nil {
 		p.mu.Unlock()
-		pc.c.Close()
+		p.closeConn(pc)
 		p.mu.Lock()
 		p.active--
 	}
@@ -368,10 +458,30 @@ func (p *Pool) put(pc *poolConn, forceClose bool) error {
 	return nil
 }
 
+// closeConn closes the connection of pc, dropping the replies cached from it
+// since the server stops reporting their invalidation.
+func (p *Pool) closeConn(pc *poolConn) {
+	if pc.epoch != 0 {
+		p.tracker.forget(pc)
+	}
+	pc.c.Close()
+}
+
 type activeConn struct {
-	p     *Pool
-	pc    *poolConn
-	state int
+	p       *Pool
+	pc      *poolConn
+	state   int
+	pending int32 // replies of Send not yet received, Send and Receive may run concurrently
+}
+
+// received counts a reply of Send received.
+func (ac *activeConn) received() {
+	for {
+		n := atomic.LoadInt32(&ac.pending)
+		if n <= 0 || atomic.CompareAndSwapInt32(&ac.pending, n, n-1) {
+			return
+		}
+	}
 }
 
 var (
@@ -444,6 +554,12 @@ func (ac *activeConn) Do(commandName string, args ...interface{}) (reply interfa
 	}
 	ci := internal.LookupCommandInfo(commandName)
 	ac.state = (ac.state | ci.Set) &^ ci.Clear
+	if key, tk, ok := ac.cacheable(commandName, args); ok {
+		return ac.p.tracker.do(pc, key, tk, func() (interface{}, error) {
+			return pc.c.Do(commandName, args...)
+		})
+	}
+	atomic.StoreInt32(&ac.pending, 0)
 	return pc.c.Do(commandName, args...)
 }
 
@@ -458,6 +574,12 @@ func (ac *activeConn) DoWithTimeout(timeout time.Duration, commandName string, a
 	}
 	ci := internal.LookupCommandInfo(commandName)
 	ac.state = (ac.state | ci.Set) &^ ci.Clear
+	if key, tk, ok := ac.cacheable(commandName, args); ok {
+		return ac.p.tracker.do(pc, key, tk, func() (interface{}, error) {
+			return cwt.DoWithTimeout(timeout, commandName, args...)
+		})
+	}
+	atomic.StoreInt32(&ac.pending, 0)
 	return cwt.DoWithTimeout(timeout, commandName, args...)
 }
 
@@ -468,6 +590,7 @@ func (ac *activeConn) Send(commandName string, args ...interface{}) error {
 	}
 	ci := internal.LookupCommandInfo(commandName)
 	ac.state = (ac.state | ci.Set) &^ ci.Clear
+	atomic.AddInt32(&ac.pending, 1)
 	return pc.c.Send(commandName, args...)
 }
 
@@ -484,6 +607,7 @@ func (ac *activeConn) Receive() (reply interface{}, err error) {
 	if pc == nil {
 		return nil, errConnClosed
 	}
+	ac.received()
 	return pc.c.Receive()
 }
 
@@ -496,6 +620,7 @@ func (ac *activeConn) ReceiveWithTimeout(timeout time.Duration) (reply interface
 	if !ok {
 		return nil, errTimeoutNotSupported
 	}
+	ac.received()
 	return cwt.ReceiveWithTimeout(timeout)
 }
 
@@ -521,6 +646,8 @@ type poolConn struct {
 	c          Conn
 	t          time.Time
 	created    time.Time
+	gen        uint64
+	epoch      uint64 // client side cache epoch, 0 when not cached
 	next, prev *poolConn
 }
 
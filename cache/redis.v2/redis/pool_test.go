@@ -22,7 +22,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
 )
 
 type poolTestConn struct {
@@ -17,6 +17,7 @@ package redis
 import (
 	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
@@ -118,6 +119,7 @@ func Uint64(reply interface{}, err error) (uint64, error) {
 // the reply to an int as follows:
 //
 //  Reply type    Result
+//  double        reply, nil
 //  bulk string   parsed reply, nil
 //  nil           0, ErrNil
 //  other         0, error
@@ -126,6 +128,8 @@ func Float64(reply interface{}, err error) (float64, error) {
 		return 0, err
 	}
 	switch reply := reply.(type) {
+	case float64:
+		return reply, nil
 	case []byte:
 		n, err := strconv.ParseFloat(string(reply), 64)
 		return n, err
@@ -189,11 +193,45 @@ func Bytes(reply interface{}, err error) ([]byte, error) {
 	return nil, fmt.Errorf("redigo: unexpected type for Bytes, got type %T", reply)
 }
 
+// BigInt is a helper that converts a command reply to a big integer. If err
+// is not equal to nil, then BigInt returns nil, err. Otherwise, BigInt
+// converts the reply as follows:
+//
+//  Reply type    Result
+//  big number    reply, nil
+//  integer       big.NewInt(reply), nil
+//  bulk string   parsed reply, nil
+//  nil           nil, ErrNil
+//  other         nil, error
+func BigInt(reply interface{}, err error) (*big.Int, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch reply := reply.(type) {
+	case *big.Int:
+		return reply, nil
+	case int64:
+		return big.NewInt(reply), nil
+	case []byte:
+		n, ok := new(big.Int).SetString(string(reply), 10)
+		if !ok {
+			return nil, fmt.Errorf("redigo: invalid big number %q", reply)
+		}
+		return n, nil
+	case nil:
+		return nil, ErrNil
+	case Error:
+		return nil, reply
+	}
+	return nil, fmt.Errorf("redigo: unexpected type for BigInt, got type %T", reply)
+}
+
 // Bool is a helper that converts a command reply to a boolean. If err is not
 // equal to nil, then Bool returns false, err. Otherwise Bool converts the
 // reply to boolean as follows:
 //
 //  Reply type      Result
+//  boolean         reply, nil
 //  integer         value != 0, nil
 //  bulk string     strconv.ParseBool(reply)
 //  nil             false, ErrNil
@@ -203,6 +241,8 @@ func Bool(reply interface{}, err error) (bool, error) {
 		return false, err
 	}
 	switch reply := reply.(type) {
+	case bool:
+		return reply, nil
 	case int64:
 		return reply != 0, nil
 	case []byte:
@@ -270,17 +310,21 @@ func sliceHelper(reply interface{}, err error, name string, makeSlice func(int),
 // Float64s is a helper that converts an array command reply to a []float64. If
 // err is not equal to nil, then Float64s returns nil, err. Nil array items are
 // converted to 0 in the output slice. Floats64 returns an error if an array
-// item is not a bulk string or nil.
+// item is not a double, a bulk string or nil.
 func Float64s(reply interface{}, err error) ([]float64, error) {
 	var result []float64
 	err = sliceHelper(reply, err, "Float64s", func(n int) { result = make([]float64, n) }, func(i int, v interface{}) error {
-		p, ok := v.([]byte)
-		if !ok {
+		switch v := v.(type) {
+		case float64:
+			result[i] = v
+			return nil
+		case []byte:
+			f, err := strconv.ParseFloat(string(v), 64)
+			result[i] = f
+			return err
+		default:
 			return fmt.Errorf("redigo: unexpected element type for Floats64, got type %T", v)
 		}
-		f, err := strconv.ParseFloat(string(p), 64)
-		result[i] = f
-		return err
 	})
 	return result, err
 }
@@ -394,6 +438,35 @@ func StringMap(result interface{}, err error) (map[string]string, error) {
 	return m, nil
 }
 
+// Map is a helper that converts an array of alternating keys and values into
+// a map[string]interface{}. RESP3 map replies, like the one of HELLO, are
+// read in this format. Keys must be strings or integers.
+func Map(result interface{}, err error) (map[string]interface{}, error) {
+	values, err := Values(result, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("redigo: Map expects even number of values result")
+	}
+	m := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		var key string
+		switch k := values[i].(type) {
+		case []byte:
+			key = string(k)
+		case string:
+			key = k
+		case int64:
+			key = strconv.FormatInt(k, 10)
+		default:
+			return nil, fmt.Errorf("redigo: unexpected key type for Map, got type %T", k)
+		}
+		m[key] = values[i+1]
+	}
+	return m, nil
+}
+
 // IntMap is a helper that converts an array of strings (alternating key, value)
 // into a map[string]int. The HGETALL commands return replies in this format.
 // Requires an even number of values in result.
@@ -106,6 +106,31 @@ var replyTests = []struct {
 		ve(redis.Float64(nil, nil)),
 		ve(float64(0.0), redis.ErrNil),
 	},
+	{
+		"float64(double)",
+		ve(redis.Float64(1.5, nil)),
+		ve(1.5, nil),
+	},
+	{
+		"float64s([double, v2])",
+		ve(redis.Float64s([]interface{}{1.5, []byte("2")}, nil)),
+		ve([]float64{1.5, 2}, nil),
+	},
+	{
+		"bool(true)",
+		ve(redis.Bool(true, nil)),
+		ve(true, nil),
+	},
+	{
+		"bigint(12345678901234567890)",
+		ve(redis.BigInt([]byte("12345678901234567890"), nil)),
+		ve(bigNumber("12345678901234567890"), nil),
+	},
+	{
+		"map([k1, v1, k2, 2])",
+		ve(redis.Map([]interface{}{[]byte("k1"), []byte("v1"), "k2", int64(2)}, nil)),
+		ve(map[string]interface{}{"k1": []byte("v1"), "k2": int64(2)}, nil),
+	},
 	{
 		"uint64(1)",
 		ve(redis.Uint64(int64(1), nil)),
@@ -135,7 +135,12 @@ func convertAssignValue(d reflect.Value, s interface{}) (err error) {
 	case int64:
 		err = convertAssignInt(d, s)
 	default:
-		err = cannotConvert(d, s)
+		// Values already decoded by the application are assigned as is.
+		if sv := reflect.ValueOf(s); sv.IsValid() && sv.Type().AssignableTo(d.Type()) {
+			d.Set(sv)
+		} else {
+			err = cannotConvert(d, s)
+		}
 	}
 	return err
 }
@@ -217,6 +222,28 @@ func convertAssign(d interface{}, s interface{}) (err error) {
 		default:
 			err = cannotConvert(reflect.ValueOf(d), s)
 		}
+	case float64:
+		switch d := d.(type) {
+		case *float64:
+			*d = s
+		case *interface{}:
+			*d = s
+		case nil:
+			// skip value
+		default:
+			err = cannotConvert(reflect.ValueOf(d), s)
+		}
+	case bool:
+		switch d := d.(type) {
+		case *bool:
+			*d = s
+		case *interface{}:
+			*d = s
+		case nil:
+			// skip value
+		default:
+			err = cannotConvert(reflect.ValueOf(d), s)
+		}
 	case []interface{}:
 		switch d := d.(type) {
 		case *[]interface{}:
@@ -284,17 +311,25 @@ func (ss *structSpec) fieldSpec(name []byte) *fieldSpec {
 	return ss.m[string(name)]
 }
 
-func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *structSpec) {
+func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *structSpec, seen map[reflect.Type]bool) {
+	// Protect against infinite recursion through embedded pointers.
+	seen[t] = true
+	defer delete(seen, t)
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		switch {
 		case f.PkgPath != "" && !f.Anonymous:
 			// Ignore unexported fields.
 		case f.Anonymous:
-			// TODO: Handle pointers. Requires change to decoder and
-			// protection against infinite recursion.
-			if f.Type.Kind() == reflect.Struct {
-				compileStructSpec(f.Type, depth, append(index, i), ss)
+			switch f.Type.Kind() {
+			case reflect.Struct:
+				compileStructSpec(f.Type, depth, append(index, i), ss, seen)
+			case reflect.Ptr:
+				// Pointers to unexported structs can not be allocated by
+				// the decoder.
+				if et := f.Type.Elem(); et.Kind() == reflect.Struct && f.PkgPath == "" && !seen[et] {
+					compileStructSpec(et, depth, append(index, i), ss, seen)
+				}
 			}
 		default:
 			fs := &fieldSpec{name: f.Name}
@@ -367,11 +402,41 @@ func structSpecForType(t reflect.Type) *structSpec {
 	}
 
 	ss = &structSpec{m: make(map[string]*fieldSpec)}
-	compileStructSpec(t, make(map[string]int), nil, ss)
+	compileStructSpec(t, make(map[string]int), nil, ss, make(map[reflect.Type]bool))
 	structSpecCache[t] = ss
 	return ss
 }
 
+// fieldByIndex returns the nested field of v by index, ok is false if it is
+// reached through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (fv reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexCreate returns the nested field of v by index, allocating the
+// nil embedded pointers on the way.
+func fieldByIndexCreate(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
 var errScanStructValue = errors.New("redigo.ScanStruct: value must be non-nil pointer to a struct")
 
 // ScanStruct scans alternating names and values from src to a struct. The
@@ -387,7 +452,11 @@ var errScanStructValue = errors.New("redigo.ScanStruct: value must be non-nil po
 // Each field uses RedisScan if available otherwise:
 // Integer, float, boolean, string and []byte fields are supported. Scan uses the
 // standard strconv package to convert bulk string values to numeric and
-// boolean types.
+// boolean types. A src element which is neither a bulk string nor an integer
+// is assigned as is if the field type allows it.
+//
+// Embedded structs and exported embedded struct pointers are flattened, nil
+// pointers are allocated when one of their fields is scanned.
 //
 // If a src element is nil, then the corresponding field is not modified.
 func ScanStruct(src []interface{}, dest interface{}) error {
@@ -418,7 +487,7 @@ func ScanStruct(src []interface{}, dest interface{}) error {
 		if fs == nil {
 			continue
 		}
-		if err := convertAssignValue(d.FieldByIndex(fs.index), s); err != nil {
+		if err := convertAssignValue(fieldByIndexCreate(d, fs.index), s); err != nil {
 			return fmt.Errorf("redigo.ScanStruct: cannot assign field %s: %v", fs.name, err)
 		}
 	}
@@ -500,7 +569,7 @@ func ScanSlice(src []interface{}, dest interface{}, fieldNames ...string) error
 			if s == nil {
 				continue
 			}
-			if err := convertAssignValue(d.FieldByIndex(fs.index), s); err != nil {
+			if err := convertAssignValue(fieldByIndexCreate(d, fs.index), s); err != nil {
 				return fmt.Errorf("redigo.ScanSlice: cannot assign element %d to field %s: %v", i*len(fss)+j, fs.name, err)
 			}
 		}
@@ -524,8 +593,9 @@ func (args Args) Add(value ...interface{}) Args {
 //
 // Structs are flattened by appending the alternating names and values of
 // exported fields to args. If v is a nil struct pointer, then nothing is
-// appended. The 'redis' field tag overrides struct field names. See ScanStruct
-// for more information on the use of the 'redis' field tag.
+// appended, nor are the fields of a nil embedded struct pointer. The 'redis'
+// field tag overrides struct field names. See ScanStruct for more information
+// on the use of the 'redis' field tag.
 //
 // Other types are appended to args as is.
 func (args Args) AddFlat(v interface{}) Args {
@@ -555,10 +625,47 @@ func (args Args) AddFlat(v interface{}) Args {
 	return args
 }
 
+var errAddFlatFieldsValue = errors.New("redigo.AddFlatFields: value must be a struct or a non-nil pointer to a struct")
+
+// AddFlatFields returns the result of appending the alternating names and
+// values of the named fields of struct v to args, or of all its fields if no
+// name is given. Unlike AddFlat, fields tagged omitempty are appended even if
+// empty, and the fields of a nil embedded pointer with their zero value.
+func (args Args) AddFlatFields(v interface{}, names ...string) (Args, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return args, errAddFlatFieldsValue
+	}
+	ss := structSpecForType(rv.Type())
+	fss := ss.l
+	if len(names) > 0 {
+		fss = make([]*fieldSpec, len(names))
+		for i, name := range names {
+			if fss[i] = ss.m[name]; fss[i] == nil {
+				return args, fmt.Errorf("redigo.AddFlatFields: bad field name %s", name)
+			}
+		}
+	}
+	for _, fs := range fss {
+		fv, ok := fieldByIndex(rv, fs.index)
+		if !ok {
+			fv = reflect.Zero(rv.Type().FieldByIndex(fs.index).Type)
+		}
+		args = append(args, fs.name, fv.Interface())
+	}
+	return args, nil
+}
+
 func flattenStruct(args Args, v reflect.Value) Args {
 	ss := structSpecForType(v.Type())
 	for _, fs := range ss.l {
-		fv := v.FieldByIndex(fs.index)
+		fv, ok := fieldByIndex(v, fs.index)
+		if !ok {
+			continue
+		}
 		if fs.omitEmpty {
 			var empty = false
 			switch fv.Kind() {
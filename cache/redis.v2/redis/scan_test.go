@@ -190,6 +190,16 @@ type s1 struct {
 	Sdp *durationScan `redis:"sdp"`
 }
 
+type Se struct {
+	Z int `redis:"z"`
+	*Se
+}
+
+type s2 struct {
+	A int `redis:"a"`
+	*Se
+}
+
 var scanStructTests = []struct {
 	title string
 	reply []string
@@ -222,6 +232,10 @@ var scanStructTests = []struct {
 			Sdp: &durationScan{Duration: time.Minute},
 		},
 	},
+	{"embedded pointer",
+		[]string{"a", "1", "z", "2"},
+		&s2{A: 1, Se: &Se{Z: 2}},
+	},
 }
 
 func TestScanStruct(t *testing.T) {
@@ -427,6 +441,14 @@ var argsTests = []struct {
 		}),
 		redis.Args{"Bt", true},
 	},
+	{"struct nil embedded pointer",
+		redis.Args{}.AddFlat(&s2{A: 1}),
+		redis.Args{"a", 1},
+	},
+	{"struct embedded pointer",
+		redis.Args{}.AddFlat(&s2{A: 1, Se: &Se{Z: 2}}),
+		redis.Args{"a", 1, "z", 2},
+	},
 }
 
 func TestArgs(t *testing.T) {
@@ -437,6 +459,32 @@ func TestArgs(t *testing.T) {
 	}
 }
 
+func TestAddFlatFields(t *testing.T) {
+	v := &struct {
+		I int    `redis:"i,omitempty"`
+		S string `redis:"s"`
+		s2
+	}{S: "hello"}
+	for _, tt := range []struct {
+		names    []string
+		expected redis.Args
+	}{
+		{nil, redis.Args{"i", 0, "s", "hello", "a", 0, "z", 0}},
+		{[]string{"z", "i"}, redis.Args{"z", 0, "i", 0}},
+	} {
+		actual, err := redis.Args{}.AddFlatFields(v, tt.names...)
+		if err != nil || !reflect.DeepEqual(actual, tt.expected) {
+			t.Fatalf("AddFlatFields(%v) is %v, %v, want %v", tt.names, actual, err, tt.expected)
+		}
+	}
+	if _, err := (redis.Args{}).AddFlatFields(v, "x"); err == nil {
+		t.Fatal("AddFlatFields accepted a bad field name")
+	}
+	if _, err := (redis.Args{}).AddFlatFields(1); err == nil {
+		t.Fatal("AddFlatFields accepted an int")
+	}
+}
+
 func ExampleArgs() {
 	c, err := dial()
 	if err != nil {
@@ -15,19 +15,13 @@
 package redis
 
 import (
-	"bufio"
-	"errors"
 	"flag"
-	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
-	"os/exec"
-	"strconv"
-	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
 )
 
 func SetNowFunc(f func() time.Time) {
@@ -37,92 +31,19 @@ func SetNowFunc(f func() time.Time) {
 var (
 	ErrNegativeInt = errNegativeInt
 
-	serverPath     = flag.String("redis-server", "redis-server", "Path to redis server binary")
-	serverAddress  = flag.String("redis-address", "127.0.0.1", "The address of the server")
-	serverBasePort = flag.Int("redis-port", 16379, "Beginning of port range for test servers")
-	serverLogName  = flag.String("redis-log", "", "Write Redis server logs to `filename`")
-	serverLog      = ioutil.Discard
+	serverAddress = flag.String("redis-address", "", "The address of a redis server to test against, instead of an in-process one")
 
 	defaultServerMu  sync.Mutex
-	defaultServer    *Server
+	defaultServer    *redistest.Server
 	defaultServerErr error
 )
 
-type Server struct {
-	name string
-	cmd  *exec.Cmd
-	done chan struct{}
-}
-
-func NewServer(name string, args ...string) (*Server, error) {
-	s := &Server{
-		name: name,
-		cmd:  exec.Command(*serverPath, args...),
-		done: make(chan struct{}),
-	}
-
-	r, err := s.cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
-	}
-
-	err = s.cmd.Start()
-	if err != nil {
-		return nil, err
-	}
-
-	ready := make(chan error, 1)
-	go s.watch(r, ready)
-
-	select {
-	case err = <-ready:
-	case <-time.After(time.Second * 10):
-		err = errors.New("timeout waiting for server to start")
-	}
-
-	if err != nil {
-		s.Stop()
-		return nil, err
-	}
-
-	return s, nil
-}
-
-func (s *Server) watch(r io.Reader, ready chan error) {
-	fmt.Fprintf(serverLog, "%d START %s \n", s.cmd.Process.Pid, s.name)
-	var listening bool
-	var text string
-	scn := bufio.NewScanner(r)
-	for scn.Scan() {
-		text = scn.Text()
-		fmt.Fprintf(serverLog, "%s\n", text)
-		if !listening {
-			if strings.Contains(text, " * Ready to accept connections") ||
-				strings.Contains(text, " * The server is now ready to accept connections on port") {
-				listening = true
-				ready <- nil
-			}
-		}
-	}
-	if !listening {
-		ready <- fmt.Errorf("server exited: %s", text)
-	}
-	s.cmd.Wait()
-	fmt.Fprintf(serverLog, "%d STOP %s \n", s.cmd.Process.Pid, s.name)
-	close(s.done)
-}
-
-func (s *Server) Stop() {
-	s.cmd.Process.Signal(os.Interrupt)
-	<-s.done
-}
-
 // stopDefaultServer stops the server created by DialDefaultServer.
 func stopDefaultServer() {
 	defaultServerMu.Lock()
 	defer defaultServerMu.Unlock()
 	if defaultServer != nil {
-		defaultServer.Stop()
+		defaultServer.Close()
 		defaultServer = nil
 	}
 }
@@ -130,19 +51,18 @@ func stopDefaultServer() {
 // DefaultServerAddr starts the test server if not already started and returns
 // the address of that server.
 func DefaultServerAddr() (string, error) {
+	if *serverAddress != "" {
+		return *serverAddress, nil
+	}
 	defaultServerMu.Lock()
 	defer defaultServerMu.Unlock()
-	addr := fmt.Sprintf("%v:%d", *serverAddress, *serverBasePort)
-	if defaultServer != nil || defaultServerErr != nil {
-		return addr, defaultServerErr
+	if defaultServer == nil && defaultServerErr == nil {
+		defaultServer, defaultServerErr = redistest.NewServer()
+	}
+	if defaultServerErr != nil {
+		return "", defaultServerErr
 	}
-	defaultServer, defaultServerErr = NewServer(
-		"default",
-		"--port", strconv.Itoa(*serverBasePort),
-		"--bind", *serverAddress,
-		"--save", "",
-		"--appendonly", "no")
-	return addr, defaultServerErr
+	return defaultServer.Addr(), nil
 }
 
 // DialDefaultServer starts the test server if not already started and dials a
@@ -163,19 +83,6 @@ func DialDefaultServer() (Conn, error) {
 func TestMain(m *testing.M) {
 	os.Exit(func() int {
 		flag.Parse()
-
-		var f *os.File
-		if *serverLogName != "" {
-			var err error
-			f, err = os.OpenFile(*serverLogName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error opening redis-log: %v\n", err)
-				return 1
-			}
-			defer f.Close()
-			serverLog = f
-		}
-
 		defer stopDefaultServer()
 
 		return m.Run()
@@ -0,0 +1,400 @@
+package redis
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	_invalidateChannel = "__redis__:invalidate"
+	_trackingPing      = 30 * time.Second // health check of the redirect connection
+	_trackingRetry     = time.Second      // delay before dialing it again
+)
+
+// ClientTracking configures the client side caching of a Pool with the
+// CLIENT TRACKING command of redis 6.
+//
+// The pool dials a dedicated connection subscribed to __redis__:invalidate
+// and turns tracking on with REDIRECT to it on every new connection, so the
+// connections keep speaking RESP2. The replies of GET and HGET are then
+// cached locally until the server invalidates their key. Nothing is cached
+// while the redirect connection is down, and the pool is Reset when it is
+// lost since its connections no longer receive invalidations.
+type ClientTracking struct {
+	// Bcast enables the broadcasting mode. The server then reports the writes
+	// of every key matching Prefixes instead of remembering the keys read by
+	// each connection.
+	Bcast bool
+
+	// Prefixes of the keys cached in broadcasting mode, all keys when empty.
+	Prefixes []string
+
+	// Optin makes the server track only the keys read by the cached commands,
+	// by sending CLIENT CACHING yes before them. It can't be used with Bcast.
+	Optin bool
+
+	// MaxEntries limits the number of cached keys. When zero, the number of
+	// keys is not limited.
+	MaxEntries int
+}
+
+func (ct *ClientTracking) matches(key string) bool {
+	if len(ct.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range ct.Prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackKey identifies a cached reply of a key.
+type trackKey struct {
+	cmd, field string
+}
+
+// trackEntry is a cached reply, reserved by a read until it completes.
+type trackEntry struct {
+	pc    *poolConn // connection the reply was read on
+	reply interface{}
+	ok    bool
+}
+
+// tracker is the client side cache of a pool and its redirect connection.
+type tracker struct {
+	p   *Pool
+	cfg *ClientTracking
+
+	hits, misses int64 // atomic
+
+	mu     sync.Mutex
+	conn   Conn      // redirect connection, nil while disconnected
+	id     int64     // CLIENT ID of conn
+	epoch  uint64    // incremented when conn changes, connections cache within their epoch
+	retry  time.Time // next time to dial conn
+	closed bool
+	keys   map[string]map[trackKey]*trackEntry
+}
+
+func newTracker(p *Pool) *tracker {
+	return &tracker{
+		p:    p,
+		cfg:  p.ClientTracking,
+		keys: make(map[string]map[trackKey]*trackEntry),
+	}
+}
+
+// tracking returns the client side cache of the pool, creating it on first
+// use.
+func (p *Pool) tracking() *tracker {
+	p.mu.Lock()
+	if p.tracker == nil {
+		p.tracker = newTracker(p)
+	}
+	t := p.tracker
+	p.mu.Unlock()
+	return t
+}
+
+// enable turns tracking on for c with REDIRECT to the invalidation
+// connection. It returns the cache epoch of c, zero when the replies read on
+// c must not be cached.
+func (t *tracker) enable(c Conn) (uint64, error) {
+	id, epoch := t.redirect()
+	if epoch == 0 {
+		return 0, nil
+	}
+	args := []interface{}{"TRACKING", "on", "REDIRECT", id}
+	if t.cfg.Bcast {
+		args = append(args, "BCAST")
+		for _, p := range t.cfg.Prefixes {
+			args = append(args, "PREFIX", p)
+		}
+	}
+	if t.cfg.Optin {
+		args = append(args, "OPTIN")
+	}
+	if _, err := c.Do("CLIENT", args...); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
+
+// redirect returns the CLIENT ID of the redirect connection and the cache
+// epoch, dialing the connection if needed. The epoch is zero when the
+// connection is not available.
+func (t *tracker) redirect() (int64, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil && !t.closed && !nowFunc().Before(t.retry) {
+		if err := t.dial(); err != nil {
+			t.retry = nowFunc().Add(_trackingRetry)
+		}
+	}
+	if t.conn == nil {
+		return 0, 0
+	}
+	return t.id, t.epoch
+}
+
+// dial connects the redirect connection, with mu held.
+func (t *tracker) dial() error {
+	c, err := t.p.Dial()
+	if err != nil {
+		return err
+	}
+	id, err := Int64(c.Do("CLIENT", "ID"))
+	if err == nil {
+		_, err = c.Do("SUBSCRIBE", _invalidateChannel)
+	}
+	if err != nil {
+		c.Close()
+		return err
+	}
+	t.conn, t.id = c, id
+	t.epoch++
+	t.keys = make(map[string]map[trackKey]*trackEntry)
+	go t.receive(c)
+	return nil
+}
+
+// disconnect closes the redirect connection and drops the cache, with mu
+// held.
+func (t *tracker) disconnect() {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	t.epoch++
+	t.keys = make(map[string]map[trackKey]*trackEntry)
+}
+
+// receive reads the invalidations from the redirect connection c until it
+// fails.
+func (t *tracker) receive(c Conn) {
+	done := make(chan struct{})
+	defer close(done)
+	go t.ping(c, done)
+	for {
+		reply, err := receiveTracking(c)
+		if err != nil {
+			break
+		}
+		// PING replies are [pong, ""]
+		values, _ := reply.([]interface{})
+		if len(values) != 3 {
+			continue
+		}
+		if kind, _ := values[0].([]byte); string(kind) == "message" {
+			t.invalidate(values[2])
+		}
+	}
+	t.mu.Lock()
+	if t.conn != c {
+		// closed by Reset or Close
+		t.mu.Unlock()
+		return
+	}
+	t.disconnect()
+	t.retry = time.Time{}
+	t.mu.Unlock()
+	t.p.Reset()
+}
+
+func receiveTracking(c Conn) (interface{}, error) {
+	if _, ok := c.(ConnWithTimeout); ok {
+		return ReceiveWithTimeout(c, 2*_trackingPing)
+	}
+	return c.Receive()
+}
+
+// ping checks the health of the redirect connection c until done is closed.
+func (t *tracker) ping(c Conn, done chan struct{}) {
+	ticker := time.NewTicker(_trackingPing)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if c.Send("PING") != nil || c.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// invalidate drops the keys of an invalidation message, or every key when it
+// is nil after a flush.
+func (t *tracker) invalidate(keys interface{}) {
+	t.mu.Lock()
+	if keys, ok := keys.([]interface{}); ok {
+		for _, key := range keys {
+			if key, ok := key.([]byte); ok {
+				delete(t.keys, string(key))
+			}
+		}
+	} else {
+		t.keys = make(map[string]map[trackKey]*trackEntry)
+	}
+	t.mu.Unlock()
+}
+
+// forget drops the replies read on pc when it is closed, since the server
+// stops tracking its keys.
+func (t *tracker) forget(pc *poolConn) {
+	t.mu.Lock()
+	if pc.epoch == t.epoch {
+		for key, entries := range t.keys {
+			for _, e := range entries {
+				if e.pc == pc {
+					delete(t.keys, key)
+					break
+				}
+			}
+		}
+	}
+	t.mu.Unlock()
+}
+
+// reset drops the cache and the redirect connection after a Pool Reset.
+func (t *tracker) reset() {
+	t.mu.Lock()
+	t.disconnect()
+	t.retry = time.Time{}
+	t.mu.Unlock()
+}
+
+func (t *tracker) close() {
+	t.mu.Lock()
+	t.closed = true
+	t.disconnect()
+	t.mu.Unlock()
+}
+
+// cacheable returns the key and the slot of the reply of a GET or HGET
+// command.
+func (t *tracker) cacheable(commandName string, args []interface{}) (string, trackKey, bool) {
+	var tk trackKey
+	switch {
+	case len(args) == 1 && strings.EqualFold(commandName, "GET"):
+		tk.cmd = "GET"
+	case len(args) == 2 && strings.EqualFold(commandName, "HGET"):
+		field, ok := trackArg(args[1])
+		if !ok {
+			return "", tk, false
+		}
+		tk = trackKey{cmd: "HGET", field: field}
+	default:
+		return "", tk, false
+	}
+	key, ok := trackArg(args[0])
+	if !ok || (t.cfg.Bcast && !t.cfg.matches(key)) {
+		return "", tk, false
+	}
+	return key, tk, true
+}
+
+func trackArg(arg interface{}) (string, bool) {
+	switch arg := arg.(type) {
+	case string:
+		return arg, true
+	case []byte:
+		return string(arg), true
+	}
+	return "", false
+}
+
+// do runs a cacheable read on pc, replying from the cache when possible.
+func (t *tracker) do(pc *poolConn, key string, tk trackKey, do func() (interface{}, error)) (interface{}, error) {
+	reply, e, ok := t.lookup(pc, key, tk)
+	if ok {
+		atomic.AddInt64(&t.hits, 1)
+		return reply, nil
+	}
+	atomic.AddInt64(&t.misses, 1)
+	if e != nil && t.cfg.Optin {
+		if err := pc.c.Send("CLIENT", "CACHING", "yes"); err != nil {
+			t.store(key, tk, e, nil, err)
+			return nil, err
+		}
+	}
+	reply, err := do()
+	t.store(key, tk, e, reply, err)
+	return reply, err
+}
+
+// lookup returns the cached reply of key, or reserves an entry for the read
+// on pc. The entry is nil when the reply must not be cached, because pc is
+// from another epoch or a read of the same reply is in flight.
+func (t *tracker) lookup(pc *poolConn, key string, tk trackKey) (interface{}, *trackEntry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if pc.epoch != t.epoch {
+		return nil, nil, false
+	}
+	entries := t.keys[key]
+	if e := entries[tk]; e != nil {
+		if e.ok {
+			return copyReply(e.reply), nil, true
+		}
+		return nil, nil, false
+	}
+	if entries == nil {
+		if max := t.cfg.MaxEntries; max > 0 && len(t.keys) >= max {
+			// evict a random key
+			for k := range t.keys {
+				delete(t.keys, k)
+				break
+			}
+		}
+		entries = make(map[trackKey]*trackEntry)
+		t.keys[key] = entries
+	}
+	e := &trackEntry{pc: pc}
+	entries[tk] = e
+	return nil, e, false
+}
+
+// store completes the entry e reserved by lookup, unless the key was
+// invalidated in the meantime.
+func (t *tracker) store(key string, tk trackKey, e *trackEntry, reply interface{}, err error) {
+	if e == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := t.keys[key]
+	if entries[tk] != e {
+		return
+	}
+	if _, ok := reply.([]byte); err == nil && (ok || reply == nil) {
+		e.reply, e.ok = copyReply(reply), true
+		return
+	}
+	delete(entries, tk)
+	if len(entries) == 0 {
+		delete(t.keys, key)
+	}
+}
+
+func copyReply(reply interface{}) interface{} {
+	if p, ok := reply.([]byte); ok {
+		return append([]byte(nil), p...)
+	}
+	return reply
+}
+
+// cacheable reports whether the command can be replied from the client side
+// cache, which needs a tracking connection not in a special state nor with
+// pending replies.
+func (ac *activeConn) cacheable(commandName string, args []interface{}) (string, trackKey, bool) {
+	if ac.pc.epoch == 0 || ac.state != 0 || atomic.LoadInt32(&ac.pending) != 0 {
+		return "", trackKey{}, false
+	}
+	return ac.p.tracker.cacheable(commandName, args)
+}
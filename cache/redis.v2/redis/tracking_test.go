@@ -0,0 +1,163 @@
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+func newTrackingPool(t *testing.T, ct *redis.ClientTracking) (*redistest.Server, *redis.Pool) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &redis.Pool{
+		MaxIdle:        1,
+		Dial:           func() (redis.Conn, error) { return redis.Dial("tcp", s.Addr()) },
+		ClientTracking: ct,
+	}
+	return s, p
+}
+
+// eventually polls get until it returns want, invalidations being
+// asynchronous.
+func eventually(t *testing.T, get func() (string, error), want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, err := get()
+		if err == nil && got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %q %v, want %q", got, err, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolClientTracking(t *testing.T) {
+	s, p := newTrackingPool(t, &redis.ClientTracking{})
+	defer s.Close()
+	defer p.Close()
+
+	c := p.Get()
+	defer c.Close()
+	other, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	get := func() (string, error) { return redis.String(c.Do("GET", "k")) }
+	hget := func() (string, error) { return redis.String(c.Do("HGET", "h", "f")) }
+	if _, err = c.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := get(); err != nil || v != "v" {
+			t.Fatalf("GET = %q %v", v, err)
+		}
+	}
+	if stats := p.Stats(); stats.CacheHits != 2 || stats.CacheMisses != 1 {
+		t.Fatalf("got %d hits %d misses, want 2 and 1", stats.CacheHits, stats.CacheMisses)
+	}
+
+	// the writes of other connections invalidate the cache
+	if _, err = other.Do("SET", "k", "w"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, get, "w")
+	if _, err = other.Do("HSET", "h", "f", "1"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, hget, "1")
+	if _, err = other.Do("HSET", "h", "f", "2"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, hget, "2")
+	if _, err = other.Do("FLUSHALL"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() (string, error) {
+		v, err := redis.String(c.Do("GET", "k"))
+		if err == redis.ErrNil {
+			return "nil", nil
+		}
+		return v, err
+	}, "nil")
+
+	// pipelined reads are not cached
+	hits := p.Stats().CacheHits
+	c.Send("GET", "k")
+	if _, err = c.Do(""); err != nil {
+		t.Fatal(err)
+	}
+	c.Send("PING")
+	if reply, err := c.Do("GET", "k"); err != nil || reply != nil {
+		t.Fatalf("GET = %v %v", reply, err)
+	}
+	if p.Stats().CacheHits != hits {
+		t.Fatal("pipelined read replied from the cache")
+	}
+}
+
+func TestPoolClientTrackingClosedConn(t *testing.T) {
+	s, p := newTrackingPool(t, &redis.ClientTracking{})
+	defer s.Close()
+	defer p.Close()
+	p.MaxIdle = 0
+
+	for i := 0; i < 2; i++ {
+		c := p.Get()
+		if _, err := c.Do("GET", "k"); err != redis.ErrNil && err != nil {
+			t.Fatal(err)
+		}
+		// the server stops tracking the keys of a closed connection
+		c.Close()
+	}
+	if stats := p.Stats(); stats.CacheHits != 0 || stats.CacheMisses != 2 {
+		t.Fatalf("got %d hits %d misses, want 0 and 2", stats.CacheHits, stats.CacheMisses)
+	}
+}
+
+func TestPoolClientTrackingBcast(t *testing.T) {
+	s, p := newTrackingPool(t, &redis.ClientTracking{Bcast: true, Prefixes: []string{"user:"}})
+	defer s.Close()
+	defer p.Close()
+
+	c := p.Get()
+	defer c.Close()
+	for _, key := range []string{"user:1", "user:1", "item:1", "item:1"} {
+		if _, err := c.Do("GET", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := p.Stats(); stats.CacheHits != 1 || stats.CacheMisses != 1 {
+		t.Fatalf("got %d hits %d misses, want 1 and 1", stats.CacheHits, stats.CacheMisses)
+	}
+	if _, err := c.Do("SET", "user:1", "x"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() (string, error) { return redis.String(c.Do("GET", "user:1")) }, "x")
+}
+
+func TestPoolClientTrackingOptin(t *testing.T) {
+	s, p := newTrackingPool(t, &redis.ClientTracking{Optin: true})
+	defer s.Close()
+	defer p.Close()
+
+	c := p.Get()
+	defer c.Close()
+	get := func() (string, error) { return redis.String(c.Do("GET", "k")) }
+	if _, err := c.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, get, "v")
+	if _, err := c.Do("SET", "k", "w"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, get, "w")
+}
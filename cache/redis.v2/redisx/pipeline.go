@@ -0,0 +1,336 @@
+package redisx
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/internal"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+const (
+	_pipelineMaxBytes = 64 * 1024 // default byte budget of a batch
+	_pipelinePending  = 1024      // commands written and waiting for their reply
+)
+
+var (
+	errPipelineClosed      = errors.New("redisx: auto pipeline closed")
+	errPipelineUnsupported = errors.New("command not supported by auto pipeline")
+)
+
+// AutoPipeline shares a connection between goroutines and coalesces the
+// commands of concurrent Do calls into one write and one flush. Replies are
+// demultiplexed in order to their callers.
+//
+// A batch holds the commands queued while the previous batch was written,
+// plus those arriving within the window after its first command, up to the
+// byte budget. Like ConnMux, AutoPipeline does not support the commands that
+// put the connection in a special mode, and blocking commands stall every
+// caller.
+type AutoPipeline struct {
+	c        redis.Conn
+	window   time.Duration
+	maxBytes int
+
+	reqs    chan *pipelineReq
+	pending chan *pipelineReq
+	done    chan struct{}
+	once    sync.Once
+
+	batches  int64 // atomic
+	commands int64 // atomic
+	maxBatch int64 // atomic
+}
+
+// AutoPipelineStats contains the batch statistics of an AutoPipeline.
+type AutoPipelineStats struct {
+	// Batches is the number of writes to the connection.
+	Batches int64
+	// Commands is the number of commands written, Commands/Batches is the
+	// mean batch size.
+	Commands int64
+	// MaxBatch is the number of commands of the largest batch.
+	MaxBatch int64
+}
+
+type pipelineReq struct {
+	cmd   string
+	args  []interface{}
+	reply interface{}
+	err   error
+	done  chan struct{}
+}
+
+// NewAutoPipeline starts pipelining the commands of c. A batch waits window
+// for more commands after its first one, and is written once its arguments
+// reach maxBytes, 64KB when zero.
+func NewAutoPipeline(c redis.Conn, window time.Duration, maxBytes int) *AutoPipeline {
+	if maxBytes <= 0 {
+		maxBytes = _pipelineMaxBytes
+	}
+	p := &AutoPipeline{
+		c:        c,
+		window:   window,
+		maxBytes: maxBytes,
+		reqs:     make(chan *pipelineReq),
+		pending:  make(chan *pipelineReq, _pipelinePending),
+		done:     make(chan struct{}),
+	}
+	go p.write()
+	go p.read()
+	return p
+}
+
+// Do sends a command in the next batch and returns its reply.
+func (p *AutoPipeline) Do(cmd string, args ...interface{}) (interface{}, error) {
+	req, err := p.submit(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	return p.wait(req)
+}
+
+func (p *AutoPipeline) submit(cmd string, args []interface{}) (*pipelineReq, error) {
+	if internal.LookupCommandInfo(cmd).Set != 0 {
+		return nil, errPipelineUnsupported
+	}
+	req := &pipelineReq{cmd: cmd, args: args, done: make(chan struct{})}
+	select {
+	case p.reqs <- req:
+		return req, nil
+	case <-p.done:
+		return nil, errPipelineClosed
+	}
+}
+
+func (p *AutoPipeline) wait(req *pipelineReq) (interface{}, error) {
+	select {
+	case <-req.done:
+		return req.reply, req.err
+	case <-p.done:
+		return nil, errPipelineClosed
+	}
+}
+
+// Get gets a connection sending its commands through the pipeline. Flush
+// hands the commands queued by Send to the pipeline. The application must
+// close the returned connection.
+func (p *AutoPipeline) Get() redis.Conn {
+	return &pipelineConn{p: p}
+}
+
+// Stats returns the batch statistics.
+func (p *AutoPipeline) Stats() AutoPipelineStats {
+	return AutoPipelineStats{
+		Batches:  atomic.LoadInt64(&p.batches),
+		Commands: atomic.LoadInt64(&p.commands),
+		MaxBatch: atomic.LoadInt64(&p.maxBatch),
+	}
+}
+
+// Err returns a non-nil value when the underlying connection is not usable.
+func (p *AutoPipeline) Err() error {
+	return p.c.Err()
+}
+
+// Close closes the underlying connection, failing the commands in flight.
+func (p *AutoPipeline) Close() error {
+	err := errPipelineClosed
+	p.once.Do(func() {
+		close(p.done)
+		err = p.c.Close()
+	})
+	return err
+}
+
+// write batches the submitted commands.
+func (p *AutoPipeline) write() {
+	defer close(p.pending)
+	var batch []*pipelineReq
+	for {
+		select {
+		case req := <-p.reqs:
+			batch = p.collect(append(batch[:0], req), size(req))
+			p.flush(batch)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// collect adds the commands queued or arriving within the window to batch.
+func (p *AutoPipeline) collect(batch []*pipelineReq, n int) []*pipelineReq {
+	var timeout <-chan time.Time
+	if p.window > 0 {
+		t := time.NewTimer(p.window)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for n < p.maxBytes {
+		select {
+		case req := <-p.reqs:
+			batch = append(batch, req)
+			n += size(req)
+			continue
+		default:
+		}
+		if timeout == nil {
+			break
+		}
+		select {
+		case req := <-p.reqs:
+			batch = append(batch, req)
+			n += size(req)
+		case <-timeout:
+			return batch
+		case <-p.done:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush writes batch, handing the commands to the reader.
+func (p *AutoPipeline) flush(batch []*pipelineReq) {
+	var err error
+	for _, req := range batch {
+		if err == nil {
+			err = p.c.Send(req.cmd, req.args...)
+		}
+		if err != nil {
+			req.err = err
+			close(req.done)
+			continue
+		}
+		select {
+		case p.pending <- req:
+		case <-p.done:
+			return
+		}
+	}
+	if err == nil {
+		// a failed flush is reported by Receive
+		p.c.Flush()
+	}
+	n := int64(len(batch))
+	atomic.AddInt64(&p.batches, 1)
+	atomic.AddInt64(&p.commands, n)
+	for {
+		max := atomic.LoadInt64(&p.maxBatch)
+		if n <= max || atomic.CompareAndSwapInt64(&p.maxBatch, max, n) {
+			break
+		}
+	}
+}
+
+// read demultiplexes the replies in order.
+func (p *AutoPipeline) read() {
+	for req := range p.pending {
+		req.reply, req.err = p.c.Receive()
+		close(req.done)
+	}
+}
+
+// size estimates the bytes written for req.
+func size(req *pipelineReq) int {
+	n := len(req.cmd)
+	for _, arg := range req.args {
+		switch arg := arg.(type) {
+		case string:
+			n += len(arg)
+		case []byte:
+			n += len(arg)
+		default:
+			n += 8
+		}
+	}
+	return n
+}
+
+type pipelineConn struct {
+	p      *AutoPipeline
+	queued []*pipelineReq // sent and not flushed
+	sent   []*pipelineReq // flushed and not received
+}
+
+func (c *pipelineConn) Send(cmd string, args ...interface{}) error {
+	if internal.LookupCommandInfo(cmd).Set != 0 {
+		return errPipelineUnsupported
+	}
+	c.queued = append(c.queued, &pipelineReq{cmd: cmd, args: args, done: make(chan struct{})})
+	return nil
+}
+
+func (c *pipelineConn) Flush() error {
+	for len(c.queued) > 0 {
+		req := c.queued[0]
+		select {
+		case c.p.reqs <- req:
+		case <-c.p.done:
+			return errPipelineClosed
+		}
+		c.queued = c.queued[1:]
+		c.sent = append(c.sent, req)
+	}
+	c.queued = nil
+	return nil
+}
+
+func (c *pipelineConn) Receive() (interface{}, error) {
+	if len(c.sent) == 0 {
+		return nil, errors.New("auto pipeline underflow")
+	}
+	req := c.sent[0]
+	c.sent = c.sent[1:]
+	return c.p.wait(req)
+}
+
+// Do flushes the commands sent on the connection with cmd and receives their
+// replies in order, as redis.Conn does: the reply of cmd is returned, with
+// the first error reply, or the replies of the pending commands if cmd is "".
+func (c *pipelineConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd != "" {
+		if err := c.Send(cmd, args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, 0, len(c.sent))
+	var first error
+	for len(c.sent) > 0 {
+		reply, err := c.Receive()
+		if e, ok := err.(redis.Error); ok {
+			// NOTE: error replies are values of the replies, as in redigo.
+			reply, err = e, nil
+			if first == nil {
+				first = e
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	if cmd == "" {
+		return replies, nil
+	}
+	return replies[len(replies)-1], first
+}
+
+func (c *pipelineConn) Err() error {
+	return c.p.Err()
+}
+
+// Close waits for the replies of the commands sent on the connection.
+func (c *pipelineConn) Close() error {
+	var err error
+	c.Flush()
+	for len(c.sent) > 0 {
+		_, err = c.Receive()
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package redisx_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redisx"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+func newAutoPipeline(t testing.TB, window time.Duration) (*redistest.Server, *redisx.AutoPipeline) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, redisx.NewAutoPipeline(c, window, 0)
+}
+
+func TestAutoPipeline(t *testing.T) {
+	s, p := newAutoPipeline(t, time.Millisecond)
+	defer s.Close()
+	defer p.Close()
+
+	const n = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v := strconv.Itoa(i)
+			if _, err := p.Do("SET", v, v); err != nil {
+				errs <- err
+				return
+			}
+			if got, err := redis.String(p.Do("GET", v)); err != nil || got != v {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("got error %v", err)
+	}
+	stats := p.Stats()
+	if stats.Commands != 2*n || stats.Batches >= stats.Commands || stats.MaxBatch < 2 {
+		t.Fatalf("got %+v, want batched commands", stats)
+	}
+
+	if _, err := p.Do("HGET", "1", "f"); err == nil {
+		t.Fatal("want WRONGTYPE error")
+	}
+	if _, err := p.Do("SUBSCRIBE", "c"); err == nil {
+		t.Fatal("want unsupported command error")
+	}
+}
+
+func TestAutoPipelineConn(t *testing.T) {
+	s, p := newAutoPipeline(t, 0)
+	defer s.Close()
+	defer p.Close()
+
+	c := p.Get()
+	c.Send("ECHO", "hello")
+	c.Send("ECHO", "world")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"hello", "world"} {
+		if got, err := redis.String(c.Receive()); err != nil || got != want {
+			t.Fatalf("got %q %v, want %q", got, err, want)
+		}
+	}
+	if _, err := c.Receive(); err == nil {
+		t.Fatal("want underflow error")
+	}
+	c.Send("ECHO", "unread")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Do receives the replies of the commands sent before it
+	c = p.Get()
+	defer c.Close()
+	c.Send("SET", "k", "v")
+	c.Send("INCR", "k")
+	if got, err := c.Do("ECHO", "last"); string(got.([]byte)) != "last" || err == nil {
+		t.Fatalf("got %q %v, want last and the INCR error", got, err)
+	}
+	c.Send("GET", "k")
+	c.Send("ECHO", "x")
+	replies, err := redis.Strings(c.Do(""))
+	if err != nil || len(replies) != 2 || replies[0] != "v" || replies[1] != "x" {
+		t.Fatalf("got %q %v, want [v x]", replies, err)
+	}
+	if _, err := c.Receive(); err == nil {
+		t.Fatal("want underflow error")
+	}
+}
+
+func TestAutoPipelineClose(t *testing.T) {
+	s, p := newAutoPipeline(t, 0)
+	defer s.Close()
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Do("PING"); err == nil {
+		t.Fatal("want closed error")
+	}
+}
+
+func BenchmarkAutoPipelineConcurrent(b *testing.B) {
+	s, p := newAutoPipeline(b, 0)
+	defer s.Close()
+	defer p.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := p.Do("PING"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
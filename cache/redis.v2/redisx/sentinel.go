@@ -0,0 +1,184 @@
+package redisx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+// ErrNoSentinel is returned when none of the sentinels could be reached.
+var ErrNoSentinel = errors.New("redisx: no reachable sentinel")
+
+// _sentinelChannels are the sentinel events watched by Watch.
+var _sentinelChannels = []string{"+switch-master", "+slave", "+sdown", "-sdown", "+odown", "-odown"}
+
+// Sentinel resolves the master and replicas of a redis group monitored by
+// sentinels.
+type Sentinel struct {
+	// Addrs is the list of sentinel addresses.
+	Addrs []string
+
+	// MasterName is the name of the monitored master.
+	MasterName string
+
+	// Dial connects to the sentinel at addr.
+	Dial func(addr string) (redis.Conn, error)
+
+	mu    sync.Mutex
+	addrs []string // sentinel addresses, the last one that answered first
+}
+
+// SentinelEvent is a notification published by a sentinel about the master
+// or one of its replicas.
+type SentinelEvent struct {
+	// Channel is the event name, e.g. +switch-master or +sdown.
+	Channel string
+
+	// Fields are the space separated fields of the event payload.
+	Fields []string
+}
+
+// MasterAddr returns the address of the current master.
+func (s *Sentinel) MasterAddr() (addr string, err error) {
+	err = s.do(func(c redis.Conn) error {
+		res, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.MasterName))
+		if err != nil {
+			return err
+		}
+		if len(res) != 2 {
+			return errors.New("redisx: master " + s.MasterName + " is unknown to sentinel")
+		}
+		addr = net.JoinHostPort(res[0], res[1])
+		return nil
+	})
+	return
+}
+
+// ReplicaAddrs returns the addresses of the replicas which are not down or
+// disconnected.
+func (s *Sentinel) ReplicaAddrs() (addrs []string, err error) {
+	err = s.do(func(c redis.Conn) error {
+		res, err := redis.Values(c.Do("SENTINEL", "slaves", s.MasterName))
+		if err != nil {
+			return err
+		}
+		addrs = addrs[:0]
+		for _, r := range res {
+			info, err := redis.StringMap(r, nil)
+			if err != nil {
+				return err
+			}
+			if replicaDown(info["flags"]) {
+				continue
+			}
+			addrs = append(addrs, net.JoinHostPort(info["ip"], info["port"]))
+		}
+		return nil
+	})
+	return
+}
+
+func replicaDown(flags string) bool {
+	for _, f := range strings.Split(flags, ",") {
+		switch f {
+		case "s_down", "o_down", "disconnected":
+			return true
+		}
+	}
+	return false
+}
+
+// do calls fn with a connection to the first sentinel that answers.
+func (s *Sentinel) do(fn func(c redis.Conn) error) (err error) {
+	addrs := s.sentinels()
+	err = ErrNoSentinel
+	for i, addr := range addrs {
+		var c redis.Conn
+		if c, err = s.Dial(addr); err != nil {
+			continue
+		}
+		err = fn(c)
+		c.Close()
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			continue
+		}
+		if i > 0 {
+			s.promote(addr)
+		}
+		return
+	}
+	return
+}
+
+// dial connects to the first sentinel that answers.
+func (s *Sentinel) dial() (c redis.Conn, err error) {
+	err = ErrNoSentinel
+	for i, addr := range s.sentinels() {
+		if c, err = s.Dial(addr); err != nil {
+			continue
+		}
+		if i > 0 {
+			s.promote(addr)
+		}
+		return
+	}
+	return
+}
+
+// sentinels returns the sentinel addresses, the last one that answered
+// first.
+func (s *Sentinel) sentinels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.addrs == nil {
+		s.addrs = append([]string(nil), s.Addrs...)
+	}
+	return append([]string(nil), s.addrs...)
+}
+
+// promote moves addr to the front of the sentinel list.
+func (s *Sentinel) promote(addr string) {
+	s.mu.Lock()
+	for i, a := range s.addrs {
+		if a == addr {
+			copy(s.addrs[1:i+1], s.addrs[:i])
+			s.addrs[0] = addr
+			break
+		}
+	}
+	s.mu.Unlock()
+}
+
+// Watch subscribes to the master and replica events of a sentinel and calls
+// fn for every event concerning MasterName. Watch reconnects to the next
+// sentinel with backoff when the subscription is lost and returns when ctx
+// is done.
+func (s *Sentinel) Watch(ctx context.Context, fn func(SentinelEvent)) {
+	sub := &Subscriber{Dial: s.dial}
+	defer sub.Close()
+	for _, channel := range _sentinelChannels {
+		sub.Subscribe(channel, func(m redis.Message) {
+			if e := (SentinelEvent{Channel: m.Channel, Fields: strings.Fields(string(m.Data))}); s.concerns(e) {
+				fn(e)
+			}
+		})
+	}
+	<-ctx.Done()
+}
+
+// concerns reports whether e is about MasterName. Payloads are either
+// "<master-name> ..." for +switch-master or "<type> <name> <ip> <port>
+// [@ <master-name> <master-ip> <master-port>]" for the other events.
+func (s *Sentinel) concerns(e SentinelEvent) bool {
+	if e.Channel == "+switch-master" {
+		return len(e.Fields) > 0 && e.Fields[0] == s.MasterName
+	}
+	if len(e.Fields) >= 6 && e.Fields[4] == "@" {
+		return e.Fields[5] == s.MasterName
+	}
+	return len(e.Fields) >= 2 && e.Fields[0] == "master" && e.Fields[1] == s.MasterName
+}
@@ -0,0 +1,317 @@
+package redisx
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/net/netutil"
+)
+
+// ErrSubscriberClosed is returned when subscribing on a closed Subscriber.
+var ErrSubscriberClosed = errors.New("redisx: subscriber closed")
+
+// DefaultBackoff is the delay between the reconnections of Subscriber, from
+// 100ms up to 10s.
+var DefaultBackoff netutil.Backoff = &netutil.BackoffConfig{
+	MaxDelay:  10 * time.Second,
+	BaseDelay: 100 * time.Millisecond,
+	Factor:    1.6,
+	Jitter:    0.2,
+}
+
+// _subscriberPing is the interval of liveness pings on the subscription.
+const _subscriberPing = 5 * time.Second
+
+// Subscriber is a pub/sub subscription which survives connection failures.
+// It keeps the set of subscribed channels and patterns, reconnects with
+// backoff when the connection is lost, subscribes everything again and
+// dispatches the messages to the handlers.
+//
+// The connection is only open while there are subscriptions. Messages
+// published while it is down are lost.
+type Subscriber struct {
+	// Dial connects to the server. The connection must support
+	// ConnWithTimeout for the liveness check.
+	Dial func() (redis.Conn, error)
+
+	// Workers bounds the number of handlers running concurrently. When zero,
+	// the messages are handled one at a time in order.
+	Workers int
+
+	// Backoff is the delay between reconnections, DefaultBackoff when nil.
+	Backoff netutil.Backoff
+
+	// OnError is called with the connection errors and the panics of the
+	// handlers, nil to ignore them.
+	OnError func(err error)
+
+	// OnReconnect is called when the subscriptions are made again after a
+	// connection failure, the messages published meanwhile were lost. It
+	// may be nil.
+	OnReconnect func()
+
+	once sync.Once
+	sem  chan struct{} // limits the running handlers
+	done chan struct{} // closed by Close
+	wg   sync.WaitGroup
+
+	mu       sync.Mutex
+	cond     *sync.Cond // signaled when subscribing or closing
+	channels map[string]func(redis.Message)
+	patterns map[string]func(redis.Message)
+	conn     redis.Conn // current connection, nil while disconnected
+	closed   bool
+}
+
+func (s *Subscriber) init() {
+	s.once.Do(func() {
+		workers := s.Workers
+		if workers <= 0 {
+			workers = 1
+		}
+		if s.Backoff == nil {
+			s.Backoff = DefaultBackoff
+		}
+		s.sem = make(chan struct{}, workers)
+		s.done = make(chan struct{})
+		s.cond = sync.NewCond(&s.mu)
+		s.channels = make(map[string]func(redis.Message))
+		s.patterns = make(map[string]func(redis.Message))
+		s.wg.Add(1)
+		go s.run()
+	})
+}
+
+// Subscribe calls h with the messages published to channel, replacing the
+// previous handler of channel.
+func (s *Subscriber) Subscribe(channel string, h func(redis.Message)) error {
+	return s.subscribe("SUBSCRIBE", channel, h)
+}
+
+// PSubscribe calls h with the messages published to the channels matching
+// pattern, replacing the previous handler of pattern.
+func (s *Subscriber) PSubscribe(pattern string, h func(redis.Message)) error {
+	return s.subscribe("PSUBSCRIBE", pattern, h)
+}
+
+// Unsubscribe stops the subscription to channel.
+func (s *Subscriber) Unsubscribe(channel string) error {
+	return s.unsubscribe("UNSUBSCRIBE", channel)
+}
+
+// PUnsubscribe stops the subscription to pattern.
+func (s *Subscriber) PUnsubscribe(pattern string) error {
+	return s.unsubscribe("PUNSUBSCRIBE", pattern)
+}
+
+func (s *Subscriber) subscribe(cmd, name string, h func(redis.Message)) error {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+	handlers := s.channels
+	if cmd == "PSUBSCRIBE" {
+		handlers = s.patterns
+	}
+	_, ok := handlers[name]
+	handlers[name] = h
+	if !ok {
+		s.send(cmd, name)
+		s.cond.Signal()
+	}
+	return nil
+}
+
+func (s *Subscriber) unsubscribe(cmd, name string) error {
+	s.init()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSubscriberClosed
+	}
+	handlers := s.channels
+	if cmd == "PUNSUBSCRIBE" {
+		handlers = s.patterns
+	}
+	if _, ok := handlers[name]; !ok {
+		return nil
+	}
+	delete(handlers, name)
+	if len(s.channels)+len(s.patterns) == 0 && s.conn != nil {
+		// the connection is dialed again by the next subscription
+		s.conn.Close()
+		return nil
+	}
+	s.send(cmd, name)
+	return nil
+}
+
+// send writes a command on the current connection, with mu held. Errors are
+// left to the receiving side which reconnects.
+func (s *Subscriber) send(cmd string, args ...interface{}) {
+	if s.conn != nil {
+		s.conn.Send(cmd, args...)
+		s.conn.Flush()
+	}
+}
+
+// Close closes the connection and waits for the running handlers. It must
+// not be called from a handler.
+func (s *Subscriber) Close() error {
+	s.init()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Subscriber) run() {
+	defer s.wg.Done()
+	for retries := 0; ; retries++ {
+		if !s.wait() {
+			return
+		}
+		err := s.serve(&retries)
+		s.mu.Lock()
+		closed, idle := s.closed, len(s.channels)+len(s.patterns) == 0
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+		if idle {
+			retries = -1
+			continue
+		}
+		s.error(err)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.Backoff.Backoff(retries)):
+		}
+	}
+}
+
+// wait waits for a subscription, it returns false when s is closed.
+func (s *Subscriber) wait() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed && len(s.channels)+len(s.patterns) == 0 {
+		s.cond.Wait()
+	}
+	return !s.closed
+}
+
+// serve subscribes a new connection and receives its messages until it
+// fails.
+func (s *Subscriber) serve(retries *int) error {
+	c, err := s.Dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSubscriberClosed
+	}
+	s.conn = c
+	for channel := range s.channels {
+		c.Send("SUBSCRIBE", channel)
+	}
+	for pattern := range s.patterns {
+		c.Send("PSUBSCRIBE", pattern)
+	}
+	err = c.Flush()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(stop)
+	psc := redis.PubSubConn{Conn: c}
+	for {
+		switch v := psc.ReceiveWithTimeout(3 * _subscriberPing).(type) {
+		case redis.Subscription:
+			if *retries > 0 && s.OnReconnect != nil {
+				s.OnReconnect()
+			}
+			*retries = 0
+		case redis.Message:
+			s.dispatch(v)
+		case error:
+			return v
+		}
+	}
+}
+
+// ping checks the liveness of the connection until stop is closed.
+func (s *Subscriber) ping(stop chan struct{}) {
+	ticker := time.NewTicker(_subscriberPing)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			// NOTE: PING replies a status outside of the subscribed mode.
+			if len(s.channels)+len(s.patterns) > 0 {
+				s.send("PING", "")
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// dispatch runs the handler of m, waiting for a worker.
+func (s *Subscriber) dispatch(m redis.Message) {
+	s.mu.Lock()
+	h := s.channels[m.Channel]
+	if m.Pattern != "" {
+		h = s.patterns[m.Pattern]
+	}
+	s.mu.Unlock()
+	if h == nil {
+		return
+	}
+	s.sem <- struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.error(fmt.Errorf("redisx: subscriber handler of %s panic: %v", m.Channel, r))
+			}
+			<-s.sem
+			s.wg.Done()
+		}()
+		h(m)
+	}()
+}
+
+func (s *Subscriber) error(err error) {
+	if s.OnError != nil && err != nil {
+		s.OnError(err)
+	}
+}
@@ -0,0 +1,181 @@
+package redisx_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redisx"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+	"github.com/Darker-D/ddbase/net/netutil"
+)
+
+// dropDialer dials s and can drop the last connection.
+type dropDialer struct {
+	s     *redistest.Server
+	mu    sync.Mutex
+	conn  redis.Conn
+	dials int
+}
+
+func (d *dropDialer) dial() (redis.Conn, error) {
+	c, err := redis.Dial("tcp", d.s.Addr())
+	if err == nil {
+		d.mu.Lock()
+		d.conn = c
+		d.dials++
+		d.mu.Unlock()
+	}
+	return c, err
+}
+
+func (d *dropDialer) drop() {
+	d.mu.Lock()
+	d.conn.Close()
+	d.mu.Unlock()
+}
+
+// publish publishes msg on channel until a subscriber receives want. The
+// duplicates of the previous messages are skipped.
+func publish(t *testing.T, s *redistest.Server, channel, msg, want string, got chan string) {
+	t.Helper()
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := c.Do("PUBLISH", channel, msg); err != nil {
+			t.Fatal(err)
+		}
+		timeout := time.After(10 * time.Millisecond)
+	wait:
+		for {
+			select {
+			case v := <-got:
+				if v == want {
+					return
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+	}
+	t.Fatalf("message %q not received", want)
+}
+
+func TestSubscriber(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	d := &dropDialer{s: s}
+	errs := make(chan error, 10)
+	reconnects := make(chan struct{}, 10)
+	sub := &redisx.Subscriber{
+		Dial:    d.dial,
+		Backoff: &netutil.BackoffConfig{MaxDelay: 10 * time.Millisecond, BaseDelay: time.Millisecond, Factor: 1.6},
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+		OnReconnect: func() { reconnects <- struct{}{} },
+	}
+	defer sub.Close()
+
+	got := make(chan string, 100)
+	if err := sub.Subscribe("news", func(m redis.Message) { got <- string(m.Data) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.PSubscribe("log.*", func(m redis.Message) { got <- m.Channel + ":" + string(m.Data) }); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, s, "news", "a", "a", got)
+	publish(t, s, "log.x", "b", "log.x:b", got)
+
+	// the subscriptions are restored on a new connection
+	d.drop()
+	publish(t, s, "news", "c", "c", got)
+	publish(t, s, "log.y", "d", "log.y:d", got)
+	d.mu.Lock()
+	dials := d.dials
+	d.mu.Unlock()
+	if dials != 2 {
+		t.Fatalf("got %d dials, want 2", dials)
+	}
+	if n := len(reconnects); n != 1 {
+		t.Fatalf("got %d reconnects, want 1", n)
+	}
+	if err := <-errs; err == nil {
+		t.Fatal("want connection error")
+	}
+
+	// a panic is reported and the next messages are handled
+	sub.Subscribe("panic", func(m redis.Message) {
+		if string(m.Data) == "boom" {
+			panic("boom")
+		}
+		got <- string(m.Data)
+	})
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for {
+		n, _ := redis.Int(c.Do("PUBLISH", "panic", "boom"))
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("want panic error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic not reported")
+	}
+	publish(t, s, "panic", "e", "e", got)
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Subscribe("news", func(redis.Message) {}); err != redisx.ErrSubscriberClosed {
+		t.Fatalf("got %v, want ErrSubscriberClosed", err)
+	}
+}
+
+func TestSubscriberUnsubscribe(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	d := &dropDialer{s: s}
+	sub := &redisx.Subscriber{Dial: d.dial}
+	defer sub.Close()
+
+	got := make(chan string, 100)
+	sub.Subscribe("a", func(m redis.Message) { got <- string(m.Data) })
+	publish(t, s, "a", "1", "1", got)
+	sub.Unsubscribe("a")
+	// the idle subscriber closes its connection and dials again on demand
+	sub.Subscribe("b", func(m redis.Message) { got <- string(m.Data) })
+	publish(t, s, "b", "2", "2", got)
+
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if n, err := redis.Int(c.Do("PUBLISH", "a", "3")); err != nil || n != 0 {
+		t.Fatalf("got %d receivers of a, %v, want 0", n, err)
+	}
+}
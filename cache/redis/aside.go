@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/ecode"
+	"github.com/Darker-D/ddbase/sync/singleflight"
+)
+
+// _asideNotFound marks a cached not found result, a gob stream never starts
+// with a zero byte.
+var _asideNotFound = []byte{0}
+
+// AsideConfig is the cache-aside config.
+type AsideConfig struct {
+	Expire         time.Duration // 缓存过期时间, 默认 5m
+	NotFoundExpire time.Duration // 空结果缓存时间, 默认 30s, 负数不缓存
+	Jitter         float64       // 过期时间随机浮动比例, 默认 0.1, 负数不浮动
+	EarlyRefresh   float64       // 剩余过期时间低于 Expire 的该比例时后台刷新, 0 不刷新
+}
+
+func (conf *AsideConfig) fix() *AsideConfig {
+	c := AsideConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	if c.Expire <= 0 {
+		c.Expire = 5 * time.Minute
+	}
+	if c.NotFoundExpire == 0 {
+		c.NotFoundExpire = 30 * time.Second
+	}
+	if c.Jitter == 0 {
+		c.Jitter = 0.1
+	}
+	return &c
+}
+
+// Aside caches the results of a loader in redis. Concurrent misses of a key
+// are collapsed into one load, and not found results are cached too.
+type Aside struct {
+	client *Client
+	conf   *AsideConfig
+	group  singleflight.Group
+}
+
+// NewAside new a cache-aside helper on client.
+func NewAside(client *Client, conf *AsideConfig) *Aside {
+	return &Aside{client: client, conf: conf.fix()}
+}
+
+// Fetch loads the cached value of key into val, calling load on a miss and
+// caching its result. A loader returning ecode.NothingFound is cached for
+// NotFoundExpire, during which Fetch returns ecode.NothingFound. Redis errors
+// are not returned, the value is loaded instead.
+func (a *Aside) Fetch(ctx context.Context, key string, val interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	reply, pttl, err := a.get(ctx, key)
+	if err == nil && reply != nil {
+		if bytes.Equal(reply, _asideNotFound) {
+			return ecode.NothingFound
+		}
+		if a.conf.EarlyRefresh > 0 && pttl >= 0 && float64(pttl) < a.conf.EarlyRefresh*float64(a.conf.Expire) {
+			a.group.DoChan(key, func() (interface{}, error) {
+				return a.load(context.Background(), key, load)
+			})
+		}
+		return a.client.decode(reply, val)
+	}
+	v, err, _ := a.group.Do(key, func() (interface{}, error) {
+		return a.load(ctx, key, load)
+	})
+	if err != nil {
+		return err
+	}
+	return a.client.decode(v, val)
+}
+
+// Delete deletes the cached value of key, call it after the source changes.
+func (a *Aside) Delete(ctx context.Context, key string) error {
+	return a.client.Delete(ctx, key)
+}
+
+// get <=> GET key; PTTL key
+func (a *Aside) get(ctx context.Context, key string) (reply []byte, pttl time.Duration, err error) {
+	conn, err := a.client.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Send("GET", key)
+	conn.Send("PTTL", key)
+	if err = conn.Flush(); err != nil {
+		return
+	}
+	reply, err = redis.Bytes(conn.Receive())
+	ms, perr := redis.Int64(conn.Receive())
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+		return
+	}
+	if err = perr; err != nil {
+		return
+	}
+	if ms < 0 {
+		return reply, -1, nil
+	}
+	return reply, time.Duration(ms) * time.Millisecond, nil
+}
+
+// load calls the loader and caches its result, the encoded value is
+// returned so that it can be decoded by every collapsed caller.
+func (a *Aside) load(ctx context.Context, key string, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	v, err := load(ctx)
+	if ecode.EqualError(ecode.NothingFound, err) {
+		if a.conf.NotFoundExpire > 0 {
+			a.set(ctx, key, _asideNotFound, a.conf.NotFoundExpire)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := a.client.encodeBytes(v)
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: the cache is best effort, the loaded value is returned even if
+	// it could not be cached.
+	a.set(ctx, key, b, a.expire())
+	return b, nil
+}
+
+// set <=> SET key value PX expire
+func (a *Aside) set(ctx context.Context, key string, value []byte, expire time.Duration) error {
+	conn, err := a.client.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do("SET", key, value, "PX", int64(expire/time.Millisecond))
+	return err
+}
+
+// expire returns Expire with a random jitter so that keys cached together do
+// not expire together.
+func (a *Aside) expire() time.Duration {
+	d := a.conf.Expire
+	if a.conf.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * a.conf.Jitter * float64(d))
+	}
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d
+}
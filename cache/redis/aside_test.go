@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/ecode"
+)
+
+type asideUser struct {
+	ID   int64
+	Name string
+}
+
+func TestAside(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 10})
+	defer client.Close()
+	aside := NewAside(client, &AsideConfig{Expire: time.Minute})
+	ctx := context.Background()
+
+	var loads int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return &asideUser{ID: 1, Name: "foo"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var u asideUser
+			if err := aside.Fetch(ctx, "user:1", &u, load); err != nil || u.Name != "foo" {
+				t.Errorf("Fetch = %+v, %v", u, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("loaded %d times, want 1", n)
+	}
+	var u asideUser
+	if err := aside.Fetch(ctx, "user:1", &u, load); err != nil || u.ID != 1 || loads != 1 {
+		t.Fatalf("cached Fetch = %+v, %v, loads %d", u, err, loads)
+	}
+
+	var n int64
+	count := func(ctx context.Context) (interface{}, error) { return int64(42), nil }
+	if err := aside.Fetch(ctx, "count", &n, count); err != nil || n != 42 {
+		t.Fatalf("Fetch(count) = %d, %v", n, err)
+	}
+	n = 0
+	if err := aside.Fetch(ctx, "count", &n, nil); err != nil || n != 42 {
+		t.Fatalf("cached Fetch(count) = %d, %v", n, err)
+	}
+}
+
+func TestAsideNotFound(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1})
+	defer client.Close()
+	aside := NewAside(client, nil)
+	ctx := context.Background()
+
+	var loads int
+	load := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return nil, ecode.NothingFound
+	}
+	var u asideUser
+	for i := 0; i < 2; i++ {
+		if err := aside.Fetch(ctx, "user:2", &u, load); !ecode.EqualError(ecode.NothingFound, err) {
+			t.Fatalf("Fetch error(%v)", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loaded %d times, want 1", loads)
+	}
+	if err := aside.Delete(ctx, "user:2"); err != nil {
+		t.Fatal(err)
+	}
+	aside.Fetch(ctx, "user:2", &u, load)
+	if loads != 2 {
+		t.Fatalf("loaded %d times after Delete, want 2", loads)
+	}
+}
+
+func TestAsideEarlyRefresh(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	aside := NewAside(client, &AsideConfig{Expire: time.Second, Jitter: -1, EarlyRefresh: 0.5})
+	ctx := context.Background()
+
+	var version int64
+	load := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt64(&version, 1), nil
+	}
+	var v int64
+	if err := aside.Fetch(ctx, "v", &v, load); err != nil || v != 1 {
+		t.Fatalf("Fetch = %d, %v", v, err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	// the stale value is served while it is refreshed in background.
+	if err := aside.Fetch(ctx, "v", &v, load); err != nil || v != 1 {
+		t.Fatalf("Fetch = %d, %v", v, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := aside.Fetch(ctx, "v", &v, load); err != nil || v != 2 {
+		t.Fatalf("refreshed Fetch = %d, %v", v, err)
+	}
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+// SetBit <=> SETBIT key offset value, returns the previous bit.
+func (c *Client) SetBit(ctx context.Context, key string, offset int64, value bool) (old bool, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	bit := 0
+	if value {
+		bit = 1
+	}
+	return redis.Bool(conn.Do("SETBIT", key, offset, bit))
+}
+
+// GetBit <=> GETBIT key offset
+func (c *Client) GetBit(ctx context.Context, key string, offset int64) (bit bool, err error) {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	return redis.Bool(conn.Do("GETBIT", key, offset))
+}
+
+// BitCount <=> BITCOUNT key
+func (c *Client) BitCount(ctx context.Context, key string) (count int64, err error) {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("BITCOUNT", key))
+}
+
+// BitCountRange <=> BITCOUNT key start end, start and end are byte offsets
+// and may be negative.
+func (c *Client) BitCountRange(ctx context.Context, key string, start, end int64) (count int64, err error) {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	return redis.Int64(conn.Do("BITCOUNT", key, start, end))
+}
+
+// BitFieldOp is a subcommand of BITFIELD.
+type BitFieldOp []interface{}
+
+// BitFieldGet <=> GET typ offset, typ is i<bits> or u<bits> such as u8.
+func BitFieldGet(typ string, offset int64) BitFieldOp {
+	return BitFieldOp{"GET", typ, offset}
+}
+
+// BitFieldSet <=> SET typ offset value, replies the previous value.
+func BitFieldSet(typ string, offset int64, value int64) BitFieldOp {
+	return BitFieldOp{"SET", typ, offset, value}
+}
+
+// BitFieldIncrBy <=> INCRBY typ offset increment, replies the new value.
+func BitFieldIncrBy(typ string, offset int64, increment int64) BitFieldOp {
+	return BitFieldOp{"INCRBY", typ, offset, increment}
+}
+
+// BitFieldOverflow <=> OVERFLOW WRAP|SAT|FAIL, applies to the following
+// SET and INCRBY.
+func BitFieldOverflow(mode string) BitFieldOp {
+	return BitFieldOp{"OVERFLOW", mode}
+}
+
+// BitField <=> BITFIELD key op [op ...], returns a value per GET, SET and
+// INCRBY. A SET or INCRBY failed by OVERFLOW FAIL returns 0 and false in ok.
+func (c *Client) BitField(ctx context.Context, key string, ops ...BitFieldOp) (values []int64, ok []bool, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := []interface{}{key}
+	for _, op := range ops {
+		args = append(args, op...)
+	}
+	replies, err := redis.Values(conn.Do("BITFIELD", args...))
+	if err != nil {
+		return
+	}
+	values = make([]int64, len(replies))
+	ok = make([]bool, len(replies))
+	for i, r := range replies {
+		if r == nil {
+			continue
+		}
+		if values[i], err = redis.Int64(r, nil); err != nil {
+			return nil, nil, err
+		}
+		ok[i] = true
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBitField(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := New(&Config{Network: "tcp", Address: s.Addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	if old, err := c.SetBit(ctx, "checkin", 7, true); err != nil || old {
+		t.Fatalf("SetBit = %v, %v", old, err)
+	}
+	if old, err := c.SetBit(ctx, "checkin", 7, true); err != nil || !old {
+		t.Fatalf("SetBit again = %v, %v", old, err)
+	}
+	if bit, err := c.GetBit(ctx, "checkin", 7); err != nil || !bit {
+		t.Fatalf("GetBit = %v, %v", bit, err)
+	}
+	if bit, err := c.GetBit(ctx, "checkin", 6); err != nil || bit {
+		t.Fatalf("GetBit(6) = %v, %v", bit, err)
+	}
+	c.SetBit(ctx, "checkin", 9, true)
+	if n, err := c.BitCount(ctx, "checkin"); err != nil || n != 2 {
+		t.Fatalf("BitCount = %d, %v", n, err)
+	}
+	if n, err := c.BitCountRange(ctx, "checkin", -1, -1); err != nil || n != 1 {
+		t.Fatalf("BitCountRange = %d, %v", n, err)
+	}
+
+	values, ok, err := c.BitField(ctx, "counters",
+		BitFieldGet("u8", 0),
+		BitFieldSet("u8", 8, 255),
+		BitFieldOverflow("FAIL"),
+		BitFieldIncrBy("u8", 8, 1))
+	if err != nil || !reflect.DeepEqual(values, []int64{0, 0, 0}) || !reflect.DeepEqual(ok, []bool{true, true, false}) {
+		t.Fatalf("BitField = %v, %v, %v", values, ok, err)
+	}
+	values, ok, err = c.BitField(ctx, "counters", BitFieldIncrBy("u8", 8, 1))
+	if err != nil || !reflect.DeepEqual(values, []int64{0}) || !reflect.DeepEqual(ok, []bool{true}) {
+		t.Fatalf("BitField(wrap) = %v, %v, %v", values, ok, err)
+	}
+}
@@ -0,0 +1,676 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+const (
+	_clusterSlots        = 16384
+	_clusterMaxRedirects = 5
+	_clusterRetryDelay   = 10 * time.Millisecond
+)
+
+var (
+	errClusterNoNodes   = errors.New("redis: cluster has no reachable nodes")
+	errClusterClosed    = errors.New("redis: cluster connection closed")
+	errClusterUnderflow = errors.New("redis: cluster connection receive underflow")
+)
+
+// _clusterKeyless commands carry no key and may be sent to any node.
+var _clusterKeyless = map[string]bool{
+	"PING":      true,
+	"ECHO":      true,
+	"INFO":      true,
+	"TIME":      true,
+	"KEYS":      true,
+	"SCAN":      true,
+	"DBSIZE":    true,
+	"SCRIPT":    true,
+	"CLUSTER":   true,
+	"PUBLISH":   true,
+	"RANDOMKEY": true,
+}
+
+// cluster routes commands to redis cluster nodes by key hash slot.
+type cluster struct {
+	conf  *Config
+	seeds []string
+
+	mu    sync.RWMutex
+	slots [_clusterSlots]string  // slot -> master address
+	pools map[string]*redis.Pool // address -> pool
+	nodes []string               // master addresses
+	shut  bool
+
+	reloading int32
+}
+
+func newCluster(c *Config) *cluster {
+	seeds := c.Addrs
+	if len(seeds) == 0 {
+		seeds = []string{c.Address}
+	}
+	cl := &cluster{
+		conf:  c,
+		seeds: seeds,
+		pools: make(map[string]*redis.Pool),
+	}
+	// NOTE: nodes may be unreachable at startup, slots are reloaded lazily.
+	cl.reload()
+	return cl
+}
+
+// GetContext gets a connection which routes every command by its key.
+func (c *cluster) GetContext(ctx context.Context) (redis.Conn, error) {
+	c.mu.RLock()
+	shut := c.shut
+	c.mu.RUnlock()
+	if shut {
+		return nil, errClusterClosed
+	}
+	return &clusterConn{c: c, ctx: ctx}, nil
+}
+
+// Close closes all node pools.
+func (c *cluster) Close() error {
+	c.mu.Lock()
+	c.shut = true
+	pools := c.pools
+	c.pools = make(map[string]*redis.Pool)
+	c.mu.Unlock()
+	for _, p := range pools {
+		p.Close()
+	}
+	return nil
+}
+
+// Pools returns the pools of the known nodes.
+func (c *cluster) Pools() []*redis.Pool {
+	c.mu.RLock()
+	pools := make([]*redis.Pool, 0, len(c.pools))
+	for _, p := range c.pools {
+		pools = append(pools, p)
+	}
+	c.mu.RUnlock()
+	return pools
+}
+
+// Masters returns the addresses of all known master nodes.
+func (c *cluster) Masters() []string {
+	c.mu.RLock()
+	nodes := make([]string, len(c.nodes))
+	copy(nodes, c.nodes)
+	c.mu.RUnlock()
+	return nodes
+}
+
+// pool get or create the pool of node addr.
+func (c *cluster) pool(addr string) *redis.Pool {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+	c.mu.Lock()
+	if p, ok = c.pools[addr]; !ok {
+		p = newPool(c.conf, addr)
+		c.pools[addr] = p
+	}
+	c.mu.Unlock()
+	return p
+}
+
+// addr returns the node which serves slot, a random node if unknown.
+func (c *cluster) addr(slot int) (addr string, err error) {
+	if addr = c.lookup(slot); addr != "" {
+		return
+	}
+	if err = c.reload(); err != nil {
+		return
+	}
+	if addr = c.lookup(slot); addr == "" {
+		err = errClusterNoNodes
+	}
+	return
+}
+
+func (c *cluster) lookup(slot int) (addr string) {
+	c.mu.RLock()
+	if slot >= 0 {
+		addr = c.slots[slot]
+	}
+	if addr == "" && len(c.nodes) > 0 {
+		addr = c.nodes[rand.Intn(len(c.nodes))]
+	}
+	c.mu.RUnlock()
+	return
+}
+
+// reload fetches the slot map from the first node which answers CLUSTER SLOTS.
+func (c *cluster) reload() (err error) {
+	addrs := append(c.Masters(), c.seeds...)
+	err = errClusterNoNodes
+	for _, addr := range addrs {
+		var reply []interface{}
+		if reply, err = c.clusterSlots(addr); err != nil {
+			continue
+		}
+		var slots [_clusterSlots]string
+		var nodes []string
+		if nodes, err = parseClusterSlots(reply, addr, &slots); err != nil {
+			continue
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.nodes = nodes
+		c.mu.Unlock()
+		return nil
+	}
+	return
+}
+
+// reloadAsync reloads the slot map in background, once at a time.
+func (c *cluster) reloadAsync() {
+	if !atomic.CompareAndSwapInt32(&c.reloading, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.reloading, 0)
+		c.reload()
+	}()
+}
+
+func (c *cluster) clusterSlots(addr string) (reply []interface{}, err error) {
+	conn := c.pool(addr).Get()
+	defer conn.Close()
+	return redis.Values(conn.Do("CLUSTER", "SLOTS"))
+}
+
+// moved records the new owner of slot after a MOVED redirect.
+func (c *cluster) moved(slot int, addr string) {
+	c.mu.Lock()
+	c.slots[slot] = addr
+	c.mu.Unlock()
+	c.reloadAsync()
+}
+
+// do executes a single command and follows MOVED/ASK redirects.
+func (c *cluster) do(ctx context.Context, cmd string, args []interface{}) (reply interface{}, err error) {
+	return c.doTimeout(ctx, 0, cmd, args)
+}
+
+// doTimeout is do with a read timeout, 0 uses Config.ReadTimeout.
+func (c *cluster) doTimeout(ctx context.Context, timeout time.Duration, cmd string, args []interface{}) (reply interface{}, err error) {
+	slot := -1
+	if key, ok := clusterKey(cmd, args); ok {
+		slot = hashSlot(key)
+	}
+	addr, err := c.addr(slot)
+	if err != nil {
+		return
+	}
+	asking := false
+	for i := 0; i <= _clusterMaxRedirects; i++ {
+		if reply, err = c.doNode(ctx, addr, asking, timeout, cmd, args); err == nil {
+			return
+		}
+		e, ok := err.(redis.Error)
+		if !ok {
+			if _, ok = err.(net.Error); ok {
+				c.reloadAsync()
+			}
+			return
+		}
+		kind, s, to := parseRedirect(e)
+		switch kind {
+		case "MOVED":
+			c.moved(s, to)
+			addr, asking = to, false
+		case "ASK":
+			addr, asking = to, true
+		case "TRYAGAIN", "CLUSTERDOWN":
+			time.Sleep(_clusterRetryDelay)
+		default:
+			return
+		}
+	}
+	return
+}
+
+func (c *cluster) doNode(ctx context.Context, addr string, asking bool, timeout time.Duration, cmd string, args []interface{}) (reply interface{}, err error) {
+	conn, err := c.pool(addr).GetContext(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if asking {
+		if err = conn.Send("ASKING"); err != nil {
+			return
+		}
+	}
+	if timeout > 0 {
+		return redis.DoWithTimeout(conn, timeout, cmd, args...)
+	}
+	return conn.Do(cmd, args...)
+}
+
+// clusterCmd is a pipelined command and its result.
+type clusterCmd struct {
+	name  string
+	args  []interface{}
+	reply interface{}
+	err   error
+}
+
+// pipeline executes cmds grouped by node, one round trip per node. Commands
+// that are redirected are retried one by one.
+func (c *cluster) pipeline(ctx context.Context, cmds []*clusterCmd) {
+	groups := make(map[string][]*clusterCmd)
+	for _, cmd := range cmds {
+		slot := -1
+		if key, ok := clusterKey(cmd.name, cmd.args); ok {
+			slot = hashSlot(key)
+		}
+		addr, err := c.addr(slot)
+		if err != nil {
+			cmd.err = err
+			continue
+		}
+		groups[addr] = append(groups[addr], cmd)
+	}
+	for addr, group := range groups {
+		c.pipelineNode(ctx, addr, group)
+	}
+	for _, cmd := range cmds {
+		if e, ok := cmd.err.(redis.Error); ok {
+			if kind, _, _ := parseRedirect(e); kind != "" {
+				cmd.reply, cmd.err = c.do(ctx, cmd.name, cmd.args)
+			}
+		}
+	}
+}
+
+func (c *cluster) pipelineNode(ctx context.Context, addr string, cmds []*clusterCmd) {
+	conn, err := c.pool(addr).GetContext(ctx)
+	if err == nil {
+		defer conn.Close()
+		for _, cmd := range cmds {
+			if err = conn.Send(cmd.name, cmd.args...); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = conn.Flush()
+	}
+	if err != nil {
+		for _, cmd := range cmds {
+			cmd.err = err
+		}
+		return
+	}
+	for _, cmd := range cmds {
+		cmd.reply, cmd.err = conn.Receive()
+	}
+}
+
+// doMulti splits a multi-key command into one command per slot and merges
+// the replies.
+func (c *cluster) doMulti(ctx context.Context, cmd string, args []interface{}) (interface{}, error) {
+	step := 1
+	if cmd == "MSET" {
+		step = 2
+	}
+	if len(args)%step != 0 {
+		return nil, fmt.Errorf("redis: wrong number of arguments for %s", cmd)
+	}
+	var (
+		cmds   []*clusterCmd
+		idxs   [][]int // positions of each key in args
+		bySlot = make(map[int]int)
+	)
+	for i := 0; i < len(args); i += step {
+		slot := hashSlot(keyString(args[i]))
+		n, ok := bySlot[slot]
+		if !ok {
+			n = len(cmds)
+			bySlot[slot] = n
+			cmds = append(cmds, &clusterCmd{name: cmd})
+			idxs = append(idxs, nil)
+		}
+		cmds[n].args = append(cmds[n].args, args[i:i+step]...)
+		idxs[n] = append(idxs[n], i/step)
+	}
+	if len(cmds) == 1 {
+		return c.do(ctx, cmd, args)
+	}
+	c.pipeline(ctx, cmds)
+	for _, sub := range cmds {
+		if sub.err != nil {
+			return nil, sub.err
+		}
+	}
+	switch cmd {
+	case "MGET":
+		values := make([]interface{}, len(args))
+		for n, sub := range cmds {
+			vs, err := redis.Values(sub.reply, nil)
+			if err != nil {
+				return nil, err
+			}
+			for j, v := range vs {
+				values[idxs[n][j]] = v
+			}
+		}
+		return values, nil
+	case "MSET":
+		return "OK", nil
+	default:
+		var sum int64
+		for _, sub := range cmds {
+			n, err := redis.Int64(sub.reply, nil)
+			if err != nil {
+				return nil, err
+			}
+			sum += n
+		}
+		return sum, nil
+	}
+}
+
+// _clusterMultiKey commands are split per slot by clusterConn.
+var _clusterMultiKey = map[string]bool{
+	"MGET":   true,
+	"MSET":   true,
+	"DEL":    true,
+	"UNLINK": true,
+	"EXISTS": true,
+	"TOUCH":  true,
+}
+
+// clusterConn implements redis.Conn on top of cluster. Commands which keep
+// server side state on the connection (MULTI, WATCH, SUBSCRIBE...) are not
+// supported.
+type clusterConn struct {
+	c       *cluster
+	ctx     context.Context
+	closed  bool
+	pending []*clusterCmd
+	replies []*clusterCmd
+}
+
+func (cc *clusterConn) Close() error {
+	cc.closed = true
+	cc.pending, cc.replies = nil, nil
+	return nil
+}
+
+func (cc *clusterConn) Err() error {
+	if cc.closed {
+		return errClusterClosed
+	}
+	return nil
+}
+
+func (cc *clusterConn) Do(cmd string, args ...interface{}) (reply interface{}, err error) {
+	if cc.closed {
+		return nil, errClusterClosed
+	}
+	if cmd == "" {
+		if err = cc.Flush(); err != nil {
+			return
+		}
+		values := make([]interface{}, len(cc.replies))
+		for i, r := range cc.replies {
+			values[i] = r.reply
+			if r.err != nil {
+				values[i] = r.err
+			}
+		}
+		cc.replies = nil
+		return values, nil
+	}
+	if err = cc.Flush(); err != nil {
+		return
+	}
+	cc.replies = nil
+	cmd = strings.ToUpper(cmd)
+	if _clusterMultiKey[cmd] && len(args) > 1 {
+		return cc.c.doMulti(cc.ctx, cmd, args)
+	}
+	return cc.c.do(cc.ctx, cmd, args)
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout for blocking commands.
+func (cc *clusterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (reply interface{}, err error) {
+	if cc.closed {
+		return nil, errClusterClosed
+	}
+	if cmd == "" {
+		return cc.Do("")
+	}
+	if err = cc.Flush(); err != nil {
+		return
+	}
+	cc.replies = nil
+	return cc.c.doTimeout(cc.ctx, timeout, strings.ToUpper(cmd), args)
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout, replies are read on
+// Flush so the timeout does not apply.
+func (cc *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return cc.Receive()
+}
+
+func (cc *clusterConn) Send(cmd string, args ...interface{}) error {
+	if cc.closed {
+		return errClusterClosed
+	}
+	cc.pending = append(cc.pending, &clusterCmd{name: strings.ToUpper(cmd), args: args})
+	return nil
+}
+
+func (cc *clusterConn) Flush() error {
+	if cc.closed {
+		return errClusterClosed
+	}
+	if len(cc.pending) == 0 {
+		return nil
+	}
+	pending := cc.pending
+	cc.pending = nil
+	var single []*clusterCmd
+	for _, cmd := range pending {
+		if _clusterMultiKey[cmd.name] && len(cmd.args) > 1 {
+			cmd.reply, cmd.err = cc.c.doMulti(cc.ctx, cmd.name, cmd.args)
+			continue
+		}
+		single = append(single, cmd)
+	}
+	cc.c.pipeline(cc.ctx, single)
+	cc.replies = append(cc.replies, pending...)
+	return nil
+}
+
+func (cc *clusterConn) Receive() (reply interface{}, err error) {
+	if cc.closed {
+		return nil, errClusterClosed
+	}
+	if len(cc.replies) == 0 {
+		if err = cc.Flush(); err != nil {
+			return
+		}
+	}
+	if len(cc.replies) == 0 {
+		return nil, errClusterUnderflow
+	}
+	r := cc.replies[0]
+	cc.replies = cc.replies[1:]
+	return r.reply, r.err
+}
+
+// clusterKey returns the key which decides the slot of the command.
+func clusterKey(cmd string, args []interface{}) (string, bool) {
+	cmd = strings.ToUpper(cmd)
+	if _clusterKeyless[cmd] {
+		return "", false
+	}
+	switch cmd {
+	case "EVAL", "EVALSHA":
+		if len(args) > 2 {
+			if n, err := strconv.Atoi(keyString(args[1])); err == nil && n > 0 {
+				return keyString(args[2]), true
+			}
+		}
+		return "", false
+	case "BITOP", "OBJECT", "MEMORY", "XINFO", "XGROUP":
+		if len(args) > 1 {
+			return keyString(args[1]), true
+		}
+		return "", false
+	case "XREAD", "XREADGROUP":
+		for i, arg := range args {
+			if strings.EqualFold(keyString(arg), "STREAMS") && i+1 < len(args) {
+				return keyString(args[i+1]), true
+			}
+		}
+		return "", false
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	return keyString(args[0]), true
+}
+
+func keyString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+// parseRedirect parses MOVED, ASK, TRYAGAIN and CLUSTERDOWN errors.
+func parseRedirect(e redis.Error) (kind string, slot int, addr string) {
+	fields := strings.Fields(string(e))
+	if len(fields) == 0 {
+		return
+	}
+	switch fields[0] {
+	case "MOVED", "ASK":
+		if len(fields) != 3 {
+			return
+		}
+		var err error
+		if slot, err = strconv.Atoi(fields[1]); err != nil || slot < 0 || slot >= _clusterSlots {
+			return "", 0, ""
+		}
+		return fields[0], slot, fields[2]
+	case "TRYAGAIN", "CLUSTERDOWN":
+		return fields[0], 0, ""
+	}
+	return
+}
+
+// parseClusterSlots fills slots from a CLUSTER SLOTS reply and returns the
+// master addresses. Nodes announcing an empty ip are reached via from.
+func parseClusterSlots(reply []interface{}, from string, slots *[_clusterSlots]string) (nodes []string, err error) {
+	fromHost, _, _ := net.SplitHostPort(from)
+	seen := make(map[string]bool)
+	for _, r := range reply {
+		var entry []interface{}
+		if entry, err = redis.Values(r, nil); err != nil {
+			return
+		}
+		if len(entry) < 3 {
+			return nil, errors.New("redis: malformed CLUSTER SLOTS reply")
+		}
+		var start, end int
+		if start, err = redis.Int(entry[0], nil); err != nil {
+			return
+		}
+		if end, err = redis.Int(entry[1], nil); err != nil {
+			return
+		}
+		if start < 0 || end >= _clusterSlots || start > end {
+			return nil, fmt.Errorf("redis: invalid slot range %d-%d", start, end)
+		}
+		var node []interface{}
+		if node, err = redis.Values(entry[2], nil); err != nil {
+			return
+		}
+		if len(node) < 2 {
+			return nil, errors.New("redis: malformed CLUSTER SLOTS node")
+		}
+		var (
+			host string
+			port int
+		)
+		if host, err = redis.String(node[0], nil); err != nil {
+			return
+		}
+		if port, err = redis.Int(node[1], nil); err != nil {
+			return
+		}
+		if host == "" {
+			host = fromHost
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		for s := start; s <= end; s++ {
+			slots[s] = addr
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			nodes = append(nodes, addr)
+		}
+	}
+	return
+}
+
+// hashSlot returns the cluster slot of key, honoring {hash tags}.
+func hashSlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key) % _clusterSlots)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) as required by redis cluster.
+func crc16(s string) (crc uint16) {
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ _crc16tab[byte(crc>>8)^s[i]]
+	}
+	return
+}
+
+var _crc16tab = func() (tab [256]uint16) {
+	for i := range tab {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		tab[i] = crc
+	}
+	return
+}()
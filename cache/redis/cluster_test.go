@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+func TestHashSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{"123456789", 0x31C3 % _clusterSlots},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"{user1000}.following", hashSlot("user1000")},
+		{"{user1000}.followers", hashSlot("user1000")},
+		{"foo{}{bar}", hashSlot("foo{}{bar}")},
+		{"foo{{bar}}zap", hashSlot("{bar")},
+	}
+	for _, tt := range tests {
+		if got := hashSlot(tt.key); got != tt.slot {
+			t.Errorf("hashSlot(%q) = %d, want %d", tt.key, got, tt.slot)
+		}
+	}
+}
+
+func TestClusterKey(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{"GET", []interface{}{"a"}, "a", true},
+		{"ping", nil, "", false},
+		{"EVALSHA", []interface{}{"sha", 1, "k", "v"}, "k", true},
+		{"EVAL", []interface{}{"src", 0}, "", false},
+		{"BITOP", []interface{}{"AND", "dest", "a"}, "dest", true},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c", "STREAMS", "s", ">"}, "s", true},
+	}
+	for _, tt := range tests {
+		key, ok := clusterKey(tt.cmd, tt.args)
+		if key != tt.key || ok != tt.ok {
+			t.Errorf("clusterKey(%s, %v) = %q, %v, want %q, %v", tt.cmd, tt.args, key, ok, tt.key, tt.ok)
+		}
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	kind, slot, addr := parseRedirect(redis.Error("MOVED 3999 127.0.0.1:6381"))
+	if kind != "MOVED" || slot != 3999 || addr != "127.0.0.1:6381" {
+		t.Errorf("got %s %d %s", kind, slot, addr)
+	}
+	kind, slot, addr = parseRedirect(redis.Error("ASK 1 10.0.0.1:7000"))
+	if kind != "ASK" || slot != 1 || addr != "10.0.0.1:7000" {
+		t.Errorf("got %s %d %s", kind, slot, addr)
+	}
+	if kind, _, _ = parseRedirect(redis.Error("ERR unknown command")); kind != "" {
+		t.Errorf("got %s", kind)
+	}
+}
+
+// newTestCluster starts two nodes splitting the slots in half. The first
+// node announces every slot on itself until reshard is called, so a client
+// which loaded the slot map before must follow the MOVED redirects.
+func newTestCluster(t *testing.T) (a, b *redistest.Server, reshard func()) {
+	a, b = newTestServer(t), newTestServer(t)
+	half := []redistest.Slots{
+		{Start: 0, End: _clusterSlots/2 - 1, Addr: a.Addr()},
+		{Start: _clusterSlots / 2, End: _clusterSlots - 1, Addr: b.Addr()},
+	}
+	a.SetCluster([]redistest.Slots{{Start: 0, End: _clusterSlots - 1, Addr: a.Addr()}})
+	b.SetCluster(half)
+	return a, b, func() { a.SetCluster(half) }
+}
+
+func TestCluster(t *testing.T) {
+	a, b, reshard := newTestCluster(t)
+	defer a.Close()
+	defer b.Close()
+
+	client := New(&Config{Network: "tcp", Cluster: true, Addrs: []string{a.Addr()}, MaxIdle: 2})
+	defer client.Close()
+	ctx := context.Background()
+	if ok, err := client.Exists(ctx, "foo"); err != nil || ok {
+		t.Fatalf("Exists(foo) = %v, %v", ok, err)
+	}
+	reshard()
+
+	// "foo" is served by b, "bar" by a.
+	keys := []string{"foo", "bar", "missing"}
+	for _, k := range keys[:2] {
+		if err := client.SetEx(ctx, k, k+"-value", 0); err != nil {
+			t.Fatalf("SetEx(%s) error(%v)", k, err)
+		}
+	}
+	if v, err := client.GetString(ctx, "foo"); err != nil || v != "foo-value" {
+		t.Fatalf("GetString(foo) = %q, %v", v, err)
+	}
+	values, err := client.MGetOrigin(ctx, keys)
+	if err != nil {
+		t.Fatalf("MGetOrigin error(%v)", err)
+	}
+	if len(values) != 3 || string(values[0].([]byte)) != "foo-value" || string(values[1].([]byte)) != "bar-value" || values[2] != nil {
+		t.Fatalf("MGetOrigin = %v", values)
+	}
+	found, err := client.MExists(ctx, keys)
+	if err != nil || !found[0] || !found[1] || found[2] {
+		t.Fatalf("MExists = %v, %v", found, err)
+	}
+	if err = client.MultiDelete(ctx, keys); err != nil {
+		t.Fatalf("MultiDelete error(%v)", err)
+	}
+	if ok, err := client.Exists(ctx, "foo"); err != nil || ok {
+		t.Fatalf("Exists(foo) = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Darker-D/ddbase/encoding/json"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ugorji/go/codec"
+)
+
+// Codecs of Load/Store values.
+const (
+	Gob     = "gob"
+	JSON    = "json"
+	Proto   = "proto"
+	Msgpack = "msgpack"
+)
+
+// Compressions of Load/Store values.
+const (
+	Snappy = "snappy"
+	Zstd   = "zstd"
+)
+
+// _codecMagic starts the header of encoded values. A gob stream starts with
+// a byte in [0x01, 0x7f] or [0xf8, 0xff] and integers are stored as decimal
+// text, so values written before codecs existed have no header.
+const _codecMagic = 0xcd
+
+// codec ids and compression ids share the header flags byte.
+const (
+	_codecGob     = 0x00
+	_codecJSON    = 0x01
+	_codecProto   = 0x02
+	_codecMsgpack = 0x03
+	_codecMask    = 0x0f
+
+	_compressNone   = 0x00
+	_compressSnappy = 0x10
+	_compressZstd   = 0x20
+	_compressMask   = 0xf0
+)
+
+var (
+	errCodecHeader = errors.New("redis: invalid value header")
+	errNotProto    = errors.New("redis: value is not a proto.Message")
+)
+
+var _codecIDs = map[string]byte{
+	"":      _codecGob,
+	Gob:     _codecGob,
+	JSON:    _codecJSON,
+	Proto:   _codecProto,
+	Msgpack: _codecMsgpack,
+}
+
+var _compressIDs = map[string]byte{
+	"":     _compressNone,
+	Snappy: _compressSnappy,
+	Zstd:   _compressZstd,
+}
+
+var _msgpack = &codec.MsgpackHandle{}
+
+var (
+	_zstdOnce sync.Once
+	_zstdEnc  *zstd.Encoder
+	_zstdDec  *zstd.Decoder
+)
+
+// valueCodec encodes Load/Store values, see Config.Codec.
+type valueCodec struct {
+	codec    byte
+	compress byte
+	above    int
+}
+
+func newValueCodec(c *Config) valueCodec {
+	vc := valueCodec{above: c.CompressAbove}
+	var ok bool
+	if vc.codec, ok = _codecIDs[c.Codec]; !ok {
+		panic(fmt.Sprintf("redis: unknown codec %q", c.Codec))
+	}
+	if vc.compress, ok = _compressIDs[c.Compress]; !ok {
+		panic(fmt.Sprintf("redis: unknown compression %q", c.Compress))
+	}
+	if vc.above <= 0 {
+		vc.above = 1024
+	}
+	return vc
+}
+
+// marshal encodes val with a header, uncompressed gob values are written
+// without header to stay readable by older clients.
+func (vc valueCodec) marshal(val interface{}) (b []byte, err error) {
+	switch vc.codec {
+	case _codecJSON:
+		b, err = json.Marshal(val)
+	case _codecProto:
+		m, ok := val.(proto.Message)
+		if !ok {
+			return nil, errNotProto
+		}
+		b, err = proto.Marshal(m)
+	case _codecMsgpack:
+		err = codec.NewEncoderBytes(&b, _msgpack).Encode(val)
+	default:
+		buf := new(bytes.Buffer)
+		err = gob.NewEncoder(buf).Encode(val)
+		b = buf.Bytes()
+	}
+	if err != nil {
+		return
+	}
+	flags := vc.codec
+	if vc.compress != _compressNone && len(b) > vc.above {
+		flags |= vc.compress
+		b = compress(vc.compress, b)
+	}
+	if flags == _codecGob {
+		return
+	}
+	return append([]byte{_codecMagic, flags}, b...), nil
+}
+
+// unmarshal decodes b written with any codec into val.
+func (vc valueCodec) unmarshal(b []byte, val interface{}) (err error) {
+	if len(b) == 0 || b[0] != _codecMagic {
+		return gob.NewDecoder(bytes.NewReader(b)).Decode(val)
+	}
+	if len(b) < 2 {
+		return errCodecHeader
+	}
+	flags := b[1]
+	if b, err = decompress(flags&_compressMask, b[2:]); err != nil {
+		return
+	}
+	switch flags & _codecMask {
+	case _codecGob:
+		return gob.NewDecoder(bytes.NewReader(b)).Decode(val)
+	case _codecJSON:
+		return json.Unmarshal(b, val)
+	case _codecProto:
+		m, ok := val.(proto.Message)
+		if !ok {
+			return errNotProto
+		}
+		return proto.Unmarshal(b, m)
+	case _codecMsgpack:
+		return codec.NewDecoderBytes(b, _msgpack).Decode(val)
+	}
+	return errCodecHeader
+}
+
+func initZstd() {
+	_zstdEnc, _ = zstd.NewWriter(nil)
+	_zstdDec, _ = zstd.NewReader(nil)
+}
+
+func compress(id byte, b []byte) []byte {
+	if id == _compressZstd {
+		_zstdOnce.Do(initZstd)
+		return _zstdEnc.EncodeAll(b, nil)
+	}
+	return snappy.Encode(nil, b)
+}
+
+func decompress(id byte, b []byte) ([]byte, error) {
+	switch id {
+	case _compressNone:
+		return b, nil
+	case _compressSnappy:
+		return snappy.Decode(nil, b)
+	case _compressZstd:
+		_zstdOnce.Do(initZstd)
+		return _zstdDec.DecodeAll(b, nil)
+	}
+	return nil, errCodecHeader
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+)
+
+type codecUser struct {
+	ID   int64
+	Name string
+	Tags []string
+}
+
+func TestValueCodec(t *testing.T) {
+	user := codecUser{ID: 1, Name: strings.Repeat("foo", 500), Tags: []string{"a", "b"}}
+	for _, codec := range []string{Gob, JSON, Msgpack} {
+		for _, compress := range []string{"", Snappy, Zstd} {
+			vc := newValueCodec(&Config{Codec: codec, Compress: compress})
+			b, err := vc.marshal(&user)
+			if err != nil {
+				t.Fatalf("%s/%s: marshal error(%v)", codec, compress, err)
+			}
+			if compress != "" && len(b) > 1024 {
+				t.Errorf("%s/%s: %d bytes not compressed", codec, compress, len(b))
+			}
+			var got codecUser
+			if err = vc.unmarshal(b, &got); err != nil {
+				t.Fatalf("%s/%s: unmarshal error(%v)", codec, compress, err)
+			}
+			if got.ID != user.ID || got.Name != user.Name || len(got.Tags) != 2 {
+				t.Errorf("%s/%s: got %+v", codec, compress, got)
+			}
+		}
+	}
+}
+
+func TestValueCodecProto(t *testing.T) {
+	vc := newValueCodec(&Config{Codec: Proto})
+	b, err := vc.marshal(&types.StringValue{Value: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got types.StringValue
+	if err = vc.unmarshal(b, &got); err != nil || got.Value != "foo" {
+		t.Fatalf("unmarshal = %v, %v", got.Value, err)
+	}
+	if _, err = vc.marshal(&codecUser{}); err != errNotProto {
+		t.Fatalf("marshal error(%v)", err)
+	}
+}
+
+func TestValueCodecMigration(t *testing.T) {
+	// values written by gob before codecs existed carry no header.
+	user := codecUser{ID: 2, Name: "bar"}
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(&user); err != nil {
+		t.Fatal(err)
+	}
+	gobValue, err := newValueCodec(&Config{}).marshal(&user)
+	if err != nil || !bytes.Equal(gobValue, buf.Bytes()) {
+		t.Fatalf("gob value changed: %v", err)
+	}
+	vc := newValueCodec(&Config{Codec: JSON, Compress: Snappy})
+	var got codecUser
+	if err = vc.unmarshal(buf.Bytes(), &got); err != nil || got.ID != user.ID || got.Name != user.Name {
+		t.Fatalf("unmarshal = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+// the coordinates redis can index, see GEOADD.
+const (
+	_geoMaxLng = 180
+	_geoMaxLat = 85.05112878
+)
+
+var errGeoReply = errors.New("redis: unexpected geo reply")
+
+// GeoPoint is a position in degrees.
+type GeoPoint struct {
+	Lng float64 // 经度
+	Lat float64 // 纬度
+}
+
+// ParseGeoPoint parses a position in the format of the loc_lat and loc_lng
+// request headers, see net/http.HeaderContent.
+func ParseGeoPoint(lat, lng string) (p GeoPoint, err error) {
+	if p.Lat, err = strconv.ParseFloat(lat, 64); err != nil {
+		return
+	}
+	if p.Lng, err = strconv.ParseFloat(lng, 64); err != nil {
+		return
+	}
+	if p.Lng < -_geoMaxLng || p.Lng > _geoMaxLng || p.Lat < -_geoMaxLat || p.Lat > _geoMaxLat {
+		err = fmt.Errorf("redis: invalid geo point lat(%s) lng(%s)", lat, lng)
+	}
+	return
+}
+
+// GeoLocation is a member found by GeoSearch.
+type GeoLocation struct {
+	Member string
+	Dist   float64 // distance to the center in the unit of the query
+	GeoPoint
+}
+
+// GeoSearchQuery is the area searched by GeoSearch.
+type GeoSearchQuery struct {
+	Member string   // 以该成员为中心, 为空时使用 Center
+	Center GeoPoint // 中心点
+	Radius float64  // 圆形范围半径, 为 0 时使用 Width 和 Height 矩形范围
+	Width  float64  // 矩形范围宽
+	Height float64  // 矩形范围高
+	Unit   string   // 距离单位, m, km, mi 或 ft, 默认 m
+	Count  int      // 0不限制，返回的最大数量
+	Any    bool     // 找到 Count 个即返回, 不保证是最近的
+	Desc   bool     // 由远及近排序, 默认由近及远
+}
+
+func (q *GeoSearchQuery) args(key string) []interface{} {
+	unit := q.Unit
+	if unit == "" {
+		unit = "m"
+	}
+	args := []interface{}{key}
+	if q.Member != "" {
+		args = append(args, "FROMMEMBER", q.Member)
+	} else {
+		args = append(args, "FROMLONLAT", q.Center.Lng, q.Center.Lat)
+	}
+	if q.Radius > 0 {
+		args = append(args, "BYRADIUS", q.Radius, unit)
+	} else {
+		args = append(args, "BYBOX", q.Width, q.Height, unit)
+	}
+	if q.Desc {
+		args = append(args, "DESC")
+	} else {
+		args = append(args, "ASC")
+	}
+	if q.Count > 0 {
+		args = append(args, "COUNT", q.Count)
+		if q.Any {
+			args = append(args, "ANY")
+		}
+	}
+	return append(args, "WITHCOORD", "WITHDIST")
+}
+
+// GeoAdd <=> GEOADD key lng lat member [lng lat member ...], returns the
+// number of members added.
+func (c *Client) GeoAdd(ctx context.Context, key string, members map[string]GeoPoint) (added int64, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := make([]interface{}, 0, 1+3*len(members))
+	args = append(args, key)
+	for member, p := range members {
+		args = append(args, p.Lng, p.Lat, member)
+	}
+	return redis.Int64(conn.Do("GEOADD", args...))
+}
+
+// GeoPos <=> GEOPOS key member [member ...], the position of a missing member
+// is nil.
+func (c *Client) GeoPos(ctx context.Context, key string, members ...string) (points []*GeoPoint, err error) {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := make([]interface{}, 0, 1+len(members))
+	args = append(args, key)
+	for _, member := range members {
+		args = append(args, member)
+	}
+	values, err := redis.Values(conn.Do("GEOPOS", args...))
+	if err != nil {
+		return
+	}
+	points = make([]*GeoPoint, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		p, err := geoPoint(v)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = &p
+	}
+	return
+}
+
+// GeoDist <=> GEODIST key member1 member2 unit, found is false if either
+// member is missing.
+func (c *Client) GeoDist(ctx context.Context, key, member1, member2, unit string) (found bool, dist float64, err error) {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if unit == "" {
+		unit = "m"
+	}
+	dist, err = redis.Float64(conn.Do("GEODIST", key, member1, member2, unit))
+	if err == redis.ErrNil {
+		return false, 0, nil
+	}
+	return err == nil, dist, err
+}
+
+// GeoSearch <=> GEOSEARCH key ... WITHCOORD WITHDIST, needs redis 6.2.
+func (c *Client) GeoSearch(ctx context.Context, key string, q *GeoSearchQuery) (locations []GeoLocation, err error) {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("GEOSEARCH", q.args(key)...))
+	if err != nil {
+		return
+	}
+	locations = make([]GeoLocation, 0, len(values))
+	for _, v := range values {
+		// member dist [lng lat]
+		fields, err := redis.Values(v, nil)
+		if err != nil || len(fields) != 3 {
+			return nil, errGeoReply
+		}
+		var l GeoLocation
+		if l.Member, err = redis.String(fields[0], nil); err != nil {
+			return nil, err
+		}
+		if l.Dist, err = redis.Float64(fields[1], nil); err != nil {
+			return nil, err
+		}
+		if l.GeoPoint, err = geoPoint(fields[2]); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return
+}
+
+// geoPoint parses a [lng lat] reply.
+func geoPoint(v interface{}) (p GeoPoint, err error) {
+	coord, err := redis.Float64s(v, nil)
+	if err != nil {
+		return
+	}
+	if len(coord) != 2 {
+		return p, errGeoReply
+	}
+	return GeoPoint{Lng: coord[0], Lat: coord[1]}, nil
+}
@@ -0,0 +1,67 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestParseGeoPoint(t *testing.T) {
+	p, err := ParseGeoPoint("39.9042", "116.4074")
+	if err != nil || p != (GeoPoint{Lng: 116.4074, Lat: 39.9042}) {
+		t.Fatalf("ParseGeoPoint = %+v, %v", p, err)
+	}
+	for _, ll := range [][2]string{{"", "116"}, {"39", "x"}, {"86", "116"}, {"39", "181"}} {
+		if _, err := ParseGeoPoint(ll[0], ll[1]); err == nil {
+			t.Errorf("ParseGeoPoint(%q, %q) want error", ll[0], ll[1])
+		}
+	}
+}
+
+func near(p GeoPoint, lng, lat float64) bool {
+	return math.Abs(p.Lng-lng) < 1e-5 && math.Abs(p.Lat-lat) < 1e-5
+}
+
+func TestGeo(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := New(&Config{Network: "tcp", Address: s.Addr()})
+	defer c.Close()
+	ctx := context.Background()
+
+	n, err := c.GeoAdd(ctx, "drivers", map[string]GeoPoint{
+		"a": {Lng: 116.4074, Lat: 39.9042},
+		"b": {Lng: 116.4174, Lat: 39.9042},
+		"c": {Lng: 117.2, Lat: 39.1},
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("GeoAdd = %d, %v", n, err)
+	}
+
+	points, err := c.GeoPos(ctx, "drivers", "a", "missing")
+	if err != nil || len(points) != 2 || !near(*points[0], 116.4074, 39.9042) || points[1] != nil {
+		t.Fatalf("GeoPos = %v, %v", points, err)
+	}
+
+	if found, dist, err := c.GeoDist(ctx, "drivers", "a", "b", "km"); err != nil || !found || math.Abs(dist-0.8539) > 1e-3 {
+		t.Fatalf("GeoDist = %v, %v, %v", found, dist, err)
+	}
+	if found, _, err := c.GeoDist(ctx, "drivers", "a", "missing", ""); err != nil || found {
+		t.Fatalf("GeoDist(missing) = %v, %v", found, err)
+	}
+
+	locations, err := c.GeoSearch(ctx, "drivers", &GeoSearchQuery{
+		Center: GeoPoint{Lng: 116.4074, Lat: 39.9042},
+		Radius: 2,
+		Unit:   "km",
+		Count:  10,
+	})
+	if err != nil || len(locations) != 2 || locations[0].Member != "a" || locations[1].Member != "b" ||
+		locations[0].Dist > 1e-3 || math.Abs(locations[1].Dist-0.8539) > 1e-3 || !near(locations[1].GeoPoint, 116.4174, 39.9042) {
+		t.Fatalf("GeoSearch = %+v, %v", locations, err)
+	}
+	locations, err = c.GeoSearch(ctx, "drivers", &GeoSearchQuery{Member: "a", Width: 200, Height: 200, Unit: "km", Desc: true})
+	if err != nil || len(locations) != 3 || locations[0].Member != "c" || locations[2].Member != "a" {
+		t.Fatalf("GeoSearch(box) = %+v, %v", locations, err)
+	}
+}
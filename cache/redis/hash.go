@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/encoding/json"
+)
+
+var errHashStruct = errors.New("redis: hash value must be a non-nil pointer to a struct")
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// isJSON reports whether a field value is stored as json: structs, maps,
+// pointers, arrays, slices other than []byte and nil interfaces, unless it
+// implements redis.Argument.
+func isJSON(v interface{}) bool {
+	if _, ok := v.(redis.Argument); ok {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid, reflect.Struct, reflect.Map, reflect.Ptr, reflect.Array:
+		return true
+	case reflect.Slice:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// marshalJSON encodes the json values of args, alternating names and values
+// after the key.
+func marshalJSON(args redis.Args) (err error) {
+	for i := 2; i < len(args); i += 2 {
+		if isJSON(args[i]) {
+			if args[i], err = json.Marshal(args[i]); err != nil {
+				return fmt.Errorf("redis: cannot encode hash field %s: %v", args[i-1], err)
+			}
+		}
+	}
+	return
+}
+
+// unmarshalJSON decodes the json values of the alternating names and values
+// of a hash reply to the types of fields, as returned by AddFlatFields, for
+// redis.ScanStruct to assign them.
+func unmarshalJSON(values []interface{}, fields redis.Args) error {
+	types := make(map[string]reflect.Type)
+	for i := 0; i < len(fields); i += 2 {
+		switch name, v := fields[i].(string), fields[i+1]; {
+		case v == nil:
+			types[name] = interfaceType
+		case isJSON(v):
+			types[name] = reflect.TypeOf(v)
+		}
+	}
+	for i := 0; i+1 < len(values); i += 2 {
+		name, _ := values[i].([]byte)
+		b, ok := values[i+1].([]byte)
+		t := types[string(name)]
+		if !ok || t == nil {
+			continue
+		}
+		v := reflect.New(t)
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return fmt.Errorf("redis: cannot decode hash field %s: %v", name, err)
+		}
+		values[i+1] = v.Elem().Interface()
+	}
+	return nil
+}
+
+func checkStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errHashStruct
+	}
+	return nil
+}
+
+// HSetStruct stores the fields of the struct pointed to by v in hash key,
+// fields tagged omitempty are skipped when empty. If fields are given only
+// those fields are updated, empty or not, leaving the rest of the hash
+// untouched.
+//
+//	type Profile struct {
+//		Name  string            `redis:"name"`
+//		Age   int               `redis:"age,omitempty"`
+//		Tags  map[string]string `redis:"tags"` // stored as json
+//		Cache []byte            `redis:"-"`
+//	}
+func (c *Client) HSetStruct(ctx context.Context, key string, v interface{}, fields ...string) (err error) {
+	if err = checkStruct(v); err != nil {
+		return
+	}
+	args := redis.Args{key}
+	if len(fields) == 0 {
+		args = args.AddFlat(v)
+	} else if args, err = args.AddFlatFields(v, fields...); err != nil {
+		return
+	}
+	if len(args) == 1 {
+		return
+	}
+	if err = marshalJSON(args); err != nil {
+		return
+	}
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Do("HMSET", args...)
+	return
+}
+
+// HGetStruct loads hash key into the struct pointed to by dest, ok is false
+// if the hash does not exist. Fields missing from the hash are left
+// unchanged.
+func (c *Client) HGetStruct(ctx context.Context, key string, dest interface{}) (ok bool, err error) {
+	if err = checkStruct(dest); err != nil {
+		return
+	}
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("HGETALL", key))
+	if err == redis.ErrNil {
+		err = nil
+	}
+	if err != nil || len(values) == 0 {
+		return
+	}
+	fields, _ := redis.Args{}.AddFlatFields(dest)
+	if err = unmarshalJSON(values, fields); err != nil {
+		return
+	}
+	if err = redis.ScanStruct(values, dest); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// HGetFields loads the named fields of hash key into the struct pointed to
+// by dest with HMGET, fields missing from the hash are left unchanged.
+func (c *Client) HGetFields(ctx context.Context, key string, dest interface{}, fields ...string) (err error) {
+	if err = checkStruct(dest); err != nil {
+		return
+	}
+	flat, err := redis.Args{}.AddFlatFields(dest, fields...)
+	if err != nil || len(flat) == 0 {
+		return
+	}
+	args := redis.Args{key}
+	for i := 0; i < len(flat); i += 2 {
+		args = append(args, flat[i])
+	}
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("HMGET", args...))
+	if err != nil {
+		return
+	}
+	// NOTE: the reply is made names and values for redis.ScanStruct.
+	src := make([]interface{}, 0, 2*len(values))
+	for i, v := range values {
+		if i+1 < len(args) {
+			src = append(src, []byte(args[i+1].(string)), v)
+		}
+	}
+	if err = unmarshalJSON(src, flat); err != nil {
+		return
+	}
+	return redis.ScanStruct(src, dest)
+}
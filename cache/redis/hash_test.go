@@ -0,0 +1,159 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+// hgetall returns the fields of the hash key.
+func hgetall(t *testing.T, s *redistest.Server, key string) map[string]string {
+	h, err := redis.StringMap(do(t, s, "HGETALL", key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+type hashBase struct {
+	ID   int64  `redis:"id"`
+	Name string `redis:"name"`
+}
+
+type hashProfile struct {
+	hashBase
+	Name    string            `redis:"name"`
+	Age     uint8             `redis:"age,omitempty"`
+	VIP     bool              `redis:"vip"`
+	Score   float64           `redis:"score"`
+	Avatar  []byte            `redis:"avatar,omitempty"`
+	Tags    []string          `redis:"tags,omitempty"`
+	Extra   map[string]string `redis:"extra"`
+	Address *struct {
+		City string `json:"city"`
+	} `redis:"address,omitempty"`
+	Ignored string `redis:"-"`
+	private string
+}
+
+func TestHashStruct(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	ctx := context.Background()
+
+	p := &hashProfile{
+		hashBase: hashBase{ID: 7, Name: "shadowed"},
+		Name:     "alice",
+		VIP:      true,
+		Score:    1.5,
+		Tags:     []string{"a", "b"},
+		Extra:    map[string]string{"k": "v"},
+		Ignored:  "x",
+		private:  "y",
+	}
+	p.Address = &struct {
+		City string `json:"city"`
+	}{City: "paris"}
+	if err := client.HSetStruct(ctx, "user:7", p); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"id":      "7",
+		"name":    "alice",
+		"vip":     "1",
+		"score":   "1.5",
+		"tags":    `["a","b"]`,
+		"extra":   `{"k":"v"}`,
+		"address": `{"city":"paris"}`,
+	}
+	h := hgetall(t, s, "user:7")
+	if len(h) != len(want) {
+		t.Fatalf("stored %v, want %v", h, want)
+	}
+	for k, v := range want {
+		if h[k] != v {
+			t.Errorf("field %s = %q, want %q", k, h[k], v)
+		}
+	}
+
+	var got hashProfile
+	if ok, err := client.HGetStruct(ctx, "user:7", &got); err != nil || !ok {
+		t.Fatalf("HGetStruct = %v, %v", ok, err)
+	}
+	if got.ID != 7 || got.Name != "alice" || !got.VIP || got.Score != 1.5 || strings.Join(got.Tags, ",") != "a,b" ||
+		got.Extra["k"] != "v" || got.Address == nil || got.Address.City != "paris" || got.hashBase.Name != "" {
+		t.Fatalf("HGetStruct got %+v", got)
+	}
+	if ok, err := client.HGetStruct(ctx, "user:8", &got); err != nil || ok {
+		t.Fatalf("HGetStruct missing = %v, %v", ok, err)
+	}
+	if _, err := client.HGetStruct(ctx, "user:7", got); err != errHashStruct {
+		t.Fatalf("HGetStruct non pointer error(%v)", err)
+	}
+
+	// partial update writes the named fields only, even if empty.
+	update := &hashProfile{Age: 0, Score: 2}
+	if err := client.HSetStruct(ctx, "user:7", update, "age", "score"); err != nil {
+		t.Fatal(err)
+	}
+	if h = hgetall(t, s, "user:7"); h["age"] != "0" || h["score"] != "2" || h["name"] != "alice" {
+		t.Fatalf("partial update stored %v", h)
+	}
+	if err := client.HSetStruct(ctx, "user:7", update, "nope"); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+
+	var fields hashProfile
+	if err := client.HGetFields(ctx, "user:7", &fields, "name", "score", "avatar"); err != nil {
+		t.Fatal(err)
+	}
+	if fields.Name != "alice" || fields.Score != 2 || fields.Avatar != nil || fields.ID != 0 {
+		t.Fatalf("HGetFields got %+v", fields)
+	}
+	do(t, s, "HSET", "user:7", "vip", "maybe")
+	if err := client.HGetFields(ctx, "user:7", &fields, "vip"); err == nil {
+		t.Fatal("bad bool decoded")
+	}
+}
+
+type HashOwner struct {
+	Owner string `redis:"owner"`
+}
+
+type hashDoc struct {
+	*HashOwner
+	Title string `redis:"title"`
+}
+
+func TestHashEmbeddedPointer(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	// a nil embedded pointer stores none of its fields
+	if err := client.HSetStruct(ctx, "doc", &hashDoc{Title: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if h := hgetall(t, s, "doc"); len(h) != 1 || h["title"] != "a" {
+		t.Fatalf("stored %v", h)
+	}
+	do(t, s, "HSET", "doc", "owner", "bob")
+	var got hashDoc
+	if ok, err := client.HGetStruct(ctx, "doc", &got); err != nil || !ok {
+		t.Fatalf("HGetStruct = %v, %v", ok, err)
+	}
+	if got.HashOwner == nil || got.Owner != "bob" || got.Title != "a" {
+		t.Fatalf("HGetStruct got %+v", got)
+	}
+	got = hashDoc{}
+	if err := client.HGetFields(ctx, "doc", &got, "owner"); err != nil || got.HashOwner == nil || got.Owner != "bob" {
+		t.Fatalf("HGetFields got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/log"
+	"github.com/Darker-D/ddbase/net/stat/prom"
+	"go.uber.org/zap"
+)
+
+// health is the result of the periodic PING probe of a client.
+type health struct {
+	mu  sync.RWMutex
+	err error
+
+	registered bool // the pool metrics are exported under the client name
+	probed     bool // HealthCheck is on
+	done       chan struct{}
+	once       sync.Once
+}
+
+// startHealth exports the pool metrics of the client under name and probes
+// its servers every interval, disabled when not positive. The metrics are
+// not exported if another client has the same name.
+func (c *Client) startHealth(name string, interval time.Duration) {
+	c.name = name
+	c.health = &health{done: make(chan struct{})}
+	if err := prom.RedisPool.Register(name, c.promStats); err != nil {
+		if log.Logger().Logger != nil {
+			log.Logger().WithCTX(context.Background()).Error("redis pool metrics not exported", zap.String("name", name), zap.Error(err))
+		}
+	} else {
+		c.health.registered = true
+	}
+	if interval > 0 {
+		c.health.probed = true
+		go c.probeLoop(interval)
+	}
+}
+
+// stopHealth stops the probe and the metrics of the client.
+func (c *Client) stopHealth() {
+	c.health.once.Do(func() {
+		close(c.health.done)
+		if c.health.registered {
+			prom.RedisPool.Unregister(c.name)
+		}
+	})
+}
+
+func (c *Client) probeLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.setHealth(c.probe())
+		select {
+		case <-ticker.C:
+		case <-c.health.done:
+			return
+		}
+	}
+}
+
+func (c *Client) setHealth(err error) {
+	h := c.health
+	h.mu.Lock()
+	changed := (err == nil) != (h.err == nil)
+	h.err = err
+	h.mu.Unlock()
+	if !changed || log.Logger().Logger == nil {
+		return
+	}
+	if err != nil {
+		log.Logger().WithCTX(context.Background()).Error("redis unhealthy", zap.String("name", c.name), zap.Error(err))
+	} else {
+		log.Logger().WithCTX(context.Background()).Info("redis healthy", zap.String("name", c.name))
+	}
+}
+
+// probe PINGs a server of every pool.
+func (c *Client) probe() error {
+	pools := c.pools()
+	if len(pools) == 0 {
+		return errClusterNoNodes
+	}
+	for _, p := range pools {
+		conn := p.Get()
+		_, err := conn.Do("PING")
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Healthy returns the error of the last health probe, nil when every server
+// answered PING or when HealthCheck is not set. It is meant for readiness
+// checks.
+func (c *Client) Healthy() error {
+	c.health.mu.RLock()
+	err := c.health.err
+	c.health.mu.RUnlock()
+	return err
+}
+
+// pools returns the connection pools of the client, one per node under
+// cluster mode.
+func (c *Client) pools() []*redis.Pool {
+	switch {
+	case c.cluster != nil:
+		return c.cluster.Pools()
+	case c.sentinel != nil:
+		return c.sentinel.pools()
+	}
+	return []*redis.Pool{c.pool}
+}
+
+// PoolStats returns the statistics of the connection pools of the client,
+// summed over the nodes under cluster and sentinel modes.
+func (c *Client) PoolStats() (stats redis.PoolStats) {
+	for _, p := range c.pools() {
+		s := p.Stats()
+		stats.ActiveCount += s.ActiveCount
+		stats.IdleCount += s.IdleCount
+		stats.CacheHits += s.CacheHits
+		stats.CacheMisses += s.CacheMisses
+		stats.WaitCount += s.WaitCount
+		stats.WaitDuration += s.WaitDuration
+		stats.DialFailures += s.DialFailures
+		stats.IdleClosed += s.IdleClosed
+		stats.LifetimeClosed += s.LifetimeClosed
+	}
+	return
+}
+
+func (c *Client) promStats() prom.PoolStats {
+	s := c.PoolStats()
+	return prom.PoolStats{
+		Active:         s.ActiveCount,
+		Idle:           s.IdleCount,
+		WaitCount:      s.WaitCount,
+		WaitDuration:   s.WaitDuration,
+		DialFailures:   s.DialFailures,
+		IdleClosed:     s.IdleClosed,
+		LifetimeClosed: s.LifetimeClosed,
+		Healthy:        c.Healthy() == nil,
+		Unprobed:       !c.health.probed,
+	}
+}
@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/net/stat/prom"
+)
+
+func TestHealth(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	c := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1, HealthCheck: 10 * time.Millisecond})
+	defer c.Close()
+
+	waitHealth := func(healthy bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for (c.Healthy() == nil) != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("Healthy() = %v, want healthy %v", c.Healthy(), healthy)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitHealth(true)
+	// PING fails with NOAUTH while a password is required.
+	s.RequireAuth("secret")
+	waitHealth(false)
+	if stats := c.promStats(); stats.Healthy || stats.Unprobed {
+		t.Fatalf("got %+v, want unhealthy", stats)
+	}
+	s.RequireAuth("")
+	waitHealth(true)
+	if stats := c.PoolStats(); stats.ActiveCount == 0 {
+		t.Fatalf("got %+v, want an active connection", stats)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	s := newTestServer(t)
+	c := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1, IdleTimeout: time.Millisecond})
+	defer c.Close()
+
+	ctx := context.Background()
+	if _, err := c.GetString(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.Close()
+	// the idle connection is pruned, then the dial fails
+	if _, err := c.GetString(ctx, "k"); err == nil {
+		t.Fatal("want dial error")
+	}
+	if stats := c.PoolStats(); stats.IdleClosed != 1 || stats.DialFailures != 1 {
+		t.Fatalf("got %+v, want 1 idle closed and 1 dial failure", stats)
+	}
+	if stats := c.promStats(); !stats.Unprobed {
+		t.Fatalf("got %+v, want unprobed", stats)
+	}
+}
+
+func TestPoolName(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	db0 := New(&Config{Network: "tcp", Address: s.Addr()})
+	defer db0.Close()
+	db1 := New(&Config{Network: "tcp", Address: s.Addr(), DB: 1})
+	defer db1.Close()
+	if db0.name != s.Addr()+"/0" || !db0.health.registered || !db1.health.registered {
+		t.Fatalf("got names %q %q, want both registered", db0.name, db1.name)
+	}
+
+	// a duplicate is not exported and does not unregister the first client
+	dup := New(&Config{Network: "tcp", Address: s.Addr()})
+	if dup.health.registered {
+		t.Fatal("duplicate name registered")
+	}
+	dup.Close()
+	if err := prom.RedisPool.Register(db0.name, db0.promStats); err == nil {
+		t.Fatal("first client unregistered by the duplicate")
+	}
+}
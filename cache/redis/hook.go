@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/log"
+	"github.com/Darker-D/ddbase/net/trace/opentracing/ext"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+const (
+	_hookComponent = "cache/redis"
+	// slow commands are logged with at most _slowArgs arguments of at most
+	// _slowArgLen bytes each.
+	_slowArgs   = 8
+	_slowArgLen = 64
+)
+
+// hookConn observes the commands of a connection: a span per command when ctx
+// carries one, latency and result counters per client and command name, and
+// a log of the commands slower than Config.SlowLog. Commands sent in a pipeline are
+// observed on Receive.
+type hookConn struct {
+	redis.Conn
+	ctx     context.Context
+	client  *Client
+	pending []hookCmd // pipelined commands waiting for their reply
+}
+
+type hookCmd struct {
+	name  string
+	args  []interface{}
+	start time.Time
+}
+
+// hook wraps conn to observe its commands.
+func (c *Client) hook(ctx context.Context, conn redis.Conn) redis.Conn {
+	return &hookConn{Conn: conn, ctx: ctx, client: c}
+}
+
+func (hc *hookConn) Do(cmd string, args ...interface{}) (reply interface{}, err error) {
+	if cmd == "" {
+		// NOTE: Do("") flushes and receives the pending replies.
+		return hc.receiveAll(func() (interface{}, error) { return hc.Conn.Do(cmd) })
+	}
+	start := time.Now()
+	reply, err = hc.Conn.Do(cmd, args...)
+	// NOTE: Do also flushes the pipeline, the pending replies are discarded.
+	for _, p := range hc.pending {
+		hc.observe(p, true, err)
+	}
+	hc.pending = nil
+	hc.observe(hookCmd{name: cmd, args: args, start: start}, reply, err)
+	return
+}
+
+// DoWithTimeout implements redis.ConnWithTimeout for blocking commands.
+func (hc *hookConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (reply interface{}, err error) {
+	start := time.Now()
+	reply, err = redis.DoWithTimeout(hc.Conn, timeout, cmd, args...)
+	hc.observe(hookCmd{name: cmd, args: args, start: start}, reply, err)
+	return
+}
+
+func (hc *hookConn) Send(cmd string, args ...interface{}) error {
+	hc.pending = append(hc.pending, hookCmd{name: cmd, args: args, start: time.Now()})
+	return hc.Conn.Send(cmd, args...)
+}
+
+func (hc *hookConn) Receive() (interface{}, error) {
+	return hc.receive(hc.Conn.Receive)
+}
+
+// ReceiveWithTimeout implements redis.ConnWithTimeout.
+func (hc *hookConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return hc.receive(func() (interface{}, error) { return redis.ReceiveWithTimeout(hc.Conn, timeout) })
+}
+
+func (hc *hookConn) receive(recv func() (interface{}, error)) (reply interface{}, err error) {
+	reply, err = recv()
+	if len(hc.pending) > 0 {
+		cmd := hc.pending[0]
+		hc.pending = hc.pending[1:]
+		hc.observe(cmd, reply, err)
+	}
+	return
+}
+
+func (hc *hookConn) receiveAll(do func() (interface{}, error)) (reply interface{}, err error) {
+	reply, err = do()
+	pending := hc.pending
+	hc.pending = nil
+	values, _ := reply.([]interface{})
+	for i, cmd := range pending {
+		var v interface{} = true
+		if i < len(values) {
+			v = values[i]
+		}
+		hc.observe(cmd, v, err)
+	}
+	return
+}
+
+func (hc *hookConn) Close() error {
+	hc.pending = nil
+	return hc.Conn.Close()
+}
+
+func (hc *hookConn) observe(cmd hookCmd, reply interface{}, err error) {
+	if e, ok := reply.(redis.Error); ok && err == nil {
+		// NOTE: errors of pipelined replies are returned as values.
+		err = e
+	}
+	name := strings.ToUpper(cmd.name)
+	cost := time.Since(cmd.start)
+	c := hc.client
+	// NOTE: the clients are told apart by their pool name, as in the pool
+	// metrics.
+	method := "redis:" + c.name + ":" + name
+	_statsCache.Timing(method, int64(cost/time.Millisecond))
+	_statsCache.Incr(method, resultCode(reply, err))
+	if parent := opentracing.SpanFromContext(hc.ctx); parent != nil {
+		span := parent.Tracer().StartSpan("redis:"+name, opentracing.ChildOf(parent.Context()), opentracing.StartTime(cmd.start))
+		ext.Component.Set(span, _hookComponent)
+		ext.SpanKind.Set(span, ext.SpanKindRPCClientEnum)
+		ext.DBType.Set(span, "redis")
+		ext.DBInstance.Set(span, c.addr)
+		ext.DBStatement.Set(span, statement(name, cmd.args, 1))
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogKV("error", err.Error())
+		}
+		span.Finish()
+	}
+	if c.slowLog > 0 && cost >= c.slowLog && log.Logger().Logger != nil {
+		log.Logger().WithCTX(hc.ctx).Warn("redis slow command",
+			zap.String("name", c.name),
+			zap.String("addr", c.addr),
+			zap.String("command", statement(name, cmd.args, _slowArgs)),
+			zap.Duration("cost", cost),
+			zap.Error(err))
+	}
+}
+
+// resultCode is the stat code of a command result.
+func resultCode(reply interface{}, err error) string {
+	switch {
+	case err == nil && reply == nil:
+		return "nil"
+	case err == nil:
+		return "ok"
+	}
+	if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+		return "timeout"
+	}
+	if _, ok := err.(redis.Error); ok {
+		return "reply_error"
+	}
+	return "error"
+}
+
+// statement formats cmd with at most n arguments truncated to _slowArgLen
+// bytes, values are never fully logged.
+func statement(cmd string, args []interface{}, n int) string {
+	var b strings.Builder
+	b.WriteString(cmd)
+	for i, arg := range args {
+		if i == n {
+			fmt.Fprintf(&b, " ...(%d more)", len(args)-n)
+			break
+		}
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			s = fmt.Sprint(v)
+		}
+		if len(s) > _slowArgLen {
+			s = fmt.Sprintf("%s...(%d bytes)", s[:_slowArgLen], len(s))
+		}
+		b.WriteByte(' ')
+		b.WriteString(s)
+	}
+	return b.String()
+}
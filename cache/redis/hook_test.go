@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type fakeStat struct {
+	mu    sync.Mutex
+	codes map[string]int
+}
+
+func (s *fakeStat) Timing(name string, time int64, extra ...string) {}
+func (s *fakeStat) State(name string, val int64, extra ...string)   {}
+func (s *fakeStat) Incr(name string, extra ...string) {
+	s.mu.Lock()
+	s.codes[name+" "+strings.Join(extra, " ")]++
+	s.mu.Unlock()
+}
+
+func TestHook(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	stats := &fakeStat{codes: make(map[string]int)}
+	old := _statsCache
+	_statsCache = stats
+	defer func() { _statsCache = old }()
+
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	if err := client.SetEx(ctx, "k", "v", 10); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.GetString(ctx, "missing"); err != nil || v != "" {
+		t.Fatalf("GetString = %q, %v", v, err)
+	}
+	conn, err := client.getConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Send("GET", "k")
+	conn.Send("NOPE", "x")
+	conn.Flush()
+	conn.Receive()
+	conn.Receive()
+	conn.Close()
+	// commands without a span are counted but not traced.
+	client.GetString(context.Background(), "k")
+
+	spans := tracer.FinishedSpans()
+	var names []string
+	for _, sp := range spans {
+		names = append(names, sp.OperationName)
+		if sp.ParentID != parent.Context().(mocktracer.MockSpanContext).SpanID {
+			t.Errorf("span %s is not a child of the request span", sp.OperationName)
+		}
+		if sp.Tag("db.type") != "redis" || sp.Tag("db.instance") != s.Addr() {
+			t.Errorf("span %s tags %v", sp.OperationName, sp.Tags())
+		}
+	}
+	if strings.Join(names, ",") != "redis:SET,redis:GET,redis:GET,redis:NOPE" {
+		t.Fatalf("spans %v", names)
+	}
+	if spans[0].Tag("db.statement") != "SET k ...(3 more)" {
+		t.Errorf("statement %v", spans[0].Tag("db.statement"))
+	}
+	if spans[3].Tag("error") != true {
+		t.Errorf("error span tags %v", spans[3].Tags())
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	prefix := "redis:" + s.Addr() + "/0:"
+	for key, n := range map[string]int{
+		prefix + "SET ok":           1,
+		prefix + "GET nil":          1,
+		prefix + "GET ok":           2,
+		prefix + "NOPE reply_error": 1,
+	} {
+		if stats.codes[key] != n {
+			t.Errorf("stat %q = %d, want %d (%v)", key, stats.codes[key], n, stats.codes)
+		}
+	}
+}
+
+func TestStatement(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	got := statement("MSET", []interface{}{"a", []byte(long), 1, 2}, 3)
+	want := "MSET a " + long[:_slowArgLen] + "...(100 bytes) 1 ...(1 more)"
+	if got != want {
+		t.Fatalf("statement = %q, want %q", got, want)
+	}
+}
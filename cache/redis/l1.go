@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"container/list"
+	"time"
+)
+
+// L1 eviction policies.
+const (
+	LRU = "lru"
+	LFU = "lfu"
+)
+
+// l1 is a size bounded in-process store of encoded values, it is not safe for
+// concurrent use.
+type l1 interface {
+	get(key string, now time.Time) ([]byte, bool)
+	set(key string, value []byte, expire time.Time)
+	del(key string)
+	clear()
+}
+
+func newL1(policy string, size int) l1 {
+	if policy == LFU {
+		return &lfu{size: size, freqs: list.New(), items: make(map[string]*lfuEntry)}
+	}
+	return &lru{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+type lruEntry struct {
+	key    string
+	value  []byte
+	expire time.Time
+}
+
+// lru evicts the least recently used entry.
+type lru struct {
+	size  int
+	ll    *list.List // front is the most recently used
+	items map[string]*list.Element
+}
+
+func (c *lru) get(key string, now time.Time) ([]byte, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if now.After(e.expire) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *lru) set(key string, value []byte, expire time.Time) {
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expire = value, expire
+		c.ll.MoveToFront(el)
+		return
+	}
+	if c.ll.Len() >= c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expire: expire})
+}
+
+func (c *lru) del(key string) {
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru) clear() {
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+type lfuEntry struct {
+	key    string
+	value  []byte
+	expire time.Time
+	bucket *list.Element // element of lfu.freqs
+	el     *list.Element // element of the bucket entries
+}
+
+type lfuBucket struct {
+	freq    int
+	entries *list.List // front is the most recently used
+}
+
+// lfu evicts the least frequently used entry, the least recently used one
+// among equals. Every operation is O(1).
+type lfu struct {
+	size  int
+	freqs *list.List // buckets by ascending frequency
+	items map[string]*lfuEntry
+}
+
+func (c *lfu) get(key string, now time.Time) ([]byte, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(e.expire) {
+		c.del(key)
+		return nil, false
+	}
+	c.touch(e)
+	return e.value, true
+}
+
+func (c *lfu) set(key string, value []byte, expire time.Time) {
+	if e, ok := c.items[key]; ok {
+		e.value, e.expire = value, expire
+		c.touch(e)
+		return
+	}
+	if len(c.items) >= c.size {
+		b := c.freqs.Front().Value.(*lfuBucket)
+		c.del(b.entries.Back().Value.(*lfuEntry).key)
+	}
+	front := c.freqs.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = c.freqs.PushFront(&lfuBucket{freq: 1, entries: list.New()})
+	}
+	e := &lfuEntry{key: key, value: value, expire: expire, bucket: front}
+	e.el = front.Value.(*lfuBucket).entries.PushFront(e)
+	c.items[key] = e
+}
+
+// touch moves e to the bucket of the next frequency.
+func (c *lfu) touch(e *lfuEntry) {
+	cur := e.bucket
+	b := cur.Value.(*lfuBucket)
+	next := cur.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != b.freq+1 {
+		next = c.freqs.InsertAfter(&lfuBucket{freq: b.freq + 1, entries: list.New()}, cur)
+	}
+	b.entries.Remove(e.el)
+	if b.entries.Len() == 0 {
+		c.freqs.Remove(cur)
+	}
+	e.bucket = next
+	e.el = next.Value.(*lfuBucket).entries.PushFront(e)
+}
+
+func (c *lfu) del(key string) {
+	e, ok := c.items[key]
+	if !ok {
+		return
+	}
+	b := e.bucket.Value.(*lfuBucket)
+	b.entries.Remove(e.el)
+	if b.entries.Len() == 0 {
+		c.freqs.Remove(e.bucket)
+	}
+	delete(c.items, key)
+}
+
+func (c *lfu) clear() {
+	c.freqs.Init()
+	c.items = make(map[string]*lfuEntry)
+}
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := newL1(LRU, 2)
+	now := time.Now()
+	expire := now.Add(time.Minute)
+	c.set("a", []byte("a"), expire)
+	c.set("b", []byte("b"), expire)
+	c.get("a", now)
+	c.set("c", []byte("c"), expire)
+	if _, ok := c.get("b", now); ok {
+		t.Fatal("b not evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if v, ok := c.get(k, now); !ok || string(v) != k {
+			t.Fatalf("get(%s) = %s, %v", k, v, ok)
+		}
+	}
+	if _, ok := c.get("a", expire.Add(time.Second)); ok {
+		t.Fatal("a not expired")
+	}
+}
+
+func TestLFU(t *testing.T) {
+	c := newL1(LFU, 2)
+	now := time.Now()
+	expire := now.Add(time.Minute)
+	c.set("a", []byte("a"), expire)
+	c.set("b", []byte("b"), expire)
+	c.get("a", now)
+	c.get("a", now)
+	c.get("b", now)
+	// b is used less often than a although more recently.
+	c.set("c", []byte("c"), expire)
+	if _, ok := c.get("b", now); ok {
+		t.Fatal("b not evicted")
+	}
+	// c and a have different frequencies, c is evicted.
+	c.set("d", []byte("d"), expire)
+	if _, ok := c.get("c", now); ok {
+		t.Fatal("c not evicted")
+	}
+	if v, ok := c.get("a", now); !ok || string(v) != "a" {
+		t.Fatalf("get(a) = %s, %v", v, ok)
+	}
+	c.del("a")
+	c.del("d")
+	if l := c.(*lfu); len(l.items) != 0 || l.freqs.Len() != 0 {
+		t.Fatalf("%d items, %d buckets left", len(l.items), l.freqs.Len())
+	}
+}
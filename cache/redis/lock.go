@@ -0,0 +1,306 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/log"
+	"github.com/Darker-D/ddbase/net/netutil"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrLockNotObtained is returned when the lock is held by another owner.
+	ErrLockNotObtained = errors.New("redis: lock not obtained")
+	// ErrLockNotHeld is returned when the lock has expired or is owned by
+	// another owner.
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+var (
+	// _unlockScript deletes the lock only if it is still owned by the token.
+	_unlockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	// _refreshScript extends the lock only if it is still owned by the token.
+	_refreshScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// LockConfig is the lock config.
+type LockConfig struct {
+	TTL         time.Duration          // 锁过期时间, 默认 10s
+	Retry       *netutil.BackoffConfig // 获取失败时的重试退避, nil 不重试
+	AutoRefresh bool                   // 持有期间每 TTL/3 自动续期
+}
+
+func (conf *LockConfig) fix() *LockConfig {
+	c := LockConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	if c.TTL <= 0 {
+		c.TTL = 10 * time.Second
+	}
+	return &c
+}
+
+// Lock is a lock held on one or several clients.
+type Lock struct {
+	clients []*Client
+	quorum  int
+	key     string
+	token   string
+	ttl     time.Duration
+
+	once sync.Once
+	stop chan struct{} // closed by Unlock
+	lost chan struct{} // closed when auto refresh fails
+}
+
+// Lock acquires the lock of key, retrying with Retry backoff until ctx is
+// done. The returned lock must be released with Unlock.
+func (c *Client) Lock(ctx context.Context, key string, conf *LockConfig) (*Lock, error) {
+	return obtain(ctx, []*Client{c}, 1, key, conf.fix())
+}
+
+// Redlock acquires locks on a majority of independent redis masters, see
+// https://redis.io/topics/distlock.
+type Redlock struct {
+	clients []*Client
+	conf    *LockConfig
+}
+
+// NewRedlock new a redlock over clients which must not replicate each other.
+func NewRedlock(clients []*Client, conf *LockConfig) *Redlock {
+	return &Redlock{clients: clients, conf: conf.fix()}
+}
+
+// Lock acquires the lock of key on a majority of the clients.
+func (r *Redlock) Lock(ctx context.Context, key string) (*Lock, error) {
+	return obtain(ctx, r.clients, len(r.clients)/2+1, key, r.conf)
+}
+
+func obtain(ctx context.Context, clients []*Client, quorum int, key string, conf *LockConfig) (l *Lock, err error) {
+	token, err := lockToken()
+	if err != nil {
+		return
+	}
+	l = &Lock{
+		clients: clients,
+		quorum:  quorum,
+		key:     key,
+		token:   token,
+		ttl:     conf.TTL,
+		stop:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+	var start time.Time
+	for retries := 0; ; retries++ {
+		var ok bool
+		start = time.Now()
+		if ok, err = l.acquire(ctx); err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if conf.Retry == nil {
+			return nil, ErrLockNotObtained
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ErrLockNotObtained
+		case <-time.After(conf.Retry.Backoff(retries)):
+		}
+	}
+	if conf.AutoRefresh {
+		go l.refreshLoop(start)
+	}
+	return l, nil
+}
+
+// acquire sets the lock on every client and keeps it if a quorum was reached
+// within its validity time. Errors are only returned with a single client.
+func (l *Lock) acquire(ctx context.Context) (ok bool, err error) {
+	start := time.Now()
+	n := l.each(ctx, func(ctx context.Context, c *Client) (bool, error) {
+		return c.setLock(ctx, l.key, l.token, l.ttl)
+	}, &err)
+	if len(l.clients) > 1 {
+		err = nil
+	}
+	// NOTE: clock drift, see https://redis.io/topics/distlock#is-the-algorithm-asynchronous
+	drift := l.ttl/100 + 2*time.Millisecond
+	if n >= l.quorum && time.Since(start)+drift < l.ttl {
+		return true, nil
+	}
+	if n > 0 {
+		l.release(context.Background())
+	}
+	return false, err
+}
+
+// each calls fn on every client and returns the number of successes. The
+// last error is stored in errp.
+func (l *Lock) each(ctx context.Context, fn func(context.Context, *Client) (bool, error), errp *error) (n int) {
+	if len(l.clients) == 1 {
+		ok, err := fn(ctx, l.clients[0])
+		if ok {
+			n++
+		}
+		*errp = err
+		return
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range l.clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			// NOTE: a slow master must not eat the lock validity time.
+			cctx, cancel := context.WithTimeout(ctx, l.ttl/10)
+			ok, err := fn(cctx, c)
+			cancel()
+			mu.Lock()
+			if ok {
+				n++
+			}
+			if err != nil {
+				*errp = err
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return
+}
+
+func (l *Lock) release(ctx context.Context) (n int, err error) {
+	n = l.each(ctx, func(ctx context.Context, c *Client) (bool, error) {
+		return c.evalLock(ctx, _unlockScript, l.key, l.token)
+	}, &err)
+	return
+}
+
+// Key returns the locked key.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the random owner token of the lock.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost returns a channel which is closed when auto refresh failed to extend
+// the lock: it is owned by another lock, or was not refreshed for TTL. The
+// critical section must be abandoned.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock releases the lock if it is still owned by this lock.
+func (l *Lock) Unlock(ctx context.Context) (err error) {
+	l.once.Do(func() { close(l.stop) })
+	n, err := l.release(ctx)
+	if n >= l.quorum {
+		return nil
+	}
+	if err == nil || len(l.clients) > 1 {
+		err = ErrLockNotHeld
+	}
+	return
+}
+
+// Refresh extends the lock to ttl if it is still owned by this lock.
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) (err error) {
+	ms := int64(ttl / time.Millisecond)
+	n := l.each(ctx, func(ctx context.Context, c *Client) (bool, error) {
+		return c.evalLock(ctx, _refreshScript, l.key, l.token, ms)
+	}, &err)
+	if n >= l.quorum {
+		return nil
+	}
+	if err == nil || len(l.clients) > 1 {
+		err = ErrLockNotHeld
+	}
+	return
+}
+
+// refreshLoop refreshes the lock acquired at start until Unlock. The lock is
+// lost once it is not held, or TTL passed since the last refresh whatever
+// the errors, as it may have expired.
+func (l *Lock) refreshLoop(start time.Time) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	expired := time.NewTimer(time.Until(start.Add(l.ttl)))
+	defer expired.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-expired.C:
+			close(l.lost)
+			return
+		case <-ticker.C:
+			begin := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			err := l.Refresh(ctx, l.ttl)
+			cancel()
+			switch {
+			case err == nil:
+				if !expired.Stop() {
+					<-expired.C
+				}
+				expired.Reset(time.Until(begin.Add(l.ttl)))
+			case err == ErrLockNotHeld:
+				close(l.lost)
+				return
+			case log.Logger().Logger != nil:
+				log.Logger().WithCTX(context.Background()).Warn("redis lock refresh failed", zap.String("key", l.key), zap.Error(err))
+			}
+		}
+	}
+}
+
+// setLock <=> SET key token PX ttl NX
+func (c *Client) setLock(ctx context.Context, key, token string, ttl time.Duration) (ok bool, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = redis.String(conn.Do("SET", key, token, "PX", int64(ttl/time.Millisecond), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// evalLock evaluates a compare-and-* lock script and reports whether the
+// token still owned the lock.
+func (c *Client) evalLock(ctx context.Context, script *redis.Script, key string, args ...interface{}) (ok bool, err error) {
+	n, err := redis.Int64(c.Eval(ctx, script, append([]interface{}{key}, args...)...))
+	return n == 1, err
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/net/netutil"
+)
+
+func TestLock(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	ctx := context.Background()
+
+	l, err := client.Lock(ctx, "lock", &LockConfig{TTL: time.Second})
+	if err != nil {
+		t.Fatalf("Lock error(%v)", err)
+	}
+	if _, err = client.Lock(ctx, "lock", nil); err != ErrLockNotObtained {
+		t.Fatalf("second Lock error(%v), want ErrLockNotObtained", err)
+	}
+	other := &Lock{clients: l.clients, quorum: 1, key: l.key, token: "other", stop: make(chan struct{})}
+	if err = other.Unlock(ctx); err != ErrLockNotHeld {
+		t.Fatalf("Unlock by other owner error(%v), want ErrLockNotHeld", err)
+	}
+	if err = l.Refresh(ctx, time.Second); err != nil {
+		t.Fatalf("Refresh error(%v)", err)
+	}
+	if err = l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock error(%v)", err)
+	}
+	if err = l.Refresh(ctx, time.Second); err != ErrLockNotHeld {
+		t.Fatalf("Refresh after Unlock error(%v), want ErrLockNotHeld", err)
+	}
+}
+
+func TestLockRetry(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+
+	l, err := client.Lock(context.Background(), "lock", &LockConfig{TTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Lock error(%v)", err)
+	}
+	conf := &LockConfig{TTL: time.Second, Retry: &netutil.BackoffConfig{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Factor: 1.6}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	l2, err := client.Lock(ctx, "lock", conf)
+	if err != nil {
+		t.Fatalf("Lock with retry error(%v)", err)
+	}
+	if l2.Token() == l.Token() {
+		t.Fatal("tokens must differ")
+	}
+}
+
+func TestLockAutoRefresh(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	ctx := context.Background()
+
+	l, err := client.Lock(ctx, "lock", &LockConfig{TTL: 60 * time.Millisecond, AutoRefresh: true})
+	if err != nil {
+		t.Fatalf("Lock error(%v)", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-l.Lost():
+		t.Fatal("lock lost")
+	default:
+	}
+	if err = l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock error(%v)", err)
+	}
+
+	// refresh errors lose the lock once TTL passed
+	l, err = client.Lock(ctx, "lock", &LockConfig{TTL: 60 * time.Millisecond, AutoRefresh: true})
+	if err != nil {
+		t.Fatalf("Lock error(%v)", err)
+	}
+	s.Close()
+	start := time.Now()
+	select {
+	case <-l.Lost():
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Fatalf("lost after %v, want within TTL", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lock not lost")
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		s := newTestServer(t)
+		defer s.Close()
+		c := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	// the third master is down.
+	down := New(&Config{Network: "tcp", Address: "127.0.0.1:1", MaxIdle: 2})
+	clients[2] = down
+	ctx := context.Background()
+
+	rl := NewRedlock(clients, &LockConfig{TTL: time.Second})
+	l, err := rl.Lock(ctx, "lock")
+	if err != nil {
+		t.Fatalf("Redlock error(%v)", err)
+	}
+	if _, err = rl.Lock(ctx, "lock"); err != ErrLockNotObtained {
+		t.Fatalf("second Redlock error(%v), want ErrLockNotObtained", err)
+	}
+	if err = l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock error(%v)", err)
+	}
+}
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"sync"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/net/naming"
+)
+
+// discovery keeps the pool of a standalone client pointing to the current
+// instances of a naming watcher.
+type discovery struct {
+	w    naming.Watcher
+	pool *redis.Pool
+	done chan struct{}
+	once sync.Once
+}
+
+func newDiscovery(c *Config) *discovery {
+	// NOTE: the redirect connection of the client side caching must be on
+	// the same server as the tracked connections, which Pick does not keep.
+	if c.Tracking != "" {
+		panic("redis: Tracking is not supported with Naming")
+	}
+	d := &discovery{w: c.Naming, done: make(chan struct{})}
+	d.pool = newPool(c, "")
+	d.pool.Dial = func() (redis.Conn, error) {
+		in, err := naming.Pick(d.w)
+		if err != nil {
+			return nil, err
+		}
+		return dial(c, in.Addr)
+	}
+	go d.watch()
+	return d
+}
+
+// watch drains the pool when the instances change, so that the connections
+// to the removed instances are not reused.
+func (d *discovery) watch() {
+	ch := d.w.Watch()
+	for {
+		select {
+		case <-d.done:
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			d.pool.Reset()
+		}
+	}
+}
+
+// Close stops watching the instances and closes the pool.
+func (d *discovery) Close() error {
+	d.once.Do(func() { close(d.done) })
+	return d.pool.Close()
+}
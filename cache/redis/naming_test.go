@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+	"github.com/Darker-D/ddbase/net/naming"
+)
+
+// fakeWatcher is a naming.Watcher whose instances are set by the test.
+type fakeWatcher struct {
+	mu  sync.Mutex
+	ins []*naming.Instance
+	ch  chan struct{}
+}
+
+func newFakeWatcher(addrs ...string) *fakeWatcher {
+	w := &fakeWatcher{ch: make(chan struct{}, 1)}
+	w.set(addrs...)
+	return w
+}
+
+func (w *fakeWatcher) set(addrs ...string) {
+	w.mu.Lock()
+	w.ins = w.ins[:0:0]
+	for _, addr := range addrs {
+		w.ins = append(w.ins, &naming.Instance{Addr: addr})
+	}
+	w.mu.Unlock()
+	w.ch <- struct{}{}
+}
+
+func (w *fakeWatcher) Instances() ([]*naming.Instance, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ins, nil
+}
+
+func (w *fakeWatcher) Watch() <-chan struct{} { return w.ch }
+func (w *fakeWatcher) Close() error           { return nil }
+
+func TestNaming(t *testing.T) {
+	var servers [2]*redistest.Server
+	for i := range servers {
+		s, err := redistest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		servers[i] = s
+	}
+	w := newFakeWatcher(servers[0].Addr())
+
+	client := New(&Config{Network: "tcp", Naming: w, MaxIdle: 1})
+	defer client.Close()
+	set := func(v string) {
+		conn := client.pool.Get()
+		defer conn.Close()
+		if _, err := conn.Do("SET", "k", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(s *redistest.Server) string {
+		c, err := redis.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		v, _ := redis.String(c.Do("GET", "k"))
+		return v
+	}
+
+	set("v1")
+	if v := get(servers[0]); v != "v1" {
+		t.Fatalf("GET = %q, want the command sent to the instance", v)
+	}
+	// the idle connection to the removed instance is not reused
+	w.set(servers[1].Addr())
+	deadline := time.Now().Add(time.Second)
+	for client.pool.IdleCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the pool is not reset on the instance change")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	set("v2")
+	if v := get(servers[1]); v != "v2" {
+		t.Fatalf("GET = %q, want the command sent to the new instance", v)
+	}
+	if v := get(servers[0]); v != "v1" {
+		t.Fatalf("GET = %q on the removed instance", v)
+	}
+}
+
+func TestNamingTracking(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want a panic with Tracking")
+		}
+	}()
+	New(&Config{Network: "tcp", Naming: newFakeWatcher("127.0.0.1:1"), Tracking: "default"})
+}
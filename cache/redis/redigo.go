@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// redigoPool is the Pool of a client, kept a redigo pool for the callers of
+// the previous versions. Its connections are borrowed from the pools of the
+// client, routed by key slot under cluster mode, and are given back on Close.
+func (c *Client) redigoPool() *redigo.Pool {
+	return &redigo.Pool{
+		// NOTE: no idle connection is kept, the client pools keep them.
+		Dial: func() (redigo.Conn, error) {
+			conn, err := c.getConn(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			if err = conn.Err(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return redigoConn{conn}, nil
+		},
+	}
+}
+
+// redigoConn converts the error replies of a connection to redigo.Error, as
+// redigo callers check them.
+type redigoConn struct {
+	redis.Conn
+}
+
+func (c redigoConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return redigoReply(c.Conn.Do(cmd, args...))
+}
+
+func (c redigoConn) Receive() (interface{}, error) {
+	return redigoReply(c.Conn.Receive())
+}
+
+func (c redigoConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redigoReply(redis.DoWithTimeout(c.Conn, timeout, cmd, args...))
+}
+
+func (c redigoConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redigoReply(redis.ReceiveWithTimeout(c.Conn, timeout))
+}
+
+func redigoReply(reply interface{}, err error) (interface{}, error) {
+	if e, ok := err.(redis.Error); ok {
+		err = redigo.Error(e)
+	}
+	return redigoValue(reply), err
+}
+
+// redigoValue converts the error replies nested in a reply, such as those of
+// EXEC.
+func redigoValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case redis.Error:
+		return redigo.Error(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = redigoValue(v[i])
+		}
+	}
+	return v
+}
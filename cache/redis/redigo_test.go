@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+func TestRedigoPool(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1})
+	defer client.Close()
+
+	conn := client.Pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redigo.String(conn.Do("GET", "missing")); err != redigo.ErrNil {
+		t.Fatalf("GET missing error(%v), want redigo.ErrNil", err)
+	}
+	if _, err := conn.Do("INCR", "k"); err == nil {
+		t.Fatal("want an error reply")
+	} else if _, ok := err.(redigo.Error); !ok {
+		t.Fatalf("got error %T, want redigo.Error", err)
+	}
+	conn.Send("MULTI")
+	conn.Send("INCR", "k")
+	replies, err := redigo.Values(conn.Do("EXEC"))
+	if err != nil || len(replies) != 1 {
+		t.Fatalf("EXEC = %v, %v", replies, err)
+	}
+	if _, ok := replies[0].(redigo.Error); !ok {
+		t.Fatalf("got EXEC reply %T, want redigo.Error", replies[0])
+	}
+	if _, err := redigo.DoWithTimeout(conn, time.Second, "PING"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedigoPoolCluster(t *testing.T) {
+	a, b, _ := newTestCluster(t)
+	defer a.Close()
+	defer b.Close()
+	client := New(&Config{Network: "tcp", Cluster: true, Addrs: []string{a.Addr()}, MaxIdle: 2})
+	defer client.Close()
+
+	// the connections are routed by key slot
+	conn := client.Pool.Get()
+	defer conn.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if _, err := conn.Do("SET", key, key); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := redigo.String(conn.Do("GET", key)); err != nil || v != key {
+			t.Fatalf("GET %s = %q, %v", key, v, err)
+		}
+	}
+}
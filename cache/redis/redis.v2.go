@@ -1,16 +1,17 @@
 package redis
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
+	"math/rand"
 	"reflect"
 	"strings"
 	"time"
 
 	"fmt"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/net/naming"
 	"github.com/cznic/mathutil"
-	"github.com/gomodule/redigo/redis"
+	redigo "github.com/gomodule/redigo/redis"
 )
 
 type Config struct {
@@ -19,65 +20,208 @@ type Config struct {
 	Auth     string
 	Password string
 	DB       int
+	// cluster
+	Cluster bool     // 集群模式, 通过 CLUSTER SLOTS 发现节点
+	Addrs   []string // 集群种子节点, 为空时使用 Address
+	// sentinel
+	MasterName       string   // sentinel 模式, 非空时通过 SentinelAddrs 发现 master
+	SentinelAddrs    []string // sentinel 节点
+	SentinelPassword string   // sentinel 密码
+	ReadReplica      bool     // sentinel 模式下只读命令走从节点
+	// naming
+	Naming naming.Watcher // 单机模式下的实例发现, 新建连接时按权重选取, 实例变化时重置连接池, 非空时忽略 Address, 不支持 Tracking
+	// codec
+	Codec         string // Load/Store 的编码, gob, json, proto, msgpack, 默认 gob
+	Compress      string // 压缩算法, snappy 或 zstd, 为空不压缩
+	CompressAbove int    // 编码后超过该字节数才压缩, 默认 1024
+	// script
+	Scripts *Scripts // 具名 lua 脚本, 新建连接时预加载, 通过 RunScript 调用
 	// pool
 	MaxActive       int           // 0无限制，给定时间内最大分配的连接数
 	MaxIdle         int           // 最大空闲连接数
 	IdleTimeout     time.Duration // 0不关闭连接，空闲连接时间
 	MaxConnLifetime time.Duration // 0不限制，连接最大的生存时间
+	// client side caching
+	Tracking         string   // GET/HGET 客户端缓存, default, bcast 或 optin, 为空不开启, 需要 redis 6
+	TrackingPrefixes []string // bcast 模式下缓存的 key 前缀, 为空缓存所有 key
+	TrackingEntries  int      // 0不限制，客户端缓存的最大 key 数
 	// connect
 	ConnectTimeout time.Duration
 	ReadTimeout    time.Duration
 	WriteTimeout   time.Duration
+	// observability
+	SlowLog     time.Duration // 慢命令日志阈值, 默认 100ms, 负数关闭
+	Name        string        // 连接池指标名称, 需唯一, 重名时不导出, 为空使用 地址/DB, Naming 模式为 naming/DB
+	HealthCheck time.Duration // PING 健康检查间隔, 0 或负数不开启, 开启后需 Close
 }
 
 type Client struct {
-	sscanKeyLimit int         // 批量获取数量
-	batchLimit    int         // 批量数量限制
-	Pool          *redis.Pool // redis connection pool
+	sscanKeyLimit int           // 批量获取数量
+	batchLimit    int           // 批量数量限制
+	Pool          *redigo.Pool  // redigo 连接池, 兼容旧版本, 连接借自 pool, 集群模式下按 key 路由
+	pool          *redis.Pool   // redis connection pool, 集群模式下为 nil
+	cluster       *cluster      // redis cluster, 单机模式下为 nil
+	sentinel      *sentinel     // redis sentinel, 非 sentinel 模式下为 nil
+	discovery     *discovery    // 实例发现, 未配置 Naming 时为 nil
+	codec         valueCodec    // Load/Store 的编码
+	readTimeout   time.Duration // 读超时, 阻塞命令在阻塞时间上增加该超时
+	addr          string        // 地址, 用于 trace 和慢日志
+	slowLog       time.Duration // 慢命令日志阈值
+	name          string        // 连接池指标名称
+	health        *health       // 健康检查结果
+	scripts       *Scripts      // 具名 lua 脚本
 }
 
 func New(c *Config) *Client {
-	pool := &redis.Pool{
+	client := &Client{
+		sscanKeyLimit: 1000,
+		batchLimit:    5000,
+		codec:         newValueCodec(c),
+		readTimeout:   c.ReadTimeout,
+		addr:          c.Address,
+		slowLog:       c.SlowLog,
+		scripts:       c.Scripts,
+	}
+	if client.slowLog == 0 {
+		client.slowLog = 100 * time.Millisecond
+	}
+	switch {
+	case c.Cluster && len(c.Addrs) > 0:
+		client.addr = strings.Join(c.Addrs, ",")
+	case c.MasterName != "":
+		client.addr = c.MasterName
+	}
+	switch {
+	case c.Cluster:
+		client.cluster = newCluster(c)
+	case c.MasterName != "":
+		client.sentinel = newSentinel(c)
+		client.pool = client.sentinel.master
+	case c.Naming != nil:
+		client.discovery = newDiscovery(c)
+		client.pool = client.discovery.pool
+	default:
+		client.pool = newPool(c, c.Address)
+	}
+	name := c.Name
+	if name == "" {
+		addr := client.addr
+		if c.Naming != nil {
+			addr = "naming"
+		}
+		name = fmt.Sprintf("%s/%d", addr, c.DB)
+	}
+	client.Pool = client.redigoPool()
+	client.startHealth(name, c.HealthCheck)
+	return client
+}
+
+// newPool new a connection pool to the node at addr.
+func newPool(c *Config, addr string) *redis.Pool {
+	return &redis.Pool{
 		MaxActive:       c.MaxActive,
 		MaxIdle:         c.MaxIdle,
 		IdleTimeout:     c.IdleTimeout,
 		MaxConnLifetime: c.MaxConnLifetime,
+		ClientTracking:  newClientTracking(c),
 
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
 			_, err := c.Do("PING")
 			return err
 		},
 		Dial: func() (redis.Conn, error) {
-			options := make([]redis.DialOption, 0)
+			return dial(c, addr)
+		},
+	}
+}
 
-			options = append(options, redis.DialDatabase(c.DB))
-			options = append(options, redis.DialConnectTimeout(c.ConnectTimeout))
-			options = append(options, redis.DialReadTimeout(c.ReadTimeout))
-			options = append(options, redis.DialWriteTimeout(c.WriteTimeout))
+// newClientTracking returns the client side caching of c, nil when disabled.
+func newClientTracking(c *Config) *redis.ClientTracking {
+	if c.Tracking == "" {
+		return nil
+	}
+	return &redis.ClientTracking{
+		Bcast:      c.Tracking == "bcast",
+		Prefixes:   c.TrackingPrefixes,
+		Optin:      c.Tracking == "optin",
+		MaxEntries: c.TrackingEntries,
+	}
+}
 
-			if c.Password != "" {
-				pwdOptions := redis.DialPassword(c.Password)
-				options = append(options, pwdOptions)
-			}
+func dial(c *Config, addr string) (redis.Conn, error) {
+	options := make([]redis.DialOption, 0)
 
-			c, err := redis.Dial(c.Network, c.Address, options...)
-			if err != nil {
-				return nil, err
-			}
+	options = append(options, redis.DialDatabase(c.DB))
+	options = append(options, redis.DialConnectTimeout(c.ConnectTimeout))
+	options = append(options, redis.DialReadTimeout(c.ReadTimeout))
+	options = append(options, redis.DialWriteTimeout(c.WriteTimeout))
 
-			return c, err
-		},
+	if c.Password != "" {
+		pwdOptions := redis.DialPassword(c.Password)
+		options = append(options, pwdOptions)
 	}
-	return &Client{
-		sscanKeyLimit: 1000,
-		batchLimit:    5000,
-		Pool:          pool,
+
+	conn, err := redis.Dial(c.Network, addr, options...)
+	if err != nil || c.Scripts == nil {
+		return conn, err
+	}
+	if err = c.Scripts.load(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// getConn get a connection, routed by key slot under cluster mode.
+func (c *Client) getConn(ctx context.Context) (conn redis.Conn, err error) {
+	if c.cluster != nil {
+		conn, err = c.cluster.GetContext(ctx)
+	} else {
+		conn, err = c.pool.GetContext(ctx)
+	}
+	if err != nil {
+		return
 	}
+	return c.hook(ctx, conn), nil
+}
+
+// dialConn dials a connection outside of the pool for long blocking commands
+// such as SUBSCRIBE, to a random node under cluster mode.
+func (c *Client) dialConn() (conn redis.Conn, err error) {
+	if c.cluster == nil {
+		return c.pool.Dial()
+	}
+	addrs := c.cluster.Masters()
+	if len(addrs) == 0 {
+		addrs = c.cluster.seeds
+	}
+	err = errClusterNoNodes
+	for _, i := range rand.Perm(len(addrs)) {
+		if conn, err = dial(c.cluster.conf, addrs[i]); err == nil {
+			return
+		}
+	}
+	return
+}
+
+// Close releases the resources used by the client.
+func (c *Client) Close() error {
+	c.stopHealth()
+	if c.cluster != nil {
+		return c.cluster.Close()
+	}
+	if c.sentinel != nil {
+		return c.sentinel.Close()
+	}
+	if c.discovery != nil {
+		return c.discovery.Close()
+	}
+	return c.pool.Close()
 }
 
 // do base function
 func (c *Client) do(ctx context.Context, action string, key string, val ...interface{}) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -94,7 +238,7 @@ func (c *Client) do(ctx context.Context, action string, key string, val ...inter
 }
 
 func (c *Client) Load(ctx context.Context, key string, val interface{}) (found bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -109,44 +253,58 @@ func (c *Client) Load(ctx context.Context, key string, val interface{}) (found b
 	if reply == nil {
 		return false, nil // no reply was associated with this key
 	}
+	return true, c.decode(reply, val)
+}
+
+// encode encodes val as stored by Store, integers are stored as is.
+func (c *Client) encode(val interface{}) (interface{}, error) {
+	switch val.(type) {
+	case int, uint, int32, uint32, int64, uint64:
+		return val, nil
+	}
+	return c.codec.marshal(val)
+}
+
+// encodeBytes is encode with integers formatted as redis replies them.
+func (c *Client) encodeBytes(val interface{}) ([]byte, error) {
+	v, err := c.encode(val)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return []byte(fmt.Sprint(v)), nil
+}
+
+// decode decodes a reply stored by Store into val.
+func (c *Client) decode(reply interface{}, val interface{}) (err error) {
 	switch val.(type) {
 	case *int, *uint, *int32, *uint32, *int64, *uint64:
-		num, err := redis.Int64(reply, err)
+		num, err := redis.Int64(reply, nil)
 		if err != nil {
-			return false, err
+			return err
 		}
 		rv := reflect.ValueOf(val)
 		p := rv.Elem()
 		p.SetInt(num)
 	default:
-		b, err := redis.Bytes(reply, err)
+		b, err := redis.Bytes(reply, nil)
 		if err != nil {
-			return false, err
+			return err
 		}
-
-		decoder := gob.NewDecoder(bytes.NewBuffer(b))
-		err = decoder.Decode(val)
+		return c.codec.unmarshal(b, val)
 	}
-
-	return true, err
+	return nil
 }
 
 func (c *Client) Store(ctx context.Context, key string, val interface{}) (err error) {
-	var storeValue interface{}
-	switch val.(type) {
-	case int, uint, int32, uint32, int64, uint64:
-		storeValue = val
-	default:
-		buf := new(bytes.Buffer)
-		encoder := gob.NewEncoder(buf)
-		err = encoder.Encode(val)
-		if err != nil {
-			return err
-		}
-		storeValue = buf.Bytes()
+	storeValue, err := c.encode(val)
+	if err != nil {
+		return err
 	}
 
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -166,16 +324,12 @@ func (c *Client) SetEx(ctx context.Context, key string, val interface{}, maxAge
 	case int, uint, int32, uint32, int64, uint64, string:
 		storeValue = val
 	default:
-		buf := new(bytes.Buffer)
-		encoder := gob.NewEncoder(buf)
-		err = encoder.Encode(val)
-		if err != nil {
+		if storeValue, err = c.codec.marshal(val); err != nil {
 			return err
 		}
-		storeValue = buf.Bytes()
 	}
 
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -192,7 +346,7 @@ func (c *Client) SetEx(ctx context.Context, key string, val interface{}, maxAge
 }
 
 func (c *Client) SetNxEx(ctx context.Context, key string, val int, expire int) (success bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -209,7 +363,7 @@ func (c *Client) SetNxEx(ctx context.Context, key string, val int, expire int) (
 }
 
 func (c *Client) SetNx(ctx context.Context, key string, val int) (success bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -226,7 +380,7 @@ func (c *Client) SetNx(ctx context.Context, key string, val int) (success bool,
 }
 
 func (c *Client) GetString(ctx context.Context, key string) (content string, err error) { //refactor
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -242,7 +396,7 @@ func (c *Client) GetString(ctx context.Context, key string) (content string, err
 }
 
 func (c *Client) GetByte(ctx context.Context, key string) (content []byte, err error) { //refactor
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -258,7 +412,7 @@ func (c *Client) GetByte(ctx context.Context, key string) (content []byte, err e
 }
 
 func (c *Client) GetInt64(ctx context.Context, key string) (content int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -274,7 +428,7 @@ func (c *Client) GetInt64(ctx context.Context, key string) (content int64, err e
 }
 
 func (c *Client) GetInt(ctx context.Context, key string) (content int, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -290,7 +444,7 @@ func (c *Client) GetInt(ctx context.Context, key string) (content int, err error
 }
 
 func (c *Client) GetBool(ctx context.Context, key string) (val bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -307,7 +461,7 @@ func (c *Client) GetBool(ctx context.Context, key string) (val bool, err error)
 }
 
 func (c *Client) Incr(ctx context.Context, key string) (counter int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -320,7 +474,7 @@ func (c *Client) Incr(ctx context.Context, key string) (counter int64, err error
 }
 
 func (c *Client) IncrBy(ctx context.Context, key string, counter int64) (result int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -333,7 +487,7 @@ func (c *Client) IncrBy(ctx context.Context, key string, counter int64) (result
 }
 
 func (c *Client) Decrease(ctx context.Context, key string) (counter int, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -346,7 +500,7 @@ func (c *Client) Decrease(ctx context.Context, key string) (counter int, err err
 }
 
 func (c *Client) Delete(ctx context.Context, key string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -366,7 +520,7 @@ func (c *Client) MultiDelete(ctx context.Context, keys []string) (err error) {
 	for _, k := range keys {
 		val = append(val, k)
 	}
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -376,8 +530,10 @@ func (c *Client) MultiDelete(ctx context.Context, keys []string) (err error) {
 }
 
 // Keys 获取少量key
+//
+// Deprecated: KEYS blocks the server until every key is checked, use ScanEach.
 func (c *Client) Keys(ctx context.Context, pattern string) (keys []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -394,7 +550,7 @@ func (c *Client) Keys(ctx context.Context, pattern string) (keys []string, err e
 }
 
 func (c *Client) SAdd(ctx context.Context, key string, member string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -406,7 +562,7 @@ func (c *Client) SAdd(ctx context.Context, key string, member string) (err error
 }
 
 func (c *Client) Spop(ctx context.Context, key string) (member string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -419,7 +575,7 @@ func (c *Client) Spop(ctx context.Context, key string) (member string, err error
 }
 
 func (c *Client) SRem(ctx context.Context, key string, member string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -436,7 +592,7 @@ func (c *Client) SRems(ctx context.Context, key string, members []string) (err e
 		args = append(args, member)
 	}
 
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -448,7 +604,7 @@ func (c *Client) SRems(ctx context.Context, key string, members []string) (err e
 }
 
 func (c *Client) Expire(ctx context.Context, key string, maxAge int) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -460,7 +616,7 @@ func (c *Client) Expire(ctx context.Context, key string, maxAge int) (err error)
 }
 
 func (c *Client) SAddMult(ctx context.Context, params ...string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -473,7 +629,7 @@ func (c *Client) SAddMult(ctx context.Context, params ...string) (err error) {
 }
 
 func (c *Client) SAddMultValues(ctx context.Context, key string, values []string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -504,7 +660,7 @@ func (c *Client) SAddLargeMult(ctx context.Context, key string, values []string)
 }
 
 func (c *Client) Scard(ctx context.Context, key string) (num int, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -517,7 +673,7 @@ func (c *Client) Scard(ctx context.Context, key string) (num int, err error) {
 }
 
 func (c *Client) SMembers(ctx context.Context, key string) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -531,7 +687,7 @@ func (c *Client) SMembers(ctx context.Context, key string) (members []string, er
 }
 
 func (c *Client) SisMember(ctx context.Context, key string, member interface{}) (has bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -545,7 +701,7 @@ func (c *Client) SisMember(ctx context.Context, key string, member interface{})
 }
 
 func (c *Client) SINTER(ctx context.Context, keys ...string) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -563,7 +719,7 @@ func (c *Client) SINTER(ctx context.Context, keys ...string) (members []string,
 }
 
 func (c *Client) SDIFF(ctx context.Context, keys ...string) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -586,7 +742,7 @@ func (c *Client) SDIFFSTORE(ctx context.Context, keys ...string) (err error) {
 	for _, v := range keys {
 		val = append(val, v)
 	}
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -597,7 +753,7 @@ func (c *Client) SDIFFSTORE(ctx context.Context, keys ...string) (err error) {
 }
 
 func (c *Client) SRandMember(ctx context.Context, key string, count int) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -615,7 +771,7 @@ func (c *Client) SRandMember(ctx context.Context, key string, count int) (member
 }
 
 func (c *Client) Exists(ctx context.Context, key string) (found bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -637,7 +793,7 @@ func (c *Client) Exists(ctx context.Context, key string) (found bool, err error)
 }
 
 func (c *Client) ZAdd(ctx context.Context, key string, score int64, member string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -650,7 +806,7 @@ func (c *Client) ZAdd(ctx context.Context, key string, score int64, member strin
 
 // ZAddMulti first element of val must be key
 func (c *Client) ZAddMulti(ctx context.Context, val []interface{}) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -666,7 +822,7 @@ func (c *Client) ZAddMulti(ctx context.Context, val []interface{}) (err error) {
 }
 
 func (c *Client) ZRem(ctx context.Context, key string, member string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -678,7 +834,7 @@ func (c *Client) ZRem(ctx context.Context, key string, member string) (err error
 }
 
 func (c *Client) ZRemRangeByRank(ctx context.Context, key string, start, stop int) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -691,7 +847,7 @@ func (c *Client) ZRemRangeByRank(ctx context.Context, key string, start, stop in
 }
 
 func (c *Client) ZRemRangeByScore(ctx context.Context, key string, start, stop int) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -708,7 +864,7 @@ func (c *Client) ZRemBatch(ctx context.Context, key string, members []string) (e
 	for _, member := range members {
 		args = append(args, member)
 	}
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -720,7 +876,7 @@ func (c *Client) ZRemBatch(ctx context.Context, key string, members []string) (e
 }
 
 func (c *Client) ZRange(ctx context.Context, key string, start, stop int) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -741,7 +897,7 @@ func (c *Client) ZRange(ctx context.Context, key string, start, stop int) (membe
 }
 
 func (c *Client) ZRangeWithScores(ctx context.Context, key string, start, stop int) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -758,7 +914,7 @@ func (c *Client) ZRangeWithScores(ctx context.Context, key string, start, stop i
 }
 
 func (c *Client) ZIncrby(ctx context.Context, key string, inc int, member string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -771,7 +927,7 @@ func (c *Client) ZIncrby(ctx context.Context, key string, inc int, member string
 }
 
 func (c *Client) ZUnionstore(ctx context.Context, targetKey string, originKey string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -784,7 +940,7 @@ func (c *Client) ZUnionstore(ctx context.Context, targetKey string, originKey st
 }
 
 func (c *Client) ZRank(ctx context.Context, key, member string) (rank int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -800,7 +956,7 @@ func (c *Client) ZRank(ctx context.Context, key, member string) (rank int64, err
 }
 
 func (c *Client) MGetBytes(ctx context.Context, keys []string) (bs [][]byte, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -825,7 +981,7 @@ func (c *Client) MGetBytes(ctx context.Context, keys []string) (bs [][]byte, err
 }
 
 func (c *Client) MGetOrigin(ctx context.Context, keys []string) (values []interface{}, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -839,7 +995,7 @@ func (c *Client) MGetOrigin(ctx context.Context, keys []string) (values []interf
 }
 
 func (c *Client) MGetInt(ctx context.Context, keys []string) (values []int, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -861,7 +1017,7 @@ func (c *Client) MGetInt(ctx context.Context, keys []string) (values []int, err
 }
 
 func (c *Client) ZRevRange(ctx context.Context, key string, start, stop int64, val interface{}) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -881,7 +1037,7 @@ func (c *Client) ZRevRange(ctx context.Context, key string, start, stop int64, v
 }
 
 func (c *Client) ZRangeByScoreWithScores(ctx context.Context, key string, start, stop int64, val interface{}) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -901,7 +1057,7 @@ func (c *Client) ZRangeByScoreWithScores(ctx context.Context, key string, start,
 }
 
 func (c *Client) ZRangeByScore(ctx context.Context, key string, start, stop int64, val interface{}) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -921,7 +1077,7 @@ func (c *Client) ZRangeByScore(ctx context.Context, key string, start, stop int6
 }
 
 func (c *Client) ZRevRank(ctx context.Context, key string, member string) (found bool, rank int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -938,7 +1094,7 @@ func (c *Client) ZRevRank(ctx context.Context, key string, member string) (found
 }
 
 func (c *Client) ZRevRanks(ctx context.Context, key string, members []string) (founds []bool, ranks []int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -966,7 +1122,7 @@ func (c *Client) ZRevRanks(ctx context.Context, key string, members []string) (f
 }
 
 func (c *Client) ZScore(ctx context.Context, key string, member string) (found bool, score float64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -983,7 +1139,7 @@ func (c *Client) ZScore(ctx context.Context, key string, member string) (found b
 }
 
 func (c *Client) MExists(ctx context.Context, keys []string) (found []bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1011,7 +1167,7 @@ func (c *Client) LPushBatch(ctx context.Context, key string, members []string) (
 	for _, member := range members {
 		args = append(args, member)
 	}
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1023,7 +1179,7 @@ func (c *Client) LPushBatch(ctx context.Context, key string, members []string) (
 }
 
 func (c *Client) LRange(ctx context.Context, key string, start, stop int64) (members []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1048,7 +1204,7 @@ func (c *Client) RPush(ctx context.Context, key string, members []string) (err e
 	for _, member := range members {
 		args = append(args, member)
 	}
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1060,7 +1216,7 @@ func (c *Client) RPush(ctx context.Context, key string, members []string) (err e
 }
 
 func (c *Client) LPop(ctx context.Context, key string) (member string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1097,7 +1253,7 @@ func (c *Client) LPushLargeMult(ctx context.Context, key string, values []string
 func (c *Client) BRPop(ctx context.Context, key string) (rlt []string, err error) {
 	args := []interface{}{key}
 	args = append(args, "0")
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1114,7 +1270,7 @@ func (c *Client) BRPop(ctx context.Context, key string) (rlt []string, err error
 }
 
 func (c *Client) Rpop(ctx context.Context, key string) (member string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1124,7 +1280,7 @@ func (c *Client) Rpop(ctx context.Context, key string) (member string, err error
 }
 
 func (c *Client) ping(ctx context.Context) (bool, error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return false, nil
 	}
@@ -1139,7 +1295,7 @@ func (c *Client) ping(ctx context.Context) (bool, error) {
 func (c *Client) HMSet(ctx context.Context, key string, kv ...interface{}) (err error) {
 	var val = []interface{}{key}
 	val = append(val, kv...)
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1155,7 +1311,7 @@ func (c *Client) HMSet(ctx context.Context, key string, kv ...interface{}) (err
 }
 
 func (c *Client) HExists(ctx context.Context, key, field string) (ok bool, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1178,7 +1334,7 @@ func (c *Client) PFAdd(ctx context.Context, key string, val ...interface{}) (err
 
 // PFCount <=> PFCOUNT key element and others [others]
 func (c *Client) PFCount(ctx context.Context, key string, others ...interface{}) (count int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1200,7 +1356,7 @@ func (c *Client) PFMerge(ctx context.Context, destkey string, sourcekey string,
 
 // HashIncrBy hash increase by...
 func (c *Client) HashIncrBy(ctx context.Context, key string, field string, by int64) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1216,7 +1372,7 @@ func (c *Client) HashIncrBy(ctx context.Context, key string, field string, by in
 
 // HashGetAllInt hash get all [integer]
 func (c *Client) HashGetAllInt(ctx context.Context, key string) (result map[string]int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1228,7 +1384,7 @@ func (c *Client) HashGetAllInt(ctx context.Context, key string) (result map[stri
 }
 
 func (c *Client) HashGetAllString(ctx context.Context, key string) (result map[string]string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1240,7 +1396,7 @@ func (c *Client) HashGetAllString(ctx context.Context, key string) (result map[s
 }
 
 func (c *Client) HashKeys(ctx context.Context, key string) (keys []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1258,7 +1414,7 @@ func (c *Client) HashKeys(ctx context.Context, key string) (keys []string, err e
 }
 
 func (c *Client) HGet(ctx context.Context, key, field string) (member string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1271,7 +1427,7 @@ func (c *Client) HGet(ctx context.Context, key, field string) (member string, er
 }
 
 func (c *Client) TTL(ctx context.Context, key string) (reply int64, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getReadConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1285,7 +1441,7 @@ func (c *Client) TTL(ctx context.Context, key string) (reply int64, err error) {
 }
 
 func (c *Client) HDel(ctx context.Context, key, field string) (err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
@@ -1295,7 +1451,7 @@ func (c *Client) HDel(ctx context.Context, key, field string) (err error) {
 }
 
 func (c *Client) SScan(ctx context.Context, key string) (val []string, err error) {
-	conn, err := c.Pool.GetContext(ctx)
+	conn, err := c.getConn(ctx)
 	if err != nil {
 		return
 	}
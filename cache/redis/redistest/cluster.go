@@ -0,0 +1,126 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// _clusterSlots is the number of hash slots of a cluster.
+const _clusterSlots = 16384
+
+// Slots is a range of the hash slots of a cluster served by a node.
+type Slots struct {
+	Start, End int
+	Addr       string // the node serving the slots
+}
+
+// SetCluster makes the server a node of a cluster with the slot map slots:
+// CLUSTER SLOTS replies it, commands on keys of the slots of other nodes are
+// redirected with MOVED, and commands on keys of several slots fail with
+// CROSSSLOT. The map may differ between the nodes, such as during a
+// resharding.
+func (s *Server) SetCluster(slots []Slots) {
+	s.mu.Lock()
+	s.slots = append([]Slots(nil), slots...)
+	s.mu.Unlock()
+}
+
+func registerCluster() {
+	register("CLUSTER", 2, -1, cmdCluster)
+}
+
+func cmdCluster(c *client, args []string) interface{} {
+	if c.srv.slots == nil {
+		return errors.New("ERR This instance has cluster support disabled")
+	}
+	switch strings.ToUpper(args[1]) {
+	case "SLOTS":
+		reply := make([]interface{}, 0, len(c.srv.slots))
+		for _, s := range c.srv.slots {
+			host, port, _ := net.SplitHostPort(s.Addr)
+			p, _ := strconv.Atoi(port)
+			reply = append(reply, []interface{}{s.Start, s.End, []interface{}{host, p}})
+		}
+		return reply
+	case "KEYSLOT":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		return hashSlot(args[2])
+	}
+	return fmt.Errorf("ERR Unknown subcommand or wrong number of arguments for '%s'", args[1])
+}
+
+// redirect checks the keys of a command are served by the node, with mu held.
+func (c *client) redirect(name string, args []string) error {
+	s := c.srv
+	if s.slots == nil {
+		return nil
+	}
+	slot := -1
+	for _, key := range commandKeys(name, args) {
+		n := hashSlot(key)
+		if slot >= 0 && n != slot {
+			return errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+		slot = n
+	}
+	if slot < 0 {
+		return nil
+	}
+	for _, r := range s.slots {
+		if slot >= r.Start && slot <= r.End {
+			if r.Addr == s.Addr() {
+				return nil
+			}
+			return fmt.Errorf("MOVED %d %s", slot, r.Addr)
+		}
+	}
+	return errors.New("CLUSTERDOWN Hash slot not served")
+}
+
+// commandKeys returns the keys of a command.
+func commandKeys(name string, args []string) []string {
+	switch name {
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO":
+		if len(args) < 3 {
+			return nil
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 || 3+n > len(args) {
+			return nil
+		}
+		return args[3 : 3+n]
+	case "XREADGROUP":
+		x, _ := parseXReadGroup(args)
+		return x.keys
+	}
+	if spec, ok := _keySpecs[name]; ok {
+		return spec.keys(args)
+	}
+	return nil
+}
+
+// hashSlot returns the cluster slot of key, honoring {hash tags}.
+func hashSlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc % _clusterSlots)
+}
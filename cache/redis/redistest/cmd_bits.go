@@ -0,0 +1,303 @@
+package redistest
+
+import (
+	"errors"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// _maxBitOffset is the size limit of a string, 512MB.
+const _maxBitOffset = 1<<32 - 1
+
+var (
+	errBitOffset = errors.New("ERR bit offset is not an integer or out of range")
+	errBitType   = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+)
+
+func registerBits() {
+	register("SETBIT", 4, 4, cmdSetBit)
+	register("GETBIT", 3, 3, cmdGetBit)
+	register("BITCOUNT", 2, 5, cmdBitCount)
+	register("BITFIELD", 2, -1, cmdBitField)
+}
+
+func parseBitOffset(s string) (uint64, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n > _maxBitOffset {
+		return 0, errBitOffset
+	}
+	return n, nil
+}
+
+// getBits returns n bits of buf from offset, the first bit is the most
+// significant one of the first byte.
+func getBits(buf []byte, offset uint64, n uint) uint64 {
+	var v uint64
+	for i := uint64(0); i < uint64(n); i++ {
+		v <<= 1
+		if byteIdx := (offset + i) / 8; byteIdx < uint64(len(buf)) && buf[byteIdx]&(0x80>>((offset+i)%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// setBits writes the n low bits of v to buf from offset, growing buf if needed.
+func setBits(buf []byte, offset uint64, n uint, v uint64) []byte {
+	if end := (offset + uint64(n) + 7) / 8; end > uint64(len(buf)) {
+		buf = append(buf, make([]byte, end-uint64(len(buf)))...)
+	}
+	for i := uint64(0); i < uint64(n); i++ {
+		mask := byte(0x80 >> ((offset + i) % 8))
+		if v&(1<<(uint64(n)-1-i)) != 0 {
+			buf[(offset+i)/8] |= mask
+		} else {
+			buf[(offset+i)/8] &^= mask
+		}
+	}
+	return buf
+}
+
+func cmdSetBit(c *client, args []string) interface{} {
+	offset, err := parseBitOffset(args[2])
+	if err != nil {
+		return err
+	}
+	if args[3] != "0" && args[3] != "1" {
+		return errors.New("ERR bit is not an integer or out of range")
+	}
+	e, err := c.db().create(args[1], typeString, c.now())
+	if err != nil {
+		return err
+	}
+	buf := []byte(e.str)
+	old := getBits(buf, offset, 1)
+	e.str = string(setBits(buf, offset, 1, uint64(args[3][0]-'0')))
+	return int(old)
+}
+
+func cmdGetBit(c *client, args []string) interface{} {
+	offset, err := parseBitOffset(args[2])
+	if err != nil {
+		return err
+	}
+	v, _, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	return int(getBits([]byte(v), offset, 1))
+}
+
+// bitRange resolves the start and end of a range of size n, negative ones
+// counting from the end, empty if start > end.
+func bitRange(start, end, n int64) (int64, int64) {
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+	return start, end
+}
+
+func cmdBitCount(c *client, args []string) interface{} {
+	v, _, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	buf := []byte(v)
+	if len(args) == 2 {
+		n := 0
+		for _, b := range buf {
+			n += bits.OnesCount8(b)
+		}
+		return n
+	}
+	if len(args) == 3 {
+		return errSyntax
+	}
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	unit := "BYTE"
+	if len(args) == 5 {
+		if unit = strings.ToUpper(args[4]); unit != "BYTE" && unit != "BIT" {
+			return errSyntax
+		}
+	}
+	size := int64(len(buf))
+	if unit == "BIT" {
+		size *= 8
+	}
+	start, end = bitRange(start, end, size)
+	n := 0
+	for i := start; i <= end; i++ {
+		if unit == "BIT" {
+			n += int(getBits(buf, uint64(i), 1))
+		} else {
+			n += bits.OnesCount8(buf[i])
+		}
+	}
+	return n
+}
+
+// bitfieldType is a type of BITFIELD, i<bits> or u<bits>.
+type bitfieldType struct {
+	signed bool
+	bits   uint
+}
+
+func parseBitfieldType(s string) (t bitfieldType, err error) {
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'u') {
+		return t, errBitType
+	}
+	n, err := strconv.Atoi(s[1:])
+	t = bitfieldType{signed: s[0] == 'i', bits: uint(n)}
+	if err != nil || n < 1 || (t.signed && n > 64) || (!t.signed && n > 63) {
+		return t, errBitType
+	}
+	return t, nil
+}
+
+// parseBitfieldOffset parses an offset in bits, or in multiples of the type
+// width when prefixed by #.
+func parseBitfieldOffset(s string, t bitfieldType) (uint64, error) {
+	if strings.HasPrefix(s, "#") {
+		n, err := parseBitOffset(s[1:])
+		if err != nil || n*uint64(t.bits) > _maxBitOffset {
+			return 0, errBitOffset
+		}
+		return n * uint64(t.bits), nil
+	}
+	return parseBitOffset(s)
+}
+
+// value converts the raw bits of t to its value.
+func (t bitfieldType) value(raw uint64) int64 {
+	if t.signed && t.bits < 64 && raw&(1<<(t.bits-1)) != 0 {
+		return int64(raw) - int64(1)<<t.bits
+	}
+	return int64(raw)
+}
+
+// fit applies the overflow mode to v, ok is false if it fails.
+func (t bitfieldType) fit(v *big.Int, overflow string) (int64, bool) {
+	min, max := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), t.bits)
+	if t.signed {
+		min.Neg(new(big.Int).Lsh(big.NewInt(1), t.bits-1))
+		max.Lsh(big.NewInt(1), t.bits-1)
+	}
+	max.Sub(max, big.NewInt(1))
+	if v.Cmp(min) >= 0 && v.Cmp(max) <= 0 {
+		return v.Int64(), true
+	}
+	switch overflow {
+	case "SAT":
+		if v.Cmp(min) < 0 {
+			return min.Int64(), true
+		}
+		return max.Int64(), true
+	case "FAIL":
+		return 0, false
+	}
+	// WRAP
+	mod := new(big.Int).Lsh(big.NewInt(1), t.bits)
+	raw := new(big.Int).Mod(v, mod)
+	return t.value(raw.Uint64()), true
+}
+
+func cmdBitField(c *client, args []string) interface{} {
+	e, err := c.db().typed(args[1], typeString, c.now())
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	if e != nil {
+		buf = []byte(e.str)
+	}
+	var (
+		replies  = []interface{}{}
+		overflow = "WRAP"
+		written  bool
+	)
+	for i := 2; i < len(args); {
+		op := strings.ToUpper(args[i])
+		if op == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			switch overflow = strings.ToUpper(args[i+1]); overflow {
+			case "WRAP", "SAT", "FAIL":
+			default:
+				return errors.New("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+		n := 3
+		if op == "GET" {
+			n = 2
+		} else if op != "SET" && op != "INCRBY" {
+			return errSyntax
+		}
+		if i+n >= len(args) {
+			return errSyntax
+		}
+		t, err := parseBitfieldType(args[i+1])
+		if err != nil {
+			return err
+		}
+		offset, err := parseBitfieldOffset(args[i+2], t)
+		if err != nil {
+			return err
+		}
+		old := t.value(getBits(buf, offset, t.bits))
+		if op == "GET" {
+			replies = append(replies, old)
+			i += n + 1
+			continue
+		}
+		arg, err := parseInt(args[i+3])
+		if err != nil {
+			return err
+		}
+		v := big.NewInt(arg)
+		if op == "INCRBY" {
+			v.Add(v, big.NewInt(old))
+		}
+		fitted, ok := t.fit(v, overflow)
+		switch {
+		case !ok:
+			replies = append(replies, nil)
+		case op == "SET":
+			replies = append(replies, old)
+		default:
+			replies = append(replies, fitted)
+		}
+		if ok {
+			buf = setBits(buf, offset, t.bits, uint64(fitted))
+			written = true
+		}
+		i += n + 1
+	}
+	if written {
+		if e == nil {
+			e, _ = c.db().create(args[1], typeString, c.now())
+		}
+		e.str = string(buf)
+	}
+	return replies
+}
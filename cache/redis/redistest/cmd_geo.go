@@ -0,0 +1,368 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// geo members are stored in a sorted set scored by their 52 bits geohash, as
+// redis does.
+const (
+	_geoStep      = 26
+	_geoLatLimit  = 85.05112878
+	_geoLngLimit  = 180
+	_earthRadiusM = 6372797.560856
+)
+
+var (
+	errGeoUnit   = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+	errGeoMember = errors.New("ERR could not decode requested zset member")
+)
+
+func registerGeo() {
+	register("GEOADD", 5, -1, cmdGeoAdd)
+	register("GEOPOS", 2, -1, cmdGeoPos)
+	register("GEODIST", 4, 5, cmdGeoDist)
+	register("GEOSEARCH", 7, -1, cmdGeoSearch)
+}
+
+// geoEncode interleaves the cells of lat and lng, lat on the odd bits.
+func geoEncode(lng, lat float64) float64 {
+	cells := float64(uint64(1) << _geoStep)
+	ilat := uint64((lat + _geoLatLimit) / (2 * _geoLatLimit) * cells)
+	ilng := uint64((lng + _geoLngLimit) / (2 * _geoLngLimit) * cells)
+	// NOTE: the limits are in the last cells.
+	if max := uint64(cells) - 1; ilat > max {
+		ilat = max
+	}
+	if max := uint64(cells) - 1; ilng > max {
+		ilng = max
+	}
+	var hash uint64
+	for i := uint(0); i < _geoStep; i++ {
+		hash |= (ilat>>i&1)<<(2*i) | (ilng>>i&1)<<(2*i+1)
+	}
+	return float64(hash)
+}
+
+// geoDecode returns the center of the cell of a geohash.
+func geoDecode(score float64) (lng, lat float64) {
+	hash := uint64(score)
+	var ilat, ilng uint64
+	for i := uint(0); i < _geoStep; i++ {
+		ilat |= (hash >> (2 * i) & 1) << i
+		ilng |= (hash >> (2*i + 1) & 1) << i
+	}
+	cells := float64(uint64(1) << _geoStep)
+	lat = -_geoLatLimit + (float64(ilat)+0.5)/cells*2*_geoLatLimit
+	lng = -_geoLngLimit + (float64(ilng)+0.5)/cells*2*_geoLngLimit
+	return math.Max(-_geoLngLimit, math.Min(_geoLngLimit, lng)), math.Max(-_geoLatLimit, math.Min(_geoLatLimit, lat))
+}
+
+// geoDistance is the haversine distance in meters.
+func geoDistance(lng1, lat1, lng2, lat2 float64) float64 {
+	rad := math.Pi / 180
+	u := math.Sin((lat2 - lat1) * rad / 2)
+	v := math.Sin((lng2 - lng1) * rad / 2)
+	a := u*u + math.Cos(lat1*rad)*math.Cos(lat2*rad)*v*v
+	return 2 * _earthRadiusM * math.Asin(math.Sqrt(a))
+}
+
+func geoUnit(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, errGeoUnit
+}
+
+func parseGeoPoint(lng, lat string) (float64, float64, error) {
+	x, err := parseFloat(lng)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := parseFloat(lat)
+	if err != nil {
+		return 0, 0, err
+	}
+	if math.Abs(x) > _geoLngLimit || math.Abs(y) > _geoLatLimit {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", x, y)
+	}
+	return x, y, nil
+}
+
+func formatCoord(f float64) string {
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+func cmdGeoAdd(c *client, args []string) interface{} {
+	var nx, xx, ch bool
+	i := 2
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		default:
+			break flags
+		}
+	}
+	if (len(args)-i)%3 != 0 || i == len(args) {
+		return errors.New("ERR wrong number of arguments for 'geoadd' command")
+	}
+	if nx && xx {
+		return errors.New("ERR XX and NX options at the same time are not compatible")
+	}
+	scores := make([]float64, 0, (len(args)-i)/3)
+	for j := i; j < len(args); j += 3 {
+		lng, lat, err := parseGeoPoint(args[j], args[j+1])
+		if err != nil {
+			return err
+		}
+		scores = append(scores, geoEncode(lng, lat))
+	}
+	e, err := c.db().create(args[1], typeZSet, c.now())
+	if err != nil {
+		return err
+	}
+	n := 0
+	for j, score := range scores {
+		_, added, changed, _ := zaddScore(e, args[i+3*j+2], score, false, nx, xx, false, false)
+		if added || (ch && changed) {
+			n++
+		}
+	}
+	c.db().cleanup(args[1])
+	return n
+}
+
+func cmdGeoPos(c *client, args []string) interface{} {
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	reply := make([]interface{}, 0, len(args)-2)
+	for _, m := range args[2:] {
+		score, ok := 0.0, false
+		if e != nil {
+			score, ok = e.zset[m]
+		}
+		if !ok {
+			reply = append(reply, nullArray{})
+			continue
+		}
+		lng, lat := geoDecode(score)
+		reply = append(reply, []interface{}{formatCoord(lng), formatCoord(lat)})
+	}
+	return reply
+}
+
+func cmdGeoDist(c *client, args []string) interface{} {
+	unit := 1.0
+	if len(args) == 5 {
+		var err error
+		if unit, err = geoUnit(args[4]); err != nil {
+			return err
+		}
+	}
+	e, err := c.zset(args[1])
+	if err != nil || e == nil {
+		return err
+	}
+	s1, ok1 := e.zset[args[2]]
+	s2, ok2 := e.zset[args[3]]
+	if !ok1 || !ok2 {
+		return nil
+	}
+	lng1, lat1 := geoDecode(s1)
+	lng2, lat2 := geoDecode(s2)
+	return strconv.FormatFloat(geoDistance(lng1, lat1, lng2, lat2)/unit, 'f', 4, 64)
+}
+
+// geoQuery is the area and the options of GEOSEARCH.
+type geoQuery struct {
+	member              string
+	lng, lat            float64
+	fromLonLat          bool
+	radius              float64 // meters, 0 for a box
+	width, height       float64 // meters
+	unit                float64
+	shape               bool
+	desc, sorted        bool
+	count               int
+	any                 bool
+	withCoord, withDist bool
+	withHash            bool
+}
+
+func parseGeoQuery(args []string) (q geoQuery, err error) {
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "FROMMEMBER" && i+1 < len(args) && q.member == "" && !q.fromLonLat:
+			q.member = args[i+1]
+			i++
+		case opt == "FROMLONLAT" && i+2 < len(args) && q.member == "" && !q.fromLonLat:
+			if q.lng, q.lat, err = parseGeoPoint(args[i+1], args[i+2]); err != nil {
+				return
+			}
+			q.fromLonLat = true
+			i += 2
+		case opt == "BYRADIUS" && i+2 < len(args) && !q.shape:
+			if q.radius, err = parseFloat(args[i+1]); err != nil {
+				return
+			}
+			if q.unit, err = geoUnit(args[i+2]); err != nil {
+				return
+			}
+			q.radius *= q.unit
+			q.shape = true
+			i += 2
+		case opt == "BYBOX" && i+3 < len(args) && !q.shape:
+			if q.width, err = parseFloat(args[i+1]); err != nil {
+				return
+			}
+			if q.height, err = parseFloat(args[i+2]); err != nil {
+				return
+			}
+			if q.unit, err = geoUnit(args[i+3]); err != nil {
+				return
+			}
+			q.width, q.height = q.width*q.unit, q.height*q.unit
+			q.shape = true
+			i += 3
+		case opt == "ASC" || opt == "DESC":
+			q.desc, q.sorted = opt == "DESC", true
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := parseInt(args[i+1])
+			if err != nil || n <= 0 {
+				return q, errors.New("ERR COUNT must be > 0")
+			}
+			q.count = int(n)
+			i++
+			if i+1 < len(args) && strings.ToUpper(args[i+1]) == "ANY" {
+				q.any = true
+				i++
+			}
+		case opt == "WITHCOORD":
+			q.withCoord = true
+		case opt == "WITHDIST":
+			q.withDist = true
+		case opt == "WITHHASH":
+			q.withHash = true
+		default:
+			return q, errSyntax
+		}
+	}
+	if q.member == "" && !q.fromLonLat {
+		return q, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch")
+	}
+	if !q.shape {
+		return q, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch")
+	}
+	return q, nil
+}
+
+// contains returns the distance of a point to the center, ok if it is in
+// the area.
+func (q *geoQuery) contains(lng, lat float64) (dist float64, ok bool) {
+	if q.radius > 0 {
+		dist = geoDistance(q.lng, q.lat, lng, lat)
+		return dist, dist <= q.radius
+	}
+	if math.Abs(lat-q.lat)*math.Pi/180*_earthRadiusM > q.height/2 {
+		return 0, false
+	}
+	if geoDistance(q.lng, lat, lng, lat) > q.width/2 {
+		return 0, false
+	}
+	return geoDistance(q.lng, q.lat, lng, lat), true
+}
+
+func cmdGeoSearch(c *client, args []string) interface{} {
+	q, err := parseGeoQuery(args[2:])
+	if err != nil {
+		return err
+	}
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return []interface{}{}
+	}
+	if q.member != "" {
+		score, ok := e.zset[q.member]
+		if !ok {
+			return errGeoMember
+		}
+		q.lng, q.lat = geoDecode(score)
+	}
+
+	type found struct {
+		member   string
+		dist     float64
+		lng, lat float64
+	}
+	var all []found
+	for m, score := range e.zset {
+		lng, lat := geoDecode(score)
+		if dist, ok := q.contains(lng, lat); ok {
+			all = append(all, found{m, dist, lng, lat})
+		}
+	}
+	if q.sorted || (q.count > 0 && !q.any) {
+		sort.Slice(all, func(i, j int) bool {
+			if all[i].dist != all[j].dist {
+				return all[i].dist < all[j].dist != q.desc
+			}
+			return all[i].member < all[j].member
+		})
+	} else {
+		// NOTE: in the order of the sorted set, not of the map.
+		sort.Slice(all, func(i, j int) bool {
+			si, sj := e.zset[all[i].member], e.zset[all[j].member]
+			if si != sj {
+				return si < sj
+			}
+			return all[i].member < all[j].member
+		})
+	}
+	if q.count > 0 && q.count < len(all) {
+		all = all[:q.count]
+	}
+
+	reply := make([]interface{}, 0, len(all))
+	for _, f := range all {
+		if !q.withDist && !q.withHash && !q.withCoord {
+			reply = append(reply, f.member)
+			continue
+		}
+		item := []interface{}{f.member}
+		if q.withDist {
+			item = append(item, strconv.FormatFloat(f.dist/q.unit, 'f', 4, 64))
+		}
+		if q.withHash {
+			item = append(item, int64(e.zset[f.member]))
+		}
+		if q.withCoord {
+			item = append(item, []interface{}{formatCoord(f.lng), formatCoord(f.lat)})
+		}
+		reply = append(reply, item)
+	}
+	return reply
+}
@@ -0,0 +1,219 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func registerHashes() {
+	register("HSET", 4, -1, cmdHSet)
+	register("HMSET", 4, -1, cmdHSet)
+	register("HSETNX", 4, 4, cmdHSetNx)
+	register("HGET", 3, 3, cmdHGet)
+	register("HMGET", 3, -1, cmdHMGet)
+	register("HGETALL", 2, 2, cmdHGetAll)
+	register("HDEL", 3, -1, cmdHDel)
+	register("HEXISTS", 3, 3, cmdHExists)
+	register("HLEN", 2, 2, cmdHLen)
+	register("HKEYS", 2, 2, cmdHKeys)
+	register("HVALS", 2, 2, cmdHVals)
+	register("HINCRBY", 4, 4, cmdHIncrBy)
+	register("HINCRBYFLOAT", 4, 4, cmdHIncrByFloat)
+	register("HSCAN", 3, -1, cmdHScan)
+}
+
+func (c *client) hash(key string) (map[string]string, error) {
+	e, err := c.db().typed(key, typeHash, c.now())
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.hash, nil
+}
+
+func cmdHSet(c *client, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errors.New("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+	}
+	e, err := c.db().create(args[1], typeHash, c.now())
+	if err != nil {
+		return err
+	}
+	n := 0
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := e.hash[args[i]]; !ok {
+			n++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	if strings.ToUpper(args[0]) == "HMSET" {
+		return status("OK")
+	}
+	return n
+}
+
+func cmdHSetNx(c *client, args []string) interface{} {
+	e, err := c.db().create(args[1], typeHash, c.now())
+	if err != nil {
+		return err
+	}
+	if _, ok := e.hash[args[2]]; ok {
+		return 0
+	}
+	e.hash[args[2]] = args[3]
+	return 1
+}
+
+func cmdHGet(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	if v, ok := h[args[2]]; ok {
+		return v
+	}
+	return nil
+}
+
+func cmdHMGet(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, 0, len(args)-2)
+	for _, f := range args[2:] {
+		if v, ok := h[f]; ok {
+			values = append(values, v)
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+func cmdHGetAll(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	values := []string{}
+	for _, f := range sortedHash(h) {
+		values = append(values, f, h[f])
+	}
+	return values
+}
+
+func cmdHDel(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, f := range args[2:] {
+		if _, ok := h[f]; ok {
+			delete(h, f)
+			n++
+		}
+	}
+	c.db().cleanup(args[1])
+	return n
+}
+
+func cmdHExists(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[2]]; ok {
+		return 1
+	}
+	return 0
+}
+
+func cmdHLen(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	return len(h)
+}
+
+func cmdHKeys(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	return append([]string{}, sortedHash(h)...)
+}
+
+func cmdHVals(c *client, args []string) interface{} {
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	values := []string{}
+	for _, f := range sortedHash(h) {
+		values = append(values, h[f])
+	}
+	return values
+}
+
+func cmdHIncrBy(c *client, args []string) interface{} {
+	by, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	e, err := c.db().create(args[1], typeHash, c.now())
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v, ok := e.hash[args[2]]; ok {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return errors.New("ERR hash value is not an integer")
+		}
+	}
+	if (by > 0 && n > math.MaxInt64-by) || (by < 0 && n < math.MinInt64-by) {
+		return errors.New("ERR increment or decrement would overflow")
+	}
+	n += by
+	e.hash[args[2]] = strconv.FormatInt(n, 10)
+	return n
+}
+
+func cmdHIncrByFloat(c *client, args []string) interface{} {
+	by, err := parseFloat(args[3])
+	if err != nil {
+		return err
+	}
+	e, err := c.db().create(args[1], typeHash, c.now())
+	if err != nil {
+		return err
+	}
+	var f float64
+	if v, ok := e.hash[args[2]]; ok {
+		if f, err = parseFloat(v); err != nil {
+			return errors.New("ERR hash value is not a float")
+		}
+	}
+	s := formatFloat(f + by)
+	e.hash[args[2]] = s
+	return s
+}
+
+func cmdHScan(c *client, args []string) interface{} {
+	pattern, count, _, err := scanOpts(args[3:], false)
+	if err != nil {
+		return err
+	}
+	h, err := c.hash(args[1])
+	if err != nil {
+		return err
+	}
+	var items []string
+	for _, f := range sortedHash(h) {
+		items = append(items, f, h[f])
+	}
+	return scanPage(items, 2, args[2], count, pattern)
+}
@@ -0,0 +1,460 @@
+package redistest
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func registerKeys() {
+	register("PING", 1, 2, cmdPing)
+	register("ECHO", 2, 2, func(c *client, args []string) interface{} { return args[1] })
+	register("QUIT", 1, 1, func(c *client, args []string) interface{} { return status("OK") })
+	register("AUTH", 2, 3, cmdAuth)
+	register("SELECT", 2, 2, cmdSelect)
+	register("CLIENT", 2, -1, cmdClient)
+	register("INFO", 1, 2, func(c *client, args []string) interface{} { return "# Server\r\nredis_version:6.2.0\r\n" })
+	register("TIME", 1, 1, cmdTime)
+	register("DBSIZE", 1, 1, cmdDBSize)
+	register("FLUSHDB", 1, 2, cmdFlushDB)
+	register("FLUSHALL", 1, 2, cmdFlushAll)
+	register("DEL", 2, -1, cmdDel)
+	register("UNLINK", 2, -1, cmdDel)
+	register("EXISTS", 2, -1, cmdExists)
+	register("TYPE", 2, 2, cmdType)
+	register("KEYS", 2, 2, cmdKeys)
+	register("SCAN", 2, -1, cmdScan)
+	register("RENAME", 3, 3, cmdRename)
+	register("EXPIRE", 3, 3, cmdExpire)
+	register("PEXPIRE", 3, 3, cmdExpire)
+	register("EXPIREAT", 3, 3, cmdExpire)
+	register("PEXPIREAT", 3, 3, cmdExpire)
+	register("TTL", 2, 2, cmdTTL)
+	register("PTTL", 2, 2, cmdTTL)
+	register("PERSIST", 2, 2, cmdPersist)
+	register("SORT", 2, -1, cmdSort)
+	register("MULTI", 1, 1, cmdMulti)
+	register("EXEC", 1, 1, cmdExec)
+	register("DISCARD", 1, 1, cmdDiscard)
+	register("WATCH", 2, -1, func(c *client, args []string) interface{} { return status("OK") })
+	register("UNWATCH", 1, 1, func(c *client, args []string) interface{} { return status("OK") })
+}
+
+func cmdPing(c *client, args []string) interface{} {
+	if len(c.channels)+len(c.patterns) > 0 {
+		msg := ""
+		if len(args) > 1 {
+			msg = args[1]
+		}
+		return []interface{}{"pong", msg}
+	}
+	if len(args) > 1 {
+		return args[1]
+	}
+	return status("PONG")
+}
+
+func cmdAuth(c *client, args []string) interface{} {
+	if c.srv.password == "" {
+		return errors.New("ERR Client sent AUTH, but no password is set")
+	}
+	if args[len(args)-1] != c.srv.password {
+		return errors.New("WRONGPASS invalid username-password pair")
+	}
+	c.authed = true
+	return status("OK")
+}
+
+func cmdSelect(c *client, args []string) interface{} {
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 || n >= _dbs {
+		return errors.New("ERR DB index is out of range")
+	}
+	c.dbIndex = n
+	return status("OK")
+}
+
+func cmdTime(c *client, args []string) interface{} {
+	now := c.now()
+	return []interface{}{
+		strconv.FormatInt(now.Unix(), 10),
+		strconv.FormatInt(int64(now.Nanosecond()/1000), 10),
+	}
+}
+
+func cmdDBSize(c *client, args []string) interface{} {
+	return len(c.db().sortedKeys("", c.now()))
+}
+
+func cmdFlushDB(c *client, args []string) interface{} {
+	c.srv.dbs[c.dbIndex] = newDB()
+	c.srv.invalidateAll()
+	return status("OK")
+}
+
+func cmdFlushAll(c *client, args []string) interface{} {
+	for i := range c.srv.dbs {
+		c.srv.dbs[i] = newDB()
+	}
+	c.srv.invalidateAll()
+	return status("OK")
+}
+
+func cmdDel(c *client, args []string) interface{} {
+	d, n := c.db(), 0
+	for _, key := range args[1:] {
+		if d.get(key, c.now()) != nil && d.del(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(c *client, args []string) interface{} {
+	n := 0
+	for _, key := range args[1:] {
+		if c.db().get(key, c.now()) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(c *client, args []string) interface{} {
+	e := c.db().get(args[1], c.now())
+	if e == nil {
+		return status("none")
+	}
+	return status(e.typ)
+}
+
+func cmdKeys(c *client, args []string) interface{} {
+	return c.db().sortedKeys(args[1], c.now())
+}
+
+// scanOpts parses the MATCH, COUNT and TYPE options of the SCAN family.
+func scanOpts(args []string, allowType bool) (pattern string, count int, typ string, err error) {
+	count = 10
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return "", 0, "", errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return "", 0, "", errSyntax
+			}
+		case "TYPE":
+			if !allowType {
+				return "", 0, "", errSyntax
+			}
+			typ = strings.ToLower(args[i+1])
+		default:
+			return "", 0, "", errSyntax
+		}
+	}
+	return
+}
+
+// scanPage returns a page of count items from cursor, items are sorted and
+// the cursor is their offset. Items of width 2 are field/value pairs.
+func scanPage(items []string, width int, cursor string, count int, pattern string) interface{} {
+	offset, err := strconv.Atoi(cursor)
+	if err != nil || offset < 0 {
+		return errors.New("ERR invalid cursor")
+	}
+	var page []interface{}
+	next := 0
+	for i := offset * width; i < len(items); i += width {
+		if (i/width)-offset == count {
+			next = i / width
+			break
+		}
+		if pattern == "" || match(pattern, items[i]) {
+			for _, item := range items[i : i+width] {
+				page = append(page, item)
+			}
+		}
+	}
+	if page == nil {
+		page = []interface{}{}
+	}
+	return []interface{}{strconv.Itoa(next), page}
+}
+
+func cmdScan(c *client, args []string) interface{} {
+	pattern, count, typ, err := scanOpts(args[2:], true)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	var keys []string
+	for _, key := range d.sortedKeys("", c.now()) {
+		if typ == "" || d.keys[key].typ == typ {
+			keys = append(keys, key)
+		}
+	}
+	return scanPage(keys, 1, args[1], count, pattern)
+}
+
+func cmdRename(c *client, args []string) interface{} {
+	d := c.db()
+	e := d.get(args[1], c.now())
+	if e == nil {
+		return errNoKey
+	}
+	expire, ok := d.expire[args[1]]
+	d.del(args[1])
+	d.set(args[2], e)
+	if ok {
+		d.expire[args[2]] = expire
+	}
+	return status("OK")
+}
+
+func cmdExpire(c *client, args []string) interface{} {
+	n, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	d, now := c.db(), c.now()
+	if d.get(args[1], now) == nil {
+		return 0
+	}
+	var at time.Time
+	switch strings.ToUpper(args[0]) {
+	case "EXPIRE":
+		at = now.Add(time.Duration(n) * time.Second)
+	case "PEXPIRE":
+		at = now.Add(time.Duration(n) * time.Millisecond)
+	case "EXPIREAT":
+		at = time.Unix(n, 0)
+	case "PEXPIREAT":
+		at = time.Unix(0, n*int64(time.Millisecond))
+	}
+	if !at.After(now) {
+		d.del(args[1])
+		return 1
+	}
+	d.expire[args[1]] = at
+	return 1
+}
+
+func cmdTTL(c *client, args []string) interface{} {
+	d, now := c.db(), c.now()
+	if d.get(args[1], now) == nil {
+		return -2
+	}
+	at, ok := d.expire[args[1]]
+	if !ok {
+		return -1
+	}
+	left := at.Sub(now)
+	if strings.ToUpper(args[0]) == "PTTL" {
+		return int64(left / time.Millisecond)
+	}
+	return int64((left + time.Second/2) / time.Second)
+}
+
+func cmdPersist(c *client, args []string) interface{} {
+	d := c.db()
+	if d.get(args[1], c.now()) == nil {
+		return 0
+	}
+	if _, ok := d.expire[args[1]]; !ok {
+		return 0
+	}
+	delete(d.expire, args[1])
+	return 1
+}
+
+// sortElems returns the elements of a list, set or sorted set to sort.
+func (c *client) sortElems(key string) ([]string, error) {
+	e := c.db().get(key, c.now())
+	if e == nil {
+		return nil, nil
+	}
+	var elems []string
+	switch e.typ {
+	case typeList:
+		elems = append(elems, e.list...)
+	case typeSet:
+		for m := range e.set {
+			elems = append(elems, m)
+		}
+	case typeZSet:
+		for m := range e.zset {
+			elems = append(elems, m)
+		}
+	default:
+		return nil, errWrongType
+	}
+	return elems, nil
+}
+
+// sortLookup returns the value of a BY or GET pattern for elem: # is elem
+// itself, the first * is replaced by elem, and key->field is a hash field.
+func (c *client) sortLookup(pattern, elem string) (string, bool) {
+	if pattern == "#" {
+		return elem, true
+	}
+	i := strings.Index(pattern, "*")
+	if i < 0 {
+		return "", false
+	}
+	key := pattern[:i] + elem + pattern[i+1:]
+	if j := strings.Index(key[i+len(elem):], "->"); j >= 0 {
+		j += i + len(elem)
+		h, _ := c.hash(key[:j])
+		v, ok := h[key[j+2:]]
+		return v, ok
+	}
+	v, ok, _ := c.getString(key)
+	return v, ok
+}
+
+func cmdSort(c *client, args []string) interface{} {
+	var (
+		by, store   string
+		gets        []string
+		desc, alpha bool
+		offset      int64
+		count       int64 = -1
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "ASC" || opt == "DESC":
+			desc = opt == "DESC"
+		case opt == "ALPHA":
+			alpha = true
+		case opt == "BY" && i+1 < len(args):
+			i++
+			by = args[i]
+		case opt == "GET" && i+1 < len(args):
+			i++
+			gets = append(gets, args[i])
+		case opt == "STORE" && i+1 < len(args):
+			i++
+			store = args[i]
+		case opt == "LIMIT" && i+2 < len(args):
+			var err error
+			if offset, err = parseInt(args[i+1]); err != nil {
+				return err
+			}
+			if count, err = parseInt(args[i+2]); err != nil {
+				return err
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	elems, err := c.sortElems(args[1])
+	if err != nil {
+		return err
+	}
+
+	if by == "" || strings.Contains(by, "*") {
+		keys := make(map[string]string, len(elems))
+		scores := make(map[string]float64, len(elems))
+		for _, elem := range elems {
+			v := elem
+			if by != "" {
+				v, _ = c.sortLookup(by, elem)
+			}
+			keys[elem] = v
+			if alpha || v == "" {
+				continue
+			}
+			if scores[elem], err = strconv.ParseFloat(v, 64); err != nil {
+				return errors.New("ERR One or more scores can't be converted into double")
+			}
+		}
+		sort.SliceStable(elems, func(i, j int) bool {
+			a, b := elems[i], elems[j]
+			if desc {
+				a, b = b, a
+			}
+			if !alpha && scores[a] != scores[b] {
+				return scores[a] < scores[b]
+			}
+			if keys[a] != keys[b] {
+				return keys[a] < keys[b]
+			}
+			return a < b
+		})
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > int64(len(elems)) {
+		offset = int64(len(elems))
+	}
+	elems = elems[offset:]
+	if count >= 0 && count < int64(len(elems)) {
+		elems = elems[:count]
+	}
+
+	var reply []interface{}
+	for _, elem := range elems {
+		if len(gets) == 0 {
+			reply = append(reply, elem)
+			continue
+		}
+		for _, get := range gets {
+			if v, ok := c.sortLookup(get, elem); ok {
+				reply = append(reply, v)
+			} else {
+				reply = append(reply, nil)
+			}
+		}
+	}
+	if store == "" {
+		if reply == nil {
+			return []interface{}{}
+		}
+		return reply
+	}
+	list := make([]string, len(reply))
+	for i, v := range reply {
+		list[i], _ = v.(string)
+	}
+	c.db().del(store)
+	if len(list) > 0 {
+		c.db().set(store, &entry{typ: typeList, list: list})
+	}
+	return len(list)
+}
+
+func cmdMulti(c *client, args []string) interface{} {
+	if c.inMulti {
+		return errors.New("ERR MULTI calls can not be nested")
+	}
+	c.inMulti, c.multi = true, nil
+	return status("OK")
+}
+
+func cmdExec(c *client, args []string) interface{} {
+	if !c.inMulti {
+		return errors.New("ERR EXEC without MULTI")
+	}
+	queued := c.multi
+	c.inMulti, c.multi = false, nil
+	replies := make([]interface{}, 0, len(queued))
+	for _, args := range queued {
+		replies = append(replies, c.exec(args))
+	}
+	return replies
+}
+
+func cmdDiscard(c *client, args []string) interface{} {
+	if !c.inMulti {
+		return errors.New("ERR DISCARD without MULTI")
+	}
+	c.inMulti, c.multi = false, nil
+	return status("OK")
+}
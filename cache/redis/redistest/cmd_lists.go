@@ -0,0 +1,381 @@
+package redistest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// _blocking are the commands waiting for a list push or a stream entry, they
+// do not block inside MULTI or scripts. The funcs return the timeout of a
+// command, 0 waiting forever, and false if it does not block.
+var _blocking = map[string]func(args []string) (time.Duration, bool){
+	"BLPOP":      listTimeout,
+	"BRPOP":      listTimeout,
+	"BRPOPLPUSH": listTimeout,
+	"XREADGROUP": xreadTimeout,
+}
+
+func registerLists() {
+	register("LPUSH", 3, -1, cmdPush)
+	register("RPUSH", 3, -1, cmdPush)
+	register("LPUSHX", 3, -1, cmdPush)
+	register("RPUSHX", 3, -1, cmdPush)
+	register("LPOP", 2, 3, cmdPop)
+	register("RPOP", 2, 3, cmdPop)
+	register("LLEN", 2, 2, cmdLLen)
+	register("LRANGE", 4, 4, cmdLRange)
+	register("LINDEX", 3, 3, cmdLIndex)
+	register("LSET", 4, 4, cmdLSet)
+	register("LREM", 4, 4, cmdLRem)
+	register("LTRIM", 4, 4, cmdLTrim)
+	register("LINSERT", 5, 5, cmdLInsert)
+	register("RPOPLPUSH", 3, 3, cmdRPopLPush)
+	register("BLPOP", 3, -1, cmdBPop)
+	register("BRPOP", 3, -1, cmdBPop)
+	register("BRPOPLPUSH", 4, 4, cmdBRPopLPush)
+}
+
+func (c *client) list(key string) (*entry, error) {
+	return c.db().typed(key, typeList, c.now())
+}
+
+func cmdPush(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	var (
+		e   *entry
+		err error
+	)
+	if strings.HasSuffix(name, "X") {
+		if e, err = c.list(args[1]); err != nil || e == nil {
+			return errOrZero(err)
+		}
+	} else if e, err = c.db().create(args[1], typeList, c.now()); err != nil {
+		return err
+	}
+	for _, v := range args[2:] {
+		if name[0] == 'L' {
+			e.list = append([]string{v}, e.list...)
+		} else {
+			e.list = append(e.list, v)
+		}
+	}
+	c.srv.notifyPush()
+	return len(e.list)
+}
+
+// pop removes up to n items from the left or the right of the list at key.
+func (c *client) pop(key string, left bool, n int) ([]string, error) {
+	e, err := c.list(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if n > len(e.list) {
+		n = len(e.list)
+	}
+	var items []string
+	if left {
+		items = append(items, e.list[:n]...)
+		e.list = e.list[n:]
+	} else {
+		for i := 0; i < n; i++ {
+			items = append(items, e.list[len(e.list)-1-i])
+		}
+		e.list = e.list[:len(e.list)-n]
+	}
+	c.db().cleanup(key)
+	return items, nil
+}
+
+func cmdPop(c *client, args []string) interface{} {
+	n := 1
+	if len(args) == 3 {
+		count, err := strconv.Atoi(args[2])
+		if err != nil || count < 0 {
+			return errors.New("ERR value is out of range, must be positive")
+		}
+		n = count
+	}
+	items, err := c.pop(args[1], strings.ToUpper(args[0]) == "LPOP", n)
+	if err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		if items == nil {
+			return nullArray{}
+		}
+		return items
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+func cmdLLen(c *client, args []string) interface{} {
+	e, err := c.list(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	return len(e.list)
+}
+
+func cmdLRange(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	e, err := c.list(args[1])
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return []string{}
+	}
+	i, j, ok := rangeIndex(start, stop, len(e.list))
+	if !ok {
+		return []string{}
+	}
+	return append([]string{}, e.list[i:j]...)
+}
+
+// listIndex resolves a possibly negative index of a list of n items.
+func listIndex(s string, n int) (int, bool, error) {
+	i, err := parseInt(s)
+	if err != nil {
+		return 0, false, err
+	}
+	if i < 0 {
+		i += int64(n)
+	}
+	return int(i), i >= 0 && i < int64(n), nil
+}
+
+func cmdLIndex(c *client, args []string) interface{} {
+	e, err := c.list(args[1])
+	if err != nil || e == nil {
+		return err
+	}
+	i, ok, err := listIndex(args[2], len(e.list))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return e.list[i]
+}
+
+func cmdLSet(c *client, args []string) interface{} {
+	e, err := c.list(args[1])
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return errNoKey
+	}
+	i, ok, err := listIndex(args[2], len(e.list))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("ERR index out of range")
+	}
+	e.list[i] = args[3]
+	return status("OK")
+}
+
+func cmdLRem(c *client, args []string) interface{} {
+	count, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	e, err := c.list(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	removed := 0
+	keep := func(i int) bool {
+		if e.list[i] != args[3] || (count != 0 && int64(removed) == abs(count)) {
+			return true
+		}
+		removed++
+		return false
+	}
+	var list []string
+	if count >= 0 {
+		for i := range e.list {
+			if keep(i) {
+				list = append(list, e.list[i])
+			}
+		}
+	} else {
+		for i := len(e.list) - 1; i >= 0; i-- {
+			if keep(i) {
+				list = append([]string{e.list[i]}, list...)
+			}
+		}
+	}
+	e.list = list
+	c.db().cleanup(args[1])
+	return removed
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func cmdLTrim(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	e, err := c.list(args[1])
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		i, j, ok := rangeIndex(start, stop, len(e.list))
+		if ok {
+			e.list = append([]string{}, e.list[i:j]...)
+		} else {
+			e.list = nil
+		}
+		c.db().cleanup(args[1])
+	}
+	return status("OK")
+}
+
+func cmdLInsert(c *client, args []string) interface{} {
+	where := strings.ToUpper(args[2])
+	if where != "BEFORE" && where != "AFTER" {
+		return errSyntax
+	}
+	e, err := c.list(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	for i, v := range e.list {
+		if v != args[3] {
+			continue
+		}
+		if where == "AFTER" {
+			i++
+		}
+		e.list = append(e.list[:i], append([]string{args[4]}, e.list[i:]...)...)
+		c.srv.notifyPush()
+		return len(e.list)
+	}
+	return -1
+}
+
+func cmdRPopLPush(c *client, args []string) interface{} {
+	if _, err := c.list(args[2]); err != nil {
+		return err
+	}
+	items, err := c.pop(args[1], false, 1)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return cmdPushed(c, args[2], items[0])
+}
+
+func cmdPushed(c *client, key, v string) interface{} {
+	cmdPush(c, []string{"LPUSH", key, v})
+	return v
+}
+
+// cmdBPop is the non blocking attempt of BLPOP and BRPOP.
+func cmdBPop(c *client, args []string) interface{} {
+	if _, err := parseTimeout(args[len(args)-1]); err != nil {
+		return err
+	}
+	left := strings.ToUpper(args[0]) == "BLPOP"
+	for _, key := range args[1 : len(args)-1] {
+		items, err := c.pop(key, left, 1)
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			return []string{key, items[0]}
+		}
+	}
+	return nullArray{}
+}
+
+// cmdBRPopLPush is the non blocking attempt of BRPOPLPUSH.
+func cmdBRPopLPush(c *client, args []string) interface{} {
+	if _, err := parseTimeout(args[3]); err != nil {
+		return err
+	}
+	if reply := cmdRPopLPush(c, args[:3]); reply != nil {
+		return reply
+	}
+	return nullArray{}
+}
+
+func parseTimeout(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if f < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// listTimeout is the timeout of the blocking list commands, their last
+// argument.
+func listTimeout(args []string) (time.Duration, bool) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	return timeout, err == nil
+}
+
+// blockingPop runs a blocking command, waiting for a push until timeout, 0
+// waiting forever.
+func (c *client) blockingPop(args []string, timeout time.Duration) interface{} {
+	s := c.srv
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		s.mu.Lock()
+		if err := c.allowed(strings.ToUpper(args[0])); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		reply := c.exec(args)
+		pushed, closed := s.pushed, s.closed
+		s.mu.Unlock()
+		if _, ok := reply.(nullArray); !ok || closed {
+			return reply
+		}
+		select {
+		case <-pushed:
+		case <-deadline:
+			if strings.ToUpper(args[0]) == "BRPOPLPUSH" {
+				return nil
+			}
+			return reply
+		}
+	}
+}
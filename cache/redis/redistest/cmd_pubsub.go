@@ -0,0 +1,122 @@
+package redistest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// noReply is returned by the commands which already wrote their replies.
+type noReply struct{}
+
+func registerPubSub() {
+	register("SUBSCRIBE", 2, -1, cmdSubscribe)
+	register("PSUBSCRIBE", 2, -1, cmdSubscribe)
+	register("UNSUBSCRIBE", 1, -1, cmdUnsubscribe)
+	register("PUNSUBSCRIBE", 1, -1, cmdUnsubscribe)
+	register("PUBLISH", 3, 3, cmdPublish)
+	register("PUBSUB", 2, -1, cmdPubSub)
+}
+
+// push writes reply to the connection, with mu held so that the
+// subscription replies are ordered with the published messages.
+func (c *client) push(reply interface{}) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	writeReply(c.bw, reply)
+	c.bw.Flush()
+}
+
+func (c *client) subscriptions(pattern bool) map[string]struct{} {
+	if pattern {
+		return c.patterns
+	}
+	return c.channels
+}
+
+func cmdSubscribe(c *client, args []string) interface{} {
+	pattern := strings.ToUpper(args[0]) == "PSUBSCRIBE"
+	kind := strings.ToLower(args[0])
+	for _, ch := range args[1:] {
+		c.subscriptions(pattern)[ch] = struct{}{}
+		c.srv.subs[c] = struct{}{}
+		c.push([]interface{}{kind, ch, len(c.channels) + len(c.patterns)})
+	}
+	return noReply{}
+}
+
+func cmdUnsubscribe(c *client, args []string) interface{} {
+	pattern := strings.ToUpper(args[0]) == "PUNSUBSCRIBE"
+	kind := strings.ToLower(args[0])
+	subs := c.subscriptions(pattern)
+	targets := args[1:]
+	if len(targets) == 0 {
+		targets = sortedSet(subs)
+	}
+	if len(targets) == 0 {
+		c.push([]interface{}{kind, nil, len(c.channels) + len(c.patterns)})
+	}
+	for _, ch := range targets {
+		delete(subs, ch)
+		c.push([]interface{}{kind, ch, len(c.channels) + len(c.patterns)})
+	}
+	if len(c.channels)+len(c.patterns) == 0 {
+		delete(c.srv.subs, c)
+	}
+	return noReply{}
+}
+
+func cmdPublish(c *client, args []string) interface{} {
+	return c.srv.publish(args[1], args[2])
+}
+
+// publish sends message to the subscribers of channel, with mu held.
+func (s *Server) publish(channel, message string) int {
+	n := 0
+	for sub := range s.subs {
+		if _, ok := sub.channels[channel]; ok {
+			sub.push([]interface{}{"message", channel, message})
+			n++
+		}
+		for p := range sub.patterns {
+			if match(p, channel) {
+				sub.push([]interface{}{"pmessage", p, channel, message})
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func cmdPubSub(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "CHANNELS":
+		channels := make(map[string]struct{})
+		for sub := range c.srv.subs {
+			for ch := range sub.channels {
+				if len(args) < 3 || match(args[2], ch) {
+					channels[ch] = struct{}{}
+				}
+			}
+		}
+		return sortedSet(channels)
+	case "NUMSUB":
+		reply := []interface{}{}
+		for _, ch := range args[2:] {
+			n := 0
+			for sub := range c.srv.subs {
+				if _, ok := sub.channels[ch]; ok {
+					n++
+				}
+			}
+			reply = append(reply, ch, n)
+		}
+		return reply
+	case "NUMPAT":
+		n := 0
+		for sub := range c.srv.subs {
+			n += len(sub.patterns)
+		}
+		return n
+	}
+	return fmt.Errorf("ERR unknown subcommand '%s'", args[1])
+}
@@ -0,0 +1,81 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+
+func registerScripts() {
+	register("EVAL", 3, -1, cmdEval)
+	register("EVALSHA", 3, -1, cmdEval)
+	register("EVAL_RO", 3, -1, cmdEval)
+	register("EVALSHA_RO", 3, -1, cmdEval)
+	register("SCRIPT", 2, -1, cmdScript)
+}
+
+func cmdEval(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	script, sha := args[1], strings.ToLower(args[1])
+	if strings.HasPrefix(name, "EVALSHA") {
+		var ok bool
+		if script, ok = c.srv.scripts[sha]; !ok {
+			return errNoScript
+		}
+	} else {
+		sha = sha1hex(script)
+	}
+	n, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInt
+	}
+	if n < 0 {
+		return errors.New("ERR Number of keys can't be negative")
+	}
+	if n > len(args)-3 {
+		return errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	proto, err := compileLua(script)
+	if err != nil {
+		return fmt.Errorf("ERR Error compiling script (new function): %v", err)
+	}
+	c.srv.scripts[sha] = script
+	// NOTE: SELECT in a script does not outlive it.
+	defer func(db int) { c.dbIndex = db }(c.dbIndex)
+	return c.runLua(sha, proto, args[3:3+n], args[3+n:])
+}
+
+func cmdScript(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "LOAD":
+		if len(args) != 3 {
+			break
+		}
+		if _, err := compileLua(args[2]); err != nil {
+			return fmt.Errorf("ERR Error compiling script (new function): %v", err)
+		}
+		sha := sha1hex(args[2])
+		c.srv.scripts[sha] = args[2]
+		return sha
+	case "EXISTS":
+		reply := make([]interface{}, 0, len(args)-2)
+		for _, sha := range args[2:] {
+			_, ok := c.srv.scripts[strings.ToLower(sha)]
+			if ok {
+				reply = append(reply, 1)
+			} else {
+				reply = append(reply, 0)
+			}
+		}
+		return reply
+	case "FLUSH":
+		c.srv.scripts = make(map[string]string)
+		return status("OK")
+	default:
+		return fmt.Errorf("ERR unknown subcommand '%s'", args[1])
+	}
+	return fmt.Errorf("ERR wrong number of arguments for 'script|%s' command", strings.ToLower(args[1]))
+}
@@ -0,0 +1,240 @@
+package redistest
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+func registerSets() {
+	register("SADD", 3, -1, cmdSAdd)
+	register("SREM", 3, -1, cmdSRem)
+	register("SMEMBERS", 2, 2, cmdSMembers)
+	register("SISMEMBER", 3, 3, cmdSIsMember)
+	register("SCARD", 2, 2, cmdSCard)
+	register("SPOP", 2, 3, cmdSPop)
+	register("SRANDMEMBER", 2, 3, cmdSRandMember)
+	register("SMOVE", 4, 4, cmdSMove)
+	register("SUNION", 2, -1, cmdSetOp)
+	register("SINTER", 2, -1, cmdSetOp)
+	register("SDIFF", 2, -1, cmdSetOp)
+	register("SUNIONSTORE", 3, -1, cmdSetOpStore)
+	register("SINTERSTORE", 3, -1, cmdSetOpStore)
+	register("SDIFFSTORE", 3, -1, cmdSetOpStore)
+	register("SSCAN", 3, -1, cmdSScan)
+}
+
+func (c *client) set(key string) (map[string]struct{}, error) {
+	e, err := c.db().typed(key, typeSet, c.now())
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.set, nil
+}
+
+func cmdSAdd(c *client, args []string) interface{} {
+	e, err := c.db().create(args[1], typeSet, c.now())
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, m := range args[2:] {
+		if _, ok := e.set[m]; !ok {
+			e.set[m] = struct{}{}
+			n++
+		}
+	}
+	return n
+}
+
+func cmdSRem(c *client, args []string) interface{} {
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, m := range args[2:] {
+		if _, ok := set[m]; ok {
+			delete(set, m)
+			n++
+		}
+	}
+	c.db().cleanup(args[1])
+	return n
+}
+
+func cmdSMembers(c *client, args []string) interface{} {
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	return sortedSet(set)
+}
+
+func cmdSIsMember(c *client, args []string) interface{} {
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	if _, ok := set[args[2]]; ok {
+		return 1
+	}
+	return 0
+}
+
+func cmdSCard(c *client, args []string) interface{} {
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	return len(set)
+}
+
+// randomMembers returns count distinct random members, or count members
+// possibly repeated if count is negative.
+func randomMembers(set map[string]struct{}, count int) []string {
+	members := sortedSet(set)
+	if count < 0 {
+		var picked []string
+		for i := 0; i < -count && len(members) > 0; i++ {
+			picked = append(picked, members[rand.Intn(len(members))])
+		}
+		return picked
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members
+}
+
+func cmdSPop(c *client, args []string) interface{} {
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	count := 1
+	if len(args) == 3 {
+		if count, err = strconv.Atoi(args[2]); err != nil || count < 0 {
+			return errNotInt
+		}
+	}
+	members := randomMembers(set, count)
+	for _, m := range members {
+		delete(set, m)
+	}
+	c.db().cleanup(args[1])
+	if len(args) == 3 {
+		return append([]string{}, members...)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return members[0]
+}
+
+func cmdSRandMember(c *client, args []string) interface{} {
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		members := randomMembers(set, 1)
+		if len(members) == 0 {
+			return nil
+		}
+		return members[0]
+	}
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errNotInt
+	}
+	return append([]string{}, randomMembers(set, count)...)
+}
+
+func cmdSMove(c *client, args []string) interface{} {
+	src, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	if _, err = c.set(args[2]); err != nil {
+		return err
+	}
+	if _, ok := src[args[3]]; !ok {
+		return 0
+	}
+	delete(src, args[3])
+	c.db().cleanup(args[1])
+	dst, _ := c.db().create(args[2], typeSet, c.now())
+	dst.set[args[3]] = struct{}{}
+	return 1
+}
+
+// setOp computes the union, intersection or difference of the sets at keys.
+func (c *client) setOp(op string, keys []string) (map[string]struct{}, error) {
+	var result map[string]struct{}
+	for i, key := range keys {
+		set, err := c.set(key)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			result = make(map[string]struct{}, len(set))
+			for m := range set {
+				result[m] = struct{}{}
+			}
+			continue
+		}
+		switch op {
+		case "UNION":
+			for m := range set {
+				result[m] = struct{}{}
+			}
+		case "INTER":
+			for m := range result {
+				if _, ok := set[m]; !ok {
+					delete(result, m)
+				}
+			}
+		case "DIFF":
+			for m := range set {
+				delete(result, m)
+			}
+		}
+	}
+	return result, nil
+}
+
+func cmdSetOp(c *client, args []string) interface{} {
+	set, err := c.setOp(strings.ToUpper(args[0])[1:], args[1:])
+	if err != nil {
+		return err
+	}
+	return sortedSet(set)
+}
+
+func cmdSetOpStore(c *client, args []string) interface{} {
+	op := strings.TrimSuffix(strings.ToUpper(args[0])[1:], "STORE")
+	set, err := c.setOp(op, args[2:])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	d.del(args[1])
+	if len(set) > 0 {
+		d.set(args[1], &entry{typ: typeSet, set: set})
+	}
+	return len(set)
+}
+
+func cmdSScan(c *client, args []string) interface{} {
+	pattern, count, _, err := scanOpts(args[3:], false)
+	if err != nil {
+		return err
+	}
+	set, err := c.set(args[1])
+	if err != nil {
+		return err
+	}
+	return scanPage(sortedSet(set), 1, args[2], count, pattern)
+}
@@ -0,0 +1,682 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// streamID is the id of a stream entry, <ms>-<seq>.
+type streamID struct {
+	ms, seq uint64
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id streamID) less(o streamID) bool {
+	return id.ms < o.ms || (id.ms == o.ms && id.seq < o.seq)
+}
+
+// next returns the smallest id greater than id.
+func (id streamID) next() streamID {
+	if id.seq == math.MaxUint64 {
+		return streamID{ms: id.ms + 1}
+	}
+	return streamID{ms: id.ms, seq: id.seq + 1}
+}
+
+// parseStreamID parses an id of a range: - and + are the extremes, a missing
+// sequence is 0 for a start and the maximum for an end, and a ( prefix
+// excludes the id.
+func parseStreamID(s string, end bool) (id streamID, err error) {
+	switch s {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return streamID{math.MaxUint64, math.MaxUint64}, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	ms, seq := s, ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		ms, seq = s[:i], s[i+1:]
+	}
+	if id.ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return id, errStreamID
+	}
+	switch {
+	case seq != "":
+		if id.seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return id, errStreamID
+		}
+	case end:
+		id.seq = math.MaxUint64
+	}
+	if exclusive {
+		if end {
+			if id.seq > 0 {
+				id.seq--
+			} else if id.ms > 0 {
+				id.ms, id.seq = id.ms-1, math.MaxUint64
+			}
+		} else {
+			id = id.next()
+		}
+	}
+	return id, nil
+}
+
+// stream is the value of a stream key, entries are sorted by id.
+type stream struct {
+	entries []streamEntry
+	last    streamID // the greatest id ever added
+	groups  map[string]*streamGroup
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+type streamGroup struct {
+	last    streamID // the last id delivered
+	pending map[streamID]*pendingEntry
+}
+
+// pendingEntry is an entry delivered to a consumer and not acked yet.
+type pendingEntry struct {
+	consumer   string
+	delivered  time.Time
+	deliveries int64
+}
+
+// find returns the index of the first entry not less than id.
+func (s *stream) find(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].id.less(id) })
+}
+
+// entry returns the entry id, nil if it was deleted.
+func (s *stream) entry(id streamID) *streamEntry {
+	if i := s.find(id); i < len(s.entries) && s.entries[i].id == id {
+		return &s.entries[i]
+	}
+	return nil
+}
+
+// sortedPending returns the pending ids of g in [start, end], sorted.
+func (g *streamGroup) sortedPending(start, end streamID) []streamID {
+	var ids []streamID
+	for id := range g.pending {
+		if !id.less(start) && !end.less(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+func entryReply(id streamID, e *streamEntry) interface{} {
+	if e == nil {
+		return []interface{}{id.String(), nullArray{}}
+	}
+	return []interface{}{id.String(), e.fields}
+}
+
+func registerStreams() {
+	register("XADD", 5, -1, cmdXAdd)
+	register("XLEN", 2, 2, cmdXLen)
+	register("XRANGE", 4, 6, cmdXRange)
+	register("XREVRANGE", 4, 6, cmdXRange)
+	register("XDEL", 3, -1, cmdXDel)
+	register("XGROUP", 2, -1, cmdXGroup)
+	register("XREADGROUP", 7, -1, cmdXReadGroup)
+	register("XACK", 4, -1, cmdXAck)
+	register("XPENDING", 3, 9, cmdXPending)
+	register("XCLAIM", 6, -1, cmdXClaim)
+	register("XAUTOCLAIM", 6, 9, cmdXAutoClaim)
+}
+
+func (c *client) stream(key string) (*stream, error) {
+	e, err := c.db().typed(key, typeStream, c.now())
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.stream, nil
+}
+
+// group returns the consumer group of a stream, or a NOGROUP error.
+func (c *client) group(key, group string) (*stream, *streamGroup, error) {
+	s, err := c.stream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s != nil {
+		if g, ok := s.groups[group]; ok {
+			return s, g, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, group)
+}
+
+// cmdXAdd supports NOMKSTREAM and MAXLEN, MAXLEN ~ trims exactly.
+func cmdXAdd(c *client, args []string) interface{} {
+	var (
+		noMk   bool
+		maxLen = int64(-1)
+		i      = 2
+	)
+	for ; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NOMKSTREAM":
+			noMk = true
+			continue
+		case opt == "MAXLEN" && i+1 < len(args):
+			if args[i+1] == "~" || args[i+1] == "=" {
+				i++
+			}
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := parseInt(args[i+1])
+			if err != nil || n < 0 {
+				return errors.New("ERR The MAXLEN argument must be >= 0.")
+			}
+			maxLen = n
+			i++
+			continue
+		}
+		break
+	}
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return errors.New("ERR wrong number of arguments for 'xadd' command")
+	}
+	s, err := c.stream(args[1])
+	if err != nil {
+		return err
+	}
+	if s == nil && noMk {
+		return nil
+	}
+	var id streamID
+	if args[i] == "*" {
+		id = streamID{ms: uint64(c.now().UnixNano() / int64(time.Millisecond))}
+		if s != nil && !s.last.less(id) {
+			id = s.last.next()
+		}
+	} else {
+		if id, err = parseStreamID(args[i], false); err != nil {
+			return err
+		}
+		if id == (streamID{}) {
+			return errors.New("ERR The ID specified in XADD must be greater than 0-0")
+		}
+		if s != nil && !s.last.less(id) {
+			return errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	}
+	if s == nil {
+		e, _ := c.db().create(args[1], typeStream, c.now())
+		s = e.stream
+	}
+	s.entries = append(s.entries, streamEntry{id: id, fields: append([]string(nil), args[i+1:]...)})
+	s.last = id
+	if maxLen >= 0 && int64(len(s.entries)) > maxLen {
+		s.entries = append(s.entries[:0:0], s.entries[int64(len(s.entries))-maxLen:]...)
+	}
+	c.srv.notifyPush()
+	return id.String()
+}
+
+func cmdXLen(c *client, args []string) interface{} {
+	s, err := c.stream(args[1])
+	if err != nil || s == nil {
+		return errOrZero(err)
+	}
+	return len(s.entries)
+}
+
+func cmdXRange(c *client, args []string) interface{} {
+	rev := strings.ToUpper(args[0]) == "XREVRANGE"
+	startArg, endArg := args[2], args[3]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseStreamID(startArg, false)
+	if err != nil {
+		return err
+	}
+	end, err := parseStreamID(endArg, true)
+	if err != nil {
+		return err
+	}
+	count := -1
+	if len(args) > 4 {
+		if len(args) != 6 || strings.ToUpper(args[4]) != "COUNT" {
+			return errSyntax
+		}
+		n, err := parseInt(args[5])
+		if err != nil {
+			return err
+		}
+		count = int(n)
+	}
+	s, err := c.stream(args[1])
+	if err != nil {
+		return err
+	}
+	reply := []interface{}{}
+	if s == nil {
+		return reply
+	}
+	var found []streamEntry
+	for i := s.find(start); i < len(s.entries) && !end.less(s.entries[i].id); i++ {
+		found = append(found, s.entries[i])
+	}
+	if rev {
+		for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+			found[i], found[j] = found[j], found[i]
+		}
+	}
+	for i := range found {
+		if count >= 0 && len(reply) == count {
+			break
+		}
+		reply = append(reply, entryReply(found[i].id, &found[i]))
+	}
+	return reply
+}
+
+func cmdXDel(c *client, args []string) interface{} {
+	s, err := c.stream(args[1])
+	if err != nil || s == nil {
+		return errOrZero(err)
+	}
+	n := 0
+	for _, arg := range args[2:] {
+		id, err := parseStreamID(arg, false)
+		if err != nil {
+			return err
+		}
+		if i := s.find(id); i < len(s.entries) && s.entries[i].id == id {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			n++
+		}
+	}
+	return n
+}
+
+// cmdXGroup supports CREATE, SETID and DESTROY.
+func cmdXGroup(c *client, args []string) interface{} {
+	sub := strings.ToUpper(args[1])
+	switch {
+	case sub == "CREATE" && (len(args) == 5 || (len(args) == 6 && strings.ToUpper(args[5]) == "MKSTREAM")):
+		s, err := c.stream(args[2])
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			if len(args) == 5 {
+				return errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			}
+			e, _ := c.db().create(args[2], typeStream, c.now())
+			s = e.stream
+		}
+		if _, ok := s.groups[args[3]]; ok {
+			return errors.New("BUSYGROUP Consumer Group name already exists")
+		}
+		last := s.last
+		if args[4] != "$" {
+			if last, err = parseStreamID(args[4], false); err != nil {
+				return err
+			}
+		}
+		s.groups[args[3]] = &streamGroup{last: last, pending: make(map[streamID]*pendingEntry)}
+		return status("OK")
+	case sub == "SETID" && len(args) == 5:
+		s, g, err := c.group(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		last := s.last
+		if args[4] != "$" {
+			if last, err = parseStreamID(args[4], false); err != nil {
+				return err
+			}
+		}
+		g.last = last
+		return status("OK")
+	case sub == "DESTROY" && len(args) == 4:
+		s, err := c.stream(args[2])
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			return errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		if _, ok := s.groups[args[3]]; !ok {
+			return 0
+		}
+		delete(s.groups, args[3])
+		return 1
+	}
+	return fmt.Errorf("ERR unknown subcommand or wrong number of arguments for '%s'", args[1])
+}
+
+// xreadGroup is a parsed XREADGROUP.
+type xreadGroup struct {
+	group, consumer string
+	count           int
+	block           time.Duration
+	blocks          bool
+	noAck           bool
+	keys, ids       []string
+}
+
+func parseXReadGroup(args []string) (x xreadGroup, err error) {
+	if strings.ToUpper(args[1]) != "GROUP" {
+		return x, errSyntax
+	}
+	x.group, x.consumer = args[2], args[3]
+	for i := 4; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := parseInt(args[i+1])
+			if err != nil {
+				return x, err
+			}
+			x.count = int(n)
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			n, err := parseInt(args[i+1])
+			if err != nil {
+				return x, errors.New("ERR timeout is not an integer or out of range")
+			}
+			if n < 0 {
+				return x, errors.New("ERR timeout is negative")
+			}
+			x.block, x.blocks = time.Duration(n)*time.Millisecond, true
+			i++
+		case opt == "NOACK":
+			x.noAck = true
+		case opt == "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return x, errors.New("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+			}
+			x.keys, x.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return x, nil
+		default:
+			return x, errSyntax
+		}
+	}
+	return x, errSyntax
+}
+
+// xreadTimeout is the BLOCK timeout of XREADGROUP.
+func xreadTimeout(args []string) (time.Duration, bool) {
+	x, err := parseXReadGroup(args)
+	return x.block, err == nil && x.blocks
+}
+
+// cmdXReadGroup delivers the new entries for >, or else the history of the
+// entries pending on the consumer, as [id, nil] if they were deleted.
+func cmdXReadGroup(c *client, args []string) interface{} {
+	x, err := parseXReadGroup(args)
+	if err != nil {
+		return err
+	}
+	var reply []interface{}
+	for i, key := range x.keys {
+		s, g, err := c.group(key, x.group)
+		if err != nil {
+			return fmt.Errorf("%v in XREADGROUP with GROUP option", err)
+		}
+		entries := []interface{}{}
+		if x.ids[i] == ">" {
+			for j := s.find(g.last.next()); j < len(s.entries) && (x.count <= 0 || len(entries) < x.count); j++ {
+				e := &s.entries[j]
+				g.last = e.id
+				if !x.noAck {
+					g.pending[e.id] = &pendingEntry{consumer: x.consumer, delivered: c.now(), deliveries: 1}
+				}
+				entries = append(entries, entryReply(e.id, e))
+			}
+			if len(entries) == 0 {
+				continue
+			}
+		} else {
+			start, err := parseStreamID(x.ids[i], false)
+			if err != nil {
+				return err
+			}
+			for _, id := range g.sortedPending(start.next(), streamID{math.MaxUint64, math.MaxUint64}) {
+				if x.count > 0 && len(entries) == x.count {
+					break
+				}
+				if g.pending[id].consumer == x.consumer {
+					entries = append(entries, entryReply(id, s.entry(id)))
+				}
+			}
+		}
+		reply = append(reply, []interface{}{key, entries})
+	}
+	if reply == nil {
+		return nullArray{}
+	}
+	return reply
+}
+
+func cmdXAck(c *client, args []string) interface{} {
+	_, g, err := c.group(args[1], args[2])
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, arg := range args[3:] {
+		id, err := parseStreamID(arg, false)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			n++
+		}
+	}
+	return n
+}
+
+// cmdXPending replies the summary, or the extended form with an optional
+// IDLE and consumer.
+func cmdXPending(c *client, args []string) interface{} {
+	_, g, err := c.group(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	now := c.now()
+	if len(args) == 3 {
+		ids := g.sortedPending(streamID{}, streamID{math.MaxUint64, math.MaxUint64})
+		if len(ids) == 0 {
+			return []interface{}{0, nil, nil, nullArray{}}
+		}
+		counts := make(map[string]int)
+		for _, id := range ids {
+			counts[g.pending[id].consumer]++
+		}
+		var consumers []string
+		for name := range counts {
+			consumers = append(consumers, name)
+		}
+		sort.Strings(consumers)
+		perConsumer := make([]interface{}, 0, len(consumers))
+		for _, name := range consumers {
+			perConsumer = append(perConsumer, []interface{}{name, strconv.Itoa(counts[name])})
+		}
+		return []interface{}{len(ids), ids[0].String(), ids[len(ids)-1].String(), perConsumer}
+	}
+	rest := args[3:]
+	var minIdle time.Duration
+	if strings.ToUpper(rest[0]) == "IDLE" {
+		if len(rest) < 2 {
+			return errSyntax
+		}
+		n, err := parseInt(rest[1])
+		if err != nil {
+			return err
+		}
+		minIdle, rest = time.Duration(n)*time.Millisecond, rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return errSyntax
+	}
+	start, err := parseStreamID(rest[0], false)
+	if err != nil {
+		return err
+	}
+	end, err := parseStreamID(rest[1], true)
+	if err != nil {
+		return err
+	}
+	count, err := parseInt(rest[2])
+	if err != nil {
+		return err
+	}
+	reply := []interface{}{}
+	for _, id := range g.sortedPending(start, end) {
+		if int64(len(reply)) >= count {
+			break
+		}
+		p := g.pending[id]
+		idle := now.Sub(p.delivered)
+		if idle < minIdle || (len(rest) == 4 && p.consumer != rest[3]) {
+			continue
+		}
+		reply = append(reply, []interface{}{id.String(), p.consumer, int64(idle / time.Millisecond), p.deliveries})
+	}
+	return reply
+}
+
+// claim gives the pending entry id idle for minIdle to consumer, as redis 7
+// deleted entries are removed from the pending ones and not claimed.
+func (c *client) claim(s *stream, g *streamGroup, id streamID, consumer string, minIdle time.Duration, justID bool) (e *streamEntry, ok bool) {
+	p, found := g.pending[id]
+	if !found || c.now().Sub(p.delivered) < minIdle {
+		return nil, false
+	}
+	if e = s.entry(id); e == nil {
+		delete(g.pending, id)
+		return nil, false
+	}
+	p.consumer, p.delivered = consumer, c.now()
+	if !justID {
+		p.deliveries++
+	}
+	return e, true
+}
+
+// cmdXClaim supports the JUSTID option.
+func cmdXClaim(c *client, args []string) interface{} {
+	s, g, err := c.group(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	n, err := parseInt(args[4])
+	if err != nil {
+		return errors.New("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	minIdle := time.Duration(n) * time.Millisecond
+	var (
+		ids    []streamID
+		justID bool
+	)
+	for _, arg := range args[5:] {
+		if strings.ToUpper(arg) == "JUSTID" {
+			justID = true
+			continue
+		}
+		if justID {
+			return errSyntax
+		}
+		id, err := parseStreamID(arg, false)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	reply := []interface{}{}
+	for _, id := range ids {
+		e, ok := c.claim(s, g, id, args[3], minIdle, justID)
+		switch {
+		case !ok:
+		case justID:
+			reply = append(reply, id.String())
+		default:
+			reply = append(reply, entryReply(id, e))
+		}
+	}
+	return reply
+}
+
+// cmdXAutoClaim replies as redis 7: the next start, the claimed entries and
+// the deleted ids.
+func cmdXAutoClaim(c *client, args []string) interface{} {
+	s, g, err := c.group(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	n, err := parseInt(args[4])
+	if err != nil {
+		return errors.New("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	minIdle := time.Duration(n) * time.Millisecond
+	start, err := parseStreamID(args[5], false)
+	if err != nil {
+		return err
+	}
+	count, justID := 100, false
+	for i := 6; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := parseInt(args[i+1])
+			if err != nil || n < 1 {
+				return errors.New("ERR COUNT must be > 0")
+			}
+			count = int(n)
+			i++
+		case opt == "JUSTID":
+			justID = true
+		default:
+			return errSyntax
+		}
+	}
+	claimed, deleted := []interface{}{}, []interface{}{}
+	next := streamID{}
+	ids := g.sortedPending(start, streamID{math.MaxUint64, math.MaxUint64})
+	for i, id := range ids {
+		if i == count {
+			next = id
+			break
+		}
+		if s.entry(id) == nil {
+			delete(g.pending, id)
+			deleted = append(deleted, id.String())
+			continue
+		}
+		e, ok := c.claim(s, g, id, args[3], minIdle, justID)
+		switch {
+		case !ok:
+		case justID:
+			claimed = append(claimed, id.String())
+		default:
+			claimed = append(claimed, entryReply(id, e))
+		}
+	}
+	return []interface{}{next.String(), claimed, deleted}
+}
@@ -0,0 +1,393 @@
+package redistest
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	posInf = math.Inf(1)
+	negInf = math.Inf(-1)
+)
+
+func registerStrings() {
+	register("GET", 2, 2, cmdGet)
+	register("SET", 3, -1, cmdSet)
+	register("SETEX", 4, 4, cmdSetEx)
+	register("PSETEX", 4, 4, cmdSetEx)
+	register("SETNX", 3, 3, cmdSetNx)
+	register("GETSET", 3, 3, cmdGetSet)
+	register("GETDEL", 2, 2, cmdGetDel)
+	register("MGET", 2, -1, cmdMGet)
+	register("MSET", 3, -1, cmdMSet)
+	register("MSETNX", 3, -1, cmdMSet)
+	register("INCR", 2, 2, cmdIncr)
+	register("DECR", 2, 2, cmdIncr)
+	register("INCRBY", 3, 3, cmdIncr)
+	register("DECRBY", 3, 3, cmdIncr)
+	register("INCRBYFLOAT", 3, 3, cmdIncrByFloat)
+	register("APPEND", 3, 3, cmdAppend)
+	register("STRLEN", 2, 2, cmdStrlen)
+	register("GETRANGE", 4, 4, cmdGetRange)
+	register("PFADD", 2, -1, cmdPFAdd)
+	register("PFCOUNT", 2, -1, cmdPFCount)
+	register("PFMERGE", 2, -1, cmdPFMerge)
+}
+
+// getString returns the string value of key and whether it exists.
+func (c *client) getString(key string) (string, bool, error) {
+	e, err := c.db().typed(key, typeString, c.now())
+	if err != nil || e == nil {
+		return "", false, err
+	}
+	return e.str, true, nil
+}
+
+func (c *client) setString(key, val string) {
+	c.db().set(key, &entry{typ: typeString, str: val})
+}
+
+func cmdGet(c *client, args []string) interface{} {
+	v, ok, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func cmdSet(c *client, args []string) interface{} {
+	var (
+		nx, xx, keepTTL, get bool
+		expire               time.Time
+		now                  = c.now()
+	)
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "GET":
+			get = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 == len(args) {
+				return errSyntax
+			}
+			i++
+			n, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			if n <= 0 {
+				return errors.New("ERR invalid expire time in 'set' command")
+			}
+			switch opt {
+			case "EX":
+				expire = now.Add(time.Duration(n) * time.Second)
+			case "PX":
+				expire = now.Add(time.Duration(n) * time.Millisecond)
+			case "EXAT":
+				expire = time.Unix(n, 0)
+			case "PXAT":
+				expire = time.Unix(0, n*int64(time.Millisecond))
+			}
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+	d := c.db()
+	e := d.get(args[1], now)
+	exists := e != nil
+	var reply interface{} = status("OK")
+	if get {
+		if exists && (e.typ != typeString || e.hll != nil) {
+			return errWrongType
+		}
+		reply = nil
+		if exists {
+			reply = e.str
+		}
+	}
+	if (nx && exists) || (xx && !exists) {
+		if get {
+			return reply
+		}
+		return nil
+	}
+	ttl, hasTTL := d.expire[args[1]]
+	c.setString(args[1], args[2])
+	switch {
+	case !expire.IsZero():
+		d.expire[args[1]] = expire
+	case keepTTL && hasTTL:
+		d.expire[args[1]] = ttl
+	}
+	return reply
+}
+
+func cmdSetEx(c *client, args []string) interface{} {
+	unit := "EX"
+	if strings.ToUpper(args[0]) == "PSETEX" {
+		unit = "PX"
+	}
+	return cmdSet(c, []string{"SET", args[1], args[3], unit, args[2]})
+}
+
+func cmdSetNx(c *client, args []string) interface{} {
+	if cmdSet(c, []string{"SET", args[1], args[2], "NX"}) == nil {
+		return 0
+	}
+	return 1
+}
+
+func cmdGetSet(c *client, args []string) interface{} {
+	return cmdSet(c, []string{"SET", args[1], args[2], "GET"})
+}
+
+func cmdGetDel(c *client, args []string) interface{} {
+	v := cmdGet(c, args)
+	if _, ok := v.(string); ok {
+		c.db().del(args[1])
+	}
+	return v
+}
+
+func cmdMGet(c *client, args []string) interface{} {
+	values := make([]interface{}, 0, len(args)-1)
+	for _, key := range args[1:] {
+		v, ok, _ := c.getString(key)
+		if ok {
+			values = append(values, v)
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+func cmdMSet(c *client, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return errors.New("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+	}
+	if strings.ToUpper(args[0]) == "MSETNX" {
+		for i := 1; i < len(args); i += 2 {
+			if c.db().get(args[i], c.now()) != nil {
+				return 0
+			}
+		}
+		for i := 1; i < len(args); i += 2 {
+			c.setString(args[i], args[i+1])
+		}
+		return 1
+	}
+	for i := 1; i < len(args); i += 2 {
+		c.setString(args[i], args[i+1])
+	}
+	return status("OK")
+}
+
+// update replaces the string value of key keeping its ttl.
+func (c *client) update(key, val string) {
+	d := c.db()
+	ttl, ok := d.expire[key]
+	c.setString(key, val)
+	if ok {
+		d.expire[key] = ttl
+	}
+}
+
+func cmdIncr(c *client, args []string) interface{} {
+	by := int64(1)
+	if len(args) == 3 {
+		var err error
+		if by, err = parseInt(args[2]); err != nil {
+			return err
+		}
+	}
+	if strings.HasPrefix(strings.ToUpper(args[0]), "DECR") {
+		by = -by
+	}
+	v, ok, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, err = parseInt(v); err != nil {
+			return err
+		}
+	}
+	if (by > 0 && n > math.MaxInt64-by) || (by < 0 && n < math.MinInt64-by) {
+		return errors.New("ERR increment or decrement would overflow")
+	}
+	n += by
+	c.update(args[1], strconv.FormatInt(n, 10))
+	return n
+}
+
+func cmdIncrByFloat(c *client, args []string) interface{} {
+	by, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	v, ok, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var f float64
+	if ok {
+		if f, err = parseFloat(v); err != nil {
+			return err
+		}
+	}
+	f += by
+	if math.IsInf(f, 0) {
+		return errors.New("ERR increment would produce NaN or Infinity")
+	}
+	s := formatFloat(f)
+	c.update(args[1], s)
+	return s
+}
+
+func cmdAppend(c *client, args []string) interface{} {
+	v, _, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	v += args[2]
+	c.update(args[1], v)
+	return len(v)
+}
+
+func cmdStrlen(c *client, args []string) interface{} {
+	v, _, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	return len(v)
+}
+
+// rangeIndex converts the start and stop indexes, possibly negative, of a
+// sequence of n items to a slice range, ok is false if the range is empty.
+func rangeIndex(start, stop int64, n int) (int, int, bool) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	if start > stop || start >= int64(n) {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
+
+func cmdGetRange(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	v, _, err := c.getString(args[1])
+	if err != nil {
+		return err
+	}
+	i, j, ok := rangeIndex(start, stop, len(v))
+	if !ok {
+		return ""
+	}
+	return v[i:j]
+}
+
+// hll returns the HyperLogLog of key, which is counted exactly.
+func (c *client) hll(key string, create bool) (*entry, error) {
+	d := c.db()
+	e := d.get(key, c.now())
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &entry{typ: typeString, hll: make(map[string]struct{})}
+		d.set(key, e)
+		return e, nil
+	}
+	if e.hll == nil {
+		return nil, errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return e, nil
+}
+
+func cmdPFAdd(c *client, args []string) interface{} {
+	exists := c.db().get(args[1], c.now()) != nil
+	e, err := c.hll(args[1], true)
+	if err != nil {
+		return err
+	}
+	changed := !exists
+	for _, el := range args[2:] {
+		if _, ok := e.hll[el]; !ok {
+			e.hll[el] = struct{}{}
+			changed = true
+		}
+	}
+	if changed {
+		return 1
+	}
+	return 0
+}
+
+func cmdPFCount(c *client, args []string) interface{} {
+	union := make(map[string]struct{})
+	for _, key := range args[1:] {
+		e, err := c.hll(key, false)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			for el := range e.hll {
+				union[el] = struct{}{}
+			}
+		}
+	}
+	return len(union)
+}
+
+func cmdPFMerge(c *client, args []string) interface{} {
+	dest, err := c.hll(args[1], true)
+	if err != nil {
+		return err
+	}
+	for _, key := range args[2:] {
+		e, err := c.hll(key, false)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			for el := range e.hll {
+				dest.hll[el] = struct{}{}
+			}
+		}
+	}
+	return status("OK")
+}
@@ -0,0 +1,421 @@
+package redistest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+func registerZSets() {
+	register("ZADD", 4, -1, cmdZAdd)
+	register("ZINCRBY", 4, 4, cmdZIncrBy)
+	register("ZREM", 3, -1, cmdZRem)
+	register("ZSCORE", 3, 3, cmdZScore)
+	register("ZMSCORE", 3, -1, cmdZMScore)
+	register("ZCARD", 2, 2, cmdZCard)
+	register("ZCOUNT", 4, 4, cmdZCount)
+	register("ZRANK", 3, 3, cmdZRank)
+	register("ZREVRANK", 3, 3, cmdZRank)
+	register("ZRANGE", 4, -1, cmdZRange)
+	register("ZREVRANGE", 4, 5, cmdZRange)
+	register("ZRANGEBYSCORE", 4, -1, cmdZRange)
+	register("ZREVRANGEBYSCORE", 4, -1, cmdZRange)
+	register("ZREMRANGEBYRANK", 4, 4, cmdZRemRange)
+	register("ZREMRANGEBYSCORE", 4, 4, cmdZRemRange)
+	register("ZPOPMIN", 2, 3, cmdZPop)
+	register("ZPOPMAX", 2, 3, cmdZPop)
+	register("ZSCAN", 3, -1, cmdZScan)
+}
+
+func (c *client) zset(key string) (*entry, error) {
+	return c.db().typed(key, typeZSet, c.now())
+}
+
+// zaddScore applies a ZADD or ZINCRBY to member, changed reports whether its
+// score changed and ok whether the flags allowed it.
+func zaddScore(e *entry, member string, score float64, incr, nx, xx, gt, lt bool) (result float64, added, changed, ok bool) {
+	old, exists := e.zset[member]
+	if (nx && exists) || (xx && !exists) {
+		return 0, false, false, false
+	}
+	if incr {
+		score += old
+	}
+	if exists && ((gt && score <= old) || (lt && score >= old)) {
+		return 0, false, false, false
+	}
+	e.zset[member] = score
+	return score, !exists, exists && score != old, true
+}
+
+func cmdZAdd(c *client, args []string) interface{} {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 2
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) || (gt && lt) || (nx && (gt || lt)) {
+		return errSyntax
+	}
+	if incr && len(pairs) != 2 {
+		return errors.New("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		f, err := parseFloat(pairs[j])
+		if err != nil {
+			return err
+		}
+		scores = append(scores, f)
+	}
+	e, err := c.db().create(args[1], typeZSet, c.now())
+	if err != nil {
+		return err
+	}
+	defer c.db().cleanup(args[1])
+	n := 0
+	for j, score := range scores {
+		result, added, changed, ok := zaddScore(e, pairs[2*j+1], score, incr, nx, xx, gt, lt)
+		if incr {
+			if !ok {
+				return nil
+			}
+			return formatFloat(result)
+		}
+		if added || (ch && changed) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdZIncrBy(c *client, args []string) interface{} {
+	return cmdZAdd(c, []string{"ZADD", args[1], "INCR", args[2], args[3]})
+}
+
+func cmdZRem(c *client, args []string) interface{} {
+	e, err := c.zset(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	n := 0
+	for _, m := range args[2:] {
+		if _, ok := e.zset[m]; ok {
+			delete(e.zset, m)
+			n++
+		}
+	}
+	c.db().cleanup(args[1])
+	return n
+}
+
+func errOrZero(err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return 0
+}
+
+func cmdZScore(c *client, args []string) interface{} {
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		if s, ok := e.zset[args[2]]; ok {
+			return formatFloat(s)
+		}
+	}
+	return nil
+}
+
+func cmdZMScore(c *client, args []string) interface{} {
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	scores := make([]interface{}, 0, len(args)-2)
+	for _, m := range args[2:] {
+		if e != nil {
+			if s, ok := e.zset[m]; ok {
+				scores = append(scores, formatFloat(s))
+				continue
+			}
+		}
+		scores = append(scores, nil)
+	}
+	return scores
+}
+
+func cmdZCard(c *client, args []string) interface{} {
+	e, err := c.zset(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	return len(e.zset)
+}
+
+// scoreBound is an end of a score range, "(" makes it exclusive.
+type scoreBound struct {
+	score     float64
+	exclusive bool
+}
+
+func parseBound(s string) (b scoreBound, err error) {
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	if b.score, err = parseFloat(s); err != nil {
+		return b, errors.New("ERR min or max is not a float")
+	}
+	return
+}
+
+func (b scoreBound) above(score float64) bool {
+	return score > b.score || (!b.exclusive && score == b.score)
+}
+
+func (b scoreBound) below(score float64) bool {
+	return score < b.score || (!b.exclusive && score == b.score)
+}
+
+func cmdZCount(c *client, args []string) interface{} {
+	min, err := parseBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseBound(args[3])
+	if err != nil {
+		return err
+	}
+	e, err := c.zset(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	n := 0
+	for _, s := range e.zset {
+		if min.above(s) && max.below(s) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdZRank(c *client, args []string) interface{} {
+	e, err := c.zset(args[1])
+	if err != nil || e == nil {
+		return err
+	}
+	ms := e.sorted()
+	for i, m := range ms {
+		if m.member == args[2] {
+			if strings.ToUpper(args[0]) == "ZREVRANK" {
+				return len(ms) - 1 - i
+			}
+			return i
+		}
+	}
+	return nil
+}
+
+// zrangeQuery is a parsed ZRANGE family command.
+type zrangeQuery struct {
+	byScore    bool
+	rev        bool
+	withScores bool
+	start      int64
+	stop       int64
+	min, max   scoreBound
+	offset     int
+	count      int // -1 for all
+}
+
+func parseZRange(args []string) (q zrangeQuery, err error) {
+	name := strings.ToUpper(args[0])
+	q.count = -1
+	q.rev = strings.HasPrefix(name, "ZREV")
+	q.byScore = strings.HasSuffix(name, "BYSCORE")
+	rest := args[4:]
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToUpper(rest[i]) {
+		case "WITHSCORES":
+			q.withScores = true
+		case "BYSCORE":
+			if name != "ZRANGE" {
+				return q, errSyntax
+			}
+			q.byScore = true
+		case "REV":
+			if name != "ZRANGE" {
+				return q, errSyntax
+			}
+			q.rev = true
+		case "LIMIT":
+			if i+2 >= len(rest) {
+				return q, errSyntax
+			}
+			if q.offset, err = strconv.Atoi(rest[i+1]); err != nil {
+				return q, errNotInt
+			}
+			if q.count, err = strconv.Atoi(rest[i+2]); err != nil {
+				return q, errNotInt
+			}
+			i += 2
+		default:
+			return q, errSyntax
+		}
+	}
+	lo, hi := args[2], args[3]
+	if !q.byScore {
+		if q.start, err = parseInt(lo); err != nil {
+			return
+		}
+		q.stop, err = parseInt(hi)
+		return
+	}
+	if q.rev {
+		// NOTE: reversed score ranges are given max first.
+		lo, hi = hi, lo
+	}
+	if q.min, err = parseBound(lo); err != nil {
+		return
+	}
+	q.max, err = parseBound(hi)
+	return
+}
+
+// members returns the members selected by q.
+func (q zrangeQuery) members(e *entry) []zmember {
+	ms := e.sorted()
+	if q.rev {
+		for i, j := 0, len(ms)-1; i < j; i, j = i+1, j-1 {
+			ms[i], ms[j] = ms[j], ms[i]
+		}
+	}
+	if !q.byScore {
+		i, j, ok := rangeIndex(q.start, q.stop, len(ms))
+		if !ok {
+			return nil
+		}
+		return ms[i:j]
+	}
+	var selected []zmember
+	for _, m := range ms {
+		if q.min.above(m.score) && q.max.below(m.score) {
+			selected = append(selected, m)
+		}
+	}
+	if q.offset < 0 || q.offset >= len(selected) {
+		return nil
+	}
+	selected = selected[q.offset:]
+	if q.count >= 0 && q.count < len(selected) {
+		selected = selected[:q.count]
+	}
+	return selected
+}
+
+func zreply(ms []zmember, withScores bool) []string {
+	reply := []string{}
+	for _, m := range ms {
+		reply = append(reply, m.member)
+		if withScores {
+			reply = append(reply, formatFloat(m.score))
+		}
+	}
+	return reply
+}
+
+func cmdZRange(c *client, args []string) interface{} {
+	q, err := parseZRange(args)
+	if err != nil {
+		return err
+	}
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return []string{}
+	}
+	return zreply(q.members(e), q.withScores)
+}
+
+func cmdZRemRange(c *client, args []string) interface{} {
+	name := "ZRANGE"
+	if strings.ToUpper(args[0]) == "ZREMRANGEBYSCORE" {
+		name = "ZRANGEBYSCORE"
+	}
+	q, err := parseZRange([]string{name, args[1], args[2], args[3]})
+	if err != nil {
+		return err
+	}
+	e, err := c.zset(args[1])
+	if err != nil || e == nil {
+		return errOrZero(err)
+	}
+	ms := q.members(e)
+	for _, m := range ms {
+		delete(e.zset, m.member)
+	}
+	c.db().cleanup(args[1])
+	return len(ms)
+}
+
+func cmdZPop(c *client, args []string) interface{} {
+	count := int64(1)
+	if len(args) == 3 {
+		var err error
+		if count, err = parseInt(args[2]); err != nil {
+			return err
+		}
+	}
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	if e == nil || count <= 0 {
+		return []string{}
+	}
+	q := zrangeQuery{rev: strings.ToUpper(args[0]) == "ZPOPMAX", start: 0, stop: count - 1}
+	ms := q.members(e)
+	for _, m := range ms {
+		delete(e.zset, m.member)
+	}
+	c.db().cleanup(args[1])
+	return zreply(ms, true)
+}
+
+func cmdZScan(c *client, args []string) interface{} {
+	pattern, count, _, err := scanOpts(args[3:], false)
+	if err != nil {
+		return err
+	}
+	e, err := c.zset(args[1])
+	if err != nil {
+		return err
+	}
+	var items []string
+	if e != nil {
+		items = zreply(e.sorted(), true)
+	}
+	return scanPage(items, 2, args[2], count, pattern)
+}
@@ -0,0 +1,242 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// key types as replied by TYPE.
+const (
+	typeString = "string"
+	typeHash   = "hash"
+	typeSet    = "set"
+	typeZSet   = "zset"
+	typeList   = "list"
+	typeStream = "stream"
+)
+
+// entry is a value of the keyspace, only the field of its type is set.
+type entry struct {
+	typ    string
+	str    string
+	hash   map[string]string
+	set    map[string]struct{}
+	zset   map[string]float64
+	list   []string
+	stream *stream
+	hll    map[string]struct{} // HyperLogLog, counted exactly, typ is string
+}
+
+// db is a numbered database.
+type db struct {
+	keys   map[string]*entry
+	expire map[string]time.Time
+}
+
+func newDB() *db {
+	return &db{keys: make(map[string]*entry), expire: make(map[string]time.Time)}
+}
+
+// get returns the entry of key, expiring it if its time has come.
+func (d *db) get(key string, now time.Time) *entry {
+	if t, ok := d.expire[key]; ok && !now.Before(t) {
+		d.del(key)
+	}
+	return d.keys[key]
+}
+
+func (d *db) del(key string) bool {
+	_, ok := d.keys[key]
+	delete(d.keys, key)
+	delete(d.expire, key)
+	return ok
+}
+
+// set replaces key by e, clearing its ttl.
+func (d *db) set(key string, e *entry) {
+	d.keys[key] = e
+	delete(d.expire, key)
+}
+
+// typed returns the entry of key if it has type typ, nil if key does not
+// exist, or a WRONGTYPE error.
+func (d *db) typed(key, typ string, now time.Time) (*entry, error) {
+	e := d.get(key, now)
+	if e == nil {
+		return nil, nil
+	}
+	if e.typ != typ || (typ == typeString && e.hll != nil) {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+// create returns the entry of key with type typ, creating it if needed.
+func (d *db) create(key, typ string, now time.Time) (*entry, error) {
+	e, err := d.typed(key, typ, now)
+	if err != nil || e != nil {
+		return e, err
+	}
+	e = &entry{typ: typ}
+	switch typ {
+	case typeHash:
+		e.hash = make(map[string]string)
+	case typeSet:
+		e.set = make(map[string]struct{})
+	case typeZSet:
+		e.zset = make(map[string]float64)
+	case typeStream:
+		e.stream = &stream{groups: make(map[string]*streamGroup)}
+	}
+	d.keys[key] = e
+	return e, nil
+}
+
+// cleanup deletes key if its collection became empty, empty streams are
+// kept.
+func (d *db) cleanup(key string) {
+	e := d.keys[key]
+	if e == nil {
+		return
+	}
+	switch e.typ {
+	case typeHash:
+		if len(e.hash) == 0 {
+			d.del(key)
+		}
+	case typeSet:
+		if len(e.set) == 0 {
+			d.del(key)
+		}
+	case typeZSet:
+		if len(e.zset) == 0 {
+			d.del(key)
+		}
+	case typeList:
+		if len(e.list) == 0 {
+			d.del(key)
+		}
+	}
+}
+
+// sortedKeys returns the live keys matching pattern, sorted.
+func (d *db) sortedKeys(pattern string, now time.Time) []string {
+	var keys []string
+	for k := range d.keys {
+		if d.get(k, now) == nil {
+			continue
+		}
+		if pattern == "" || match(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// match reports whether s matches the glob-style pattern of KEYS and SCAN.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']') + 1
+			if end == 0 || len(s) == 0 {
+				return false
+			}
+			class, negate := pattern[1:end], false
+			if len(class) > 0 && class[0] == '^' {
+				class, negate = class[1:], true
+			}
+			found := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					found = found || class[i] <= s[0] && s[0] <= class[i+2]
+					i += 2
+				} else {
+					found = found || class[i] == s[0]
+				}
+			}
+			if found == negate {
+				return false
+			}
+			pattern = pattern[end:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members of a sorted set by score then member.
+func (e *entry) sorted() []zmember {
+	ms := make([]zmember, 0, len(e.zset))
+	for m, s := range e.zset {
+		ms = append(ms, zmember{m, s})
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].score != ms[j].score {
+			return ms[i].score < ms[j].score
+		}
+		return ms[i].member < ms[j].member
+	})
+	return ms
+}
+
+func sortedSet(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func sortedHash(hash map[string]string) []string {
+	fields := make([]string, 0, len(hash))
+	for f := range hash {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// formatFloat formats a score or a float value as redis does, with the
+// shortest representation and no exponent below 1e17.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f != 0 && (math.Abs(f) < 1e-4 || math.Abs(f) >= 1e17):
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
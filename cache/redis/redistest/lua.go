@@ -0,0 +1,252 @@
+package redistest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// _scriptTimeout stops a script which does not end, such as an endless loop.
+const _scriptTimeout = 5 * time.Second
+
+// _notInScript are the commands a script may not call.
+var _notInScript = map[string]struct{}{
+	"MULTI": {}, "EXEC": {}, "DISCARD": {}, "WATCH": {}, "UNWATCH": {},
+	"SUBSCRIBE": {}, "PSUBSCRIBE": {}, "UNSUBSCRIBE": {}, "PUNSUBSCRIBE": {},
+	"EVAL": {}, "EVALSHA": {}, "EVAL_RO": {}, "EVALSHA_RO": {}, "SCRIPT": {},
+	"AUTH": {}, "QUIT": {},
+}
+
+func sha1hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// compileLua compiles a script as the body of a function, the error is on a
+// single line to be replied.
+func compileLua(script string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), "user_script")
+	if err == nil {
+		var proto *lua.FunctionProto
+		if proto, err = lua.Compile(chunk, "user_script"); err == nil {
+			return proto, nil
+		}
+	}
+	return nil, errors.New(strings.Join(strings.Fields(err.Error()), " "))
+}
+
+// runLua runs a compiled script with mu held, its commands run as those of
+// the connection.
+func (c *client) runLua(sha string, proto *lua.FunctionProto, keys, argv []string) interface{} {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), _scriptTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	c.openLibs(L, keys, argv)
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		var obj lua.LValue = lua.LString(err.Error())
+		if e, ok := err.(*lua.ApiError); ok {
+			obj = e.Object
+		}
+		if t, ok := obj.(*lua.LTable); ok {
+			if e, ok := t.RawGetString("err").(lua.LString); ok {
+				return errors.New(string(e))
+			}
+		}
+		return fmt.Errorf("ERR %s script: %s", lua.LVAsString(obj), sha)
+	}
+	return fromLua(L.Get(-1))
+}
+
+// openLibs opens the libraries of a script, as redis does.
+func (c *client) openLibs(L *lua.LState, keys, argv []string) {
+	for name, open := range map[string]lua.LGFunction{
+		lua.BaseLibName:   lua.OpenBase,
+		lua.TabLibName:    lua.OpenTable,
+		lua.StringLibName: lua.OpenString,
+		lua.MathLibName:   lua.OpenMath,
+	} {
+		L.Push(L.NewFunction(open))
+		L.Push(lua.LString(name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// NOTE: gopher-lua does not parse the exponents with a leading zero of
+	// the floats formatted by Go, such as 6e+06, which strtod of Lua 5.1 does.
+	tonumber := L.GetGlobal("tonumber")
+	L.SetGlobal("tonumber", L.NewFunction(func(L *lua.LState) int {
+		if s, ok := L.Get(1).(lua.LString); ok && L.GetTop() == 1 {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(string(s)), 64); err == nil {
+				L.Push(lua.LNumber(f))
+				return 1
+			}
+		}
+		args := make([]lua.LValue, L.GetTop())
+		for i := range args {
+			args[i] = L.Get(i + 1)
+		}
+		L.CallByParam(lua.P{Fn: tonumber, NRet: 1}, args...)
+		return 1
+	}))
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call":         func(L *lua.LState) int { return c.redisCall(L, false) },
+		"pcall":        func(L *lua.LState) int { return c.redisCall(L, true) },
+		"status_reply": func(L *lua.LState) int { return reply(L, "ok") },
+		"error_reply":  func(L *lua.LState) int { return reply(L, "err") },
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex(L.CheckString(1))))
+			return 1
+		},
+		"log":      func(L *lua.LState) int { return 0 },
+		"set_repl": func(L *lua.LState) int { return 0 },
+		"replicate_commands": func(L *lua.LState) int {
+			L.Push(lua.LTrue)
+			return 1
+		},
+	})
+	for i, name := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		redis.RawSetString(name, lua.LNumber(i))
+	}
+	for i, name := range []string{"REPL_NONE", "REPL_AOF", "REPL_REPLICA", "REPL_ALL"} {
+		redis.RawSetString(name, lua.LNumber(i))
+	}
+	L.SetGlobal("redis", redis)
+	L.SetGlobal("KEYS", stringTable(L, keys))
+	L.SetGlobal("ARGV", stringTable(L, argv))
+
+	// NOTE: scripts may not create globals, which would leak between runs
+	// on redis.
+	mt := L.NewTable()
+	mt.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("Script attempted to create global variable '%s'", L.CheckString(2))
+		return 0
+	}))
+	L.SetMetatable(L.Get(lua.GlobalsIndex), mt)
+}
+
+func stringTable(L *lua.LState, ss []string) *lua.LTable {
+	t := L.CreateTable(len(ss), 0)
+	for _, s := range ss {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
+
+func reply(L *lua.LState, field string) int {
+	t := L.NewTable()
+	t.RawSetString(field, lua.LString(L.CheckString(1)))
+	L.Push(t)
+	return 1
+}
+
+// redisCall runs the command of the arguments, an error reply is raised
+// unless protected.
+func (c *client) redisCall(L *lua.LState, protected bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for this redis lib call")
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		switch v := L.Get(i + 1).(type) {
+		case lua.LString:
+			cmd[i] = string(v)
+		case lua.LNumber:
+			// NOTE: as lua_tostring of Lua 5.1.
+			cmd[i] = strconv.FormatFloat(float64(v), 'g', 14, 64)
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	var r interface{}
+	if _, ok := _notInScript[strings.ToUpper(cmd[0])]; ok {
+		r = errors.New("ERR This Redis command is not allowed from script")
+	} else {
+		r = c.exec(cmd)
+	}
+	v := toLua(L, r)
+	if _, ok := r.(error); ok && !protected {
+		L.Error(v, 0)
+	}
+	L.Push(v)
+	return 1
+}
+
+// toLua converts a reply to Lua, as redis does.
+func toLua(L *lua.LState, r interface{}) lua.LValue {
+	switch r := r.(type) {
+	case nil, nullArray:
+		return lua.LFalse
+	case status:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(r))
+		return t
+	case error:
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(r.Error()))
+		return t
+	case int:
+		return lua.LNumber(r)
+	case int64:
+		return lua.LNumber(r)
+	case string:
+		return lua.LString(r)
+	case []string:
+		return stringTable(L, r)
+	case []interface{}:
+		t := L.CreateTable(len(r), 0)
+		for _, e := range r {
+			t.Append(toLua(L, e))
+		}
+		return t
+	}
+	panic(fmt.Sprintf("redistest: unsupported reply %T", r))
+}
+
+// fromLua converts the value returned by a script to a reply: numbers are
+// truncated to integers, false to nil, and tables to arrays stopping at the
+// first nil, unless they hold an ok or err field.
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		if v {
+			return 1
+		}
+		return nil
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return errors.New(string(e))
+		}
+		if s, ok := v.RawGetString("ok").(lua.LString); ok {
+			return status(s)
+		}
+		r := []interface{}{}
+		for i := 1; ; i++ {
+			e := v.RawGetInt(i)
+			if e == lua.LNil {
+				return r
+			}
+			r = append(r, fromLua(e))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package redistest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+func TestEval(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	tests := []struct {
+		script string
+		want   interface{}
+	}{
+		{`return 1 + 2 * 3 ^ 2`, int64(19)},
+		{`return 7 / 2`, int64(3)},
+		{`return -7 % 3`, int64(2)},
+		{`return "a" .. 1 .. "b" .. 1.5`, "a1b1.5"},
+		{`redis.call("SET", "n", 10 / 3) return redis.call("GET", "n")`, "3.3333333333333"},
+		{`redis.call("SET", "n", 2^53) return redis.call("GET", "n")`, "9.007199254741e+15"},
+		{`return string.format("%.0f|%.6f|%d|%s|%5.1f|%x", 2^53, 1/3, 3.9, nil, 2.25, 255)`, "9007199254740992|0.333333|3|nil|  2.2|ff"},
+		{`return {1, "two", true, false, {3}}`, list(int64(1), "two", int64(1), nil, list(int64(3)))},
+		{`return {1, nil, 3}`, list(int64(1))},
+		{`return nil`, nil},
+		{`return false`, nil},
+		{`return redis.status_reply("FINE")`, "FINE"},
+		{`return {ok = "OK"}`, "OK"},
+		{`return #KEYS + #ARGV`, int64(3)},
+		{`return KEYS[1] .. ARGV[1] .. ARGV[2]`, "kab"},
+		{`return tonumber("0x10") + tonumber(" 5 ") + tonumber("z", 36)`, int64(56)},
+		{`return tonumber("5x") == nil and "nil" or "number"`, "nil"},
+		{`return tonumber("6e+06") + tonumber("1e-07") * 1e7`, int64(6000001)},
+		{`return math.max(1, 5, 3) + math.min(4, 2) + math.floor(2.7) + math.ceil(2.1)`, int64(12)},
+		{`return ("hello"):upper() .. string.sub("hello", 2, -2) .. #"abc"`, "HELLOell3"},
+		{`return string.rep("ab", 3, nil) .. string.len("xyz")`, "ababab3"},
+		{`
+local t = {}
+for i = 10, 1, -3 do
+	table.insert(t, i)
+end
+table.insert(t, 1, 0)
+return table.concat(t, ",") .. ";" .. table.remove(t) .. ";" .. #t`, "0,10,7,4,1;1;4"},
+		{`
+local sum = 0
+for k, v in pairs({a = 1, b = 2, 3}) do
+	sum = sum + v
+end
+local i = 0
+while true do
+	i = i + 1
+	if i > 5 then
+		break
+	end
+end
+repeat
+	local j = i
+	i = i + 1
+until j >= 7
+return sum * 100 + i`, int64(608)},
+		{`
+local function fib(n)
+	if n < 2 then
+		return n
+	end
+	return fib(n - 1) + fib(n - 2)
+end
+local counter = function()
+	local n = 0
+	return function()
+		n = n + 1
+		return n
+	end
+end
+local next = counter()
+next()
+return fib(10) + next()`, int64(57)},
+		{`
+local t = {5, 2, 9, 1}
+table.sort(t)
+local r = {}
+table.sort(t, function(a, b) return a > b end)
+for _, v in ipairs(t) do
+	r[#r + 1] = v
+end
+return table.concat(r, " ")`, "9 5 2 1"},
+		{`
+local ok, err = pcall(function()
+	error("boom")
+end)
+local ok2, err2 = pcall(error, {code = 42})
+return {tostring(ok), err, err2.code}`, list("false", "user_script:3: boom", int64(42))},
+		{`return select("#", 1, 2, 3) + select(2, 10, 20, 30)`, int64(23)},
+		{`-- comments
+--[[ long
+comment ]]
+return [[long
+string]]`, "long\nstring"},
+	}
+	for _, test := range tests {
+		reply, err := conn.Do("EVAL", test.script, 1, "k", "a", "b")
+		if err != nil {
+			t.Fatalf("%s: %v", test.script, err)
+		}
+		if got := normalize(reply); !equal(got, test.want) {
+			t.Fatalf("%s: got %#v, want %#v", test.script, got, test.want)
+		}
+	}
+}
+
+func equal(got, want interface{}) bool {
+	gs, ok := got.([]interface{})
+	ws, ok2 := want.([]interface{})
+	if !ok || !ok2 {
+		return got == want
+	}
+	if len(gs) != len(ws) {
+		return false
+	}
+	for i := range gs {
+		if !equal(gs[i], ws[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEvalRedis(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(2), "EVAL", `
+redis.call("SET", KEYS[1], "1")
+redis.call("HSET", KEYS[2], "f", 1)
+return redis.call("INCR", KEYS[1])`, 2, "a", "h")
+	check(t, conn, "1", "HGET", "h", "f")
+	// nil bulk replies are false, arrays are tables
+	check(t, conn, "missing", "EVAL", `
+if not redis.call("GET", "nope") then
+	return "missing"
+end`, 0)
+	check(t, conn, list("f", "1", int64(1)), "EVAL", `
+local r = redis.call("HGETALL", KEYS[1])
+r[3] = redis.call("HEXISTS", KEYS[1], "f")
+return r`, 1, "h")
+	check(t, conn, "OK", "EVAL", `return redis.call("SET", "x", "y")`, 0)
+	check(t, conn, "PONG", "EVAL", `return redis.call("PING")["ok"]`, 0)
+
+	// errors
+	checkErr(t, conn, "WRONGTYPE", "EVAL", `return redis.call("HGET", "a", "f")`, 0)
+	check(t, conn, "WRONGTYPE", "EVAL", `
+local r = redis.pcall("HGET", "a", "f")
+return string.sub(r.err, 1, 9)`, 0)
+	checkErr(t, conn, "MYERR custom", "EVAL", `return redis.error_reply("MYERR custom")`, 0)
+	checkErr(t, conn, "ERR This Redis command is not allowed from script", "EVAL", `return redis.call("MULTI")`, 0)
+	checkErr(t, conn, "ERR Error compiling script", "EVAL", `return (`, 0)
+	checkErr(t, conn, "ERR user_script:1: Script attempted to create global variable 'x'", "EVAL", `x = 1`, 0)
+	checkErr(t, conn, "ERR user_script:2: ", "EVAL", "local t = {}\nreturn t.x + 1", 0)
+	checkErr(t, conn, "ERR Number of keys can't be greater than number of args", "EVAL", `return 1`, 2, "a")
+
+	// SELECT in a script does not change the database of the connection
+	check(t, conn, "y", "EVAL", `redis.call("SELECT", 2) return "y"`, 0)
+	check(t, conn, "y", "GET", "x")
+}
+
+func TestEvalSha(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	script := redis.NewScript(1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+	checkErr(t, conn, "NOSCRIPT", "EVALSHA", script.Hash(), 1, "n", 1)
+	// Script.Do falls back to EVAL on NOSCRIPT
+	if n, err := redis.Int(script.Do(conn, "n", 2)); err != nil || n != 2 {
+		t.Fatalf("got %d %v", n, err)
+	}
+	check(t, conn, list(int64(1), int64(0)), "SCRIPT", "EXISTS", script.Hash(), "0000")
+	check(t, conn, int64(5), "EVALSHA", script.Hash(), 1, "n", 3)
+	check(t, conn, "OK", "SCRIPT", "FLUSH")
+	check(t, conn, script.Hash(), "SCRIPT", "LOAD", `return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+	check(t, conn, int64(6), "EVALSHA", script.Hash(), 1, "n", 1)
+}
+
+// TestEvalRateLimit runs a token bucket in the style of the limiter scripts.
+func TestEvalRateLimit(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	script := redis.NewScript(1, `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", string.format("%.6f", tokens), "ts", string.format("%.0f", now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate / 1000) + 1000)
+return {allowed, math.floor(tokens)}`)
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		reply, err := redis.Ints(script.Do(conn, "bucket", "0.000001", 3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed += reply[0]
+	}
+	if allowed != 3 {
+		t.Fatalf("got %d allowed, want 3", allowed)
+	}
+	s.FastForward(2 * time.Second)
+	if reply, err := redis.Ints(script.Do(conn, "bucket", "0.000001", 3)); err != nil || reply[0] != 1 {
+		t.Fatalf("got %v %v, want allowed after refill", reply, err)
+	}
+}
@@ -0,0 +1,95 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// monitored is a master group of a sentinel.
+type monitored struct {
+	master   string
+	replicas []string
+}
+
+// SetReplicaOf makes the server a replica of the master at addr, or a master
+// again if addr is "": ROLE replies it and writes fail with READONLY. No data
+// is replicated.
+func (s *Server) SetReplicaOf(addr string) {
+	s.mu.Lock()
+	s.masterAddr = addr
+	s.mu.Unlock()
+}
+
+// Monitor makes the server a sentinel of the group name whose master is at
+// master: SENTINEL get-master-addr-by-name and SENTINEL slaves reply it, and
+// when the master changes +switch-master is published to the subscribers of
+// the server, as on a failover.
+func (s *Server) Monitor(name, master string, replicas ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.monitored == nil {
+		s.monitored = make(map[string]*monitored)
+	}
+	old, ok := s.monitored[name]
+	s.monitored[name] = &monitored{master: master, replicas: append([]string(nil), replicas...)}
+	if ok && old.master != master {
+		oldHost, oldPort, _ := net.SplitHostPort(old.master)
+		newHost, newPort, _ := net.SplitHostPort(master)
+		s.publish("+switch-master", strings.Join([]string{name, oldHost, oldPort, newHost, newPort}, " "))
+	}
+}
+
+func registerSentinel() {
+	register("ROLE", 1, 1, cmdRole)
+	register("SENTINEL", 2, -1, cmdSentinel)
+}
+
+// readOnly checks a replica is not written, with mu held.
+func (c *client) readOnly(name string) error {
+	if c.srv.masterAddr != "" && _keySpecs[name].write {
+		return errors.New("READONLY You can't write against a read only replica.")
+	}
+	return nil
+}
+
+func cmdRole(c *client, args []string) interface{} {
+	if c.srv.masterAddr == "" {
+		return []interface{}{"master", 0, []interface{}{}}
+	}
+	host, port, _ := net.SplitHostPort(c.srv.masterAddr)
+	p, _ := strconv.Atoi(port)
+	return []interface{}{"slave", host, p, "connected", 0}
+}
+
+func cmdSentinel(c *client, args []string) interface{} {
+	if c.srv.monitored == nil {
+		return errors.New("ERR unknown command 'SENTINEL'")
+	}
+	switch sub := strings.ToLower(args[1]); sub {
+	case "get-master-addr-by-name", "slaves", "replicas":
+		if len(args) != 3 {
+			return fmt.Errorf("ERR wrong number of arguments for 'sentinel|%s' command", sub)
+		}
+		m, ok := c.srv.monitored[args[2]]
+		if sub == "get-master-addr-by-name" {
+			if !ok {
+				return nullArray{}
+			}
+			host, port, _ := net.SplitHostPort(m.master)
+			return []interface{}{host, port}
+		}
+		if !ok {
+			return errors.New("ERR No such master with that name")
+		}
+		reply := make([]interface{}, 0, len(m.replicas))
+		for _, addr := range m.replicas {
+			host, port, _ := net.SplitHostPort(addr)
+			reply = append(reply, []interface{}{"name", addr, "ip", host, "port", port, "flags", "slave"})
+		}
+		return reply
+	}
+	return fmt.Errorf("ERR Unknown sentinel subcommand '%s'", args[1])
+}
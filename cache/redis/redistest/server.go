@@ -0,0 +1,427 @@
+// Package redistest provides an in-process redis server for unit tests. It
+// speaks RESP on a local tcp port so that it can be used as the Address of a
+// cache/redis Config, and keeps its data in memory.
+//
+// Strings, bitmaps, hashes, sets, sorted sets, geo, lists, streams with
+// consumer groups, TTLs, HyperLogLog, pub/sub, MULTI/EXEC, SORT, EVAL and
+// CLIENT TRACKING with REDIRECT are supported. Servers are made cluster nodes by SetCluster, replicas by
+// SetReplicaOf and sentinels by Monitor. Scripts run on gopher-lua, a Lua 5.1
+// VM, with the redis, string, math and table libraries.
+//
+//	s, err := redistest.NewServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//	client := redis.New(&redis.Config{Network: "tcp", Address: s.Addr()})
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_dbs = 16
+
+	_maxMultibulk = 1024 * 1024 // max arguments of a command, as redis
+	_maxBulk      = 64 << 20    // max size of an argument
+)
+
+var (
+	errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = errors.New("ERR value is not an integer or out of range")
+	errNotFloat  = errors.New("ERR value is not a valid float")
+	errSyntax    = errors.New("ERR syntax error")
+	errNoKey     = errors.New("ERR no such key")
+
+	errMultibulkLen = errors.New("ERR Protocol error: invalid multibulk length")
+	errBulkLen      = errors.New("ERR Protocol error: invalid bulk length")
+)
+
+// status is a simple string reply.
+type status string
+
+// nullArray is the nil multi bulk reply.
+type nullArray struct{}
+
+// Server is an in-memory redis server.
+type Server struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	dbs     [_dbs]*db
+	offset  time.Duration // added to the wall clock by FastForward
+	scripts map[string]string
+	subs    map[*client]struct{}
+	clients map[int64]*client               // by CLIENT ID
+	tracked map[string]map[*client]struct{} // connections tracking a key
+	nextID  int64
+	pushed  chan struct{} // closed and renewed when a list is pushed
+	slots   []Slots       // slot map of the cluster, nil if not a cluster node
+
+	masterAddr string                // master of a replica, "" for a master
+	monitored  map[string]*monitored // groups of a sentinel, by name
+
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// NewServer starts a server on a random local port.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		scripts: make(map[string]string),
+		subs:    make(map[*client]struct{}),
+		clients: make(map[int64]*client),
+		tracked: make(map[string]map[*client]struct{}),
+		pushed:  make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	for i := range s.dbs {
+		s.dbs[i] = newDB()
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address of the server.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// RequireAuth makes the server require AUTH password.
+func (s *Server) RequireAuth(password string) {
+	s.mu.Lock()
+	s.password = password
+	s.mu.Unlock()
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	return s.ln.Close()
+}
+
+// FastForward moves the server clock forward by d, expiring the keys whose
+// TTL elapsed.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// FlushAll deletes every key of every database.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	for i := range s.dbs {
+		s.dbs[i] = newDB()
+	}
+	s.invalidateAll()
+	s.mu.Unlock()
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// notifyPush wakes up the blocked commands, called with mu held.
+func (s *Server) notifyPush() {
+	close(s.pushed)
+	s.pushed = make(chan struct{})
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// client is the state of a connection.
+type client struct {
+	srv     *Server
+	conn    net.Conn
+	id      int64
+	dbIndex int
+	authed  bool
+
+	tracking *tracking // nil when CLIENT TRACKING is off
+	caching  bool      // CLIENT CACHING yes was sent before the command
+
+	wmu sync.Mutex // serializes the replies and the published messages
+	bw  *bufio.Writer
+
+	multi    [][]string // queued commands, nil outside of MULTI
+	inMulti  bool
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	c := &client{
+		srv:      s,
+		conn:     conn,
+		bw:       bufio.NewWriter(conn),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	s.mu.Lock()
+	s.nextID++
+	c.id = s.nextID
+	s.clients[c.id] = c
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, c)
+		delete(s.clients, c.id)
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	br := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			if err == errMultibulkLen || err == errBulkLen {
+				// NOTE: the connection is closed after the error as redis does.
+				c.wmu.Lock()
+				writeReply(c.bw, err)
+				c.bw.Flush()
+				c.wmu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reply := c.handle(args)
+		c.wmu.Lock()
+		writeReply(c.bw, reply)
+		err = c.bw.Flush()
+		c.wmu.Unlock()
+		if err != nil || strings.EqualFold(args[0], "QUIT") {
+			return
+		}
+	}
+}
+
+// handle runs a command received on the connection.
+func (c *client) handle(args []string) interface{} {
+	s := c.srv
+	name := strings.ToUpper(args[0])
+	if blocks, ok := _blocking[name]; ok && !c.inMulti {
+		if timeout, ok := blocks(args); ok {
+			return c.blockingPop(args, timeout)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := c.allowed(name); err != nil {
+		return err
+	}
+	if err := c.redirect(name, args); err != nil {
+		return err
+	}
+	if err := c.readOnly(name); err != nil {
+		return err
+	}
+	if c.inMulti {
+		switch name {
+		case "EXEC", "DISCARD", "MULTI", "WATCH", "UNWATCH":
+		default:
+			if _, err := lookup(args); err != nil {
+				c.inMulti, c.multi = false, nil
+				return err
+			}
+			c.multi = append(c.multi, args)
+			return status("QUEUED")
+		}
+	}
+	return c.exec(args)
+}
+
+// allowed checks the connection state allows the command, with mu held.
+func (c *client) allowed(name string) error {
+	if c.srv.password != "" && !c.authed && name != "AUTH" && name != "QUIT" {
+		return errors.New("NOAUTH Authentication required.")
+	}
+	if len(c.channels)+len(c.patterns) > 0 {
+		switch name {
+		case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+		default:
+			return fmt.Errorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(name))
+		}
+	}
+	return nil
+}
+
+// exec runs a command with mu held.
+func (c *client) exec(args []string) interface{} {
+	cmd, err := lookup(args)
+	if err != nil {
+		return err
+	}
+	reply := cmd.fn(c, args)
+	c.srv.track(c, strings.ToUpper(args[0]), args)
+	return reply
+}
+
+type command struct {
+	fn      func(c *client, args []string) interface{}
+	minArgs int // including the command name
+	maxArgs int // -1 for no limit
+}
+
+var _commands map[string]*command
+
+func init() {
+	_commands = make(map[string]*command)
+	for _, register := range []func(){registerKeys, registerStrings, registerHashes, registerSets, registerZSets, registerLists, registerPubSub, registerScripts, registerBits, registerGeo, registerCluster, registerSentinel, registerStreams} {
+		register()
+	}
+}
+
+func register(name string, minArgs, maxArgs int, fn func(c *client, args []string) interface{}) {
+	_commands[name] = &command{fn: fn, minArgs: minArgs, maxArgs: maxArgs}
+}
+
+func lookup(args []string) (*command, error) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := _commands[name]
+	if !ok {
+		return nil, fmt.Errorf("ERR unknown command '%s'", args[0])
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs >= 0 && len(args) > cmd.maxArgs) {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+	}
+	return cmd, nil
+}
+
+func (c *client) db() *db {
+	return c.srv.dbs[c.dbIndex]
+}
+
+func (c *client) now() time.Time {
+	return c.srv.now()
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		// inline command
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > _maxMultibulk {
+		return nil, errMultibulkLen
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if line, err = readLine(br); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("redistest: expected bulk string")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > _maxBulk {
+			return nil, errBulkLen
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case nullArray:
+		w.WriteString("*-1\r\n")
+	case noReply:
+	case status:
+		w.WriteString("+" + string(v) + "\r\n")
+	case error:
+		w.WriteString("-" + strings.Replace(v.Error(), "\r\n", " ", -1) + "\r\n")
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("redistest: unsupported reply %T", reply))
+	}
+}
+
+// parseInt parses an integer argument.
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errNotInt
+	}
+	return n, nil
+}
+
+// parseFloat parses a float argument, accepting inf and -inf.
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != f {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
@@ -0,0 +1,660 @@
+package redistest
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/Darker-D/ddbase/cache/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+func newTestServer(t *testing.T) (*Server, redis.Conn) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, conn
+}
+
+// check runs a command and compares its normalized reply to want.
+func check(t *testing.T, conn redis.Conn, want interface{}, args ...interface{}) {
+	t.Helper()
+	reply, err := conn.Do(args[0].(string), args[1:]...)
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	if got := normalize(reply); !reflect.DeepEqual(got, want) {
+		t.Fatalf("%v: got %#v, want %#v", args, got, want)
+	}
+}
+
+// checkErr runs a command and checks its error starts with prefix.
+func checkErr(t *testing.T, conn redis.Conn, prefix string, args ...interface{}) {
+	t.Helper()
+	_, err := conn.Do(args[0].(string), args[1:]...)
+	if err == nil || !strings.HasPrefix(err.Error(), prefix) {
+		t.Fatalf("%v: got error %v, want %q", args, err, prefix)
+	}
+}
+
+// normalize turns bulk strings into strings.
+func normalize(reply interface{}) interface{} {
+	switch r := reply.(type) {
+	case []byte:
+		return string(r)
+	case []interface{}:
+		vs := make([]interface{}, len(r))
+		for i, v := range r {
+			vs[i] = normalize(v)
+		}
+		return vs
+	}
+	return reply
+}
+
+func list(vs ...interface{}) []interface{} { return vs }
+
+func TestStrings(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, "OK", "SET", "k", "v")
+	check(t, conn, "v", "GET", "k")
+	check(t, conn, nil, "SET", "k", "w", "NX")
+	check(t, conn, "v", "SET", "k", "w", "GET")
+	check(t, conn, nil, "GET", "missing")
+	check(t, conn, int64(2), "APPEND", "k", "x")
+	check(t, conn, "wx", "GET", "k")
+	check(t, conn, int64(1), "INCR", "n")
+	check(t, conn, int64(11), "INCRBY", "n", 10)
+	check(t, conn, "12.5", "INCRBYFLOAT", "n", "1.5")
+	checkErr(t, conn, "ERR value is not an integer", "INCR", "n")
+	check(t, conn, list("wx", nil, "12.5"), "MGET", "k", "missing", "n")
+	check(t, conn, "OK", "MSET", "a", "hello", "b", "world")
+	check(t, conn, "ell", "GETRANGE", "a", 1, 3)
+	check(t, conn, "world", "GETDEL", "b")
+	check(t, conn, int64(0), "EXISTS", "b")
+
+	check(t, conn, int64(1), "SADD", "set", "m")
+	checkErr(t, conn, "WRONGTYPE", "GET", "set")
+	check(t, conn, "set", "TYPE", "set")
+	checkErr(t, conn, "ERR unknown command", "NOPE")
+	checkErr(t, conn, "ERR wrong number of arguments", "GET")
+}
+
+func TestExpire(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, "OK", "SET", "k", "v", "EX", 10)
+	check(t, conn, int64(10), "TTL", "k")
+	check(t, conn, "OK", "SET", "k2", "v")
+	check(t, conn, int64(-1), "TTL", "k2")
+	check(t, conn, int64(-2), "TTL", "k3")
+	s.FastForward(5 * time.Second)
+	check(t, conn, int64(5), "TTL", "k")
+	s.FastForward(5 * time.Second)
+	check(t, conn, nil, "GET", "k")
+	check(t, conn, int64(-2), "TTL", "k")
+
+	check(t, conn, "OK", "SET", "k", "v")
+	check(t, conn, int64(1), "PEXPIRE", "k", 1500)
+	if ms, err := redis.Int(conn.Do("PTTL", "k")); err != nil || ms <= 1400 || ms > 1500 {
+		t.Fatalf("got PTTL %d %v, want 1500", ms, err)
+	}
+	check(t, conn, int64(1), "PERSIST", "k")
+	check(t, conn, int64(-1), "PTTL", "k")
+	check(t, conn, int64(1), "EXPIRE", "k", 1)
+	check(t, conn, int64(1), "INCR", "counter")
+	check(t, conn, "OK", "SET", "k", "w", "KEEPTTL")
+	check(t, conn, int64(1), "TTL", "k")
+	s.FastForward(time.Second)
+	check(t, conn, int64(0), "EXISTS", "k")
+}
+
+func TestHashes(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(2), "HSET", "h", "a", "1", "b", "2")
+	check(t, conn, "OK", "HMSET", "h", "c", "3")
+	check(t, conn, "1", "HGET", "h", "a")
+	check(t, conn, list("1", nil, "3"), "HMGET", "h", "a", "x", "c")
+	check(t, conn, int64(12), "HINCRBY", "h", "b", 10)
+	check(t, conn, list("a", "1", "b", "12", "c", "3"), "HGETALL", "h")
+	check(t, conn, int64(0), "HSETNX", "h", "a", "9")
+	check(t, conn, int64(1), "HDEL", "h", "a", "x")
+	check(t, conn, int64(2), "HLEN", "h")
+	check(t, conn, list("b", "c"), "HKEYS", "h")
+	check(t, conn, int64(0), "HEXISTS", "h", "a")
+}
+
+func TestSets(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(3), "SADD", "s1", "a", "b", "c")
+	check(t, conn, int64(2), "SADD", "s2", "b", "c", "c")
+	check(t, conn, list("a", "b", "c"), "SMEMBERS", "s1")
+	check(t, conn, list("b", "c"), "SINTER", "s1", "s2")
+	check(t, conn, list("a"), "SDIFF", "s1", "s2")
+	check(t, conn, int64(3), "SUNIONSTORE", "s3", "s1", "s2")
+	check(t, conn, int64(1), "SISMEMBER", "s3", "a")
+	check(t, conn, int64(1), "SMOVE", "s1", "s2", "a")
+	check(t, conn, int64(3), "SCARD", "s2")
+	check(t, conn, int64(2), "SREM", "s1", "b", "c")
+	check(t, conn, int64(0), "EXISTS", "s1")
+}
+
+func TestZSets(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(3), "ZADD", "z", 1, "a", 2, "b", 3, "c")
+	check(t, conn, int64(0), "ZADD", "z", "NX", 5, "a")
+	check(t, conn, int64(1), "ZADD", "z", "XX", "CH", 5, "a")
+	check(t, conn, list("b", "2", "c", "3", "a", "5"), "ZRANGE", "z", 0, -1, "WITHSCORES")
+	check(t, conn, list("a", "c"), "ZREVRANGE", "z", 0, 1)
+	check(t, conn, list("c"), "ZRANGEBYSCORE", "z", "(2", "+inf", "LIMIT", 0, 1)
+	check(t, conn, list("a", "c"), "ZREVRANGEBYSCORE", "z", "+inf", "3")
+	check(t, conn, int64(2), "ZCOUNT", "z", 2, 3)
+	check(t, conn, int64(2), "ZRANK", "z", "a")
+	check(t, conn, "7.5", "ZINCRBY", "z", "2.5", "a")
+	check(t, conn, int64(1), "ZREMRANGEBYSCORE", "z", "-inf", 2)
+	check(t, conn, list("c", "3"), "ZPOPMIN", "z")
+	check(t, conn, int64(1), "ZCARD", "z")
+
+	// NOTE: millisecond timestamps are not formatted with an exponent.
+	check(t, conn, int64(1), "ZADD", "t", 1700000000000, "job")
+	check(t, conn, "1700000000000", "ZSCORE", "t", "job")
+}
+
+func TestLists(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(3), "RPUSH", "l", "a", "b", "c")
+	check(t, conn, int64(4), "LPUSH", "l", "z")
+	check(t, conn, list("z", "a", "b", "c"), "LRANGE", "l", 0, -1)
+	check(t, conn, "c", "LINDEX", "l", -1)
+	check(t, conn, "z", "LPOP", "l")
+	check(t, conn, list("c", "b"), "RPOP", "l", 2)
+	check(t, conn, "a", "RPOPLPUSH", "l", "m")
+	check(t, conn, int64(0), "LLEN", "l")
+	check(t, conn, int64(0), "RPUSHX", "l", "x")
+	check(t, conn, int64(3), "RPUSH", "m", "b", "a")
+	check(t, conn, int64(2), "LREM", "m", 0, "a")
+	check(t, conn, "OK", "LTRIM", "m", 0, 0)
+	check(t, conn, list("b"), "LRANGE", "m", 0, -1)
+}
+
+func TestBlockingPop(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, nil, "BLPOP", "q", "0.05")
+	pusher, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pusher.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pusher.Do("RPUSH", "q", "job")
+	}()
+	check(t, conn, list("q", "job"), "BLPOP", "other", "q", 5)
+}
+
+func TestHyperLogLog(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(1), "PFADD", "h1", "a", "b", "c")
+	check(t, conn, int64(0), "PFADD", "h1", "a")
+	check(t, conn, int64(1), "PFADD", "h2", "c", "d")
+	check(t, conn, int64(3), "PFCOUNT", "h1")
+	check(t, conn, int64(4), "PFCOUNT", "h1", "h2")
+	check(t, conn, "OK", "PFMERGE", "h3", "h1", "h2")
+	check(t, conn, int64(4), "PFCOUNT", "h3")
+}
+
+func TestScan(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	for _, k := range []string{"user:1", "user:2", "user:3", "item:1"} {
+		check(t, conn, "OK", "SET", k, "v")
+	}
+	check(t, conn, list("user:1", "user:2", "user:3"), "KEYS", "user:*")
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", "user:*", "COUNT", 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, _ := redis.Strings(reply[1], nil)
+		keys = append(keys, page...)
+		if cursor = string(reply[0].([]byte)); cursor == "0" {
+			break
+		}
+	}
+	if want := []string{"user:1", "user:2", "user:3"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("got %v, want %v", keys, want)
+	}
+}
+
+func TestSort(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(3), "RPUSH", "l", "3", "10", "1")
+	check(t, conn, list("1", "3", "10"), "SORT", "l")
+	check(t, conn, list("3", "1"), "SORT", "l", "DESC", "LIMIT", 1, 2)
+	check(t, conn, list("1", "10", "3"), "SORT", "l", "ALPHA")
+	check(t, conn, "OK", "HMSET", "w:1", "weight", "5", "name", "a")
+	check(t, conn, "OK", "HMSET", "w:3", "weight", "2", "name", "c")
+	check(t, conn, "OK", "SET", "w:10", "1")
+	check(t, conn, list(nil, "10", "c", "3", "a", "1"), "SORT", "l", "BY", "w:*->weight", "GET", "w:*->name", "GET", "#")
+	check(t, conn, list("3", "10", "1"), "SORT", "l", "BY", "nosort")
+	check(t, conn, int64(3), "SORT", "l", "BY", "w:*", "STORE", "dst")
+	check(t, conn, list("1", "3", "10"), "LRANGE", "dst", 0, -1)
+	check(t, conn, "OK", "SET", "s", "x")
+	checkErr(t, conn, "WRONGTYPE", "SORT", "s")
+	check(t, conn, int64(1), "RPUSH", "bad", "x")
+	checkErr(t, conn, "ERR One or more scores can't be converted into double", "SORT", "bad")
+}
+
+func TestBits(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(0), "SETBIT", "b", 7, 1)
+	check(t, conn, int64(1), "SETBIT", "b", 7, 1)
+	check(t, conn, "\x01", "GET", "b")
+	check(t, conn, int64(1), "GETBIT", "b", 7)
+	check(t, conn, int64(0), "GETBIT", "b", 100)
+	check(t, conn, "OK", "SET", "s", "foobar")
+	check(t, conn, int64(26), "BITCOUNT", "s")
+	check(t, conn, int64(4), "BITCOUNT", "s", 0, 0)
+	check(t, conn, int64(6), "BITCOUNT", "s", 1, 1)
+	check(t, conn, int64(7), "BITCOUNT", "s", -2, -1)
+	check(t, conn, int64(17), "BITCOUNT", "s", 5, 30, "BIT")
+	checkErr(t, conn, "ERR bit is not an integer or out of range", "SETBIT", "b", 1, 2)
+
+	check(t, conn, list(int64(0), int64(0), int64(255)), "BITFIELD", "f", "GET", "u8", 0, "SET", "u8", "#1", 255, "GET", "u8", 8)
+	check(t, conn, list(int64(0), nil, int64(255)), "BITFIELD", "f", "INCRBY", "u8", 8, 1, "OVERFLOW", "FAIL", "INCRBY", "u8", "#1", -1, "OVERFLOW", "SAT", "INCRBY", "u8", 8, 300)
+	check(t, conn, list(int64(-1), int64(127)), "BITFIELD", "g", "INCRBY", "i8", 0, -1, "OVERFLOW", "SAT", "INCRBY", "i8", 0, 200)
+	check(t, conn, list(int64(-128)), "BITFIELD", "g", "INCRBY", "i8", 0, 1)
+	checkErr(t, conn, "ERR Invalid bitfield type", "BITFIELD", "f", "GET", "u64", 0)
+}
+
+func TestGeo(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, int64(2), "GEOADD", "Sicily", 13.361389, 38.115556, "Palermo", 15.087269, 37.502669, "Catania")
+	check(t, conn, int64(0), "GEOADD", "Sicily", "NX", 13, 38, "Palermo")
+	check(t, conn, "166274.1516", "GEODIST", "Sicily", "Palermo", "Catania")
+	check(t, conn, "166.2742", "GEODIST", "Sicily", "Palermo", "Catania", "km")
+	check(t, conn, nil, "GEODIST", "Sicily", "Palermo", "missing")
+	check(t, conn, list(list("13.361389338970184", "38.115556395496299"), nil), "GEOPOS", "Sicily", "Palermo", "missing")
+	checkErr(t, conn, "ERR invalid longitude,latitude pair", "GEOADD", "Sicily", 13, 86, "x")
+
+	check(t, conn, int64(2), "GEOADD", "Sicily", 12.758489, 38.788135, "edge1", 17.241510, 38.788135, "edge2")
+	check(t, conn, list("Catania", "Palermo"), "GEOSEARCH", "Sicily", "FROMLONLAT", 15, 37, "BYRADIUS", 200, "km", "ASC")
+	check(t, conn, list(
+		list("edge1", "279.7405", list("12.75848776102066", "38.788134516242252")),
+		list("edge2", "279.7403", list("17.241510450839996", "38.788134516242252")),
+	), "GEOSEARCH", "Sicily", "FROMLONLAT", 15, 37, "BYBOX", 400, 400, "km", "DESC", "COUNT", 2, "WITHCOORD", "WITHDIST")
+	check(t, conn, list("Palermo", "edge1"), "GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", 100, "km")
+	checkErr(t, conn, "ERR could not decode requested zset member", "GEOSEARCH", "Sicily", "FROMMEMBER", "x", "BYRADIUS", 1, "m")
+	checkErr(t, conn, "ERR unsupported unit", "GEODIST", "Sicily", "Palermo", "Catania", "yd")
+}
+
+func TestCluster(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	checkErr(t, conn, "ERR This instance has cluster support disabled", "CLUSTER", "SLOTS")
+	_, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+	s.SetCluster([]Slots{{Start: 0, End: 8191, Addr: s.Addr()}, {Start: 8192, End: 16383, Addr: "127.0.0.1:7001"}})
+	check(t, conn, list(
+		list(int64(0), int64(8191), list("127.0.0.1", int64(p))),
+		list(int64(8192), int64(16383), list("127.0.0.1", int64(7001))),
+	), "CLUSTER", "SLOTS")
+	check(t, conn, int64(5061), "CLUSTER", "KEYSLOT", "bar")
+	check(t, conn, int64(12182), "CLUSTER", "KEYSLOT", "foo")
+	check(t, conn, "OK", "SET", "bar", "1")
+	checkErr(t, conn, "MOVED 12182 127.0.0.1:7001", "GET", "foo")
+	checkErr(t, conn, "CROSSSLOT", "MGET", "bar", "foo")
+	check(t, conn, list(nil, "1"), "MGET", "{bar}", "bar")
+	checkErr(t, conn, "MOVED 12182 127.0.0.1:7001", "EVAL", "return 1", 1, "foo")
+	check(t, conn, "PONG", "PING")
+}
+
+func TestSentinel(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, list("master", int64(0), []interface{}{}), "ROLE")
+	s.SetReplicaOf("127.0.0.1:7001")
+	check(t, conn, list("slave", "127.0.0.1", int64(7001), "connected", int64(0)), "ROLE")
+	checkErr(t, conn, "READONLY", "SET", "k", "v")
+	check(t, conn, nil, "GET", "k")
+	s.SetReplicaOf("")
+	check(t, conn, "OK", "SET", "k", "v")
+
+	checkErr(t, conn, "ERR unknown command", "SENTINEL", "get-master-addr-by-name", "mymaster")
+	s.Monitor("mymaster", "127.0.0.1:7001", "127.0.0.1:7002")
+	check(t, conn, list("127.0.0.1", "7001"), "SENTINEL", "get-master-addr-by-name", "mymaster")
+	check(t, conn, nil, "SENTINEL", "get-master-addr-by-name", "other")
+	check(t, conn, list(list("name", "127.0.0.1:7002", "ip", "127.0.0.1", "port", "7002", "flags", "slave")), "SENTINEL", "slaves", "mymaster")
+
+	sub, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	psc := redis.PubSubConn{Conn: sub}
+	defer psc.Close()
+	if err = psc.Subscribe("+switch-master"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := psc.Receive().(redis.Subscription); !ok {
+		t.Fatal("want a subscription")
+	}
+	s.Monitor("mymaster", "127.0.0.1:7002")
+	msg, ok := psc.Receive().(redis.Message)
+	if !ok || string(msg.Data) != "mymaster 127.0.0.1 7001 127.0.0.1 7002" {
+		t.Fatalf("got %#v", msg)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	checkErr(t, conn, "ERR wrong number of arguments", "XADD", "s", "*", "f")
+	checkErr(t, conn, "ERR The XGROUP subcommand requires the key to exist", "XGROUP", "CREATE", "s", "g", "0")
+	check(t, conn, "OK", "XGROUP", "CREATE", "s", "g", "0", "MKSTREAM")
+	checkErr(t, conn, "BUSYGROUP", "XGROUP", "CREATE", "s", "g", "$")
+	check(t, conn, "1-1", "XADD", "s", "1-1", "f", "1")
+	check(t, conn, "2-0", "XADD", "s", "2-0", "f", "2")
+	checkErr(t, conn, "ERR The ID specified in XADD is equal or smaller", "XADD", "s", "2-0", "f", "x")
+	check(t, conn, "3-0", "XADD", "s", "MAXLEN", "~", 3, "3-0", "f", "3")
+	check(t, conn, int64(3), "XLEN", "s")
+	check(t, conn, list(list("2-0", list("f", "2"))), "XRANGE", "s", "(1-1", "2")
+	check(t, conn, list(list("3-0", list("f", "3")), list("2-0", list("f", "2"))), "XREVRANGE", "s", "+", "-", "COUNT", 2)
+	check(t, conn, "stream", "TYPE", "s")
+
+	check(t, conn, list(list("s", list(list("1-1", list("f", "1")), list("2-0", list("f", "2"))))),
+		"XREADGROUP", "GROUP", "g", "c1", "COUNT", 2, "STREAMS", "s", ">")
+	check(t, conn, list(list("s", list(list("2-0", list("f", "2"))))), "XREADGROUP", "GROUP", "g", "c1", "STREAMS", "s", "1-1")
+	check(t, conn, list(list("s", list(list("3-0", list("f", "3"))))), "XREADGROUP", "GROUP", "g", "c2", "STREAMS", "s", ">")
+	check(t, conn, nil, "XREADGROUP", "GROUP", "g", "c2", "BLOCK", 10, "STREAMS", "s", ">")
+	checkErr(t, conn, "NOGROUP", "XREADGROUP", "GROUP", "other", "c1", "STREAMS", "s", ">")
+	check(t, conn, list(int64(3), "1-1", "3-0", list(list("c1", "2"), list("c2", "1"))), "XPENDING", "s", "g")
+
+	check(t, conn, int64(1), "XDEL", "s", "1-1")
+	check(t, conn, list(list("s", list(list("1-1", nil), list("2-0", list("f", "2"))))),
+		"XREADGROUP", "GROUP", "g", "c1", "STREAMS", "s", "0")
+	check(t, conn, []interface{}{}, "XPENDING", "s", "g", "IDLE", 60000, "-", "+", 10)
+	s.FastForward(time.Minute)
+	check(t, conn, list(list("2-0", list("f", "2"))), "XCLAIM", "s", "g", "c2", 60000, "1-1", "2-0")
+	check(t, conn, list(int64(2), "2-0", "3-0", list(list("c2", "2"))), "XPENDING", "s", "g")
+	pending, err := redis.Values(conn.Do("XPENDING", "s", "g", "-", "+", 10, "c2"))
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("XPENDING got %v, %v", pending, err)
+	}
+	for i, want := range []int64{2, 1} {
+		if e := pending[i].([]interface{}); e[3] != want {
+			t.Fatalf("XPENDING entry %d got %d deliveries, want %d", i, e[3], want)
+		}
+	}
+	s.FastForward(time.Minute)
+	check(t, conn, list("3-0", list(list("2-0", list("f", "2"))), []interface{}{}), "XAUTOCLAIM", "s", "g", "c1", 60000, "0", "COUNT", 1)
+	check(t, conn, int64(1), "XACK", "s", "g", "2-0", "1-1")
+	check(t, conn, list(int64(1), "3-0", "3-0", list(list("c2", "1"))), "XPENDING", "s", "g")
+	check(t, conn, []interface{}{}, "XPENDING", "s", "g", "(3-0", "+", 10)
+
+	done := make(chan interface{})
+	go func() {
+		sub, err := redis.Dial("tcp", s.Addr())
+		if err != nil {
+			done <- err
+			return
+		}
+		defer sub.Close()
+		reply, err := sub.Do("XREADGROUP", "GROUP", "g", "c1", "BLOCK", 0, "STREAMS", "s", ">")
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- normalize(reply)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	check(t, conn, "4-0", "XADD", "s", "4-0", "f", "4")
+	if got, want := <-done, list(list("s", list(list("4-0", list("f", "4"))))); !reflect.DeepEqual(got, want) {
+		t.Fatalf("blocked XREADGROUP got %#v, want %#v", got, want)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	check(t, conn, "OK", "MULTI")
+	check(t, conn, "QUEUED", "SET", "k", "1")
+	check(t, conn, "QUEUED", "INCR", "k")
+	check(t, conn, list("OK", int64(2)), "EXEC")
+	checkErr(t, conn, "ERR EXEC without MULTI", "EXEC")
+	check(t, conn, "OK", "SELECT", 1)
+	check(t, conn, nil, "GET", "k")
+}
+
+func TestAuth(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	s.RequireAuth("secret")
+	checkErr(t, conn, "NOAUTH", "GET", "k")
+	checkErr(t, conn, "WRONGPASS", "AUTH", "wrong")
+	check(t, conn, "OK", "AUTH", "secret")
+	check(t, conn, nil, "GET", "k")
+}
+
+func TestProtocolError(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, c := range []struct {
+		req, want string
+	}{
+		{"*-2\r\n", "-ERR Protocol error: invalid multibulk length\r\n"},
+		{"*x\r\n", "-ERR Protocol error: invalid multibulk length\r\n"},
+		{"*99999999999\r\n", "-ERR Protocol error: invalid multibulk length\r\n"},
+		{"*1\r\n$-2\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+		{"*1\r\n$99999999999\r\n", "-ERR Protocol error: invalid bulk length\r\n"},
+	} {
+		conn, err := net.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err = conn.Write([]byte(c.req)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil || string(got) != c.want {
+			t.Fatalf("%q: got %q error(%v), want %q", c.req, got, err, c.want)
+		}
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	sub, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	psc := redis.PubSubConn{Conn: sub}
+	defer psc.Close()
+	if err = psc.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if err = psc.PSubscribe("chat.*"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := psc.Receive().(redis.Subscription); !ok {
+			t.Fatal("want a subscription")
+		}
+	}
+	checkErr(t, sub, "ERR Can't execute 'get'", "GET", "k")
+	check(t, conn, int64(1), "PUBLISH", "news", "hello")
+	check(t, conn, int64(1), "PUBLISH", "chat.go", "hi")
+	check(t, conn, int64(0), "PUBLISH", "other", "nobody")
+	check(t, conn, list("news", int64(1)), "PUBSUB", "NUMSUB", "news")
+
+	msg, ok := psc.Receive().(redis.Message)
+	if !ok || msg.Channel != "news" || string(msg.Data) != "hello" {
+		t.Fatalf("got %#v", msg)
+	}
+	msg, ok = psc.Receive().(redis.Message)
+	if !ok || msg.Pattern != "chat.*" || msg.Channel != "chat.go" || string(msg.Data) != "hi" {
+		t.Fatalf("got %#v", msg)
+	}
+}
+
+func TestClientTracking(t *testing.T) {
+	s, conn := newTestServer(t)
+	defer s.Close()
+	defer conn.Close()
+
+	redirect, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redirect.Close()
+	id, err := redis.Int64(redirect.Do("CLIENT", "ID"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = redirect.Do("SUBSCRIBE", "__redis__:invalidate"); err != nil {
+		t.Fatal(err)
+	}
+	invalidated := func(want interface{}) {
+		t.Helper()
+		reply, err := redirect.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := normalize(reply); !reflect.DeepEqual(got, list("message", "__redis__:invalidate", want)) {
+			t.Fatalf("got %#v, want invalidation of %#v", got, want)
+		}
+	}
+
+	checkErr(t, conn, "ERR The client ID", "CLIENT", "TRACKING", "on", "REDIRECT", 1000)
+	checkErr(t, conn, "ERR PREFIX option requires BCAST", "CLIENT", "TRACKING", "on", "PREFIX", "a")
+	check(t, conn, "OK", "CLIENT", "TRACKING", "on", "REDIRECT", id)
+	check(t, conn, nil, "GET", "k")
+	check(t, conn, nil, "HGET", "h", "f")
+	check(t, conn, "OK", "SET", "k", "v")
+	invalidated(list("k"))
+	// the key is tracked again only once read
+	check(t, conn, "OK", "SET", "k", "w")
+	check(t, conn, int64(1), "HSET", "h", "f", "v")
+	invalidated(list("h"))
+	check(t, conn, "w", "GET", "k")
+	check(t, conn, "OK", "FLUSHALL")
+	invalidated(nil)
+
+	// optin only tracks the reads after CLIENT CACHING yes
+	checkErr(t, conn, "ERR CLIENT CACHING", "CLIENT", "CACHING", "yes")
+	check(t, conn, "OK", "CLIENT", "TRACKING", "on", "REDIRECT", id, "OPTIN")
+	check(t, conn, nil, "GET", "a")
+	check(t, conn, "OK", "CLIENT", "CACHING", "yes")
+	check(t, conn, nil, "GET", "b")
+	check(t, conn, "OK", "MSET", "a", "1", "b", "2")
+	invalidated(list("b"))
+
+	// bcast reports the writes of every key matching the prefixes
+	check(t, conn, "OK", "CLIENT", "TRACKING", "on", "REDIRECT", id, "BCAST", "PREFIX", "user:")
+	check(t, conn, int64(1), "DEL", "a")
+	check(t, conn, "OK", "SET", "user:1", "x")
+	invalidated(list("user:1"))
+}
+
+func TestClient(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := cache.New(&cache.Config{Network: "tcp", Address: s.Addr(), Codec: "json", MaxIdle: 2})
+	defer c.Close()
+
+	ctx := context.Background()
+	type value struct{ N int }
+	if err = c.SetEx(ctx, "k", &value{N: 1}, 60); err != nil {
+		t.Fatal(err)
+	}
+	var v value
+	if ok, err := c.Load(ctx, "k", &v); err != nil || !ok || v.N != 1 {
+		t.Fatalf("got %v %v %v", v, ok, err)
+	}
+	s.FastForward(time.Minute)
+	if ok, err := c.Load(ctx, "k", &v); err != nil || ok {
+		t.Fatalf("got %v %v, want an expired key", ok, err)
+	}
+
+	// the lock scripts run on the interpreter
+	l, err := c.Lock(ctx, "lock", &cache.LockConfig{TTL: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Lock(ctx, "lock", nil); err != cache.ErrLockNotObtained {
+		t.Fatalf("got %v, want ErrLockNotObtained", err)
+	}
+	if err = l.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Unlock(ctx); err != cache.ErrLockNotHeld {
+		t.Fatalf("got %v, want ErrLockNotHeld", err)
+	}
+}
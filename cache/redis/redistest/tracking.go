@@ -0,0 +1,234 @@
+package redistest
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// _invalidate is the channel of the invalidation messages redirected to a
+// RESP2 connection.
+const _invalidate = "__redis__:invalidate"
+
+// keySpec gives the positions of the keys in the arguments of a command: the
+// first and last index, negative from the end, and the step.
+type keySpec struct {
+	first, last, step int
+	write             bool
+}
+
+var (
+	read1    = keySpec{1, 1, 1, false}
+	readAll  = keySpec{1, -1, 1, false}
+	write1   = keySpec{1, 1, 1, true}
+	write2   = keySpec{1, 2, 1, true}
+	writeAll = keySpec{1, -1, 1, true}
+)
+
+// _keySpecs lists the keys read and written by the commands, for tracking.
+var _keySpecs = map[string]keySpec{
+	// keys
+	"DEL": writeAll, "UNLINK": writeAll, "EXISTS": readAll, "TYPE": read1, "RENAME": write2,
+	"EXPIRE": write1, "PEXPIRE": write1, "EXPIREAT": write1, "PEXPIREAT": write1,
+	"PERSIST": write1, "TTL": read1, "PTTL": read1, "SORT": read1,
+	// strings
+	"GET": read1, "MGET": readAll, "STRLEN": read1, "GETRANGE": read1,
+	"SET": write1, "SETEX": write1, "PSETEX": write1, "SETNX": write1, "GETSET": write1,
+	"GETDEL": write1, "MSET": {1, -1, 2, true}, "MSETNX": {1, -1, 2, true},
+	"INCR": write1, "DECR": write1, "INCRBY": write1, "DECRBY": write1,
+	"INCRBYFLOAT": write1, "APPEND": write1,
+	"PFADD": write1, "PFCOUNT": readAll, "PFMERGE": writeAll,
+	"GETBIT": read1, "BITCOUNT": read1, "SETBIT": write1, "BITFIELD": write1,
+	// hashes
+	"HGET": read1, "HMGET": read1, "HGETALL": read1, "HEXISTS": read1, "HLEN": read1,
+	"HKEYS": read1, "HVALS": read1, "HSCAN": read1,
+	"HSET": write1, "HMSET": write1, "HSETNX": write1, "HDEL": write1,
+	"HINCRBY": write1, "HINCRBYFLOAT": write1,
+	// sets
+	"SMEMBERS": read1, "SISMEMBER": read1, "SCARD": read1, "SRANDMEMBER": read1, "SSCAN": read1,
+	"SUNION": readAll, "SINTER": readAll, "SDIFF": readAll,
+	"SADD": write1, "SREM": write1, "SPOP": write1, "SMOVE": write2,
+	"SUNIONSTORE": writeAll, "SINTERSTORE": writeAll, "SDIFFSTORE": writeAll,
+	// sorted sets
+	"ZSCORE": read1, "ZMSCORE": read1, "ZCARD": read1, "ZCOUNT": read1, "ZRANK": read1,
+	"ZREVRANK": read1, "ZRANGE": read1, "ZREVRANGE": read1, "ZRANGEBYSCORE": read1,
+	"ZREVRANGEBYSCORE": read1, "ZSCAN": read1,
+	"ZADD": write1, "ZINCRBY": write1, "ZREM": write1, "ZREMRANGEBYRANK": write1,
+	"ZREMRANGEBYSCORE": write1, "ZPOPMIN": write1, "ZPOPMAX": write1,
+	"GEOPOS": read1, "GEODIST": read1, "GEOSEARCH": read1, "GEOADD": write1,
+	// lists
+	"LLEN": read1, "LRANGE": read1, "LINDEX": read1,
+	"LPUSH": write1, "RPUSH": write1, "LPUSHX": write1, "RPUSHX": write1, "LPOP": write1,
+	"RPOP": write1, "LSET": write1, "LREM": write1, "LTRIM": write1, "LINSERT": write1,
+	"RPOPLPUSH": write2, "BRPOPLPUSH": write2,
+	"BLPOP": {1, -2, 1, true}, "BRPOP": {1, -2, 1, true},
+	// streams
+	"XLEN": read1, "XRANGE": read1, "XREVRANGE": read1, "XPENDING": read1,
+	"XADD": write1, "XDEL": write1, "XACK": write1, "XCLAIM": write1, "XAUTOCLAIM": write1,
+	"XGROUP": {2, 2, 1, true},
+}
+
+func (k keySpec) keys(args []string) []string {
+	last := k.last
+	if last < 0 {
+		last += len(args)
+	}
+	var keys []string
+	for i := k.first; i <= last && i < len(args); i += k.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// tracking is the CLIENT TRACKING state of a connection. Invalidations are
+// only sent to a REDIRECT connection subscribed to __redis__:invalidate, and
+// keys deleted by their TTL are not reported.
+type tracking struct {
+	redirect int64
+	bcast    bool
+	optin    bool
+	noloop   bool
+	prefixes []string
+}
+
+func (t *tracking) matches(key string) bool {
+	if len(t.prefixes) == 0 {
+		return true
+	}
+	for _, p := range t.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func cmdClient(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "ID":
+		return c.id
+	case "TRACKING":
+		return cmdClientTracking(c, args)
+	case "CACHING":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		if c.tracking == nil || !c.tracking.optin {
+			return errors.New("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+		}
+		c.caching = strings.EqualFold(args[2], "yes")
+	}
+	return status("OK")
+}
+
+func cmdClientTracking(c *client, args []string) interface{} {
+	if len(args) < 3 {
+		return errSyntax
+	}
+	switch strings.ToUpper(args[2]) {
+	case "OFF":
+		c.tracking = nil
+		return status("OK")
+	case "ON":
+	default:
+		return errSyntax
+	}
+	t := &tracking{}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i++; i == len(args) {
+				return errSyntax
+			}
+			id, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return errNotInt
+			}
+			if _, ok := c.srv.clients[id]; !ok {
+				return errors.New("ERR The client ID you want redirect to does not exist")
+			}
+			t.redirect = id
+		case "PREFIX":
+			if i++; i == len(args) {
+				return errSyntax
+			}
+			t.prefixes = append(t.prefixes, args[i])
+		case "BCAST":
+			t.bcast = true
+		case "OPTIN":
+			t.optin = true
+		case "NOLOOP":
+			t.noloop = true
+		default:
+			return errSyntax
+		}
+	}
+	if len(t.prefixes) > 0 && !t.bcast {
+		return errors.New("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	c.tracking = t
+	return status("OK")
+}
+
+// track records the keys read by a tracking connection and invalidates the
+// keys written by the command in args, with mu held.
+func (s *Server) track(c *client, name string, args []string) {
+	if spec, ok := _keySpecs[name]; ok {
+		t := c.tracking
+		for _, key := range spec.keys(args) {
+			switch {
+			case spec.write:
+				s.invalidate(key, c)
+			case t != nil && !t.bcast && (!t.optin || c.caching):
+				readers := s.tracked[key]
+				if readers == nil {
+					readers = make(map[*client]struct{})
+					s.tracked[key] = readers
+				}
+				readers[c] = struct{}{}
+			}
+		}
+	}
+	if name != "CLIENT" {
+		c.caching = false
+	}
+}
+
+// invalidate notifies the connections tracking key that writer modified it.
+func (s *Server) invalidate(key string, writer *client) {
+	for c := range s.tracked[key] {
+		if t := c.tracking; t != nil && (c != writer || !t.noloop) {
+			s.notify(c, []interface{}{key})
+		}
+	}
+	delete(s.tracked, key)
+	for _, c := range s.clients {
+		if t := c.tracking; t != nil && t.bcast && t.matches(key) && (c != writer || !t.noloop) {
+			s.notify(c, []interface{}{key})
+		}
+	}
+}
+
+// invalidateAll notifies every tracking connection of a flush.
+func (s *Server) invalidateAll() {
+	for _, c := range s.clients {
+		if c.tracking != nil {
+			s.notify(c, nullArray{})
+		}
+	}
+	s.tracked = make(map[string]map[*client]struct{})
+}
+
+// notify sends the invalidation of keys to the redirect connection of c.
+func (s *Server) notify(c *client, keys interface{}) {
+	if c.tracking == nil || s.clients[c.id] != c {
+		return
+	}
+	target := s.clients[c.tracking.redirect]
+	if target == nil {
+		return
+	}
+	if _, ok := target.channels[_invalidate]; ok {
+		target.push([]interface{}{"message", _invalidate, keys})
+	}
+}
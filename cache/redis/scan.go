@@ -0,0 +1,166 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+// ErrStopScan can be returned by a scan callback to stop the iteration
+// without error.
+var ErrStopScan = errors.New("redis: stop scan")
+
+var errScanReply = errors.New("redis: unexpected scan reply")
+
+// ScanOptions are the options of the SCAN command family.
+type ScanOptions struct {
+	Match string // 匹配模式, 为空匹配全部
+	Count int    // 每次迭代的数量提示, 默认 100
+	Type  string // 按类型过滤, 仅 ScanEach 使用, 需要 redis 6.0+
+}
+
+func (opt *ScanOptions) args(args []interface{}, scan bool) []interface{} {
+	o := ScanOptions{}
+	if opt != nil {
+		o = *opt
+	}
+	if o.Match != "" {
+		args = append(args, "MATCH", o.Match)
+	}
+	if o.Count <= 0 {
+		o.Count = 100
+	}
+	args = append(args, "COUNT", o.Count)
+	if scan && o.Type != "" {
+		args = append(args, "TYPE", o.Type)
+	}
+	return args
+}
+
+// ScanEach iterates the keys matching opt with SCAN and calls fn for each of
+// them, on every master under cluster mode. Keys are fetched by batches of
+// about opt.Count so that the server is never blocked, a key may be seen
+// more than once. The iteration stops when fn returns an error or ctx is
+// done.
+func (c *Client) ScanEach(ctx context.Context, opt *ScanOptions, fn func(key string) error) error {
+	each := func(items []interface{}) error {
+		return fn(string(items[0].([]byte)))
+	}
+	if c.cluster == nil {
+		conn, err := c.getReadConn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = scanEach(ctx, func(cursor string) (interface{}, error) {
+			return conn.Do("SCAN", opt.args([]interface{}{cursor}, true)...)
+		}, 1, each)
+		if err == ErrStopScan {
+			return nil
+		}
+		return err
+	}
+	nodes := c.cluster.Masters()
+	if len(nodes) == 0 {
+		if err := c.cluster.reload(); err != nil {
+			return err
+		}
+		nodes = c.cluster.Masters()
+	}
+	for _, addr := range nodes {
+		addr := addr
+		err := scanEach(ctx, func(cursor string) (interface{}, error) {
+			return c.cluster.doNode(ctx, addr, false, 0, "SCAN", opt.args([]interface{}{cursor}, true))
+		}, 1, each)
+		if err == ErrStopScan {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HScanEach iterates the fields of hash key matching opt with HSCAN.
+func (c *Client) HScanEach(ctx context.Context, key string, opt *ScanOptions, fn func(field, value string) error) error {
+	return c.scanKey(ctx, "HSCAN", key, opt, 2, func(items []interface{}) error {
+		return fn(string(items[0].([]byte)), string(items[1].([]byte)))
+	})
+}
+
+// ZScanEach iterates the members of sorted set key matching opt with ZSCAN.
+func (c *Client) ZScanEach(ctx context.Context, key string, opt *ScanOptions, fn func(member string, score float64) error) error {
+	return c.scanKey(ctx, "ZSCAN", key, opt, 2, func(items []interface{}) error {
+		score, err := redis.Float64(items[1], nil)
+		if err != nil {
+			return err
+		}
+		return fn(string(items[0].([]byte)), score)
+	})
+}
+
+// SScanEach iterates the members of set key matching opt with SSCAN.
+func (c *Client) SScanEach(ctx context.Context, key string, opt *ScanOptions, fn func(member string) error) error {
+	return c.scanKey(ctx, "SSCAN", key, opt, 1, func(items []interface{}) error {
+		return fn(string(items[0].([]byte)))
+	})
+}
+
+func (c *Client) scanKey(ctx context.Context, cmd, key string, opt *ScanOptions, n int, fn func(items []interface{}) error) error {
+	conn, err := c.getReadConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = scanEach(ctx, func(cursor string) (interface{}, error) {
+		return conn.Do(cmd, opt.args([]interface{}{key, cursor}, false)...)
+	}, n, fn)
+	if err == ErrStopScan {
+		return nil
+	}
+	return err
+}
+
+// scanEach calls do with the cursor until the iteration is complete and fn
+// with every n items of the replies. do must send every batch to the same
+// server, a cursor is meaningless on another one such as a replica.
+func scanEach(ctx context.Context, do func(cursor string) (interface{}, error), n int, fn func(items []interface{}) error) error {
+	cursor := "0"
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		values, err := redis.Values(do(cursor))
+		if err != nil {
+			return err
+		}
+		if len(values) != 2 {
+			return errScanReply
+		}
+		if cursor, err = redis.String(values[0], nil); err != nil {
+			return err
+		}
+		items, err := redis.Values(values[1], nil)
+		if err != nil {
+			return err
+		}
+		if len(items)%n != 0 {
+			return errScanReply
+		}
+		for i := 0; i < len(items); i += n {
+			for _, item := range items[i : i+n] {
+				if _, ok := item.([]byte); !ok {
+					return errScanReply
+				}
+			}
+			if err = fn(items[i : i+n]); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
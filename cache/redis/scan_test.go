@@ -0,0 +1,147 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+func TestScanEach(t *testing.T) {
+	var keys []string
+	for i := 0; i < 25; i++ {
+		keys = append(keys, fmt.Sprintf("user:%02d", i))
+	}
+	keys = append(keys, "other")
+	s := newTestServer(t)
+	defer s.Close()
+	for _, k := range keys {
+		do(t, s, "SET", k, "v")
+	}
+	do(t, s, "HSET", "h", "f1", "v1", "f2", "v2", "f3", "v3")
+	do(t, s, "ZADD", "z", 1, "a", 2.5, "b")
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1})
+	defer client.Close()
+	ctx := context.Background()
+
+	var got []string
+	err := client.ScanEach(ctx, &ScanOptions{Match: "user:*", Count: 10}, func(key string) error {
+		got = append(got, key)
+		return nil
+	})
+	if err != nil || len(got) != 25 || got[24] != "user:24" {
+		t.Fatalf("ScanEach = %v, %v", got, err)
+	}
+	got = got[:0]
+	err = client.ScanEach(ctx, nil, func(key string) error {
+		if got = append(got, key); len(got) == 3 {
+			return ErrStopScan
+		}
+		return nil
+	})
+	if err != nil || len(got) != 3 {
+		t.Fatalf("stopped ScanEach = %v, %v", got, err)
+	}
+
+	fields := make(map[string]string)
+	err = client.HScanEach(ctx, "h", &ScanOptions{Count: 1}, func(field, value string) error {
+		fields[field] = value
+		return nil
+	})
+	if err != nil || len(fields) != 3 || fields["f2"] != "v2" {
+		t.Fatalf("HScanEach = %v, %v", fields, err)
+	}
+	scores := make(map[string]float64)
+	err = client.ZScanEach(ctx, "z", nil, func(member string, score float64) error {
+		scores[member] = score
+		return nil
+	})
+	if err != nil || scores["b"] != 2.5 {
+		t.Fatalf("ZScanEach = %v, %v", scores, err)
+	}
+}
+
+func TestScanEachCluster(t *testing.T) {
+	a, b, reshard := newTestCluster(t)
+	defer a.Close()
+	defer b.Close()
+	reshard()
+	client := New(&Config{Network: "tcp", Cluster: true, Addrs: []string{a.Addr()}, MaxIdle: 1})
+	defer client.Close()
+	ctx := context.Background()
+	// "{bar}" keys are served by a, "{foo}" ones by b.
+	keys := []string{"{bar}1", "{bar}2", "{bar}3", "{foo}1", "{foo}2"}
+	for _, k := range keys {
+		if err := client.SetEx(ctx, k, "v", 0); err != nil {
+			t.Fatalf("SetEx(%s) error(%v)", k, err)
+		}
+	}
+
+	var got []string
+	err := client.ScanEach(ctx, &ScanOptions{Count: 2}, func(key string) error {
+		got = append(got, key)
+		return nil
+	})
+	sort.Strings(got)
+	if err != nil || strings.Join(got, ",") != strings.Join(keys, ",") {
+		t.Fatalf("ScanEach = %v, %v", got, err)
+	}
+}
+
+func TestScanEachOneServer(t *testing.T) {
+	var servers [2]*redistest.Server
+	for i := range servers {
+		s, err := redistest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		servers[i] = s
+		conn, err := redis.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 50; j++ {
+			conn.Do("SET", fmt.Sprintf("s%d:%02d", i, j), "v")
+			conn.Do("SADD", "set", fmt.Sprintf("s%d:%02d", i, j))
+		}
+		conn.Close()
+	}
+	// NOTE: every new connection picks a random instance, as a replica pool
+	// does, so the batches of a scan must share one connection.
+	w := newFakeWatcher(servers[0].Addr(), servers[1].Addr())
+	client := New(&Config{Network: "tcp", Naming: w})
+	defer client.Close()
+	ctx := context.Background()
+
+	check := func(name string, keys []string) {
+		sort.Strings(keys)
+		if len(keys) != 50 || keys[0][:3] != keys[49][:3] {
+			t.Fatalf("%s got %d keys %v, want the 50 keys of one server", name, len(keys), keys)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		var keys []string
+		if err := client.ScanEach(ctx, &ScanOptions{Count: 5}, func(key string) error {
+			if key != "set" {
+				keys = append(keys, key)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		check("ScanEach", keys)
+		keys = keys[:0]
+		if err := client.SScanEach(ctx, "set", &ScanOptions{Count: 5}, func(member string) error {
+			keys = append(keys, member)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		check("SScanEach", keys)
+	}
+}
@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+var (
+	errScriptNotFound  = errors.New("redis: script not registered")
+	errScriptCrossSlot = errors.New("redis: script keys hash to different cluster slots")
+)
+
+// Eval <=> EVALSHA script, falls back to EVAL if the script is not loaded.
+// Under cluster mode the command is routed by the first key.
+func (c *Client) Eval(ctx context.Context, script *redis.Script, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if err = conn.Err(); err != nil {
+		return
+	}
+	return script.Do(conn, keysAndArgs...)
+}
+
+// Scripts is a registry of named Lua scripts. Set as Config.Scripts, the
+// scripts are loaded on every new connection of the client and run by name
+// with RunScript.
+type Scripts struct {
+	mu      sync.RWMutex
+	scripts map[string]*namedScript
+}
+
+type namedScript struct {
+	*redis.Script
+	src      string
+	keyCount int // number of keys, negative if not declared
+}
+
+// NewScripts new an empty script registry.
+func NewScripts() *Scripts {
+	return &Scripts{scripts: make(map[string]*namedScript)}
+}
+
+// Register registers the script src as name, replacing the previous one. If
+// keyCount is greater than or equal to zero, it is checked against the keys
+// given to RunScript.
+func (s *Scripts) Register(name string, keyCount int, src string) {
+	s.mu.Lock()
+	// NOTE: the key count is always sent by RunScript.
+	s.scripts[name] = &namedScript{Script: redis.NewScript(-1, src), src: src, keyCount: keyCount}
+	s.mu.Unlock()
+}
+
+// LoadDir registers the *.lua files of dir named by their base name without
+// extension. A leading "-- keys: N" comment declares the key count.
+func (s *Scripts) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		src := string(b)
+		keyCount, err := scriptKeyCount(src)
+		if err != nil {
+			return fmt.Errorf("redis: script %s: %v", file, err)
+		}
+		s.Register(strings.TrimSuffix(filepath.Base(file), ".lua"), keyCount, src)
+	}
+	return nil
+}
+
+// scriptKeyCount parses the "-- keys: N" declaration in the leading comments
+// of src, -1 if missing.
+func scriptKeyCount(src string) (int, error) {
+	sc := bufio.NewScanner(strings.NewReader(src))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		if !strings.HasPrefix(strings.ToLower(line), "keys:") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line[len("keys:"):]))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid key count %q", line)
+		}
+		return n, nil
+	}
+	return -1, nil
+}
+
+func (s *Scripts) get(name string) (*namedScript, error) {
+	s.mu.RLock()
+	script, ok := s.scripts[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%v: %s", errScriptNotFound, name)
+	}
+	return script, nil
+}
+
+// load loads all the scripts on conn. Scripts failing to compile are left to
+// the EVAL fallback which reports the error.
+func (s *Scripts) load(conn redis.Conn) error {
+	s.mu.RLock()
+	for _, script := range s.scripts {
+		conn.Send("SCRIPT", "LOAD", script.src)
+	}
+	n := len(s.scripts)
+	s.mu.RUnlock()
+	if n == 0 {
+		return nil
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if _, err := conn.Receive(); err != nil {
+			if _, ok := err.(redis.Error); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunScript runs the script registered as name in Config.Scripts. Under
+// cluster mode all the keys must hash to the same slot.
+func (c *Client) RunScript(ctx context.Context, name string, keys []string, args ...interface{}) (reply interface{}, err error) {
+	if c.scripts == nil {
+		return nil, fmt.Errorf("%v: %s", errScriptNotFound, name)
+	}
+	script, err := c.scripts.get(name)
+	if err != nil {
+		return
+	}
+	if script.keyCount >= 0 && script.keyCount != len(keys) {
+		return nil, fmt.Errorf("redis: script %s wants %d keys, got %d", name, script.keyCount, len(keys))
+	}
+	if c.cluster != nil {
+		for i := 1; i < len(keys); i++ {
+			if hashSlot(keys[i]) != hashSlot(keys[0]) {
+				return nil, errScriptCrossSlot
+			}
+		}
+	}
+	keysAndArgs := make([]interface{}, 0, 1+len(keys)+len(args))
+	keysAndArgs = append(keysAndArgs, len(keys))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, key)
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+	return c.Eval(ctx, script.Script, keysAndArgs...)
+}
+
+// RunScriptInt64 runs the script name and converts the reply to int64.
+func (c *Client) RunScriptInt64(ctx context.Context, name string, keys []string, args ...interface{}) (int64, error) {
+	return redis.Int64(c.RunScript(ctx, name, keys, args...))
+}
+
+// RunScriptString runs the script name and converts the reply to string.
+func (c *Client) RunScriptString(ctx context.Context, name string, keys []string, args ...interface{}) (string, error) {
+	return redis.String(c.RunScript(ctx, name, keys, args...))
+}
+
+// RunScriptStrings runs the script name and converts the reply to []string.
+func (c *Client) RunScriptStrings(ctx context.Context, name string, keys []string, args ...interface{}) ([]string, error) {
+	return redis.Strings(c.RunScript(ctx, name, keys, args...))
+}
+
+// RunScriptBool runs the script name and converts the reply to bool.
+func (c *Client) RunScriptBool(ctx context.Context, name string, keys []string, args ...interface{}) (bool, error) {
+	return redis.Bool(c.RunScript(ctx, name, keys, args...))
+}
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+func TestScripts(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "scripts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	incr := "-- incrby the key\n-- keys: 1\nlocal v = redis.call('INCRBY', KEYS[1], ARGV[1])\nreturn v\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "incr.lua"), []byte(incr), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scripts := NewScripts()
+	if err = scripts.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	scripts.Register("echo", -1, "return ARGV[1]")
+
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1, Scripts: scripts})
+	defer client.Close()
+	ctx := context.Background()
+
+	if v, err := client.RunScriptInt64(ctx, "incr", []string{"n"}, 2); err != nil || v != 2 {
+		t.Fatalf("RunScriptInt64(incr) = %d, %v", v, err)
+	}
+	// the scripts are preloaded by the new connection
+	conn, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	exists, err := redis.Ints(conn.Do("SCRIPT", "EXISTS", redis.NewScript(-1, incr).Hash(), redis.NewScript(-1, "return ARGV[1]").Hash()))
+	if err != nil || exists[0] != 1 || exists[1] != 1 {
+		t.Fatalf("SCRIPT EXISTS = %v, %v", exists, err)
+	}
+
+	// EVAL fallback once the script cache is flushed
+	if _, err = conn.Do("SCRIPT", "FLUSH"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.RunScriptString(ctx, "echo", nil, "hi"); err != nil || v != "hi" {
+		t.Fatalf("RunScriptString(echo) = %q, %v", v, err)
+	}
+
+	if _, err = client.RunScript(ctx, "incr", []string{"a", "b"}, 1); err == nil || !strings.Contains(err.Error(), "wants 1 keys") {
+		t.Fatalf("got %v, want key count error", err)
+	}
+	if _, err = client.RunScript(ctx, "missing", nil); err == nil {
+		t.Fatal("want not registered error")
+	}
+}
+
+func TestScriptKeyCount(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want int
+		err  bool
+	}{
+		{"return 1", -1, false},
+		{"-- keys: 2\nreturn 1", 2, false},
+		{"\n-- a comment\n--KEYS:0\nreturn 1", 0, false},
+		{"return 1\n-- keys: 2", -1, false},
+		{"-- keys: x\nreturn 1", 0, true},
+	} {
+		n, err := scriptKeyCount(test.src)
+		if n != test.want || (err != nil) != test.err {
+			t.Errorf("scriptKeyCount(%q) = %d, %v, want %d", test.src, n, err, test.want)
+		}
+	}
+}
+
+func TestScriptsCrossSlot(t *testing.T) {
+	a, b, _ := newTestCluster(t)
+	defer a.Close()
+	defer b.Close()
+	scripts := NewScripts()
+	scripts.Register("mget", -1, "return redis.call('MGET', unpack(KEYS))")
+	client := New(&Config{Network: "tcp", Cluster: true, Addrs: []string{a.Addr()}, Scripts: scripts})
+	defer client.Close()
+
+	if _, err := client.RunScript(context.Background(), "mget", []string{"foo", "bar"}); err != errScriptCrossSlot {
+		t.Fatalf("got %v, want errScriptCrossSlot", err)
+	}
+}
@@ -0,0 +1,211 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redisx"
+)
+
+// sentinel keeps the master and replica pools of a sentinel monitored group
+// pointing to the current servers.
+type sentinel struct {
+	conf    *Config
+	s       *redisx.Sentinel
+	master  *redis.Pool
+	replica *redis.Pool // nil if replica reads are disabled
+	cancel  func()
+
+	mu       sync.RWMutex
+	addr     string   // current master address
+	replicas []string // current replica addresses
+}
+
+func newSentinel(c *Config) *sentinel {
+	sn := &sentinel{
+		conf: c,
+		s: &redisx.Sentinel{
+			Addrs:      c.SentinelAddrs,
+			MasterName: c.MasterName,
+			Dial: func(addr string) (redis.Conn, error) {
+				return dial(&Config{
+					Network:        c.Network,
+					Password:       c.SentinelPassword,
+					ConnectTimeout: c.ConnectTimeout,
+					ReadTimeout:    c.ReadTimeout,
+					WriteTimeout:   c.WriteTimeout,
+				}, addr)
+			},
+		},
+	}
+	sn.master = newPool(c, "")
+	sn.master.Dial = sn.dialMaster
+	if c.ReadReplica {
+		sn.replica = newPool(c, "")
+		sn.replica.Dial = sn.dialReplica
+	}
+	// NOTE: sentinels may be unreachable at startup, the master is resolved
+	// again on dial.
+	sn.resolve()
+	ctx, cancel := context.WithCancel(context.Background())
+	sn.cancel = cancel
+	go sn.s.Watch(ctx, sn.onEvent)
+	return sn
+}
+
+// Close stops watching the sentinels and closes the pools.
+func (sn *sentinel) Close() error {
+	sn.cancel()
+	if sn.replica != nil {
+		sn.replica.Close()
+	}
+	return sn.master.Close()
+}
+
+// pools returns the master pool and the replica pool if any.
+func (sn *sentinel) pools() []*redis.Pool {
+	if sn.replica != nil {
+		return []*redis.Pool{sn.master, sn.replica}
+	}
+	return []*redis.Pool{sn.master}
+}
+
+// resolve asks the sentinels for the current master and replicas.
+func (sn *sentinel) resolve() (addr string, err error) {
+	if addr, err = sn.s.MasterAddr(); err != nil {
+		return
+	}
+	var replicas []string
+	if sn.replica != nil {
+		replicas, _ = sn.s.ReplicaAddrs()
+	}
+	sn.mu.Lock()
+	sn.addr = addr
+	sn.replicas = replicas
+	sn.mu.Unlock()
+	return
+}
+
+func (sn *sentinel) current() (addr string, replicas []string) {
+	sn.mu.RLock()
+	addr, replicas = sn.addr, sn.replicas
+	sn.mu.RUnlock()
+	return
+}
+
+// onEvent drains the pools when the master switches or a replica changes.
+func (sn *sentinel) onEvent(e redisx.SentinelEvent) {
+	switch e.Channel {
+	case "+switch-master":
+		// <master-name> <old-ip> <old-port> <new-ip> <new-port>
+		if len(e.Fields) < 5 {
+			return
+		}
+		addr := net.JoinHostPort(e.Fields[3], e.Fields[4])
+		old, _ := sn.current()
+		sn.resolve()
+		sn.mu.Lock()
+		sn.addr = addr
+		sn.mu.Unlock()
+		if addr != old {
+			sn.master.Reset()
+			if sn.replica != nil {
+				sn.replica.Reset()
+			}
+		}
+	default:
+		if sn.replica == nil {
+			return
+		}
+		_, old := sn.current()
+		if _, err := sn.resolve(); err == nil {
+			if _, replicas := sn.current(); !sameAddrs(old, replicas) {
+				sn.replica.Reset()
+			}
+		}
+	}
+}
+
+// dialMaster dials the current master and checks its role, the sentinels are
+// asked again if the master is unreachable or has been demoted.
+func (sn *sentinel) dialMaster() (conn redis.Conn, err error) {
+	addr, _ := sn.current()
+	for i := 0; i < 2; i++ {
+		if addr != "" {
+			if conn, err = dial(sn.conf, addr); err == nil {
+				if err = checkRole(conn, "master"); err == nil {
+					return
+				}
+				conn.Close()
+			}
+		}
+		if i == 0 {
+			var e error
+			if addr, e = sn.resolve(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return
+}
+
+// dialReplica dials a random replica, the master if there is none.
+func (sn *sentinel) dialReplica() (redis.Conn, error) {
+	_, replicas := sn.current()
+	for _, i := range rand.Perm(len(replicas)) {
+		if conn, err := dial(sn.conf, replicas[i]); err == nil {
+			return conn, nil
+		}
+	}
+	return sn.dialMaster()
+}
+
+func checkRole(conn redis.Conn, want string) error {
+	values, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return redis.Error("ERR empty ROLE reply")
+	}
+	role, err := redis.String(values[0], nil)
+	if err != nil {
+		return err
+	}
+	if role != want {
+		return redis.Error("ERR server role is " + role)
+	}
+	return nil
+}
+
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, s := range a {
+		seen[s] = true
+	}
+	for _, s := range b {
+		if !seen[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// getReadConn get a connection for read only commands, from a replica when
+// Config.ReadReplica is enabled under sentinel mode.
+func (c *Client) getReadConn(ctx context.Context) (redis.Conn, error) {
+	if c.sentinel != nil && c.sentinel.replica != nil {
+		conn, err := c.sentinel.replica.GetContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.hook(ctx, conn), nil
+	}
+	return c.getConn(ctx)
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(2 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSentinelFailover(t *testing.T) {
+	a, b := newTestServer(t), newTestServer(t)
+	defer a.Close()
+	defer b.Close()
+	b.SetReplicaOf(a.Addr())
+	s := newTestServer(t)
+	defer s.Close()
+	s.Monitor("mymaster", a.Addr(), b.Addr())
+
+	client := New(&Config{Network: "tcp", MasterName: "mymaster", SentinelAddrs: []string{s.Addr()}, MaxIdle: 2})
+	defer client.Close()
+	ctx := context.Background()
+
+	if err := client.SetEx(ctx, "k1", "v1", 0); err != nil {
+		t.Fatalf("SetEx error(%v)", err)
+	}
+	if v := do(t, a, "EXISTS", "k1"); v != int64(1) {
+		t.Fatal("k1 not written to the first master")
+	}
+	waitFor(t, "sentinel subscription", func() bool {
+		n, _ := redis.Values(do(t, s, "PUBSUB", "NUMSUB", "+switch-master"), nil)
+		return len(n) == 2 && n[1] == int64(1)
+	})
+
+	a.SetReplicaOf(b.Addr())
+	b.SetReplicaOf("")
+	s.Monitor("mymaster", b.Addr(), a.Addr())
+	waitFor(t, "master switch", func() bool {
+		client.SetEx(ctx, "k2", "v2", 0)
+		return do(t, b, "EXISTS", "k2") == int64(1)
+	})
+	if v, err := client.GetString(ctx, "k2"); err != nil || v != "v2" {
+		t.Fatalf("GetString(k2) = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+// newTestServer starts an in-process redis server.
+func newTestServer(t *testing.T) *redistest.Server {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// do runs a command on a new connection to s.
+func do(t *testing.T, s *redistest.Server, cmd string, args ...interface{}) interface{} {
+	t.Helper()
+	conn, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reply, err := conn.Do(cmd, args...)
+	if err != nil {
+		t.Fatalf("%s error(%v)", cmd, err)
+	}
+	return reply
+}
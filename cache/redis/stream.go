@@ -0,0 +1,227 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+var errStreamReply = errors.New("redis: unexpected stream reply")
+
+// XMessage is a stream entry. Values is nil for the pending entries of a
+// consumer which were deleted from the stream.
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XPendingEntry is a pending entry of a consumer group.
+type XPendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int64
+}
+
+// XAdd <=> XADD stream MAXLEN ~ maxLen * field value ..., maxLen 0 does not
+// trim the stream.
+func (c *Client) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (id string, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := []interface{}{stream}
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	args = append(args, "*")
+	for k, v := range values {
+		args = append(args, k, v)
+	}
+	return redis.String(conn.Do("XADD", args...))
+}
+
+// XGroupCreate <=> XGROUP CREATE stream group start MKSTREAM, an existing
+// group is not an error.
+func (c *Client) XGroupCreate(ctx context.Context, stream, group, start string) (err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Do("XGROUP", "CREATE", stream, group, start, "MKSTREAM")
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "BUSYGROUP") {
+		err = nil
+	}
+	return
+}
+
+// XReadGroup <=> XREADGROUP GROUP group consumer COUNT count BLOCK block
+// STREAMS stream id. Use id ">" for new entries and "0" for the pending
+// entries of consumer. Block 0 does not block, no entry is not an error.
+func (c *Client) XReadGroup(ctx context.Context, group, consumer string, count int, block time.Duration, stream, id string) (msgs []XMessage, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := []interface{}{"GROUP", group, consumer, "COUNT", count}
+	if block > 0 {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+	args = append(args, "STREAMS", stream, id)
+	var reply interface{}
+	if block > 0 && c.readTimeout > 0 {
+		// NOTE: the read timeout must outlast the server side blocking.
+		reply, err = redis.DoWithTimeout(conn, block+c.readTimeout, "XREADGROUP", args...)
+	} else {
+		reply, err = conn.Do("XREADGROUP", args...)
+	}
+	streams, err := redis.Values(reply, err)
+	if err != nil {
+		if err == redis.ErrNil {
+			err = nil
+		}
+		return
+	}
+	for _, s := range streams {
+		var sv []interface{}
+		if sv, err = redis.Values(s, nil); err != nil {
+			return
+		}
+		if len(sv) != 2 {
+			return nil, errStreamReply
+		}
+		var m []XMessage
+		if m, err = xMessages(sv[1], nil); err != nil {
+			return
+		}
+		msgs = append(msgs, m...)
+	}
+	return
+}
+
+// XAck <=> XACK stream group id ...
+func (c *Client) XAck(ctx context.Context, stream, group string, ids ...string) (n int64, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := []interface{}{stream, group}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return redis.Int64(conn.Do("XACK", args...))
+}
+
+// XClaim <=> XCLAIM stream group consumer minIdle id ..., entries deleted
+// while pending are not returned.
+func (c *Client) XClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, ids ...string) (msgs []XMessage, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := []interface{}{stream, group, consumer, int64(minIdle / time.Millisecond)}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return xMessages(conn.Do("XCLAIM", args...))
+}
+
+// XAutoClaim <=> XAUTOCLAIM stream group consumer minIdle start COUNT count,
+// next is the start of the next call, "0-0" when the scan is complete.
+// Requires redis 6.2+.
+func (c *Client) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int) (next string, msgs []XMessage, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("XAUTOCLAIM", stream, group, consumer, int64(minIdle/time.Millisecond), start, "COUNT", count))
+	if err != nil {
+		return
+	}
+	if len(values) < 2 {
+		return "", nil, errStreamReply
+	}
+	if next, err = redis.String(values[0], nil); err != nil {
+		return
+	}
+	msgs, err = xMessages(values[1], nil)
+	return
+}
+
+// XPending <=> XPENDING stream group IDLE minIdle start end count, the
+// extended form listing entries idle for at least minIdle. Requires redis
+// 6.2+ when minIdle is set.
+func (c *Client) XPending(ctx context.Context, stream, group string, minIdle time.Duration, start, end string, count int) (entries []XPendingEntry, err error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	args := []interface{}{stream, group}
+	if minIdle > 0 {
+		args = append(args, "IDLE", int64(minIdle/time.Millisecond))
+	}
+	args = append(args, start, end, count)
+	values, err := redis.Values(conn.Do("XPENDING", args...))
+	if err != nil {
+		return
+	}
+	for _, v := range values {
+		var (
+			e    XPendingEntry
+			idle int64
+		)
+		fields, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = redis.Scan(fields, &e.ID, &e.Consumer, &idle, &e.Deliveries); err != nil {
+			return nil, err
+		}
+		e.Idle = time.Duration(idle) * time.Millisecond
+		entries = append(entries, e)
+	}
+	return
+}
+
+// xMessages parses a list of [id, [field, value, ...]] entries, the nil
+// entries of deleted ids are skipped.
+func xMessages(reply interface{}, err error) ([]XMessage, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []XMessage
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		entry, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, errStreamReply
+		}
+		var msg XMessage
+		if msg.ID, err = redis.String(entry[0], nil); err != nil {
+			return nil, err
+		}
+		if entry[1] != nil {
+			if msg.Values, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redisx"
+	"github.com/Darker-D/ddbase/log"
+	"go.uber.org/zap"
+)
+
+// The fields added to a dead letter entry.
+const (
+	_deadStream = "_stream" // the original stream
+	_deadID     = "_id"     // the original entry id
+)
+
+// StreamConsumerConfig is the consumer group runner config.
+type StreamConsumerConfig struct {
+	Stream        string        // stream 名称
+	Group         string        // 消费组名称, 不存在时从头创建
+	Consumer      string        // 消费者名称, 默认 hostname-pid
+	Count         int           // 每次读取条数, 默认 10
+	Block         time.Duration // 读取阻塞时间, 也是退出的最长等待时间, 默认 2s
+	MinIdle       time.Duration // 未 ack 超过该时间的消息被认领重试, 默认 1m
+	ClaimInterval time.Duration // 认领检查间隔, 默认 MinIdle/2
+	MaxRetries    int           // 最大重试次数, 超过后转入死信 stream, 默认 3, 负数不限制
+	DeadLetter    string        // 死信 stream, 默认 Stream + ":dead", 死信带有原 stream 和 id 字段 _stream, _id
+}
+
+func (conf *StreamConsumerConfig) fix() *StreamConsumerConfig {
+	c := *conf
+	if c.Consumer == "" {
+		host, _ := os.Hostname()
+		c.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if c.Count <= 0 {
+		c.Count = 10
+	}
+	if c.Block <= 0 {
+		c.Block = 2 * time.Second
+	}
+	if c.MinIdle <= 0 {
+		c.MinIdle = time.Minute
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = c.MinIdle / 2
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.DeadLetter == "" {
+		c.DeadLetter = c.Stream + ":dead"
+	}
+	return &c
+}
+
+// StreamConsumer consumes a stream as a member of a consumer group. Entries
+// are acked when the handler succeeds, failed entries are retried by any
+// member of the group once idle for MinIdle, and moved to the DeadLetter
+// stream after MaxRetries.
+type StreamConsumer struct {
+	client  *Client
+	conf    *StreamConsumerConfig
+	handler func(ctx context.Context, msg XMessage) error
+}
+
+// NewStreamConsumer new a consumer group runner calling handler for every
+// entry of the stream.
+func NewStreamConsumer(client *Client, conf *StreamConsumerConfig, handler func(ctx context.Context, msg XMessage) error) *StreamConsumer {
+	return &StreamConsumer{client: client, conf: conf.fix(), handler: handler}
+}
+
+// Run consumes the stream until ctx is done. The entries delivered to this
+// consumer before a restart are handled first. On shutdown the entry being
+// handled completes, the rest of the batch stays pending and is recovered on
+// the next Run. Redis errors are retried with backoff.
+func (s *StreamConsumer) Run(ctx context.Context) error {
+	conf := s.conf
+	if err := s.client.XGroupCreate(ctx, conf.Stream, conf.Group, "0"); err != nil {
+		return err
+	}
+	if err := s.recover(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	var claimed time.Time
+	for retries := 0; ctx.Err() == nil; {
+		if time.Since(claimed) >= conf.ClaimInterval {
+			if err := s.claim(ctx); err != nil {
+				s.logError(ctx, "claim", err)
+			}
+			claimed = time.Now()
+		}
+		msgs, err := s.client.XReadGroup(ctx, conf.Group, conf.Consumer, conf.Count, conf.Block, conf.Stream, ">")
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			s.logError(ctx, "read", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(redisx.DefaultBackoff.Backoff(retries)):
+			}
+			retries++
+			continue
+		}
+		retries = 0
+		s.handleAll(ctx, msgs)
+	}
+	return nil
+}
+
+// recover handles the entries pending on this consumer.
+func (s *StreamConsumer) recover(ctx context.Context) error {
+	for id := "0"; ctx.Err() == nil; {
+		msgs, err := s.client.XReadGroup(ctx, s.conf.Group, s.conf.Consumer, s.conf.Count, 0, s.conf.Stream, id)
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+		s.handleAll(ctx, msgs)
+		id = msgs[len(msgs)-1].ID
+	}
+	return nil
+}
+
+// claim takes over the entries idle for MinIdle in the group, entries
+// delivered more than MaxRetries times are moved to the dead letter stream.
+func (s *StreamConsumer) claim(ctx context.Context) error {
+	conf := s.conf
+	for start := "-"; ctx.Err() == nil; {
+		entries, err := s.client.XPending(ctx, conf.Stream, conf.Group, conf.MinIdle, start, "+", conf.Count)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		var retry, dead []string
+		for _, e := range entries {
+			if conf.MaxRetries > 0 && e.Deliveries > int64(conf.MaxRetries) {
+				dead = append(dead, e.ID)
+			} else {
+				retry = append(retry, e.ID)
+			}
+		}
+		if len(dead) > 0 {
+			if err = s.deadLetter(ctx, dead); err != nil {
+				return err
+			}
+		}
+		if len(retry) > 0 {
+			msgs, err := s.client.XClaim(ctx, conf.Stream, conf.Group, conf.Consumer, conf.MinIdle, retry...)
+			if err != nil {
+				return err
+			}
+			s.handleAll(ctx, msgs)
+		}
+		if len(entries) < conf.Count {
+			return nil
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+	return nil
+}
+
+func (s *StreamConsumer) deadLetter(ctx context.Context, ids []string) error {
+	conf := s.conf
+	msgs, err := s.client.XClaim(ctx, conf.Stream, conf.Group, conf.Consumer, conf.MinIdle, ids...)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		// NOTE: an entry deleted while pending has no values, it is acked
+		// only, else XADD fails on it at every claim.
+		if m.Values != nil {
+			values := make(map[string]interface{}, len(m.Values)+2)
+			for k, v := range m.Values {
+				values[k] = v
+			}
+			values[_deadStream], values[_deadID] = conf.Stream, m.ID
+			if _, err = s.client.XAdd(ctx, conf.DeadLetter, 0, values); err != nil {
+				return err
+			}
+		}
+		if _, err = s.client.XAck(ctx, conf.Stream, conf.Group, m.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StreamConsumer) handleAll(ctx context.Context, msgs []XMessage) {
+	for _, m := range msgs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.handle(ctx, m); err != nil {
+			s.logError(ctx, "handle "+m.ID, err)
+		}
+	}
+}
+
+// handle calls the handler and acks the entry on success, entries deleted
+// while pending are acked directly.
+func (s *StreamConsumer) handle(ctx context.Context, m XMessage) (err error) {
+	if m.Values != nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("redis: stream handler panic: %v", r)
+				}
+			}()
+			err = s.handler(ctx, m)
+		}()
+		if err != nil {
+			return
+		}
+	}
+	_, err = s.client.XAck(ctx, s.conf.Stream, s.conf.Group, m.ID)
+	return
+}
+
+func (s *StreamConsumer) logError(ctx context.Context, action string, err error) {
+	if log.Logger().Logger == nil {
+		return
+	}
+	log.Logger().WithCTX(ctx).Error("redis stream",
+		zap.String("stream", s.conf.Stream),
+		zap.String("group", s.conf.Group),
+		zap.String("action", action),
+		zap.Error(err))
+}
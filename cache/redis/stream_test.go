@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+// xpending returns the number of entries pending in group.
+func xpending(t *testing.T, s *redistest.Server, stream, group string) int64 {
+	reply := do(t, s, "XPENDING", stream, group).([]interface{})
+	return reply[0].(int64)
+}
+
+// xfields returns the fields of the first entry of stream.
+func xfields(t *testing.T, s *redistest.Server, stream string) map[string]string {
+	reply := do(t, s, "XRANGE", stream, "-", "+", "COUNT", 1).([]interface{})
+	fields, err := redis.StringMap(reply[0].([]interface{})[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestStreamDeadLetter(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	ctx := context.Background()
+	consumer := NewStreamConsumer(client, &StreamConsumerConfig{
+		Stream:   "jobs",
+		Group:    "workers",
+		Consumer: "c1",
+		MinIdle:  time.Millisecond,
+	}, nil)
+
+	if err := client.XGroupCreate(ctx, "jobs", "workers", "0"); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, job := range []string{"deleted", "dead"} {
+		id, err := client.XAdd(ctx, "jobs", 0, map[string]interface{}{"job": job})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if msgs, err := client.XReadGroup(ctx, "workers", "c1", 10, 0, "jobs", ">"); err != nil || len(msgs) != 2 {
+		t.Fatalf("XReadGroup = %v, %v", msgs, err)
+	}
+	conn := client.pool.Get()
+	_, err := conn.Do("XDEL", "jobs", ids[0])
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// the deleted entry is acked without a dead letter
+	if err := consumer.deadLetter(ctx, ids); err != nil {
+		t.Fatalf("deadLetter error(%v)", err)
+	}
+	if n := xpending(t, s, "jobs", "workers"); n != 0 {
+		t.Fatalf("got %d pending entries, want 0", n)
+	}
+	if n := do(t, s, "XLEN", "jobs:dead"); n != int64(1) {
+		t.Fatalf("got %d dead letters, want 1", n)
+	}
+	want := map[string]string{"job": "dead", "_stream": "jobs", "_id": ids[1]}
+	if got := xfields(t, s, "jobs:dead"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got dead letter %v, want %v", got, want)
+	}
+}
+
+func TestStreamConsumer(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	client := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := &StreamConsumerConfig{
+		Stream:        "jobs",
+		Group:         "workers",
+		Consumer:      "c1",
+		Block:         20 * time.Millisecond,
+		MinIdle:       30 * time.Millisecond,
+		ClaimInterval: 10 * time.Millisecond,
+		MaxRetries:    2,
+	}
+	// entries delivered to c1 before a restart are recovered.
+	if err := client.XGroupCreate(ctx, "jobs", "workers", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.XAdd(ctx, "jobs", 0, map[string]interface{}{"job": "recovered"}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := client.XReadGroup(ctx, "workers", "c1", 10, 0, "jobs", ">"); err != nil || len(msgs) != 1 {
+		t.Fatalf("XReadGroup = %v, %v", msgs, err)
+	}
+	for _, job := range []string{"a", "bad", "b"} {
+		if _, err := client.XAdd(ctx, "jobs", 1000, map[string]interface{}{"job": job}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		handled  []string
+		attempts int
+	)
+	consumer := NewStreamConsumer(client, conf, func(ctx context.Context, msg XMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.Values["job"] == "bad" {
+			attempts++
+			return errors.New("bad job")
+		}
+		handled = append(handled, msg.Values["job"])
+		return nil
+	})
+	done := make(chan error)
+	go func() { done <- consumer.Run(ctx) }()
+
+	waitFor(t, "dead letter", func() bool {
+		return do(t, s, "XLEN", "jobs:dead") == int64(1) && xpending(t, s, "jobs", "workers") == 0
+	})
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run error(%v)", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(handled, ",") != "recovered,a,b" {
+		t.Errorf("handled %v", handled)
+	}
+	if attempts != 3 {
+		t.Errorf("bad job attempted %d times, want 3", attempts)
+	}
+}
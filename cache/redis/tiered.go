@@ -0,0 +1,201 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redisx"
+	"github.com/Darker-D/ddbase/net/stat"
+)
+
+var _statsCache = stat.Cache
+
+// TieredConfig is the two-level cache config.
+type TieredConfig struct {
+	Name    string        // 指标名称, 默认 "redis"
+	Size    int           // 进程内缓存最大个数, 默认 10000
+	TTL     time.Duration // 进程内缓存过期时间, 默认 1m
+	Policy  string        // 淘汰策略, lru 或 lfu, 默认 lru
+	Channel string        // 失效通知的 pub/sub 频道, 为空不通知其它实例
+}
+
+func (conf *TieredConfig) fix() *TieredConfig {
+	c := TieredConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	if c.Name == "" {
+		c.Name = "redis"
+	}
+	if c.Size <= 0 {
+		c.Size = 10000
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Minute
+	}
+	return &c
+}
+
+// Tiered is a two-level cache with an in-process L1 in front of redis. The
+// L1 entries of other instances are invalidated through redis pub/sub when
+// Channel is set, otherwise they may be stale for up to TTL.
+type Tiered struct {
+	client *Client
+	conf   *TieredConfig
+	id     string             // instance id, to ignore our own invalidations
+	sub    *redisx.Subscriber // nil if Channel is empty
+
+	mu  sync.Mutex
+	l1  l1
+	seq uint64 // incremented on every invalidation
+}
+
+// NewTiered new a two-level cache on client.
+func NewTiered(client *Client, conf *TieredConfig) *Tiered {
+	conf = conf.fix()
+	b := make([]byte, 8)
+	rand.Read(b)
+	t := &Tiered{
+		client: client,
+		conf:   conf,
+		id:     hex.EncodeToString(b),
+		l1:     newL1(conf.Policy, conf.Size),
+	}
+	if conf.Channel != "" {
+		t.sub = &redisx.Subscriber{Dial: client.dialConn, OnReconnect: t.clear}
+		t.sub.Subscribe(conf.Channel, t.onInvalidate)
+	}
+	return t
+}
+
+// Close stops listening to invalidations.
+func (t *Tiered) Close() error {
+	if t.sub != nil {
+		return t.sub.Close()
+	}
+	return nil
+}
+
+// Load loads the value of key into val like Client.Load, from L1 first.
+func (t *Tiered) Load(ctx context.Context, key string, val interface{}) (found bool, err error) {
+	now := time.Now()
+	t.mu.Lock()
+	b, ok := t.l1.get(key, now)
+	seq := t.seq
+	t.mu.Unlock()
+	if ok {
+		_statsCache.Incr(t.conf.Name+":l1", "hit")
+		return true, t.client.decode(b, val)
+	}
+	_statsCache.Incr(t.conf.Name+":l1", "miss")
+	conn, err := t.client.getReadConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if b, err = redis.Bytes(conn.Do("GET", key)); err != nil {
+		if err == redis.ErrNil {
+			_statsCache.Incr(t.conf.Name+":l2", "miss")
+			err = nil
+		}
+		return
+	}
+	_statsCache.Incr(t.conf.Name+":l2", "hit")
+	t.mu.Lock()
+	// NOTE: do not cache a value read before an invalidation.
+	if t.seq == seq {
+		t.l1.set(key, b, now.Add(t.conf.TTL))
+	}
+	t.mu.Unlock()
+	return true, t.client.decode(b, val)
+}
+
+// Store stores val like Client.Store and invalidates the other instances.
+func (t *Tiered) Store(ctx context.Context, key string, val interface{}) error {
+	return t.SetEx(ctx, key, val, 0)
+}
+
+// SetEx stores val expiring in maxAge seconds, 0 never expires.
+func (t *Tiered) SetEx(ctx context.Context, key string, val interface{}, maxAge int) (err error) {
+	b, err := t.client.encodeBytes(val)
+	if err != nil {
+		return
+	}
+	conn, err := t.client.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if maxAge == 0 {
+		_, err = conn.Do("SET", key, b)
+	} else {
+		_, err = conn.Do("SET", key, b, "EX", maxAge)
+	}
+	t.invalidate(key)
+	if err != nil {
+		return
+	}
+	ttl := t.conf.TTL
+	if maxAge > 0 && time.Duration(maxAge)*time.Second < ttl {
+		ttl = time.Duration(maxAge) * time.Second
+	}
+	t.mu.Lock()
+	t.l1.set(key, b, time.Now().Add(ttl))
+	t.mu.Unlock()
+	return t.publish(conn, key)
+}
+
+// Delete deletes key and invalidates the other instances.
+func (t *Tiered) Delete(ctx context.Context, key string) (err error) {
+	conn, err := t.client.getConn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Do("DEL", key)
+	t.invalidate(key)
+	if err != nil {
+		return
+	}
+	return t.publish(conn, key)
+}
+
+func (t *Tiered) invalidate(key string) {
+	t.mu.Lock()
+	t.l1.del(key)
+	t.seq++
+	t.mu.Unlock()
+}
+
+// publish <=> PUBLISH channel "<id> <key>"
+func (t *Tiered) publish(conn redis.Conn, key string) (err error) {
+	if t.conf.Channel == "" {
+		return
+	}
+	_, err = conn.Do("PUBLISH", t.conf.Channel, t.id+" "+key)
+	return
+}
+
+// onInvalidate invalidates the key of a message published by another
+// instance.
+func (t *Tiered) onInvalidate(m redis.Message) {
+	i := strings.IndexByte(string(m.Data), ' ')
+	if i < 0 || string(m.Data[:i]) == t.id {
+		return
+	}
+	t.invalidate(string(m.Data[i+1:]))
+}
+
+// clear clears L1 after a disconnection since invalidations may have been
+// missed.
+func (t *Tiered) clear() {
+	t.mu.Lock()
+	t.l1.clear()
+	t.seq++
+	t.mu.Unlock()
+}
@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+func TestTiered(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+	ctx := context.Background()
+	conf := &TieredConfig{Name: "test", TTL: time.Minute, Channel: "invalidate"}
+	c1 := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer c1.Close()
+	c2 := New(&Config{Network: "tcp", Address: s.Addr(), MaxIdle: 2})
+	defer c2.Close()
+	t1, t2 := NewTiered(c1, conf), NewTiered(c2, conf)
+	defer t1.Close()
+	defer t2.Close()
+	waitFor(t, "subscriptions", func() bool {
+		n, _ := redis.Values(do(t, s, "PUBSUB", "NUMSUB", "invalidate"), nil)
+		return len(n) == 2 && n[1] == int64(2)
+	})
+
+	if err := t1.Store(ctx, "user", &asideUser{ID: 1, Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first invalidation", func() bool {
+		t2.mu.Lock()
+		defer t2.mu.Unlock()
+		return t2.seq > 0
+	})
+	var u asideUser
+	if ok, err := t2.Load(ctx, "user", &u); !ok || err != nil || u.Name != "foo" {
+		t.Fatalf("Load = %+v, %v, %v", u, ok, err)
+	}
+	// served from L1 while redis is changed behind its back.
+	do(t, s, "DEL", "user")
+	if ok, err := t2.Load(ctx, "user", &u); !ok || err != nil || u.Name != "foo" {
+		t.Fatalf("L1 Load = %+v, %v, %v", u, ok, err)
+	}
+
+	if err := t1.Store(ctx, "user", &asideUser{ID: 1, Name: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "invalidation", func() bool {
+		ok, err := t2.Load(ctx, "user", &u)
+		return ok && err == nil && u.Name == "bar"
+	})
+
+	if err := t1.Delete(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "deletion", func() bool {
+		ok, err := t2.Load(ctx, "user", &u)
+		return !ok && err == nil
+	})
+}
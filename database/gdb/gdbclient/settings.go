@@ -2,6 +2,7 @@ package gdbclient
 
 import (
 	"github.com/Darker-D/ddbase/database/gdb/gdbclient/internal/pool"
+	"github.com/Darker-D/ddbase/net/naming"
 	"github.com/Darker-D/ddbase/net/netutil/breaker"
 	"strconv"
 	"time"
@@ -55,6 +56,10 @@ type Settings struct {
 	HandshakeTimeout time.Duration
 
 	Breaker *breaker.Config // breaker
+
+	// instances of GDB to connect, host:port picked by weight for every new
+	// connection, Host and Port are ignored if set
+	Naming naming.Watcher
 }
 
 func (s *Settings) init() {
@@ -116,7 +121,7 @@ func (s *Settings) getOpts() *pool.Options {
 		WriteBufferSize:  s.WriteBufferSize,
 		HandshakeTimeout: s.HandshakeTimeout,
 
-		Dialer: pool.NewConnWebSocket,
+		Dialer: s.dialer(),
 	}
 }
 
@@ -140,6 +145,22 @@ func (s *Settings) getSessionOpts() *pool.Options {
 		WriteBufferSize:  s.WriteBufferSize,
 		HandshakeTimeout: s.HandshakeTimeout,
 
-		Dialer: pool.NewConnWebSocket,
+		Dialer: s.dialer(),
+	}
+}
+
+// dialer dials an instance of s.Naming if set.
+func (s *Settings) dialer() func(*pool.Options) (*pool.ConnWebSocket, error) {
+	if s.Naming == nil {
+		return pool.NewConnWebSocket
+	}
+	return func(opt *pool.Options) (*pool.ConnWebSocket, error) {
+		in, err := naming.Pick(s.Naming)
+		if err != nil {
+			return nil, err
+		}
+		o := *opt
+		o.GdbUrl = "ws://" + in.Addr + "/gremlin"
+		return pool.NewConnWebSocket(&o)
 	}
 }
@@ -0,0 +1,430 @@
+package http
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	xhttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Darker-D/ddbase/log"
+	"github.com/Darker-D/ddbase/net/naming"
+	"github.com/Darker-D/ddbase/net/netutil/breaker"
+	"go.uber.org/zap"
+)
+
+// Balancer policies.
+const (
+	RoundRobin   = "round_robin"
+	Weighted     = "weighted"
+	LeastPending = "least_pending"
+	P2CEWMA      = "p2c_ewma"
+)
+
+const (
+	_ewmaTau     = 600 * time.Millisecond // decay time of the latency ewma
+	_ewmaPenalty = time.Second            // latency counted for a failed request
+)
+
+var errNoEndpoints = errors.New("http: balancer has no endpoints")
+
+// Endpoint is a backend instance of a Balancer.
+type Endpoint struct {
+	Addr   string // 地址, 如 http://10.0.0.1:8000, 不带 scheme 时使用 http
+	Weight int    // weighted 策略的权重, 默认 1
+}
+
+// Resolver provides the endpoints of a Balancer.
+type Resolver interface {
+	// Endpoints returns the current endpoints.
+	Endpoints() ([]Endpoint, error)
+	// Watch returns a channel which receives when the endpoints change.
+	Watch() <-chan struct{}
+}
+
+// NamingResolver returns a Resolver of the instances of w.
+func NamingResolver(w naming.Watcher) Resolver {
+	return namingResolver{w}
+}
+
+type namingResolver struct {
+	naming.Watcher
+}
+
+func (r namingResolver) Endpoints() ([]Endpoint, error) {
+	ins, err := r.Instances()
+	if err != nil {
+		return nil, err
+	}
+	eps := make([]Endpoint, len(ins))
+	for i, in := range ins {
+		eps[i] = Endpoint{Addr: in.Addr, Weight: in.Weight}
+	}
+	return eps, nil
+}
+
+// BalancerConfig is the load balancing of the requests without host, such as
+// "/user/info", over a pool of endpoints.
+type BalancerConfig struct {
+	Policy         string          // round_robin, weighted, least_pending 或 p2c_ewma, 默认 round_robin
+	Endpoints      []Endpoint      // 静态后端地址, 使用 Resolver 时忽略
+	Breaker        *breaker.Config // 按后端熔断, 熔断的后端被摘除直到健康检查通过
+	HealthPath     string          // 健康检查路径, 为空时检查 TCP 连接
+	HealthInterval time.Duration   // 健康检查间隔, 默认 5s, 负数关闭, 此时不摘除后端
+	HealthTimeout  time.Duration   // 健康检查超时, 默认 1s
+}
+
+func (conf *BalancerConfig) fix() {
+	if conf.Policy == "" {
+		conf.Policy = RoundRobin
+	}
+	if conf.HealthInterval == 0 {
+		conf.HealthInterval = 5 * time.Second
+	}
+	if conf.HealthTimeout <= 0 {
+		conf.HealthTimeout = time.Second
+	}
+}
+
+// endpoint is an Endpoint with its balancing state.
+type endpoint struct {
+	pending int64 // requests in flight
+	ejected int32 // 1 if ejected by the breaker
+
+	Endpoint
+	scheme string
+	host   string
+
+	current int // smooth weighted round robin, under Balancer.wmu
+
+	mu    sync.Mutex
+	ewma  float64 // latency ewma in nanoseconds
+	stamp int64   // last ewma update
+}
+
+func newEndpoint(e Endpoint) (*endpoint, error) {
+	addr := e.Addr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if e.Weight <= 0 {
+		e.Weight = 1
+	}
+	return &endpoint{Endpoint: e, scheme: u.Scheme, host: u.Host}, nil
+}
+
+// load is the p2c_ewma cost of the endpoint.
+func (ep *endpoint) load() float64 {
+	ep.mu.Lock()
+	ewma := ep.ewma
+	ep.mu.Unlock()
+	return ewma * float64(atomic.LoadInt64(&ep.pending)+1)
+}
+
+func (ep *endpoint) observe(latency time.Duration) {
+	now := time.Now().UnixNano()
+	ep.mu.Lock()
+	td := now - ep.stamp
+	if td < 0 {
+		td = 0
+	}
+	w := math.Exp(-float64(td) / float64(_ewmaTau))
+	ep.ewma = ep.ewma*w + float64(latency)*(1-w)
+	ep.stamp = now
+	ep.mu.Unlock()
+}
+
+// Balancer picks an endpoint for every request. The endpoints rejected by
+// their breaker are ejected and come back once their health check passes.
+type Balancer struct {
+	next uint64 // round robin
+	wmu  sync.Mutex
+
+	conf     *BalancerConfig
+	resolver Resolver
+	breakers *breaker.Group
+	checker  *xhttp.Client
+
+	mu        sync.RWMutex
+	endpoints []*endpoint
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewBalancer new a balancer over the endpoints of r, or the static
+// endpoints of c if r is nil, which must all be valid.
+func NewBalancer(c *BalancerConfig, r Resolver) (*Balancer, error) {
+	c.fix()
+	b := &Balancer{
+		conf:     c,
+		resolver: r,
+		breakers: breaker.NewGroup(c.Breaker),
+		checker:  &xhttp.Client{Timeout: c.HealthTimeout},
+		done:     make(chan struct{}),
+	}
+	if r == nil {
+		if err := b.update(c.Endpoints); err != nil {
+			return nil, err
+		}
+	} else {
+		// NOTE: the resolver may be empty at startup, the endpoints are
+		// updated by watch.
+		b.resolve()
+		go b.watch(r.Watch())
+	}
+	if c.HealthInterval > 0 {
+		go b.healthLoop()
+	}
+	return b, nil
+}
+
+// Close stops the resolver watch and the health checks.
+func (b *Balancer) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
+
+// Endpoints returns the endpoints which are not ejected.
+func (b *Balancer) Endpoints() (eps []Endpoint) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ep := range b.endpoints {
+		if atomic.LoadInt32(&ep.ejected) == 0 {
+			eps = append(eps, ep.Endpoint)
+		}
+	}
+	return
+}
+
+// update replaces the endpoints, keeping the state of the known ones. The
+// endpoints with an invalid address are skipped, the first error is returned.
+func (b *Balancer) update(eps []Endpoint) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	known := make(map[string]*endpoint, len(b.endpoints))
+	for _, ep := range b.endpoints {
+		known[ep.Addr] = ep
+	}
+	endpoints := make([]*endpoint, 0, len(eps))
+	for _, e := range eps {
+		if ep, ok := known[e.Addr]; ok {
+			if e.Weight > 0 {
+				b.wmu.Lock()
+				ep.Weight = e.Weight
+				b.wmu.Unlock()
+			}
+			endpoints = append(endpoints, ep)
+			continue
+		}
+		ep, perr := newEndpoint(e)
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		endpoints = append(endpoints, ep)
+	}
+	b.endpoints = endpoints
+	return
+}
+
+// resolve updates the endpoints from the resolver.
+func (b *Balancer) resolve() {
+	eps, err := b.resolver.Endpoints()
+	if err != nil {
+		return
+	}
+	if err = b.update(eps); err != nil && log.Logger().Logger != nil {
+		log.Logger().Warn("http balancer invalid endpoint", zap.Error(err))
+	}
+}
+
+func (b *Balancer) watch(ch <-chan struct{}) {
+	for {
+		select {
+		case <-b.done:
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		}
+		b.resolve()
+	}
+}
+
+// pick picks an endpoint which is not ejected, any endpoint if all are.
+func (b *Balancer) pick() (*endpoint, error) {
+	b.mu.RLock()
+	all := b.endpoints
+	b.mu.RUnlock()
+	if len(all) == 0 {
+		return nil, errNoEndpoints
+	}
+	eps := make([]*endpoint, 0, len(all))
+	for _, ep := range all {
+		if atomic.LoadInt32(&ep.ejected) == 0 {
+			eps = append(eps, ep)
+		}
+	}
+	for len(eps) > 0 {
+		ep := b.choose(eps)
+		if b.breakers.Get(ep.Addr).Allow() == nil {
+			return ep, nil
+		}
+		if b.conf.HealthInterval > 0 {
+			atomic.StoreInt32(&ep.ejected, 1)
+		}
+		for i := range eps {
+			if eps[i] == ep {
+				eps = append(eps[:i:i], eps[i+1:]...)
+				break
+			}
+		}
+	}
+	// NOTE: all the endpoints are ejected, better try one than fail.
+	return b.choose(all), nil
+}
+
+func (b *Balancer) choose(eps []*endpoint) *endpoint {
+	if len(eps) == 1 {
+		return eps[0]
+	}
+	switch b.conf.Policy {
+	case Weighted:
+		return b.chooseWeighted(eps)
+	case LeastPending:
+		return chooseLeastPending(eps)
+	case P2CEWMA:
+		return chooseP2C(eps)
+	}
+	return eps[atomic.AddUint64(&b.next, 1)%uint64(len(eps))]
+}
+
+// chooseWeighted is the smooth weighted round robin of nginx.
+func (b *Balancer) chooseWeighted(eps []*endpoint) (best *endpoint) {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	total := 0
+	for _, ep := range eps {
+		ep.current += ep.Weight
+		total += ep.Weight
+		if best == nil || ep.current > best.current {
+			best = ep
+		}
+	}
+	best.current -= total
+	return
+}
+
+func chooseLeastPending(eps []*endpoint) *endpoint {
+	// NOTE: start at random to spread the ties.
+	offset := rand.Intn(len(eps))
+	best := eps[offset]
+	for i := 1; i < len(eps); i++ {
+		ep := eps[(offset+i)%len(eps)]
+		if atomic.LoadInt64(&ep.pending) < atomic.LoadInt64(&best.pending) {
+			best = ep
+		}
+	}
+	return best
+}
+
+// chooseP2C picks the cheaper of two random endpoints by latency ewma and
+// pending requests.
+func chooseP2C(eps []*endpoint) *endpoint {
+	i := rand.Intn(len(eps))
+	j := rand.Intn(len(eps) - 1)
+	if j >= i {
+		j++
+	}
+	if eps[j].load() < eps[i].load() {
+		return eps[j]
+	}
+	return eps[i]
+}
+
+// do sends r to ep and records the result.
+func (b *Balancer) do(client *xhttp.Client, ep *endpoint, r *xhttp.Request) (*xhttp.Response, error) {
+	u := *r.URL
+	u.Scheme, u.Host = ep.scheme, ep.host
+	r.URL, r.Host = &u, ep.host
+	atomic.AddInt64(&ep.pending, 1)
+	start := time.Now()
+	resp, err := client.Do(r)
+	atomic.AddInt64(&ep.pending, -1)
+	latency := time.Since(start)
+	brk := b.breakers.Get(ep.Addr)
+	if err != nil || resp.StatusCode >= xhttp.StatusInternalServerError {
+		brk.MarkFailed()
+		if latency < _ewmaPenalty {
+			latency = _ewmaPenalty
+		}
+	} else {
+		brk.MarkSuccess()
+	}
+	ep.observe(latency)
+	return resp, err
+}
+
+func (b *Balancer) healthLoop() {
+	ticker := time.NewTicker(b.conf.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+		b.mu.RLock()
+		eps := b.endpoints
+		b.mu.RUnlock()
+		for _, ep := range eps {
+			if atomic.LoadInt32(&ep.ejected) == 1 && b.check(ep) == nil {
+				// NOTE: the breaker still counts the failures which ejected
+				// the endpoint, it would be ejected again at once.
+				b.breakers.Reset(ep.Addr)
+				atomic.StoreInt32(&ep.ejected, 0)
+			}
+		}
+	}
+}
+
+// check checks the health of ep by GET HealthPath, or by connecting to it.
+func (b *Balancer) check(ep *endpoint) error {
+	if b.conf.HealthPath == "" {
+		host := ep.host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			port := "80"
+			if ep.scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(host, port)
+		}
+		conn, err := net.DialTimeout("tcp", host, b.conf.HealthTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	resp, err := b.checker.Get(ep.scheme + "://" + ep.host + b.conf.HealthPath)
+	if err != nil {
+		return err
+	}
+	discard(resp)
+	if resp.StatusCode >= xhttp.StatusBadRequest {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package http
+
+import (
+	"context"
+	xhttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/net/naming"
+	"github.com/Darker-D/ddbase/net/netutil/breaker"
+)
+
+func newEndpoints(t *testing.T, addrs ...string) []*endpoint {
+	eps := make([]*endpoint, len(addrs))
+	for i, addr := range addrs {
+		ep, err := newEndpoint(Endpoint{Addr: addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eps[i] = ep
+	}
+	return eps
+}
+
+func TestBalancerPolicies(t *testing.T) {
+	eps := newEndpoints(t, "a:1", "b:1", "c:1")
+	eps[0].Weight, eps[1].Weight, eps[2].Weight = 5, 1, 1
+
+	b := &Balancer{conf: &BalancerConfig{Policy: Weighted}}
+	counts := make(map[string]int)
+	for i := 0; i < 7; i++ {
+		counts[b.choose(eps).Addr]++
+	}
+	if counts["a:1"] != 5 || counts["b:1"] != 1 || counts["c:1"] != 1 {
+		t.Fatalf("weighted picks %v, want 5:1:1", counts)
+	}
+
+	b.conf.Policy = RoundRobin
+	counts = make(map[string]int)
+	for i := 0; i < 6; i++ {
+		counts[b.choose(eps).Addr]++
+	}
+	if counts["a:1"] != 2 || counts["b:1"] != 2 || counts["c:1"] != 2 {
+		t.Fatalf("round robin picks %v, want 2:2:2", counts)
+	}
+
+	b.conf.Policy = LeastPending
+	eps[0].pending, eps[1].pending, eps[2].pending = 3, 1, 2
+	for i := 0; i < 10; i++ {
+		if ep := b.choose(eps); ep != eps[1] {
+			t.Fatalf("least pending picks %s", ep.Addr)
+		}
+	}
+
+	b.conf.Policy = P2CEWMA
+	eps[0].ewma, eps[1].ewma, eps[2].ewma = float64(time.Second), float64(time.Millisecond), float64(time.Second)
+	eps[0].pending, eps[1].pending, eps[2].pending = 0, 0, 0
+	counts = make(map[string]int)
+	for i := 0; i < 300; i++ {
+		counts[b.choose(eps).Addr]++
+	}
+	// the fast endpoint wins every pair it is in
+	if counts["b:1"] < 150 {
+		t.Fatalf("p2c picks %v, want mostly b:1", counts)
+	}
+}
+
+func TestBalancerEjection(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		healthy = true
+		calls   = make(map[string]int)
+	)
+	handler := func(name string) xhttp.HandlerFunc {
+		return func(w xhttp.ResponseWriter, r *xhttp.Request) {
+			mu.Lock()
+			ok := healthy || name == "good"
+			calls[name+r.URL.Path]++
+			mu.Unlock()
+			if !ok {
+				w.WriteHeader(xhttp.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{}`))
+		}
+	}
+	good := httptest.NewServer(handler("good"))
+	defer good.Close()
+	bad := httptest.NewServer(handler("bad"))
+	defer bad.Close()
+
+	conf := &BalancerConfig{
+		Endpoints:      []Endpoint{{Addr: good.URL}, {Addr: bad.URL}},
+		Breaker:        &breaker.Config{Window: time.Second, Bucket: 10, Request: 5, K: 1.1},
+		HealthPath:     "/health",
+		HealthInterval: 20 * time.Millisecond,
+	}
+	client := NewClient(&ClientConfig{Timeout: time.Second, Balancer: conf})
+	defer client.Close()
+	ctx := context.Background()
+
+	mu.Lock()
+	healthy = false
+	mu.Unlock()
+	for i := 0; i < 100; i++ {
+		client.Get(ctx, "/users", url.Values{}, nil)
+	}
+	if eps := client.balancer.Endpoints(); len(eps) != 1 || eps[0].Addr != good.URL {
+		t.Fatalf("got endpoints %v, want the bad one ejected", eps)
+	}
+	mu.Lock()
+	before := calls["bad/users"]
+	mu.Unlock()
+	for i := 0; i < 10; i++ {
+		if err := client.Get(ctx, "/users", url.Values{}, nil); err != nil {
+			t.Fatalf("Get error(%v)", err)
+		}
+	}
+	mu.Lock()
+	if n := calls["bad/users"] - before; n != 0 {
+		t.Fatalf("got %d requests to the ejected endpoint", n)
+	}
+	mu.Unlock()
+
+	// the health check of the ejected endpoint passes
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for len(client.balancer.Endpoints()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the endpoint is not back")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	if calls["bad/health"] == 0 {
+		t.Fatal("want health checks")
+	}
+	before = calls["bad/users"]
+	mu.Unlock()
+
+	// the breaker is reset, the failures which ejected the endpoint do not
+	// eject it again
+	for i := 0; i < 10; i++ {
+		if err := client.Get(ctx, "/users", url.Values{}, nil); err != nil {
+			t.Fatalf("Get error(%v)", err)
+		}
+	}
+	mu.Lock()
+	if n := calls["bad/users"] - before; n == 0 {
+		t.Fatal("got no request to the endpoint back")
+	}
+	mu.Unlock()
+	if eps := client.balancer.Endpoints(); len(eps) != 2 {
+		t.Fatalf("got endpoints %v, want both", eps)
+	}
+}
+
+func TestClientBalancerClose(t *testing.T) {
+	client := NewClient(&ClientConfig{Timeout: time.Second, Balancer: &BalancerConfig{Endpoints: []Endpoint{{Addr: "a:1"}}}})
+	old := client.balancer
+	client.SetConfig(&ClientConfig{Balancer: &BalancerConfig{Endpoints: []Endpoint{{Addr: "a:1"}}}})
+	if client.balancer != old {
+		t.Fatal("the balancer is replaced by the same config")
+	}
+	client.SetConfig(&ClientConfig{Balancer: &BalancerConfig{Endpoints: []Endpoint{{Addr: "http://b c:1"}}}})
+	if client.balancer != old {
+		t.Fatal("the balancer is replaced by an invalid config")
+	}
+	client.SetConfig(&ClientConfig{Balancer: &BalancerConfig{Endpoints: []Endpoint{{Addr: "b:1"}}}})
+	if eps := client.balancer.Endpoints(); len(eps) != 1 || eps[0].Addr != "b:1" {
+		t.Fatalf("got endpoints %v, want b:1", eps)
+	}
+	closed := func(b *Balancer) bool {
+		select {
+		case <-b.done:
+			return true
+		default:
+			return false
+		}
+	}
+	if !closed(old) {
+		t.Fatal("the replaced balancer is not closed")
+	}
+	client.Close()
+	if !closed(client.balancer) {
+		t.Fatal("the balancer is not closed")
+	}
+}
+
+func TestBalancerInvalidEndpoint(t *testing.T) {
+	if _, err := NewBalancer(&BalancerConfig{HealthInterval: -1, Endpoints: []Endpoint{{Addr: "a:1"}, {Addr: "http://b c:1"}}}, nil); err == nil {
+		t.Fatal("want invalid endpoint error")
+	}
+	r := &fakeResolver{eps: []Endpoint{{Addr: "a:1"}, {Addr: "http://b c:1"}}}
+	b, err := NewBalancer(&BalancerConfig{HealthInterval: -1}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if eps := b.Endpoints(); len(eps) != 1 || eps[0].Addr != "a:1" {
+		t.Fatalf("got endpoints %v, want a:1", eps)
+	}
+}
+
+type fakeResolver struct {
+	mu  sync.Mutex
+	eps []Endpoint
+	ch  chan struct{}
+}
+
+func (r *fakeResolver) Endpoints() ([]Endpoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.eps, nil
+}
+
+func (r *fakeResolver) Watch() <-chan struct{} { return r.ch }
+
+func TestBalancerResolver(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer srv.Close()
+	r := &fakeResolver{ch: make(chan struct{}, 1)}
+	b, err := NewBalancer(&BalancerConfig{HealthInterval: -1}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	client := NewClient(&ClientConfig{Timeout: time.Second})
+	client.SetBalancer(b)
+
+	req, _ := xhttp.NewRequest(xhttp.MethodGet, "/ping", nil)
+	if _, err := client.Raw(context.Background(), req); err == nil {
+		t.Fatal("want no endpoints error")
+	}
+	r.mu.Lock()
+	r.eps = []Endpoint{{Addr: srv.URL}}
+	r.mu.Unlock()
+	r.ch <- struct{}{}
+	deadline := time.Now().Add(time.Second)
+	for len(b.Endpoints()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("endpoints not updated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.Raw(context.Background(), req); err != nil || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("Raw error(%v) hits(%d)", err, hits)
+	}
+}
+
+func TestNamingResolver(t *testing.T) {
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {}))
+	defer srv.Close()
+	w, err := naming.Static{"user": {{Addr: srv.URL, Weight: 3}}}.Resolve("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBalancer(&BalancerConfig{HealthInterval: -1}, NamingResolver(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if eps := b.Endpoints(); len(eps) != 1 || eps[0].Addr != srv.URL || eps[0].Weight != 3 {
+		t.Fatalf("got endpoints %v", eps)
+	}
+}
@@ -10,20 +10,23 @@ import (
 	xhttp "net/http"
 	"net/url"
 	"os"
+	"reflect"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Darker-D/ddbase/encoding/json"
+	"github.com/Darker-D/ddbase/log"
 	"github.com/Darker-D/ddbase/net/http/httptrace"
 	"github.com/Darker-D/ddbase/net/http/sign"
 	"github.com/Darker-D/ddbase/net/netutil/breaker"
+	"github.com/Darker-D/ddbase/net/netutil/limiter"
 	"github.com/Darker-D/ddbase/net/stat"
 
 	"github.com/gogo/protobuf/proto"
 	pkgerr "github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 const (
@@ -53,6 +56,9 @@ type ClientConfig struct {
 	Timeout    time.Duration
 	KeepAlive  time.Duration
 	Breaker    *breaker.Config
+	Retry      *RetryConfig
+	Hedge      *HedgeConfig
+	Balancer   *BalancerConfig
 	URL        map[string]*ClientConfig
 	Host       map[string]*ClientConfig
 }
@@ -63,12 +69,16 @@ type Client struct {
 	client    *xhttp.Client
 	dialer    *net.Dialer
 	transport xhttp.RoundTripper
-	autograph *sign.Sign
 
 	urlConf  map[string]*ClientConfig
 	hostConf map[string]*ClientConfig
 	mutex    sync.RWMutex
 	breaker  *breaker.Group
+	limiter  *limiter.Limiter
+	balancer *Balancer
+
+	interceptors []Interceptor
+	latencies    sync.Map // uri -> *latency, for hedged requests
 }
 
 // NewClient new a http client.
@@ -99,8 +109,12 @@ func NewClient(c *ClientConfig) *Client {
 		client.hostConf[host] = cfg
 	}
 
-	if c.SignConfig != nil {
-		client.autograph = sign.New(c.SignConfig)
+	if c.Balancer != nil {
+		b, err := NewBalancer(c.Balancer, nil)
+		if err != nil {
+			panic(fmt.Sprintf("http balancer: %v", err))
+		}
+		client.balancer = b
 	}
 
 	return client
@@ -112,8 +126,40 @@ func (client *Client) SetTransport(t xhttp.RoundTripper) {
 	client.client.Transport = t
 }
 
-// SetConfig set client config.
+// SetLimiter set client limiter, requests are limited per uri.
+func (client *Client) SetLimiter(l *limiter.Limiter) {
+	client.mutex.Lock()
+	client.limiter = l
+	client.mutex.Unlock()
+}
+
+// SetBalancer set client balancer, requests without host such as
+// "/user/info" are sent to its endpoints. The previous balancer is closed.
+func (client *Client) SetBalancer(b *Balancer) {
+	client.mutex.Lock()
+	old := client.balancer
+	client.balancer = b
+	client.mutex.Unlock()
+	if old != nil && old != b {
+		old.Close()
+	}
+}
+
+// Close closes the balancer of the client, stopping its health checks.
+func (client *Client) Close() error {
+	client.mutex.RLock()
+	b := client.balancer
+	client.mutex.RUnlock()
+	if b != nil {
+		return b.Close()
+	}
+	return nil
+}
+
+// SetConfig set client config, a changed Balancer replaces the balancer of
+// the client, an invalid one is logged and ignored.
 func (client *Client) SetConfig(c *ClientConfig) {
+	var old *Balancer
 	client.mutex.Lock()
 
 	if c.Timeout > 0 {
@@ -131,6 +177,22 @@ func (client *Client) SetConfig(c *ClientConfig) {
 		client.conf.Breaker = c.Breaker
 		client.breaker.Reload(c.Breaker)
 	}
+	if c.Retry != nil {
+		client.conf.Retry = c.Retry
+	}
+	if c.Hedge != nil {
+		client.conf.Hedge = c.Hedge
+	}
+	if c.Balancer != nil && client.balancerChanged(c.Balancer) {
+		if b, err := NewBalancer(c.Balancer, nil); err != nil {
+			if log.Logger().Logger != nil {
+				log.Logger().Warn("http balancer config ignored", zap.Error(err))
+			}
+		} else {
+			client.conf.Balancer = c.Balancer
+			old, client.balancer = client.balancer, b
+		}
+	}
 	for uri, cfg := range c.URL {
 		client.urlConf[uri] = cfg
 	}
@@ -138,6 +200,20 @@ func (client *Client) SetConfig(c *ClientConfig) {
 		client.hostConf[host] = cfg
 	}
 	client.mutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+// balancerChanged reports whether c differs from the config of the static
+// balancer of the client, it must be called with client.mutex held.
+func (client *Client) balancerChanged(c *BalancerConfig) bool {
+	b := client.balancer
+	if b == nil || b.resolver != nil {
+		return true
+	}
+	c.fix()
+	return !reflect.DeepEqual(b.conf, c)
 }
 
 // NewRequest new http request with method, uri, values and headers.
@@ -169,27 +245,6 @@ func (client *Client) NewRequest(method, uri string, params url.Values) (req *xh
 	return
 }
 
-// sign calc appkey and appsecret sign.
-func (client *Client) sign(params interface{}) (query string, err error) {
-	// FIXME 待实现
-	//if params == nil {
-	//	params = url.Values{}
-	//}
-	//params.Set(_appId, client.conf.AppID)
-	//
-	//if params.Get(_ts) == "" {
-	//	params.Set(_ts, strconv.FormatInt(time.Now().Unix(), 10))
-	//}
-	//
-	//switch params {
-	//
-	//}
-	//
-	//client.autograph.GenSign()
-
-	return
-}
-
 // Get issues a GET to the specified URL.
 func (client *Client) Get(c context.Context, uri string, params url.Values, res interface{}) (err error) {
 	req, err := client.NewRequest(xhttp.MethodGet, uri, params)
@@ -280,38 +335,24 @@ func (client *Client) RESTfulPost(c context.Context, uri string, params url.Valu
 	return client.Do(c, req, res, uri)
 }
 
-// Raw sends an HTTP request and returns bytes response
+// Raw sends an HTTP request through the interceptors and returns bytes response
 func (client *Client) Raw(c context.Context, req *xhttp.Request, v ...string) (bs []byte, err error) {
 	var (
 		ok      bool
-		code    string
 		cancel  func()
-		resp    *xhttp.Response
 		config  *ClientConfig
 		timeout time.Duration
 		uri     = fmt.Sprintf("%s://%s%s", req.URL.Scheme, req.Host, req.URL.Path)
 	)
+	if req.URL.Host == "" {
+		// NOTE: sent to the endpoints of the balancer.
+		uri = req.URL.Path
+	}
 
 	// NOTE fix prom & config uri key.
 	if len(v) == 1 {
 		uri = v[0]
 	}
-	// breaker
-	brk := client.breaker.Get(uri)
-	if err = brk.Allow(); err != nil {
-		code = "breaker"
-		clientStats.Incr(uri, code)
-		return
-	}
-	defer client.onBreaker(brk, &err)
-	// stat
-	now := time.Now()
-	defer func() {
-		clientStats.Timing(uri, int64(time.Since(now)/time.Millisecond))
-		if code != "" {
-			clientStats.Incr(uri, code)
-		}
-	}()
 	// get config
 	// 1.url config 2.host config 3.default
 	client.mutex.RLock()
@@ -336,17 +377,29 @@ func (client *Client) Raw(c context.Context, req *xhttp.Request, v ...string) (b
 		defer cancel()
 	}
 
-	req = req.Clone(c)
-
-	if resp, err = client.client.Do(req); err != nil {
-		err = pkgerr.Wrapf(err, "host:%s, url:%s", req.URL.Host, realURL(req))
-		code = "failed"
+	ctx := &ClientContext{
+		Context:  c,
+		Request:  req,
+		URI:      uri,
+		config:   config,
+		handlers: client.handlers(),
+		index:    -1,
+	}
+	ctx.Next()
+	resp := ctx.Response
+	if err = ctx.Error; err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
+	}
+	if resp == nil {
+		err = pkgerr.Wrapf(errAborted, "host:%s, url:%s", req.URL.Host, realURL(req))
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= xhttp.StatusBadRequest {
 		err = pkgerr.Errorf("incorrect http status:%d host:%s, url:%s", resp.StatusCode, req.URL.Host, realURL(req))
-		code = strconv.Itoa(resp.StatusCode)
 		return
 	}
 	if bs, err = readAll(resp.Body, _minRead); err != nil {
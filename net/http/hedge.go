@@ -0,0 +1,180 @@
+package http
+
+import (
+	"context"
+	"io"
+	xhttp "net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	_hedgeSamples    = 128 // latencies kept per uri
+	_hedgeMinSamples = 20  // latencies needed to hedge by the p95
+)
+
+// HedgeConfig is the hedged request policy: a second request is sent if the
+// first is still pending after the delay, the first response wins and the
+// other request is canceled.
+type HedgeConfig struct {
+	Delay         time.Duration // 发出对冲请求前的等待时间, 为 0 时使用该 uri 最近请求延迟的 p95
+	NonIdempotent bool          // 非幂等请求 (POST, PATCH) 也对冲, 默认只对冲幂等请求
+}
+
+// latency keeps the recent latencies of an uri for its p95.
+type latency struct {
+	mu      sync.Mutex
+	samples [_hedgeSamples]time.Duration
+	n       int // total samples
+	p95     time.Duration
+}
+
+func (l *latency) add(d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.n%_hedgeSamples] = d
+	l.n++
+	// NOTE: the p95 is computed again every 8 samples.
+	if l.n >= _hedgeMinSamples && (l.n-_hedgeMinSamples)%8 == 0 {
+		n := l.n
+		if n > _hedgeSamples {
+			n = _hedgeSamples
+		}
+		sorted := make([]time.Duration, n)
+		copy(sorted, l.samples[:n])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		l.p95 = sorted[n*95/100]
+	}
+	l.mu.Unlock()
+}
+
+// percentile95 returns the p95 latency, 0 until enough samples.
+func (l *latency) percentile95() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.p95
+}
+
+// latency returns the latencies of uri.
+func (client *Client) latency(uri string) *latency {
+	if l, ok := client.latencies.Load(uri); ok {
+		return l.(*latency)
+	}
+	l, _ := client.latencies.LoadOrStore(uri, new(latency))
+	return l.(*latency)
+}
+
+// cancelBody cancels the request of the winning response once read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type hedgeResult struct {
+	resp   *xhttp.Response
+	err    error
+	cancel func()
+	index  int // 0 for the first request, 1 for the hedge
+}
+
+// roundTrip sends req, hedged by hc if not nil. The breaker and the stats of
+// Raw count it as one request.
+func (client *Client) roundTrip(req *xhttp.Request, hc *HedgeConfig, uri string) (*xhttp.Response, error) {
+	if hc == nil {
+		return client.do(req)
+	}
+	lat := client.latency(uri)
+	delay := hc.Delay
+	if delay <= 0 {
+		delay = lat.percentile95()
+	}
+	if delay <= 0 || !replayable(req, hc.NonIdempotent) {
+		start := time.Now()
+		resp, err := client.do(req)
+		if err == nil {
+			lat.add(time.Since(start))
+		}
+		return resp, err
+	}
+
+	results := make(chan hedgeResult, 2)
+	var cancels []func()
+	send := func(r *xhttp.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			start := time.Now()
+			resp, err := client.do(r.WithContext(ctx))
+			if err == nil {
+				lat.add(time.Since(start))
+			}
+			results <- hedgeResult{resp: resp, err: err, cancel: cancel, index: index}
+		}()
+	}
+	send(req)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var err error
+	for received := 0; received < len(cancels); {
+		select {
+		case <-timer.C:
+			h := req.Clone(req.Context())
+			if req.GetBody != nil {
+				var e error
+				if h.Body, e = req.GetBody(); e != nil {
+					continue
+				}
+			}
+			clientStats.Incr(uri, "hedge")
+			send(h)
+		case r := <-results:
+			received++
+			if r.err != nil {
+				r.cancel()
+				err = r.err
+				continue
+			}
+			// cancel and drain the other request
+			for i, cancel := range cancels {
+				if i != r.index {
+					cancel()
+				}
+			}
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					if r := <-results; r.resp != nil {
+						r.resp.Body.Close()
+					}
+				}
+			}(len(cancels) - received)
+			if r.index > 0 {
+				clientStats.Incr(uri, "hedge_win")
+			}
+			r.resp.Body = &cancelBody{r.resp.Body, r.cancel}
+			return r.resp, nil
+		}
+	}
+	return nil, err
+}
+
+// do sends req to an endpoint of the balancer if req has no host.
+func (client *Client) do(req *xhttp.Request) (*xhttp.Response, error) {
+	client.mutex.RLock()
+	b := client.balancer
+	client.mutex.RUnlock()
+	if b == nil || req.URL.Host != "" {
+		return client.client.Do(req)
+	}
+	ep, err := b.pick()
+	if err != nil {
+		return nil, err
+	}
+	return b.do(client.client, ep, req)
+}
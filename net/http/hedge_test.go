@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	xhttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	var calls, canceled int32
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the first request is slow
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&canceled, 1)
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+	client := NewClient(&ClientConfig{
+		Timeout: 2 * time.Second,
+		URL: map[string]*ClientConfig{
+			srv.URL + "/hedged": {Timeout: 2 * time.Second, Hedge: &HedgeConfig{Delay: 20 * time.Millisecond}},
+		},
+	})
+
+	start := time.Now()
+	var res struct{ OK bool }
+	if err := client.Get(context.Background(), srv.URL+"/hedged", url.Values{}, &res); err != nil || !res.OK {
+		t.Fatalf("Get = %+v, %v", res, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("took %v, want the hedge response", d)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&canceled) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the slow request is not canceled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// not configured for the uri
+	atomic.StoreInt32(&calls, 0)
+	start = time.Now()
+	if err := client.Get(context.Background(), srv.URL+"/plain", url.Values{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("took %v with %d calls, want no hedge", d, calls)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	l := new(latency)
+	for i := 1; i < _hedgeMinSamples; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	if p := l.percentile95(); p != 0 {
+		t.Fatalf("got p95 %v before enough samples", p)
+	}
+	for i := _hedgeMinSamples; i <= 100; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	// 100 samples, the p95 is computed at the 100th
+	if p := l.percentile95(); p != 96*time.Millisecond {
+		t.Fatalf("got p95 %v, want 96ms", p)
+	}
+}
@@ -1,6 +1,7 @@
 package httptrace
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptrace"
@@ -15,6 +16,14 @@ const (
 	_defaultComponentName = "net/http"
 )
 
+type attemptKey struct{}
+
+// WithAttempt returns a context which tags the span of the request with the
+// attempt number, starting from 1.
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
 type closeTracker struct {
 	io.ReadCloser
 	span opentracing.Span
@@ -61,6 +70,9 @@ func (t *TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if t.peerService != "" {
 		ext.PeerService.Set(span, t.peerService)
 	}
+	if attempt, ok := req.Context().Value(attemptKey{}).(int); ok {
+		span.SetTag("net/http.attempt", attempt)
+	}
 
 	// inject trace to http header
 	_ = span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
@@ -0,0 +1,234 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	xhttp "net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Darker-D/ddbase/ecode"
+	"github.com/Darker-D/ddbase/net/http/httptrace"
+	"github.com/Darker-D/ddbase/net/http/sign"
+
+	pkgerr "github.com/pkg/errors"
+)
+
+const _sign = "sign"
+
+var errAborted = errors.New("http: request aborted without response")
+
+// Interceptor handles the requests of a client, like gin.HandlerFunc on the
+// server side. It calls c.Next to send the request through the rest of the
+// chain, or sets c.Response or c.Error and calls c.Abort to answer the request
+// itself, such as from a cache or a mock.
+type Interceptor func(c *ClientContext)
+
+// ClientContext is a request going through the interceptors of a client.
+type ClientContext struct {
+	context.Context
+	Request  *xhttp.Request
+	Response *xhttp.Response // 响应, 状态码 >= 400 时 Raw 返回错误
+	Error    error
+	URI      string // 统计, 熔断和配置使用的 uri
+
+	config   *ClientConfig
+	handlers []Interceptor
+	index    int
+}
+
+// Next calls the rest of the chain, the last one sends the request.
+func (c *ClientContext) Next() {
+	c.index++
+	for c.index < len(c.handlers) {
+		c.handlers[c.index](c)
+		c.index++
+	}
+}
+
+// Abort prevents the rest of the chain from being called.
+func (c *ClientContext) Abort() {
+	c.index = len(c.handlers)
+}
+
+// IsAborted reports whether the chain was aborted.
+func (c *ClientContext) IsAborted() bool {
+	return c.index >= len(c.handlers)
+}
+
+// Use adds interceptors to the client, called in order after its limiter,
+// breaker and stats.
+func (client *Client) Use(interceptors ...Interceptor) {
+	client.mutex.Lock()
+	client.interceptors = append(client.interceptors, interceptors...)
+	client.mutex.Unlock()
+}
+
+// handlers returns the chain of a request.
+func (client *Client) handlers() []Interceptor {
+	client.mutex.RLock()
+	defer client.mutex.RUnlock()
+	handlers := make([]Interceptor, 0, len(client.interceptors)+4)
+	handlers = append(handlers, client.limitHandler, client.breakerHandler, client.statHandler)
+	handlers = append(handlers, client.interceptors...)
+	return append(handlers, client.sendHandler)
+}
+
+// limitHandler rejects the request if the limiter of the uri does not allow it.
+func (client *Client) limitHandler(c *ClientContext) {
+	client.mutex.RLock()
+	l := client.limiter
+	client.mutex.RUnlock()
+	if l == nil {
+		return
+	}
+	if res, _ := l.Allow(c, c.URI); !res.Allowed {
+		c.Error = pkgerr.Wrapf(ecode.LimitExceed, "uri:%s, retry after:%s", c.URI, res.RetryAfter)
+		clientStats.Incr(c.URI, "limit")
+		c.Abort()
+	}
+}
+
+// breakerHandler rejects the request if the breaker of the uri is open, and
+// marks the result of the request.
+func (client *Client) breakerHandler(c *ClientContext) {
+	brk := client.breaker.Get(c.URI)
+	if c.Error = brk.Allow(); c.Error != nil {
+		clientStats.Incr(c.URI, "breaker")
+		c.Abort()
+		return
+	}
+	c.Next()
+	err := c.Error
+	if err == nil && c.Response != nil && c.Response.StatusCode >= xhttp.StatusBadRequest {
+		err = errors.New(c.Response.Status)
+	}
+	client.onBreaker(brk, &err)
+}
+
+// statHandler records the latency and the failures of the uri.
+func (client *Client) statHandler(c *ClientContext) {
+	now := time.Now()
+	c.Next()
+	clientStats.Timing(c.URI, int64(time.Since(now)/time.Millisecond))
+	if c.Response != nil && c.Response.StatusCode >= xhttp.StatusBadRequest {
+		clientStats.Incr(c.URI, strconv.Itoa(c.Response.StatusCode))
+	} else if c.Error != nil {
+		clientStats.Incr(c.URI, "failed")
+	}
+}
+
+// sendHandler sends the request, retried and hedged by the config of the uri.
+func (client *Client) sendHandler(c *ClientContext) {
+	var (
+		req   = c.Request
+		retry = c.config.Retry
+		resp  *xhttp.Response
+		err   error
+	)
+	canRetry := retry.allow(req)
+	for attempt := 1; ; attempt++ {
+		r := req.Clone(httptrace.WithAttempt(c.Context, attempt))
+		if attempt > 1 && req.GetBody != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				break
+			}
+		}
+		resp, err = client.roundTrip(r, c.config.Hedge, c.URI)
+		if !canRetry || attempt >= retry.Attempts || c.Err() != nil || !retry.retryable(resp, err) {
+			break
+		}
+		// retry only if the backoff ends before the deadline
+		delay := retry.backoff(attempt)
+		if deadline, ok := c.Deadline(); ok && time.Until(deadline) <= delay {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.Done():
+			// NOTE: the result of this attempt is kept, rather than the error
+			// of another attempt with the canceled context.
+			timer.Stop()
+		}
+		if c.Err() != nil {
+			break
+		}
+		if resp != nil {
+			discard(resp)
+		}
+		clientStats.Incr(c.URI, "retry")
+	}
+	if err != nil {
+		c.Error = pkgerr.Wrapf(err, "host:%s, url:%s", req.URL.Host, realURL(req))
+		return
+	}
+	c.Response = resp
+}
+
+// Sign signs the requests by c, the same as middleware.Sign checks: the
+// appId and ts params are added if absent, then the sign param of the query,
+// and of the form body of a POST. It is opt-in, add it by Use:
+//
+//	client.Use(Sign(conf))
+func Sign(c *sign.Config) Interceptor {
+	s := sign.New(c)
+	return func(ctx *ClientContext) {
+		req := ctx.Request
+		query := req.URL.Query()
+		var form url.Values
+		if isForm(req) && req.Body != nil {
+			body, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err == nil {
+				form, err = url.ParseQuery(string(body))
+			}
+			if err != nil {
+				ctx.Error = pkgerr.Wrapf(err, "sign host:%s, url:%s", req.URL.Host, req.URL.Path)
+				ctx.Abort()
+				return
+			}
+		}
+		params := query
+		if form != nil {
+			params = form
+		}
+		if c != nil && c.AppID != "" && query.Get(_appId) == "" && form.Get(_appId) == "" {
+			params.Set(_appId, c.AppID)
+		}
+		if query.Get(_ts) == "" && form.Get(_ts) == "" {
+			params.Set(_ts, strconv.FormatInt(time.Now().Unix(), 10))
+		}
+		all := make(map[string]string, len(query)+len(form))
+		for _, vs := range []url.Values{query, form} {
+			for k, v := range vs {
+				if len(v) > 0 {
+					all[k] = v[0]
+				}
+			}
+		}
+		params.Set(_sign, s.GenSign(all))
+
+		// NOTE: the request is shared with the caller, sign a copy.
+		r := req.Clone(req.Context())
+		r.URL.RawQuery = query.Encode()
+		if form != nil {
+			body := []byte(form.Encode())
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(body)), nil
+			}
+			r.ContentLength = int64(len(body))
+		}
+		ctx.Request = r
+	}
+}
+
+func isForm(req *xhttp.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	xhttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/net/http/sign"
+)
+
+func TestInterceptors(t *testing.T) {
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		w.Write([]byte(`{"token":"` + r.Header.Get("X-Token") + `"}`))
+	}))
+	defer srv.Close()
+	client := NewClient(&ClientConfig{Timeout: time.Second})
+
+	var order []string
+	client.Use(func(c *ClientContext) {
+		order = append(order, "auth")
+		c.Request.Header.Set("X-Token", "t1")
+		c.Next()
+		order = append(order, "auth done")
+	}, func(c *ClientContext) {
+		order = append(order, "log "+c.URI)
+	})
+	var res struct{ Token string }
+	if err := client.Get(context.Background(), srv.URL+"/user", url.Values{}, &res); err != nil || res.Token != "t1" {
+		t.Fatalf("Get = %+v, %v", res, err)
+	}
+	want := []string{"auth", "log " + srv.URL + "/user", "auth done"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+}
+
+func TestInterceptorAbort(t *testing.T) {
+	client := NewClient(&ClientConfig{Timeout: time.Second})
+	client.Use(func(c *ClientContext) {
+		if c.Request.URL.Path == "/mock" {
+			c.Response = &xhttp.Response{
+				StatusCode: xhttp.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"mocked":true}`)),
+			}
+			c.Abort()
+		}
+	})
+	var res struct{ Mocked bool }
+	if err := client.Get(context.Background(), "http://127.0.0.1:1/mock", url.Values{}, &res); err != nil || !res.Mocked {
+		t.Fatalf("Get = %+v, %v", res, err)
+	}
+
+	client.Use(func(c *ClientContext) { c.Abort() })
+	if err := client.Get(context.Background(), "http://127.0.0.1:1/other", url.Values{}, nil); err == nil {
+		t.Fatal("want an error without response")
+	}
+}
+
+func TestSignInterceptor(t *testing.T) {
+	conf := &sign.Config{AppID: "app", AppSecret: "secret", Algorithm: "sha256"}
+	s := sign.New(conf)
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(xhttp.StatusBadRequest)
+			return
+		}
+		params := make(map[string]string)
+		for k, v := range r.Form {
+			params[k] = v[0]
+		}
+		if params["appId"] != "app" || params["ts"] == "" || params["sign"] != s.GenSign(params) {
+			w.WriteHeader(xhttp.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	client := NewClient(&ClientConfig{Timeout: time.Second, SignConfig: conf})
+	ctx := context.Background()
+	// SignConfig alone does not sign
+	if err := client.Get(ctx, srv.URL+"/get", url.Values{"a": {"1"}}, nil); err == nil {
+		t.Fatal("want the unsigned request rejected")
+	}
+	client.Use(Sign(conf))
+
+	if err := client.Get(ctx, srv.URL+"/get", url.Values{"a": {"1"}}, nil); err != nil {
+		t.Fatalf("Get error(%v)", err)
+	}
+	if err := client.Post(ctx, srv.URL+"/post", url.Values{"b": {"2"}}, nil); err != nil {
+		t.Fatalf("Post error(%v)", err)
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/Darker-D/ddbase/ecode"
+	"github.com/Darker-D/ddbase/net/http"
+	"github.com/Darker-D/ddbase/net/netutil/limiter"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limit 限流, key 为 nil 时按路由限流.
+func Limit(l *limiter.Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := c.FullPath()
+		if key != nil {
+			k = key(c)
+		}
+		// NOTE: redis 异常时已降级为进程内限流, 忽略 err.
+		res, _ := l.Allow(http.ToContext(c), k)
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+			http.JSON(c, nil, ecode.LimitExceed)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	xhttp "net/http"
+	"time"
+
+	"github.com/Darker-D/ddbase/net/netutil"
+)
+
+var _retryBackoff = &netutil.BackoffConfig{
+	MaxDelay:  time.Second,
+	BaseDelay: 50 * time.Millisecond,
+	Factor:    1.6,
+	Jitter:    0.2,
+}
+
+// _retryCodes are the status codes retried by default.
+var _retryCodes = []int{xhttp.StatusBadGateway, xhttp.StatusServiceUnavailable, xhttp.StatusGatewayTimeout}
+
+// RetryConfig is the retry policy of http requests, the attempts share the
+// timeout of the request.
+type RetryConfig struct {
+	Attempts      int                    // 最大请求次数, 包含首次请求, 小于等于 1 不重试
+	Backoff       *netutil.BackoffConfig // 重试间隔, 默认 50ms 起, 最大 1s
+	Codes         []int                  // 可重试的 http 状态码, 默认 502, 503, 504
+	NonIdempotent bool                   // 非幂等请求 (POST, PATCH) 也重试, 默认只重试幂等请求
+	// Retryable decides whether a failed attempt is retried, resp is nil on
+	// error. By default errors and Codes are retried.
+	Retryable func(resp *xhttp.Response, err error) bool
+}
+
+// allow reports whether req may be retried.
+func (rc *RetryConfig) allow(req *xhttp.Request) bool {
+	return rc != nil && rc.Attempts > 1 && replayable(req, rc.NonIdempotent)
+}
+
+// replayable reports whether req may be sent again, which requires an
+// idempotent method unless nonIdempotent.
+func replayable(req *xhttp.Request, nonIdempotent bool) bool {
+	if req.Body != nil && req.Body != xhttp.NoBody && req.GetBody == nil {
+		// NOTE: the body can not be sent again.
+		return false
+	}
+	if nonIdempotent {
+		return true
+	}
+	switch req.Method {
+	case "", xhttp.MethodGet, xhttp.MethodHead, xhttp.MethodOptions, xhttp.MethodTrace, xhttp.MethodPut, xhttp.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether the attempt failed by resp or err is retried.
+func (rc *RetryConfig) retryable(resp *xhttp.Response, err error) bool {
+	if rc.Retryable != nil {
+		return rc.Retryable(resp, err)
+	}
+	if err != nil {
+		return true
+	}
+	codes := rc.Codes
+	if len(codes) == 0 {
+		codes = _retryCodes
+	}
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the retry after the failed attempt.
+func (rc *RetryConfig) backoff(attempt int) time.Duration {
+	bc := rc.Backoff
+	if bc == nil {
+		bc = _retryBackoff
+	}
+	return bc.Backoff(attempt - 1)
+}
+
+// discard drains and closes the body of a response which is not read, so
+// that its connection can be reused.
+func discard(resp *xhttp.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, _minRead))
+	resp.Body.Close()
+}
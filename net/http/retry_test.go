@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	xhttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/net/netutil"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.WriteHeader(xhttp.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+	retry := &RetryConfig{
+		Attempts: 3,
+		Backoff:  &netutil.BackoffConfig{MaxDelay: 10 * time.Millisecond, BaseDelay: time.Millisecond, Factor: 1.6},
+	}
+	client := NewClient(&ClientConfig{Timeout: time.Second, Retry: retry})
+	ctx := context.Background()
+
+	req, _ := xhttp.NewRequest(xhttp.MethodPut, srv.URL, strings.NewReader("hello"))
+	bs, err := client.Raw(ctx, req)
+	if err != nil || string(bs) != "hello" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("Raw = %q, %v after %d calls", bs, err, calls)
+	}
+
+	// POST is not idempotent
+	atomic.StoreInt32(&calls, 0)
+	if err = client.Post(ctx, srv.URL, url.Values{}, nil); err == nil || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("Post = %v after %d calls, want one failed call", err, calls)
+	}
+	retry.NonIdempotent = true
+	atomic.StoreInt32(&calls, 0)
+	if err = client.Post(ctx, srv.URL, url.Values{}, nil); err != nil || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("Post = %v after %d calls", err, calls)
+	}
+
+	// not retryable status
+	retry.Codes = []int{xhttp.StatusBadGateway}
+	atomic.StoreInt32(&calls, 0)
+	if err = client.Get(ctx, srv.URL, url.Values{}, nil); err == nil || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("Get = %v after %d calls, want one failed call", err, calls)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(xhttp.StatusBadGateway)
+	}))
+	defer srv.Close()
+	client := NewClient(&ClientConfig{Timeout: time.Second, Retry: &RetryConfig{
+		Attempts: 5,
+		Backoff:  &netutil.BackoffConfig{MaxDelay: time.Second, BaseDelay: 100 * time.Millisecond, Factor: 1},
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Get(ctx, srv.URL, url.Values{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("got %v, want status 502", err)
+	}
+	// the third attempt would start after the deadline
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Fatalf("took %v, want within the deadline", d)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(xhttp.HandlerFunc(func(w xhttp.ResponseWriter, r *xhttp.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(xhttp.StatusBadGateway)
+	}))
+	defer srv.Close()
+	client := NewClient(&ClientConfig{Timeout: time.Second, Retry: &RetryConfig{
+		Attempts: 5,
+		Backoff:  &netutil.BackoffConfig{MaxDelay: time.Second, BaseDelay: 100 * time.Millisecond, Factor: 1},
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(30*time.Millisecond, cancel)
+
+	// canceled during the backoff, the error of the attempt is kept
+	err := client.Get(ctx, srv.URL, url.Values{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("got %v, want status 502", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("got %d calls, want 1", n)
+	}
+}
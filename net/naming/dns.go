@@ -0,0 +1,86 @@
+package naming
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS resolves the services from DNS records, polled every interval.
+type DNS struct {
+	interval time.Duration
+
+	// NOTE: replaced in tests.
+	lookupHost func(host string) ([]string, error)
+	lookupSRV  func(service, proto, name string) (string, []*net.SRV, error)
+}
+
+// NewDNS new a DNS resolver, the interval is 30s by default.
+func NewDNS(interval time.Duration) *DNS {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &DNS{
+		interval:   interval,
+		lookupHost: net.LookupHost,
+		lookupSRV:  net.LookupSRV,
+	}
+}
+
+// Resolve returns a watcher of the instances of name, the A records of the
+// host if name is host:port, else the SRV records of name such as
+// _http._tcp.user.svc.cluster.local.
+func (d *DNS) Resolve(name string) (Watcher, error) {
+	lookup := d.srv
+	if host, port, err := net.SplitHostPort(name); err == nil {
+		lookup = func(string) ([]*Instance, error) { return d.host(host, port) }
+	}
+	var (
+		done = make(chan struct{})
+		once sync.Once
+	)
+	w := newWatcher(func() { once.Do(func() { close(done) }) })
+	w.set(lookup(name))
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w.set(lookup(name))
+			}
+		}
+	}()
+	return w, nil
+}
+
+func (d *DNS) host(host, port string) ([]*Instance, error) {
+	addrs, err := d.lookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+	ins := make([]*Instance, len(addrs))
+	for i, addr := range addrs {
+		ins[i] = &Instance{Addr: net.JoinHostPort(addr, port)}
+	}
+	return ins, nil
+}
+
+func (d *DNS) srv(name string) ([]*Instance, error) {
+	_, srvs, err := d.lookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+	ins := make([]*Instance, len(srvs))
+	for i, srv := range srvs {
+		ins[i] = &Instance{
+			Addr:   net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))),
+			Weight: int(srv.Weight),
+		}
+	}
+	return ins, nil
+}
@@ -0,0 +1,61 @@
+package naming
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDNS(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		hosts = []string{"10.0.0.1"}
+		srvs  = []*net.SRV{{Target: "a.user.local.", Port: 8000, Weight: 5}}
+		fail  bool
+	)
+	d := NewDNS(10 * time.Millisecond)
+	d.lookupHost = func(host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if host != "user.local" {
+			return nil, errors.New("no such host")
+		}
+		if fail {
+			return nil, errors.New("timeout")
+		}
+		return hosts, nil
+	}
+	d.lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return "", srvs, nil
+	}
+
+	w, err := d.Resolve("user.local:8000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	waitInstances(t, w, "10.0.0.1:8000")
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	waitInstances(t, w, "10.0.0.1:8000")
+	mu.Lock()
+	fail, hosts = false, []string{"10.0.0.1", "10.0.0.2"}
+	mu.Unlock()
+	waitInstances(t, w, "10.0.0.1:8000", "10.0.0.2:8000")
+
+	s, err := d.Resolve("_http._tcp.user.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	waitInstances(t, s, "a.user.local:8000")
+	if ins, _ := s.Instances(); ins[0].Weight != 5 {
+		t.Fatalf("got weight %d, want 5", ins[0].Weight)
+	}
+}
@@ -0,0 +1,139 @@
+package naming
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Darker-D/ddbase/encoding/json"
+	"gopkg.in/yaml.v2"
+)
+
+// File resolves the services from a local JSON or YAML file, which maps the
+// service names to their instances:
+//
+//	{"user": [{"addr": "10.0.0.1:8000", "weight": 10}]}
+//
+// The file is read again every interval if changed.
+type File struct {
+	path     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	data     []byte
+	services map[string][]*Instance
+	err      error
+	watchers map[string]map[*watcher]struct{}
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewFile new a resolver of the file path, YAML if its extension is .yaml or
+// .yml else JSON. The interval is 1s by default.
+func NewFile(path string, interval time.Duration) *File {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	f := &File{
+		path:     path,
+		interval: interval,
+		watchers: make(map[string]map[*watcher]struct{}),
+		done:     make(chan struct{}),
+	}
+	f.load()
+	go f.loop()
+	return f
+}
+
+// Resolve returns a watcher of the instances of name in the file.
+func (f *File) Resolve(name string) (Watcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var w *watcher
+	w = newWatcher(func() {
+		f.mu.Lock()
+		delete(f.watchers[name], w)
+		f.mu.Unlock()
+	})
+	if f.watchers[name] == nil {
+		f.watchers[name] = make(map[*watcher]struct{})
+	}
+	f.watchers[name][w] = struct{}{}
+	f.notify(name, w)
+	return w, nil
+}
+
+// Close stops watching the file.
+func (f *File) Close() error {
+	f.once.Do(func() { close(f.done) })
+	return nil
+}
+
+func (f *File) loop() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.load()
+		}
+	}
+}
+
+// load reads the file and notifies the watchers if changed.
+func (f *File) load() {
+	data, err := ioutil.ReadFile(f.path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil && f.services != nil && bytes.Equal(data, f.data) {
+		return
+	}
+	var services map[string][]*Instance
+	if err == nil {
+		services, err = parse(f.path, data)
+	}
+	if err != nil {
+		// NOTE: keep the last services on a bad file.
+		f.err = err
+	} else {
+		f.data, f.services, f.err = data, services, nil
+	}
+	for name, ws := range f.watchers {
+		for w := range ws {
+			f.notify(name, w)
+		}
+	}
+}
+
+// notify sets the instances of name to w, under f.mu.
+func (f *File) notify(name string, w *watcher) {
+	if f.services == nil {
+		w.set(nil, f.err)
+		return
+	}
+	ins := f.services[name]
+	if ins == nil {
+		// NOTE: the service is removed, so are its instances.
+		ins = []*Instance{}
+	}
+	w.set(ins, nil)
+}
+
+func parse(path string, data []byte) (services map[string][]*Instance, err error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &services)
+	default:
+		err = json.Unmarshal(data, &services)
+	}
+	if err == nil && services == nil {
+		services = make(map[string][]*Instance)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package naming
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitInstances(t *testing.T, w Watcher, want ...string) {
+	deadline := time.After(time.Second)
+	for {
+		ins, _ := w.Instances()
+		if len(ins) == len(want) {
+			ok := true
+			for i := range ins {
+				ok = ok && ins[i].Addr == want[i]
+			}
+			if ok {
+				return
+			}
+		}
+		select {
+		case <-w.Watch():
+		case <-deadline:
+			t.Fatalf("got instances %v, want %v", ins, want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "naming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct {
+		name     string
+		old, new string
+	}{
+		{"services.json", `{"user":[{"addr":"a:1"}]}`, `{"user":[{"addr":"a:1"},{"addr":"b:1","weight":2}]}`},
+		{"services.yaml", "user:\n- addr: a:1\n", "user:\n- addr: a:1\n- addr: b:1\n  weight: 2\n"},
+	} {
+		path := filepath.Join(dir, c.name)
+		if err := ioutil.WriteFile(path, []byte(c.old), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f := NewFile(path, 10*time.Millisecond)
+		w, err := f.Resolve("user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitInstances(t, w, "a:1")
+
+		// a bad file keeps the instances
+		ioutil.WriteFile(path, []byte("{"), 0644)
+		time.Sleep(30 * time.Millisecond)
+		waitInstances(t, w, "a:1")
+
+		ioutil.WriteFile(path, []byte(c.new), 0644)
+		waitInstances(t, w, "a:1", "b:1")
+		if ins, _ := w.Instances(); ins[1].Weight != 2 {
+			t.Fatalf("%s: got weight %d", c.name, ins[1].Weight)
+		}
+
+		// the service is removed
+		ioutil.WriteFile(path, []byte("{}"), 0644)
+		waitInstances(t, w)
+		w.Close()
+		f.Close()
+	}
+}
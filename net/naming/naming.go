@@ -0,0 +1,151 @@
+// Package naming resolves the instances of a service, such as a static list,
+// a watched local file or DNS records, so that clients pick up the instance
+// changes without restarts.
+package naming
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoInstances is returned when a service has no instances.
+var ErrNoInstances = errors.New("naming: no instances")
+
+// Instance is an instance of a service.
+type Instance struct {
+	Addr     string            `json:"addr" yaml:"addr"`         // 地址, host:port 或 scheme://host:port
+	Weight   int               `json:"weight" yaml:"weight"`     // 权重, 默认 1
+	Metadata map[string]string `json:"metadata" yaml:"metadata"` // 元数据
+}
+
+// Resolver resolves services by name.
+type Resolver interface {
+	// Resolve starts watching the instances of the service name.
+	Resolve(name string) (Watcher, error)
+}
+
+// Watcher watches the instances of a service.
+type Watcher interface {
+	// Instances returns the current instances.
+	Instances() ([]*Instance, error)
+	// Watch returns a channel which receives when the instances change, and
+	// once when the first instances are resolved. A watcher has a single
+	// consumer, resolve the name again for another.
+	Watch() <-chan struct{}
+	// Close stops watching.
+	Close() error
+}
+
+// Pick picks a random instance of w by weight.
+func Pick(w Watcher) (*Instance, error) {
+	ins, err := w.Instances()
+	if err != nil {
+		return nil, err
+	}
+	if len(ins) == 0 {
+		return nil, ErrNoInstances
+	}
+	total := 0
+	for _, in := range ins {
+		total += weight(in)
+	}
+	n := rand.Intn(total)
+	for _, in := range ins {
+		if n -= weight(in); n < 0 {
+			return in, nil
+		}
+	}
+	return ins[len(ins)-1], nil
+}
+
+func weight(in *Instance) int {
+	if in.Weight <= 0 {
+		return 1
+	}
+	return in.Weight
+}
+
+// watcher is a Watcher whose instances are set by its resolver.
+type watcher struct {
+	ch    chan struct{}
+	close func()
+
+	mu  sync.RWMutex
+	ins []*Instance
+	err error
+}
+
+func newWatcher(close func()) *watcher {
+	return &watcher{ch: make(chan struct{}, 1), close: close}
+}
+
+// set sets the resolved instances and notifies the change. On error the
+// last instances are kept.
+func (w *watcher) set(ins []*Instance, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		if w.ins == nil {
+			w.err = err
+		}
+		return
+	}
+	if w.ins != nil && equal(w.ins, ins) {
+		return
+	}
+	w.ins, w.err = ins, nil
+	select {
+	case w.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) Instances() ([]*Instance, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.ins, w.err
+}
+
+func (w *watcher) Watch() <-chan struct{} {
+	return w.ch
+}
+
+func (w *watcher) Close() error {
+	if w.close != nil {
+		w.close()
+	}
+	return nil
+}
+
+// equal reports whether a and b are the same instances in any order.
+func equal(a, b []*Instance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ka, kb := keys(a), keys(b)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keys returns the sorted keys of ins, an instance key covers all its fields.
+func keys(ins []*Instance) []string {
+	keys := make([]string, len(ins))
+	for i, in := range ins {
+		meta := make([]string, 0, len(in.Metadata))
+		for k, v := range in.Metadata {
+			meta = append(meta, k+"="+v)
+		}
+		sort.Strings(meta)
+		keys[i] = in.Addr + "#" + strconv.Itoa(weight(in)) + "#" + strings.Join(meta, "&")
+	}
+	sort.Strings(keys)
+	return keys
+}
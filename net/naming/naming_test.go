@@ -0,0 +1,60 @@
+package naming
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	w, err := Static{"user": {{Addr: "a:1", Weight: 3}, {Addr: "b:1"}}}.Resolve("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-w.Watch()
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		in, err := Pick(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[in.Addr]++
+	}
+	if counts["a:1"] < 2700 || counts["b:1"] < 700 {
+		t.Fatalf("picks %v, want about 3:1", counts)
+	}
+	if _, err := (Static{}).Resolve("user"); err != ErrNoInstances {
+		t.Fatalf("Resolve unknown error(%v)", err)
+	}
+}
+
+func TestWatcherSet(t *testing.T) {
+	w := newWatcher(nil)
+	if _, err := Pick(w); err != ErrNoInstances {
+		t.Fatalf("Pick error(%v), want ErrNoInstances", err)
+	}
+	boom := errors.New("boom")
+	w.set(nil, boom)
+	if _, err := w.Instances(); err != boom {
+		t.Fatalf("Instances error(%v), want boom", err)
+	}
+	w.set([]*Instance{{Addr: "a:1", Metadata: map[string]string{"x": "1", "y": "2"}}, {Addr: "b:1"}}, nil)
+	<-w.Watch()
+	// same instances in another order
+	w.set([]*Instance{{Addr: "b:1", Weight: 1}, {Addr: "a:1", Metadata: map[string]string{"y": "2", "x": "1"}}}, nil)
+	select {
+	case <-w.Watch():
+		t.Fatal("notified without changes")
+	default:
+	}
+	// the last instances are kept on error
+	w.set(nil, boom)
+	if ins, err := w.Instances(); err != nil || len(ins) != 2 {
+		t.Fatalf("Instances = %v, %v", ins, err)
+	}
+	w.set([]*Instance{{Addr: "a:1", Weight: 2}}, nil)
+	select {
+	case <-w.Watch():
+	default:
+		t.Fatal("not notified of the weight change")
+	}
+}
@@ -0,0 +1,15 @@
+package naming
+
+// Static resolves the services from a fixed list of instances.
+type Static map[string][]*Instance
+
+// Resolve returns a watcher of the instances of name, which never change.
+func (s Static) Resolve(name string) (Watcher, error) {
+	ins, ok := s[name]
+	if !ok || len(ins) == 0 {
+		return nil, ErrNoInstances
+	}
+	w := newWatcher(nil)
+	w.set(ins, nil)
+	return w, nil
+}
@@ -164,6 +164,13 @@ func (g *Group) Reload(conf *Config) {
 	g.mu.Unlock()
 }
 
+// Reset drops the breaker of key, the next Get makes a new one.
+func (g *Group) Reset(key string) {
+	g.mu.Lock()
+	delete(g.brks, key)
+	g.mu.Unlock()
+}
+
 // Go runs your function while tracking the breaker state of group.
 func (g *Group) Go(name string, run, fallback func() error) error {
 	breaker := g.Get(name)
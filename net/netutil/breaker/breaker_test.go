@@ -36,6 +36,12 @@ func TestGroup(t *testing.T) {
 	if g.conf.SwitchOff == _conf.SwitchOff {
 		t.FailNow()
 	}
+
+	brk = g.Get("key")
+	g.Reset("key")
+	if g.Get("key") == brk {
+		t.FailNow()
+	}
 }
 
 func TestInit(t *testing.T) {
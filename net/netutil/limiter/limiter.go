@@ -0,0 +1,165 @@
+// Package limiter provides rate limiters running atomically in redis, with
+// an in-process fallback when redis is unavailable.
+package limiter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	xredis "github.com/Darker-D/ddbase/cache/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/net/netutil/breaker"
+)
+
+// Algorithms.
+const (
+	TokenBucket   = "token_bucket"
+	GCRA          = "gcra"
+	SlidingWindow = "sliding_window"
+)
+
+// Config limiter config.
+type Config struct {
+	Algorithm string        // token_bucket, gcra, sliding_window, 默认 token_bucket
+	Rate      int           // 每个 Period 允许的请求数, 必须大于 0
+	Period    time.Duration // 统计周期, 默认 1s, 最小 1us
+	Burst     int           // 突发容量, 默认 Rate, sliding_window 不使用
+	Prefix    string        // redis key 前缀, 默认 "limiter:"
+
+	Breaker *breaker.Config // redis 熔断配置, 熔断期间使用进程内限流
+}
+
+func (conf *Config) fix() {
+	if conf.Algorithm == "" {
+		conf.Algorithm = TokenBucket
+	}
+	if conf.Period == 0 {
+		conf.Period = time.Second
+	}
+	if conf.Burst <= 0 {
+		conf.Burst = conf.Rate
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "limiter:"
+	}
+}
+
+// Result is the result of a limit check.
+type Result struct {
+	Allowed    bool          // 是否放行
+	Remaining  int           // 剩余可用请求数
+	RetryAfter time.Duration // 被拒绝时, 最早可重试的等待时间
+}
+
+// Limiter limits the rate of events per key.
+type Limiter struct {
+	conf    *Config
+	client  *xredis.Client
+	script  *redis.Script
+	breaker *breaker.Group
+	local   *local
+}
+
+// New new a limiter, the limit is shared by every instance through client.
+// With a nil client the limit is enforced per process only. It panics if
+// Rate or Period is invalid.
+func New(client *xredis.Client, conf *Config) *Limiter {
+	conf.fix()
+	if conf.Rate <= 0 {
+		panic(fmt.Sprintf("limiter: Rate must be > 0, got %d", conf.Rate))
+	}
+	// NOTE: the scripts divide by Period in microseconds.
+	if conf.Period < time.Microsecond {
+		panic(fmt.Sprintf("limiter: Period must be >= 1us, got %v", conf.Period))
+	}
+	l := &Limiter{
+		conf:    conf,
+		client:  client,
+		breaker: breaker.NewGroup(conf.Breaker),
+		local:   newLocal(conf),
+	}
+	switch conf.Algorithm {
+	case GCRA:
+		l.script = _gcraScript
+	case SlidingWindow:
+		l.script = _slidingWindowScript
+	default:
+		l.script = _tokenBucketScript
+	}
+	return l
+}
+
+// Allow reports whether one event of key may happen now.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n events of key may happen now. The in-process
+// fallback is used when redis fails, in which case the limit applies to
+// each instance and the redis error is returned along with the result.
+func (l *Limiter) AllowN(ctx context.Context, key string, n int) (res Result, err error) {
+	if l.client == nil {
+		return l.local.allowN(key, n, time.Now()), nil
+	}
+	brk := l.breaker.Get(l.conf.Prefix)
+	if err = brk.Allow(); err != nil {
+		return l.local.allowN(key, n, time.Now()), nil
+	}
+	if res, err = l.allowRedis(ctx, l.conf.Prefix+key, n); err != nil {
+		brk.MarkFailed()
+		return l.local.allowN(key, n, time.Now()), err
+	}
+	brk.MarkSuccess()
+	return
+}
+
+func (l *Limiter) allowRedis(ctx context.Context, key string, n int) (res Result, err error) {
+	var args []interface{}
+	switch l.conf.Algorithm {
+	case GCRA:
+		emission := float64(l.conf.Period) / float64(time.Microsecond) / float64(l.conf.Rate)
+		args = []interface{}{key, emission, l.conf.Burst, n}
+	case SlidingWindow:
+		var token string
+		if token, err = member(); err != nil {
+			return
+		}
+		args = []interface{}{key, int64(l.conf.Period / time.Microsecond), l.conf.Rate, n, token}
+	default:
+		rate := float64(l.conf.Rate) / float64(l.conf.Period/time.Microsecond)
+		args = []interface{}{key, rate, l.conf.Burst, n}
+	}
+	values, err := redis.Values(l.client.Eval(ctx, l.script, args...))
+	if err != nil {
+		return
+	}
+	var (
+		allowed, remaining int
+		retry              string
+	)
+	if _, err = redis.Scan(values, &allowed, &remaining, &retry); err != nil {
+		return
+	}
+	us, err := strconv.ParseFloat(retry, 64)
+	if err != nil {
+		return
+	}
+	return Result{
+		Allowed:    allowed == 1,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(us) * time.Microsecond,
+	}, nil
+}
+
+// member returns a unique sorted set member for the sliding window log.
+func member() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
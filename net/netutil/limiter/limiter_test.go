@@ -0,0 +1,117 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis"
+	"github.com/Darker-D/ddbase/cache/redis/redistest"
+)
+
+func TestLocal(t *testing.T) {
+	for _, algorithm := range []string{TokenBucket, GCRA, SlidingWindow} {
+		t.Run(algorithm, func(t *testing.T) {
+			conf := &Config{Algorithm: algorithm, Rate: 10, Period: time.Second}
+			conf.fix()
+			l := newLocal(conf)
+			now := time.Now()
+			for i := 0; i < 10; i++ {
+				if res := l.allowN("k", 1, now); !res.Allowed || res.Remaining != 9-i {
+					t.Fatalf("request %d: %+v", i, res)
+				}
+			}
+			res := l.allowN("k", 1, now)
+			if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Second {
+				t.Fatalf("request over limit: %+v", res)
+			}
+			if res = l.allowN("other", 1, now); !res.Allowed {
+				t.Fatalf("other key: %+v", res)
+			}
+			if res = l.allowN("k", 1, now.Add(time.Second+time.Millisecond)); !res.Allowed {
+				t.Fatalf("request after period: %+v", res)
+			}
+		})
+	}
+}
+
+func TestLocalSweep(t *testing.T) {
+	conf := &Config{Rate: 1, Period: time.Second}
+	conf.fix()
+	l := newLocal(conf)
+	now := time.Now()
+	l.allowN("a", 1, now)
+	l.allowN("b", 1, now.Add(time.Hour))
+	if _, ok := l.states["a"]; ok {
+		t.Fatal("idle state not swept")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	client := redis.New(&redis.Config{Network: "tcp", Address: "127.0.0.1:1", MaxIdle: 1})
+	defer client.Close()
+	l := New(client, &Config{Rate: 1, Period: time.Minute})
+	ctx := context.Background()
+	res, err := l.Allow(ctx, "k")
+	if err == nil {
+		t.Fatal("want redis error")
+	}
+	if !res.Allowed {
+		t.Fatalf("first request: %+v", res)
+	}
+	if res, _ = l.Allow(ctx, "k"); res.Allowed {
+		t.Fatalf("second request: %+v", res)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.New(&redis.Config{Network: "tcp", Address: s.Addr(), MaxIdle: 1})
+	defer client.Close()
+	ctx := context.Background()
+
+	for _, algorithm := range []string{TokenBucket, GCRA, SlidingWindow} {
+		t.Run(algorithm, func(t *testing.T) {
+			l := New(client, &Config{Algorithm: algorithm, Rate: 10, Period: time.Minute, Prefix: algorithm + ":"})
+			for i := 0; i < 10; i++ {
+				res, err := l.Allow(ctx, "k")
+				if err != nil || !res.Allowed || res.Remaining != 9-i {
+					t.Fatalf("request %d: %+v, %v", i, res, err)
+				}
+			}
+			res, err := l.Allow(ctx, "k")
+			if err != nil || res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+				t.Fatalf("request over limit: %+v, %v", res, err)
+			}
+			if res, err = l.AllowN(ctx, "other", 10); err != nil || !res.Allowed || res.Remaining != 0 {
+				t.Fatalf("other key: %+v, %v", res, err)
+			}
+			s.FastForward(time.Minute + time.Millisecond)
+			if res, err = l.Allow(ctx, "k"); err != nil || !res.Allowed {
+				t.Fatalf("request after period: %+v, %v", res, err)
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, conf := range []*Config{
+		{Rate: 0},
+		{Rate: -1},
+		{Rate: 1, Period: -time.Second},
+		{Rate: 1, Period: time.Nanosecond},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("New(%+v) did not panic", conf)
+				}
+			}()
+			New(nil, conf)
+		}()
+	}
+}
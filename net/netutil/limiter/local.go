@@ -0,0 +1,125 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// local is the in-process implementation of the limiter algorithms.
+type local struct {
+	conf *Config
+
+	mu     sync.Mutex
+	states map[string]*state
+	sweep  time.Time
+	idle   time.Duration // states untouched for idle are dropped
+}
+
+type state struct {
+	seen   time.Time
+	tokens float64     // token bucket
+	ts     time.Time   // token bucket last refill, gcra theoretical arrival time
+	log    []time.Time // sliding window
+}
+
+func newLocal(conf *Config) *local {
+	refill := time.Duration(float64(conf.Period) * float64(conf.Burst) / math.Max(1, float64(conf.Rate)))
+	return &local{
+		conf:   conf,
+		states: make(map[string]*state),
+		idle:   conf.Period + refill,
+	}
+}
+
+func (l *local) allowN(key string, n int, now time.Time) (res Result) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.After(l.sweep) {
+		for k, s := range l.states {
+			if now.Sub(s.seen) > l.idle {
+				delete(l.states, k)
+			}
+		}
+		l.sweep = now.Add(l.idle)
+	}
+	s, ok := l.states[key]
+	if !ok {
+		s = &state{tokens: float64(l.conf.Burst), ts: now}
+		l.states[key] = s
+	}
+	s.seen = now
+	if l.conf.Rate <= 0 {
+		return
+	}
+	switch l.conf.Algorithm {
+	case GCRA:
+		return l.gcra(s, n, now)
+	case SlidingWindow:
+		return l.slidingWindow(s, n, now)
+	default:
+		return l.tokenBucket(s, n, now)
+	}
+}
+
+func (l *local) tokenBucket(s *state, n int, now time.Time) (res Result) {
+	rate := float64(l.conf.Rate) / float64(l.conf.Period)
+	if now.After(s.ts) {
+		s.tokens = math.Min(float64(l.conf.Burst), s.tokens+float64(now.Sub(s.ts))*rate)
+		s.ts = now
+	}
+	if s.tokens >= float64(n) {
+		s.tokens -= float64(n)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((float64(n) - s.tokens) / rate)
+	}
+	res.Remaining = int(s.tokens)
+	return
+}
+
+func (l *local) gcra(s *state, n int, now time.Time) (res Result) {
+	emission := l.conf.Period / time.Duration(l.conf.Rate)
+	tolerance := emission * time.Duration(l.conf.Burst)
+	tat := s.ts
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(emission * time.Duration(n))
+	allowAt := newTat.Add(-tolerance)
+	if allowAt.After(now) {
+		res.RetryAfter = allowAt.Sub(now)
+		if r := int(now.Sub(tat.Add(-tolerance)) / emission); r > 0 {
+			res.Remaining = r
+		}
+		return
+	}
+	s.ts = newTat
+	res.Allowed = true
+	res.Remaining = int(now.Sub(newTat.Add(-tolerance)) / emission)
+	return
+}
+
+func (l *local) slidingWindow(s *state, n int, now time.Time) (res Result) {
+	start := now.Add(-l.conf.Period)
+	i := 0
+	for i < len(s.log) && !s.log[i].After(start) {
+		i++
+	}
+	s.log = s.log[i:]
+	if len(s.log)+n > l.conf.Rate {
+		if len(s.log) > 0 {
+			res.RetryAfter = s.log[0].Add(l.conf.Period).Sub(now)
+		}
+		if r := l.conf.Rate - len(s.log); r > 0 {
+			res.Remaining = r
+		}
+		return
+	}
+	for j := 0; j < n; j++ {
+		s.log = append(s.log, now)
+	}
+	res.Allowed = true
+	res.Remaining = l.conf.Rate - len(s.log)
+	return
+}
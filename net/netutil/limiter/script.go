@@ -0,0 +1,86 @@
+package limiter
+
+import (
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+// NOTE: every script reads the clock with TIME so that instances with skewed
+// clocks share the same limit, times are in microseconds and formatted with
+// %.0f since tostring loses precision above 14 digits. Scripts reply
+// {allowed, remaining, retry after}.
+
+// _tokenBucketScript KEYS[1] bucket, ARGV rate (tokens/us), burst, n.
+var _tokenBucketScript = redis.NewScript(1, `
+redis.replicate_commands()
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local state = redis.call("HMGET", key, "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+local allowed, retry = 0, 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = (n - tokens) / rate
+end
+redis.call("HMSET", key, "tokens", string.format("%.6f", tokens), "ts", string.format("%.0f", now))
+redis.call("PEXPIRE", key, math.ceil(burst / rate / 1000) + 1000)
+return {allowed, math.floor(tokens), string.format("%.0f", retry)}`)
+
+// _gcraScript KEYS[1] theoretical arrival time, ARGV emission interval (us),
+// burst, n.
+var _gcraScript = redis.NewScript(1, `
+redis.replicate_commands()
+local key = KEYS[1]
+local emission = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tolerance = emission * burst
+local tat = tonumber(redis.call("GET", key)) or now
+if tat < now then
+	tat = now
+end
+local newTat = tat + emission * n
+local allowAt = newTat - tolerance
+if allowAt > now then
+	local remaining = math.max(0, math.floor((now - (tat - tolerance)) / emission))
+	return {0, remaining, string.format("%.0f", allowAt - now)}
+end
+redis.call("SET", key, string.format("%.0f", newTat), "PX", math.ceil((newTat - now) / 1000))
+return {1, math.floor((now - (newTat - tolerance)) / emission), "0"}`)
+
+// _slidingWindowScript KEYS[1] event log, ARGV window (us), limit, n, unique
+// member prefix.
+var _slidingWindowScript = redis.NewScript(1, `
+redis.replicate_commands()
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+redis.call("ZREMRANGEBYSCORE", key, "-inf", string.format("%.0f", now - window))
+local count = redis.call("ZCARD", key)
+if count + n > limit then
+	local retry = 0
+	local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+	if oldest[2] then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, math.max(0, limit - count), string.format("%.0f", retry)}
+end
+for i = 1, n do
+	redis.call("ZADD", key, string.format("%.0f", now), ARGV[4] .. ":" .. i)
+end
+redis.call("PEXPIRE", key, math.ceil(window / 1000))
+return {1, limit - count - n, "0"}`)
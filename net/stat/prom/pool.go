@@ -0,0 +1,117 @@
+package prom
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RedisPool for redis connection pools
+var RedisPool = NewPoolCollector("go_redis_pool")
+
+// PoolStats is a snapshot of the statistics of a connection pool.
+type PoolStats struct {
+	Active         int           // open connections, idle or in use
+	Idle           int           // idle connections
+	WaitCount      int64         // total number of connections waited for
+	WaitDuration   time.Duration // total time waited for connections
+	DialFailures   int64         // total number of failed dials
+	IdleClosed     int64         // connections closed by the idle timeout
+	LifetimeClosed int64         // connections closed by the max lifetime
+	Healthy        bool          // result of the last health probe
+	Unprobed       bool          // no health probe, healthy is not exported
+}
+
+// PoolCollector exports the statistics of named connection pools, read from
+// the pools at every scrape.
+type PoolCollector struct {
+	active         *prometheus.Desc
+	idle           *prometheus.Desc
+	waitCount      *prometheus.Desc
+	waitDuration   *prometheus.Desc
+	dialFailures   *prometheus.Desc
+	idleClosed     *prometheus.Desc
+	lifetimeClosed *prometheus.Desc
+	healthy        *prometheus.Desc
+
+	mu    sync.RWMutex
+	pools map[string]func() PoolStats
+}
+
+// NewPoolCollector creates and registers a PoolCollector, its metrics are
+// prefixed by namespace and labeled by pool name.
+func NewPoolCollector(namespace string) *PoolCollector {
+	desc := func(name string) *prometheus.Desc {
+		name = namespace + "_" + name
+		return prometheus.NewDesc(name, name, []string{"name"}, nil)
+	}
+	c := &PoolCollector{
+		active:         desc("active"),
+		idle:           desc("idle"),
+		waitCount:      desc("wait_count"),
+		waitDuration:   desc("wait_duration_seconds"),
+		dialFailures:   desc("dial_failures"),
+		idleClosed:     desc("idle_closed"),
+		lifetimeClosed: desc("lifetime_closed"),
+		healthy:        desc("healthy"),
+		pools:          make(map[string]func() PoolStats),
+	}
+	prometheus.MustRegister(c)
+	return c
+}
+
+// Register exports the pool name, stats is called at every scrape. It fails
+// if a pool is already registered with the same name.
+func (c *PoolCollector) Register(name string, stats func() PoolStats) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pools[name]; ok {
+		return fmt.Errorf("prom: pool %q is already registered", name)
+	}
+	c.pools[name] = stats
+	return nil
+}
+
+// Unregister stops exporting the pool name.
+func (c *PoolCollector) Unregister(name string) {
+	c.mu.Lock()
+	delete(c.pools, name)
+	c.mu.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.dialFailures
+	ch <- c.idleClosed
+	ch <- c.lifetimeClosed
+	ch <- c.healthy
+}
+
+// Collect implements prometheus.Collector.
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, stats := range c.pools {
+		s := stats()
+		healthy := 0.0
+		if s.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(s.Active), name)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle), name)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.dialFailures, prometheus.CounterValue, float64(s.DialFailures), name)
+		ch <- prometheus.MustNewConstMetric(c.idleClosed, prometheus.CounterValue, float64(s.IdleClosed), name)
+		ch <- prometheus.MustNewConstMetric(c.lifetimeClosed, prometheus.CounterValue, float64(s.LifetimeClosed), name)
+		if !s.Unprobed {
+			ch <- prometheus.MustNewConstMetric(c.healthy, prometheus.GaugeValue, healthy, name)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package prom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolCollector(t *testing.T) {
+	c := NewPoolCollector("test_pool")
+	c.Register("a", func() PoolStats {
+		return PoolStats{Active: 3, Idle: 1, WaitCount: 2, WaitDuration: 1500 * time.Millisecond, Healthy: true}
+	})
+	c.Register("b", func() PoolStats { return PoolStats{DialFailures: 4} })
+	want := `
+# HELP test_pool_active test_pool_active
+# TYPE test_pool_active gauge
+test_pool_active{name="a"} 3
+test_pool_active{name="b"} 0
+# HELP test_pool_healthy test_pool_healthy
+# TYPE test_pool_healthy gauge
+test_pool_healthy{name="a"} 1
+test_pool_healthy{name="b"} 0
+# HELP test_pool_wait_duration_seconds test_pool_wait_duration_seconds
+# TYPE test_pool_wait_duration_seconds counter
+test_pool_wait_duration_seconds{name="a"} 1.5
+test_pool_wait_duration_seconds{name="b"} 0
+# HELP test_pool_dial_failures test_pool_dial_failures
+# TYPE test_pool_dial_failures counter
+test_pool_dial_failures{name="a"} 0
+test_pool_dial_failures{name="b"} 4
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"test_pool_active", "test_pool_healthy", "test_pool_wait_duration_seconds", "test_pool_dial_failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Register("a", func() PoolStats { return PoolStats{} }); err == nil {
+		t.Fatal("want an error registering a twice")
+	}
+	c.Unregister("b")
+	if n := testutil.CollectAndCount(c, "test_pool_active"); n != 1 {
+		t.Fatalf("got %d pools, want 1", n)
+	}
+
+	// an unprobed pool is not reported healthy nor unhealthy
+	c.Register("c", func() PoolStats { return PoolStats{Unprobed: true} })
+	if n := testutil.CollectAndCount(c, "test_pool_active"); n != 2 {
+		t.Fatalf("got %d pools, want 2", n)
+	}
+	if n := testutil.CollectAndCount(c, "test_pool_healthy"); n != 1 {
+		t.Fatalf("got %d healthy gauges, want 1", n)
+	}
+}
@@ -0,0 +1,255 @@
+// Package delay provides a delayed job queue on redis sorted sets. Jobs are
+// scheduled at a time, moved atomically to a ready list when due and kept
+// invisible to other workers while being handled, until they are acked or
+// their visibility timeout expires.
+package delay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	xredis "github.com/Darker-D/ddbase/cache/redis"
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+	"github.com/Darker-D/ddbase/log"
+	"github.com/Darker-D/ddbase/sync/pool"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrJobLost is returned when a job is acked after its visibility timeout
+// expired, the job may be handled again.
+var ErrJobLost = errors.New("delay: job visibility timeout expired")
+
+// Config is the delayed queue config.
+type Config struct {
+	Name         string        // 队列名称, redis key 前缀
+	Visibility   time.Duration // 处理超时, 超时未 ack 的任务重新投递, 默认 30s
+	PollInterval time.Duration // 没有就绪任务时的轮询间隔, 默认 500ms
+	Batch        int           // 每次迁移的到期任务数, 默认 100
+	Workers      int           // 并发处理数, 默认 10
+	RetryDelay   time.Duration // 处理失败后的重试延迟, 默认 5s
+	MaxRetries   int           // 最大重试次数, 超过后转入死信列表, 默认 0 不限制
+}
+
+func (conf *Config) fix() {
+	if conf.Visibility <= 0 {
+		conf.Visibility = 30 * time.Second
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = 500 * time.Millisecond
+	}
+	if conf.Batch <= 0 {
+		conf.Batch = 100
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = 10
+	}
+	if conf.RetryDelay <= 0 {
+		conf.RetryDelay = 5 * time.Second
+	}
+}
+
+// Job is a reserved job.
+type Job struct {
+	ID       string
+	Payload  []byte
+	Attempts int // 第几次投递, 从 1 开始
+
+	deadline string // visibility deadline, the ownership token
+}
+
+// Queue is a delayed job queue.
+type Queue struct {
+	conf   *Config
+	client *xredis.Client
+
+	delayed    string // zset id -> due time
+	ready      string // list of ids
+	processing string // zset id -> visibility deadline
+	jobs       string // hash id -> payload
+	attempts   string // hash id -> deliveries
+	dead       string // list of payloads
+}
+
+// New new a delayed queue.
+func New(client *xredis.Client, conf *Config) *Queue {
+	conf.fix()
+	prefix := "{" + conf.Name + "}:"
+	return &Queue{
+		conf:       conf,
+		client:     client,
+		delayed:    prefix + "delayed",
+		ready:      prefix + "ready",
+		processing: prefix + "processing",
+		jobs:       prefix + "jobs",
+		attempts:   prefix + "attempts",
+		dead:       prefix + "dead",
+	}
+}
+
+// Schedule schedules payload to be handled at at.
+func (q *Queue) Schedule(ctx context.Context, payload []byte, at time.Time) (id string, err error) {
+	id = uuid.New().String()
+	_, err = q.client.Eval(ctx, _scheduleScript, q.delayed, q.jobs, id, millis(at), payload)
+	return
+}
+
+// Delay schedules payload to be handled after d.
+func (q *Queue) Delay(ctx context.Context, payload []byte, d time.Duration) (string, error) {
+	return q.Schedule(ctx, payload, time.Now().Add(d))
+}
+
+// Cancel cancels a job which is not due yet.
+func (q *Queue) Cancel(ctx context.Context, id string) (bool, error) {
+	n, err := redis.Int(q.client.Eval(ctx, _cancelScript, q.delayed, q.jobs, id))
+	return n == 1, err
+}
+
+// Ack deletes a reserved job, Run acks the jobs handled without error.
+func (q *Queue) Ack(ctx context.Context, job *Job) error {
+	n, err := redis.Int(q.client.Eval(ctx, _ackScript, q.processing, q.jobs, q.attempts, job.ID, job.deadline))
+	if err == nil && n == 0 {
+		err = ErrJobLost
+	}
+	return err
+}
+
+// Retry schedules a reserved job again after d, or moves it to the dead list
+// once MaxRetries is exceeded.
+func (q *Queue) Retry(ctx context.Context, job *Job, d time.Duration) error {
+	dead := 0
+	if q.conf.MaxRetries > 0 && job.Attempts > q.conf.MaxRetries {
+		dead = 1
+	}
+	n, err := redis.Int(q.client.Eval(ctx, _retryScript, q.processing, q.delayed, q.jobs, q.attempts, q.dead,
+		job.ID, job.deadline, millis(time.Now().Add(d)), dead))
+	if err == nil && n == 0 {
+		err = ErrJobLost
+	}
+	return err
+}
+
+// Promote moves due jobs and the jobs whose visibility timeout expired to the
+// ready list, Run calls it every PollInterval.
+func (q *Queue) Promote(ctx context.Context) (int, error) {
+	return redis.Int(q.client.Eval(ctx, _promoteScript, q.delayed, q.processing, q.ready, millis(time.Now()), q.conf.Batch))
+}
+
+// Reserve takes a ready job and hides it for Visibility, nil if there is
+// none.
+func (q *Queue) Reserve(ctx context.Context) (*Job, error) {
+	for {
+		deadline := strconv.FormatInt(millis(time.Now().Add(q.conf.Visibility)), 10)
+		values, err := redis.Values(q.client.Eval(ctx, _reserveScript, q.ready, q.processing, q.jobs, q.attempts, deadline))
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{deadline: deadline}
+		if _, err = redis.Scan(values, &job.ID, &job.Payload, &job.Attempts); err != nil {
+			return nil, err
+		}
+		// NOTE: the job was acked after being redelivered, skip it.
+		if job.Payload == nil {
+			continue
+		}
+		return job, nil
+	}
+}
+
+// Run reserves and handles jobs on the sync/pool goroutine pool until ctx is
+// done, then waits for the jobs in progress. Jobs are acked when handler
+// succeeds and retried after RetryDelay otherwise.
+func (q *Queue) Run(ctx context.Context, handler func(ctx context.Context, job *Job) error) error {
+	p := pool.GetPool()
+	if p == nil {
+		pool.NewPool(q.conf.Workers)
+		p = pool.GetPool()
+	}
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, q.conf.Workers)
+		promoted time.Time
+	)
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sem <- struct{}{}:
+		}
+		if time.Since(promoted) >= q.conf.PollInterval {
+			if _, err := q.Promote(ctx); err != nil {
+				q.logError(ctx, "promote", err)
+			}
+			promoted = time.Now()
+		}
+		job, err := q.Reserve(ctx)
+		if err != nil || job == nil {
+			<-sem
+			if err != nil {
+				q.logError(ctx, "reserve", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(q.conf.PollInterval):
+			}
+			continue
+		}
+		wg.Add(1)
+		task := func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			q.handle(ctx, job, handler)
+		}
+		if err = p.Submit(task); err != nil {
+			// NOTE: the pool is overloaded or released, run it in place.
+			task()
+		}
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, job *Job, handler func(ctx context.Context, job *Job) error) {
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("delay: handler panic: %v", r)
+			}
+		}()
+		return handler(ctx, job)
+	}()
+	// NOTE: the job must be settled even if Run is stopping.
+	actx := context.Background()
+	if err == nil {
+		err = q.Ack(actx, job)
+	} else {
+		q.logError(ctx, "handle "+job.ID, err)
+		err = q.Retry(actx, job, q.conf.RetryDelay)
+	}
+	if err != nil {
+		q.logError(ctx, "settle "+job.ID, err)
+	}
+}
+
+func (q *Queue) logError(ctx context.Context, action string, err error) {
+	if log.Logger().Logger == nil {
+		return
+	}
+	log.Logger().WithCTX(ctx).Error("delay queue",
+		zap.String("queue", q.conf.Name),
+		zap.String("action", action),
+		zap.Error(err))
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,336 @@
+package delay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Darker-D/ddbase/cache/redis"
+)
+
+// fakeQueue is a RESP server emulating the queue scripts, EVALSHA always
+// replies NOSCRIPT and EVAL is dispatched on the script source.
+type fakeQueue struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	zsets map[string]map[string]int64
+	lists map[string][]string
+	hash  map[string]map[string]string
+}
+
+func newFakeQueue(t *testing.T) *fakeQueue {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeQueue{
+		ln:    ln,
+		zsets: make(map[string]map[string]int64),
+		lists: make(map[string][]string),
+		hash:  make(map[string]map[string]string),
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeQueue) serve(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ = br.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, size+2)
+			if _, err = io.ReadFull(br, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+		s.mu.Lock()
+		reply := s.exec(args)
+		s.mu.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+func encode(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "$-1\r\n"
+	case string:
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case int:
+		return fmt.Sprintf(":%d\r\n", v)
+	case []interface{}:
+		r := fmt.Sprintf("*%d\r\n", len(v))
+		for _, e := range v {
+			r += encode(e)
+		}
+		return r
+	}
+	panic(fmt.Sprintf("unsupported reply %T", v))
+}
+
+func (s *fakeQueue) zset(key string) map[string]int64 {
+	if s.zsets[key] == nil {
+		s.zsets[key] = make(map[string]int64)
+	}
+	return s.zsets[key]
+}
+
+func (s *fakeQueue) hmap(key string) map[string]string {
+	if s.hash[key] == nil {
+		s.hash[key] = make(map[string]string)
+	}
+	return s.hash[key]
+}
+
+// due returns up to limit members of key scored at most max.
+func (s *fakeQueue) due(key string, max int64, limit int) []string {
+	var ids []string
+	for id, score := range s.zsets[key] {
+		if score <= max {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return s.zsets[key][ids[i]] < s.zsets[key][ids[j]] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+func (s *fakeQueue) exec(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "EVALSHA":
+		return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+	case "EVAL":
+	default:
+		return "-ERR unknown command\r\n"
+	}
+	src := args[1]
+	n, _ := strconv.Atoi(args[2])
+	keys, argv := args[3:3+n], args[3+n:]
+	switch {
+	case strings.Contains(src, "LPOP"): // reserve
+		list := s.lists[keys[0]]
+		if len(list) == 0 {
+			return encode(nil)
+		}
+		id := list[0]
+		s.lists[keys[0]] = list[1:]
+		payload, ok := s.hmap(keys[2])[id]
+		if !ok {
+			return encode([]interface{}{id, nil, 0})
+		}
+		s.zset(keys[1])[id], _ = strconv.ParseInt(argv[0], 10, 64)
+		attempts, _ := strconv.Atoi(s.hmap(keys[3])[id])
+		attempts++
+		s.hmap(keys[3])[id] = strconv.Itoa(attempts)
+		return encode([]interface{}{id, payload, attempts})
+	case strings.Contains(src, "RPUSH\", KEYS[3]"): // promote
+		max, _ := strconv.ParseInt(argv[0], 10, 64)
+		limit, _ := strconv.Atoi(argv[1])
+		moved := 0
+		for _, key := range keys[:2] {
+			for _, id := range s.due(key, max, limit) {
+				delete(s.zsets[key], id)
+				s.lists[keys[2]] = append(s.lists[keys[2]], id)
+				moved++
+			}
+		}
+		return encode(moved)
+	case strings.Contains(src, "ZSCORE"): // ack or retry
+		score, ok := s.zsets[keys[0]][argv[0]]
+		if !ok || strconv.FormatInt(score, 10) != argv[1] {
+			return encode(0)
+		}
+		delete(s.zsets[keys[0]], argv[0])
+		if n == 3 { // ack
+			delete(s.hmap(keys[1]), argv[0])
+			delete(s.hmap(keys[2]), argv[0])
+			return encode(1)
+		}
+		if argv[3] == "1" {
+			s.lists[keys[4]] = append(s.lists[keys[4]], s.hmap(keys[2])[argv[0]])
+			delete(s.hmap(keys[2]), argv[0])
+			delete(s.hmap(keys[3]), argv[0])
+		} else {
+			s.zset(keys[1])[argv[0]], _ = strconv.ParseInt(argv[2], 10, 64)
+		}
+		return encode(1)
+	case strings.Contains(src, "ZREM"): // cancel
+		if _, ok := s.zsets[keys[0]][argv[0]]; !ok {
+			return encode(0)
+		}
+		delete(s.zsets[keys[0]], argv[0])
+		delete(s.hmap(keys[1]), argv[0])
+		return encode(1)
+	case strings.Contains(src, "ZADD"): // schedule
+		s.hmap(keys[1])[argv[0]] = argv[2]
+		s.zset(keys[0])[argv[0]], _ = strconv.ParseInt(argv[1], 10, 64)
+		return encode(1)
+	}
+	return "-ERR unknown script\r\n"
+}
+
+func (s *fakeQueue) len(kind, key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch kind {
+	case "zset":
+		return len(s.zsets[key])
+	case "hash":
+		return len(s.hash[key])
+	}
+	return len(s.lists[key])
+}
+
+func newTestQueue(t *testing.T, conf *Config) (*fakeQueue, *redis.Client, *Queue) {
+	s := newFakeQueue(t)
+	client := redis.New(&redis.Config{Network: "tcp", Address: s.ln.Addr().String(), MaxIdle: 4})
+	return s, client, New(client, conf)
+}
+
+func TestQueue(t *testing.T) {
+	s, client, q := newTestQueue(t, &Config{Name: "test", Visibility: time.Minute})
+	defer s.ln.Close()
+	defer client.Close()
+	ctx := context.Background()
+
+	if _, err := q.Delay(ctx, []byte("later"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	id, err := q.Schedule(ctx, []byte("now"), time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := q.Promote(ctx); err != nil || n != 1 {
+		t.Fatalf("Promote = %d, %v", n, err)
+	}
+	job, err := q.Reserve(ctx)
+	if err != nil || job == nil || job.ID != id || string(job.Payload) != "now" || job.Attempts != 1 {
+		t.Fatalf("Reserve = %+v, %v", job, err)
+	}
+	if job, err := q.Reserve(ctx); err != nil || job != nil {
+		t.Fatalf("Reserve = %+v, %v, want none", job, err)
+	}
+	if err = q.Ack(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Ack(ctx, job); err != ErrJobLost {
+		t.Fatalf("second Ack error(%v)", err)
+	}
+	if s.len("hash", "{test}:jobs") != 1 || s.len("zset", "{test}:delayed") != 1 {
+		t.Fatal("job not deleted")
+	}
+}
+
+func TestQueueRedelivery(t *testing.T) {
+	s, client, q := newTestQueue(t, &Config{Name: "test", Visibility: 10 * time.Millisecond})
+	defer s.ln.Close()
+	defer client.Close()
+	ctx := context.Background()
+
+	id, _ := q.Delay(ctx, []byte("job"), 0)
+	q.Promote(ctx)
+	lost, _ := q.Reserve(ctx)
+	time.Sleep(20 * time.Millisecond)
+	if n, err := q.Promote(ctx); err != nil || n != 1 {
+		t.Fatalf("Promote = %d, %v", n, err)
+	}
+	job, err := q.Reserve(ctx)
+	if err != nil || job == nil || job.ID != id || job.Attempts != 2 {
+		t.Fatalf("Reserve = %+v, %v", job, err)
+	}
+	if err = q.Ack(ctx, lost); err != ErrJobLost {
+		t.Fatalf("Ack of lost job error(%v)", err)
+	}
+	if err = q.Ack(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := q.Cancel(ctx, id); err != nil || ok {
+		t.Fatalf("Cancel = %v, %v", ok, err)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	s, client, q := newTestQueue(t, &Config{
+		Name:         "test",
+		PollInterval: 5 * time.Millisecond,
+		Workers:      4,
+		RetryDelay:   time.Millisecond,
+		MaxRetries:   2,
+	})
+	defer s.ln.Close()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		q.Delay(ctx, []byte(strconv.Itoa(i)), time.Duration(i)*time.Millisecond)
+	}
+	q.Delay(ctx, []byte("bad"), 0)
+	var (
+		mu      sync.Mutex
+		handled = make(map[string]int)
+	)
+	done := make(chan error)
+	go func() {
+		done <- q.Run(ctx, func(ctx context.Context, job *Job) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[string(job.Payload)]++
+			if string(job.Payload) == "bad" {
+				return errors.New("bad job")
+			}
+			return nil
+		})
+	}()
+	for deadline := time.Now().Add(2 * time.Second); s.len("list", "{test}:dead") == 0 || s.len("hash", "{test}:jobs") != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("jobs not handled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 10; i++ {
+		if n := handled[strconv.Itoa(i)]; n != 1 {
+			t.Errorf("job %d handled %d times", i, n)
+		}
+	}
+	if handled["bad"] != 3 {
+		t.Errorf("bad job handled %d times, want 3", handled["bad"])
+	}
+}
@@ -0,0 +1,81 @@
+package delay
+
+import (
+	"github.com/Darker-D/ddbase/cache/redis.v2/redis"
+)
+
+// NOTE: every key of a queue shares the {name} hash tag so that the scripts
+// run on a single cluster node. Times are unix milliseconds from the caller,
+// the processing score of a reserved job is its visibility deadline and
+// doubles as the ownership token of the worker.
+
+// _scheduleScript KEYS delayed, jobs; ARGV id, at, payload.
+var _scheduleScript = redis.NewScript(2, `
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[3])
+return redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])`)
+
+// _cancelScript KEYS delayed, jobs; ARGV id. Only delayed jobs are canceled.
+var _cancelScript = redis.NewScript(2, `
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 1 then
+	redis.call("HDEL", KEYS[2], ARGV[1])
+	return 1
+end
+return 0`)
+
+// _promoteScript KEYS delayed, processing, ready; ARGV now, limit. Moves due
+// jobs and jobs whose visibility timeout expired to the ready list.
+var _promoteScript = redis.NewScript(3, `
+local n = 0
+for i = 1, 2 do
+	local ids = redis.call("ZRANGEBYSCORE", KEYS[i], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+	for _, id in ipairs(ids) do
+		redis.call("ZREM", KEYS[i], id)
+		redis.call("RPUSH", KEYS[3], id)
+		n = n + 1
+	end
+end
+return n`)
+
+// _reserveScript KEYS ready, processing, jobs, attempts; ARGV deadline.
+// Replies {id, payload, attempts}, payload is false if the job was acked
+// meanwhile.
+var _reserveScript = redis.NewScript(4, `
+local id = redis.call("LPOP", KEYS[1])
+if not id then
+	return false
+end
+local payload = redis.call("HGET", KEYS[3], id)
+if not payload then
+	redis.call("HDEL", KEYS[4], id)
+	return {id, false, 0}
+end
+redis.call("ZADD", KEYS[2], ARGV[1], id)
+return {id, payload, redis.call("HINCRBY", KEYS[4], id, 1)}`)
+
+// _ackScript KEYS processing, jobs, attempts; ARGV id, deadline. Deletes the
+// job if the worker still owns it.
+var _ackScript = redis.NewScript(3, `
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[3], ARGV[1])
+return 1`)
+
+// _retryScript KEYS processing, delayed, jobs, attempts, dead; ARGV id,
+// deadline, at, dead. Schedules the job again at at, or moves its payload to
+// the dead list if dead is 1.
+var _retryScript = redis.NewScript(5, `
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+if ARGV[4] == "1" then
+	redis.call("RPUSH", KEYS[5], redis.call("HGET", KEYS[3], ARGV[1]))
+	redis.call("HDEL", KEYS[3], ARGV[1])
+	redis.call("HDEL", KEYS[4], ARGV[1])
+else
+	redis.call("ZADD", KEYS[2], ARGV[3], ARGV[1])
+end
+return 1`)